@@ -2,14 +2,18 @@ package api
 
 import (
 	"bytes"
+	"context"
 	"encoding/json"
 	"fmt"
 	"io"
+	"net"
 	"net/http"
 	"net/url"
 	"sort"
 	"strings"
 	"time"
+
+	"cert-deploy/util"
 )
 
 // CertListResponse 证书列表响应
@@ -60,6 +64,7 @@ type Client struct {
 	BaseURL    string
 	Token      string
 	HTTPClient *http.Client
+	ctx        context.Context // 见 WithContext，为 nil 时不限时
 }
 
 // NewClient 创建新的 API 客户端
@@ -73,6 +78,21 @@ func NewClient(baseURL, token string) *Client {
 	}
 }
 
+// WithContext 返回使用 ctx 的客户端副本，ctx 取消或超时后请求和重试等待随之中止
+func (c *Client) WithContext(ctx context.Context) *Client {
+	cc := *c
+	cc.ctx = ctx
+	return &cc
+}
+
+// context 请求使用的 context
+func (c *Client) context() context.Context {
+	if c.ctx == nil {
+		return context.Background()
+	}
+	return c.ctx
+}
+
 const maxRetries = 3
 
 // doWithRetry 执行带重试的 HTTP 请求
@@ -81,7 +101,11 @@ func (c *Client) doWithRetry(req *http.Request) (*http.Response, error) {
 
 	for attempt := 0; attempt <= maxRetries; attempt++ {
 		if attempt > 0 {
-			time.Sleep(time.Duration(attempt) * time.Second)
+			select {
+			case <-time.After(time.Duration(attempt) * time.Second):
+			case <-req.Context().Done():
+				return nil, fmt.Errorf("请求中止: %w", req.Context().Err())
+			}
 			// 重置 Body（如果有）
 			if req.GetBody != nil {
 				body, _ := req.GetBody()
@@ -182,7 +206,7 @@ func (c *Client) ListCertsByDomain(domain string) ([]CertData, error) {
 		apiURL += "?domain=" + url.QueryEscape(domain)
 	}
 
-	req, err := http.NewRequest("GET", apiURL, nil)
+	req, err := http.NewRequestWithContext(c.context(), "GET", apiURL, nil)
 	if err != nil {
 		return nil, fmt.Errorf("创建请求失败: %w", err)
 	}
@@ -258,8 +282,8 @@ func selectBestCert(certs []CertData, targetDomain string) *CertData {
 		}
 
 		// 优先精确匹配（不含通配符）
-		iExact := certs[i].Domain == targetDomain || isExactMatch(certs[i].Domains, targetDomain)
-		jExact := certs[j].Domain == targetDomain || isExactMatch(certs[j].Domains, targetDomain)
+		iExact := isExactMatch(certs[i].Domain, targetDomain) || isExactMatch(certs[i].Domains, targetDomain)
+		jExact := isExactMatch(certs[j].Domain, targetDomain) || isExactMatch(certs[j].Domains, targetDomain)
 		if iExact && !jExact {
 			return true
 		}
@@ -292,10 +316,16 @@ func selectBestCert(certs []CertData, targetDomain string) *CertData {
 // matchesDomain 检查模式是否匹配目标域名（支持通配符）
 // pattern: *.example.com 匹配 www.example.com, api.example.com
 // pattern: example.com 只匹配 example.com（精确匹配）
+// IP 地址按地址比较（IPv6 不同写法视为相同），不参与通配符匹配；国际化域名按 A-label 比较
 func matchesDomain(pattern, target string) bool {
+	pattern, target = util.ToASCII(pattern), util.ToASCII(target)
 	if pattern == target {
 		return true // 精确匹配
 	}
+	if ip := net.ParseIP(target); ip != nil {
+		p := net.ParseIP(pattern)
+		return p != nil && p.Equal(ip)
+	}
 	// 通配符匹配：*.example.com 匹配 www.example.com
 	if strings.HasPrefix(pattern, "*.") {
 		suffix := pattern[1:] // ".example.com"
@@ -321,10 +351,11 @@ func containsDomain(domains string, target string) bool {
 	return false
 }
 
-// isExactMatch 检查是否精确匹配（不使用通配符）
+// isExactMatch 检查是否精确匹配（不使用通配符，国际化域名按 A-label 比较）
 func isExactMatch(domains string, target string) bool {
+	target = util.ToASCII(target)
 	for _, d := range strings.Split(domains, ",") {
-		if strings.TrimSpace(d) == target {
+		if util.ToASCII(d) == target {
 			return true
 		}
 	}
@@ -350,7 +381,7 @@ func (c *Client) Callback(req *CallbackRequest) error {
 		return fmt.Errorf("序列化请求失败: %w", err)
 	}
 
-	httpReq, err := http.NewRequest("POST", apiURL, bytes.NewReader(data))
+	httpReq, err := http.NewRequestWithContext(c.context(), "POST", apiURL, bytes.NewReader(data))
 	if err != nil {
 		return fmt.Errorf("创建请求失败: %w", err)
 	}
@@ -399,7 +430,7 @@ func (c *Client) SubmitCSR(req *CSRRequest) (*CSRResponse, error) {
 		return nil, fmt.Errorf("序列化请求失败: %w", err)
 	}
 
-	httpReq, err := http.NewRequest("POST", apiURL, bytes.NewReader(data))
+	httpReq, err := http.NewRequestWithContext(c.context(), "POST", apiURL, bytes.NewReader(data))
 	if err != nil {
 		return nil, fmt.Errorf("创建请求失败: %w", err)
 	}
@@ -446,7 +477,7 @@ func (c *Client) GetCertByOrderID(orderID int) (*CertData, error) {
 	// 使用 order_id 参数直接查询
 	apiURL := fmt.Sprintf("%s?order_id=%d", c.BaseURL, orderID)
 
-	req, err := http.NewRequest("GET", apiURL, nil)
+	req, err := http.NewRequestWithContext(c.context(), "GET", apiURL, nil)
 	if err != nil {
 		return nil, fmt.Errorf("创建请求失败: %w", err)
 	}
@@ -7,13 +7,19 @@ import (
 	"crypto/x509/pkix"
 	"encoding/pem"
 	"fmt"
+	"net"
+
+	"cert-deploy/util"
 )
 
 // GenerateCSR 生成私钥和 CSR
 // domain: 主域名（Common Name）
-// sans: 额外的 Subject Alternative Names
+// sans: 额外的 Subject Alternative Names（IP 地址写入 IP SAN，其余写入 DNS SAN）
+// 国际化域名转换为 A-label 写入 CSR
 // 返回：私钥 PEM、CSR PEM、错误
 func GenerateCSR(domain string, sans []string) (keyPEM, csrPEM string, err error) {
+	domain = util.ToASCII(domain)
+
 	// 生成 RSA 私钥（2048 位）
 	privateKey, err := rsa.GenerateKey(rand.Reader, 2048)
 	if err != nil {
@@ -31,11 +37,17 @@ func GenerateCSR(domain string, sans []string) (keyPEM, csrPEM string, err error
 	// 添加 SANs（包括主域名）
 	allDomains := []string{domain}
 	for _, san := range sans {
-		if san != domain {
+		if san = util.ToASCII(san); san != domain {
 			allDomains = append(allDomains, san)
 		}
 	}
-	template.DNSNames = allDomains
+	for _, name := range allDomains {
+		if ip := net.ParseIP(name); ip != nil {
+			template.IPAddresses = append(template.IPAddresses, ip)
+		} else {
+			template.DNSNames = append(template.DNSNames, name)
+		}
+	}
 
 	// 创建 CSR
 	csrDER, err := x509.CreateCertificateRequest(rand.Reader, &template, privateKey)
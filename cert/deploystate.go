@@ -0,0 +1,158 @@
+package cert
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+
+	"cert-deploy/util"
+)
+
+// DeployStep 证书部署步骤
+type DeployStep string
+
+const (
+	StepFetched      DeployStep = "fetched"       // 已获取证书
+	StepInstalled    DeployStep = "installed"     // 已安装到本机存储
+	StepFriendlyName DeployStep = "friendly_name" // 已设置友好名称（IIS7）
+	StepBinding      DeployStep = "binding"       // 正在绑定并发送回调
+	StepBound        DeployStep = "bound"         // 绑定完成，执行部署后动作
+	StepDone         DeployStep = "done"          // 部署完成
+)
+
+// 步骤先后顺序
+var deployStepOrder = []DeployStep{StepFetched, StepInstalled, StepFriendlyName, StepBinding, StepBound, StepDone}
+
+var deployStepNames = map[DeployStep]string{
+	StepFetched:      "已获取证书",
+	StepInstalled:    "已安装证书",
+	StepFriendlyName: "已设置友好名称",
+	StepBinding:      "绑定中",
+	StepBound:        "绑定完成",
+	StepDone:         "部署完成",
+}
+
+// Name 步骤显示名称
+func (s DeployStep) Name() string {
+	if name, ok := deployStepNames[s]; ok {
+		return name
+	}
+	return string(s)
+}
+
+// Reached 是否已到达（或越过）指定步骤
+func (s DeployStep) Reached(target DeployStep) bool {
+	return stepIndex(s) >= stepIndex(target)
+}
+
+func stepIndex(s DeployStep) int {
+	for i, step := range deployStepOrder {
+		if step == s {
+			return i
+		}
+	}
+	return -1
+}
+
+// DeployState 单个订单的部署进度，保存在订单目录的 state.json，部署完成后删除
+type DeployState struct {
+	OrderID     int               `json:"order_id"`
+	Domain      string            `json:"domain"`
+	Step        DeployStep        `json:"step"`
+	Thumbprint  string            `json:"thumbprint"`            // 正在部署的证书指纹
+	Preexisting bool              `json:"preexisting,omitempty"` // 安装前证书已在本机存储中（中断后不清理）
+	Previous    map[string]string `json:"previous,omitempty"`    // 绑定目标 -> 绑定前的证书指纹
+	Bound       []string          `json:"bound,omitempty"`       // 已完成绑定的目标（host:port）
+	Error       string            `json:"error,omitempty"`       // 最近一次失败原因
+	Attempts    int               `json:"attempts,omitempty"`    // 已恢复的次数
+	StartedAt   string            `json:"started_at"`
+	UpdatedAt   string            `json:"updated_at"`
+}
+
+// Finished 部署是否已完成
+func (st *DeployState) Finished() bool {
+	return st.Step == StepDone
+}
+
+// IsBound 绑定目标是否已完成
+func (st *DeployState) IsBound(target string) bool {
+	for _, t := range st.Bound {
+		if strings.EqualFold(t, target) {
+			return true
+		}
+	}
+	return false
+}
+
+func (s *OrderStore) deployStatePath(orderID int) string {
+	return filepath.Join(s.GetOrderPath(orderID), "state.json")
+}
+
+// SaveDeployState 保存部署进度（原子写入，避免中断时留下半个文件）
+func (s *OrderStore) SaveDeployState(state *DeployState) error {
+	if err := s.EnsureOrderDir(state.OrderID); err != nil {
+		return fmt.Errorf("创建订单目录失败: %w", err)
+	}
+	state.UpdatedAt = time.Now().Format("2006-01-02 15:04:05")
+
+	data, err := json.MarshalIndent(state, "", "  ")
+	if err != nil {
+		return fmt.Errorf("序列化部署状态失败: %w", err)
+	}
+
+	if err := util.WriteFileAtomic(s.deployStatePath(state.OrderID), data, 0644); err != nil {
+		return fmt.Errorf("写入部署状态失败: %w", err)
+	}
+	return nil
+}
+
+// LoadDeployState 加载部署进度，不存在时返回 nil, nil
+func (s *OrderStore) LoadDeployState(orderID int) (*DeployState, error) {
+	data, err := os.ReadFile(s.deployStatePath(orderID))
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil, nil
+		}
+		return nil, err
+	}
+
+	var state DeployState
+	if err := json.Unmarshal(data, &state); err != nil {
+		return nil, fmt.Errorf("解析部署状态失败: %w", err)
+	}
+	return &state, nil
+}
+
+// DeleteDeployState 删除部署进度
+func (s *OrderStore) DeleteDeployState(orderID int) error {
+	err := os.Remove(s.deployStatePath(orderID))
+	if err != nil && !os.IsNotExist(err) {
+		return err
+	}
+	return nil
+}
+
+// ListDeployStates 列出所有订单的部署进度（按更新时间倒序）
+func (s *OrderStore) ListDeployStates() ([]*DeployState, error) {
+	orderIDs, err := s.ListOrders()
+	if err != nil {
+		return nil, err
+	}
+
+	states := make([]*DeployState, 0)
+	for _, id := range orderIDs {
+		state, err := s.LoadDeployState(id)
+		if err != nil || state == nil {
+			continue
+		}
+		states = append(states, state)
+	}
+	sort.Slice(states, func(i, j int) bool {
+		return states[i].UpdatedAt > states[j].UpdatedAt
+	})
+	return states, nil
+}
@@ -0,0 +1,51 @@
+package cert
+
+import (
+	"fmt"
+	"math"
+	"time"
+)
+
+// ExpiresAtLayout 配置和订单元数据中过期时间的格式（本地时间）
+const ExpiresAtLayout = "2006-01-02 15:04:05"
+
+// Validity 从证书 PEM 解析有效期，PEM 无法解析时回退到接口返回的过期时间（此时 NotBefore 为零值）
+func Validity(certPEM, fallback string) (notBefore, notAfter time.Time, err error) {
+	if certPEM != "" {
+		if parsed, parseErr := ParseCertificate(certPEM); parseErr == nil {
+			return parsed.NotBefore, parsed.NotAfter, nil
+		}
+	}
+	notAfter, err = ParseExpiresAt(fallback)
+	if err != nil {
+		return time.Time{}, time.Time{}, err
+	}
+	return time.Time{}, notAfter, nil
+}
+
+// ParseExpiresAt 解析接口或配置中的过期时间，不带时区的值按本地时间处理
+// 只有日期时表示当天 00:00，比实际过期时间略早，续签判断偏保守
+func ParseExpiresAt(value string) (time.Time, error) {
+	if value == "" {
+		return time.Time{}, fmt.Errorf("过期时间为空")
+	}
+	if t, err := time.Parse(time.RFC3339, value); err == nil {
+		return t, nil
+	}
+	for _, layout := range []string{ExpiresAtLayout, "2006-01-02"} {
+		if t, err := time.ParseInLocation(layout, value, time.Local); err == nil {
+			return t, nil
+		}
+	}
+	return time.Time{}, fmt.Errorf("无法解析过期时间: %s", value)
+}
+
+// DaysUntil 距离指定时间的整天数（向下取整，已过期为负数）
+func DaysUntil(t, now time.Time) int {
+	return int(math.Floor(t.Sub(now).Hours() / 24))
+}
+
+// FormatExpiresAt 按 ExpiresAtLayout 格式化为本地时间
+func FormatExpiresAt(t time.Time) string {
+	return t.Local().Format(ExpiresAtLayout)
+}
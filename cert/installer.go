@@ -33,9 +33,11 @@ func InstallPFX(pfxPath, password string) (*InstallResult, error) {
 	// 使用 PowerShell 导入证书
 	script := fmt.Sprintf(`
 $password = ConvertTo-SecureString -String '%s' -Force -AsPlainText
-$cert = Import-PfxCertificate -FilePath '%s' -CertStoreLocation Cert:\LocalMachine\My -Password $password -Exportable
-if ($cert) {
-    Write-Output "Thumbprint: $($cert.Thumbprint)"
+$imported = Import-PfxCertificate -FilePath '%s' -CertStoreLocation Cert:\LocalMachine\My -Password $password -Exportable
+if ($imported) {
+    Write-Output "Thumbprint: $(@($imported)[0].Thumbprint)"
+    $imported | ForEach-Object {
+        $cert = $_`+certInfoScript+`    }
 } else {
     Write-Error "导入失败"
 }
@@ -70,6 +72,13 @@ if ($cert) {
 		}, nil
 	}
 
+	// 新证书加入快照，后续查询无需重新枚举证书存储
+	for _, info := range parseCertList(outputStr) {
+		if info.Thumbprint == thumbprint {
+			inv.put(info)
+		}
+	}
+
 	return &InstallResult{
 		Success:    true,
 		Thumbprint: thumbprint,
@@ -0,0 +1,85 @@
+package cert
+
+import (
+	"strings"
+	"sync"
+)
+
+// storeInventory LocalMachine\My 证书快照
+// 首次查询时执行一次 PowerShell 加载，本程序安装、删除、改名后原地更新，
+// 外部可能修改时（每次部署开始）调用 InvalidateInventory 丢弃
+type storeInventory struct {
+	mu     sync.Mutex
+	certs  []CertInfo
+	loaded bool
+}
+
+var inv storeInventory
+
+// InvalidateInventory 丢弃证书快照，下次查询重新加载
+func InvalidateInventory() {
+	inv.mu.Lock()
+	defer inv.mu.Unlock()
+	inv.certs, inv.loaded = nil, false
+}
+
+// CachedCertificates 从快照获取证书列表（返回副本）
+func CachedCertificates() ([]CertInfo, error) {
+	inv.mu.Lock()
+	defer inv.mu.Unlock()
+	if !inv.loaded {
+		certs, err := listCertificates()
+		if err != nil {
+			return nil, err
+		}
+		inv.certs, inv.loaded = certs, true
+	}
+	return append([]CertInfo(nil), inv.certs...), nil
+}
+
+// set 用完整列表刷新快照
+func (v *storeInventory) set(certs []CertInfo) {
+	v.mu.Lock()
+	defer v.mu.Unlock()
+	v.certs, v.loaded = append([]CertInfo(nil), certs...), true
+}
+
+// put 新增或替换证书（快照未加载时忽略）
+func (v *storeInventory) put(info CertInfo) {
+	v.mu.Lock()
+	defer v.mu.Unlock()
+	if !v.loaded {
+		return
+	}
+	for i := range v.certs {
+		if strings.EqualFold(v.certs[i].Thumbprint, info.Thumbprint) {
+			v.certs[i] = info
+			return
+		}
+	}
+	v.certs = append(v.certs, info)
+}
+
+// remove 删除证书
+func (v *storeInventory) remove(thumbprint string) {
+	v.mu.Lock()
+	defer v.mu.Unlock()
+	for i := range v.certs {
+		if strings.EqualFold(v.certs[i].Thumbprint, thumbprint) {
+			v.certs = append(v.certs[:i], v.certs[i+1:]...)
+			return
+		}
+	}
+}
+
+// update 修改快照中的证书（不存在时忽略）
+func (v *storeInventory) update(thumbprint string, fn func(info *CertInfo)) {
+	v.mu.Lock()
+	defer v.mu.Unlock()
+	for i := range v.certs {
+		if strings.EqualFold(v.certs[i].Thumbprint, thumbprint) {
+			fn(&v.certs[i])
+			return
+		}
+	}
+}
@@ -17,7 +17,15 @@ type OrderMeta struct {
 	ExpiresAt    string   `json:"expires_at"`
 	CreatedAt    string   `json:"created_at"`
 	LastDeployed string   `json:"last_deployed,omitempty"`
-	Thumbprint   string   `json:"thumbprint,omitempty"`
+	Thumbprint   string   `json:"thumbprint,omitempty"` // 当前部署的证书指纹
+
+	Superseded []SupersededCert `json:"superseded,omitempty"` // 被替换、尚未删除的证书
+}
+
+// SupersededCert 被新证书替换的旧证书
+type SupersededCert struct {
+	Thumbprint string `json:"thumbprint"`
+	ReplacedAt string `json:"replaced_at"`
 }
 
 // OrderStore 本地订单存储
@@ -3,6 +3,7 @@ package cert
 import (
 	"bufio"
 	"fmt"
+	"net"
 	"regexp"
 	"strings"
 	"time"
@@ -21,14 +22,11 @@ type CertInfo struct {
 	HasPrivKey   bool
 	SerialNumber string
 	DNSNames     []string // SAN 中的 DNS 名称
+	IPAddresses  []string // SAN 中的 IP 地址
 }
 
-// ListCertificates 列出本机证书存储中的证书 (LocalMachine\My)
-func ListCertificates() ([]CertInfo, error) {
-	// 使用 PowerShell 获取证书列表
-	script := `
-Get-ChildItem -Path Cert:\LocalMachine\My | ForEach-Object {
-    $cert = $_
+// certInfoScript 输出 $cert 证书信息的 PowerShell 片段，由 parseCertList 解析
+const certInfoScript = `
     Write-Output "===CERT==="
     Write-Output "Thumbprint: $($cert.Thumbprint)"
     Write-Output "Subject: $($cert.Subject)"
@@ -46,8 +44,28 @@ Get-ChildItem -Path Cert:\LocalMachine\My | ForEach-Object {
         if ($dnsNames) {
             Write-Output "DNSNames: $($dnsNames -join ',')"
         }
+        $ipAddresses = [regex]::Matches($sanStr, 'IP Address=([^\s,]+)') | ForEach-Object { $_.Groups[1].Value }
+        if ($ipAddresses) {
+            Write-Output "IPAddresses: $($ipAddresses -join ',')"
+        }
     }
+`
+
+// ListCertificates 列出本机证书存储中的证书 (LocalMachine\My)（实时查询，同时刷新快照）
+func ListCertificates() ([]CertInfo, error) {
+	certs, err := listCertificates()
+	if err != nil {
+		return nil, err
+	}
+	inv.set(certs)
+	return certs, nil
 }
+
+func listCertificates() ([]CertInfo, error) {
+	// 使用 PowerShell 获取证书列表
+	script := `
+Get-ChildItem -Path Cert:\LocalMachine\My | ForEach-Object {
+    $cert = $_` + certInfoScript + `}
 `
 	output, err := util.RunPowerShell(script)
 	if err != nil {
@@ -107,6 +125,10 @@ func parseCertList(output string) []CertInfo {
 				if value != "" {
 					current.DNSNames = strings.Split(value, ",")
 				}
+			case "IPAddresses":
+				if value != "" {
+					current.IPAddresses = strings.Split(value, ",")
+				}
 			}
 		}
 	}
@@ -119,11 +141,11 @@ func parseCertList(output string) []CertInfo {
 	return certs
 }
 
-// GetCertByThumbprint 根据指纹获取证书
+// GetCertByThumbprint 根据指纹获取证书（查询快照）
 func GetCertByThumbprint(thumbprint string) (*CertInfo, error) {
 	thumbprint = strings.ToUpper(strings.ReplaceAll(thumbprint, " ", ""))
 
-	certs, err := ListCertificates()
+	certs, err := CachedCertificates()
 	if err != nil {
 		return nil, err
 	}
@@ -146,7 +168,7 @@ func GetCertDisplayName(cert *CertInfo) string {
 	// 从 Subject 中提取 CN
 	cn := extractCN(cert.Subject)
 	if cn != "" {
-		return cn
+		return util.ToUnicode(cn)
 	}
 
 	return cert.Subject
@@ -182,18 +204,32 @@ func GetCertStatus(cert *CertInfo) string {
 }
 
 // MatchesDomain 检查证书是否匹配指定域名
+// IP 地址与 SAN 中的 IP 地址（或 CN）按地址比较，不参与通配符匹配
+// 国际化域名统一转换为 A-label 后比较
 func (c *CertInfo) MatchesDomain(domain string) bool {
-	domain = strings.ToLower(domain)
+	if ip := net.ParseIP(domain); ip != nil {
+		if sameIP(extractCN(c.Subject), ip) {
+			return true
+		}
+		for _, addr := range c.IPAddresses {
+			if sameIP(addr, ip) {
+				return true
+			}
+		}
+		return false
+	}
+
+	domain = util.ToASCII(domain)
 
 	// 检查 CN
-	cn := strings.ToLower(extractCN(c.Subject))
+	cn := util.ToASCII(extractCN(c.Subject))
 	if matchDomain(cn, domain) {
 		return true
 	}
 
 	// 检查 SAN DNS 名称
 	for _, dns := range c.DNSNames {
-		if matchDomain(strings.ToLower(dns), domain) {
+		if matchDomain(util.ToASCII(dns), domain) {
 			return true
 		}
 	}
@@ -201,6 +237,12 @@ func (c *CertInfo) MatchesDomain(domain string) bool {
 	return false
 }
 
+// sameIP 字符串是否为与 ip 相同的地址（IPv6 不同写法视为相同）
+func sameIP(value string, ip net.IP) bool {
+	parsed := net.ParseIP(strings.TrimSpace(value))
+	return parsed != nil && parsed.Equal(ip)
+}
+
 // matchDomain 检查证书域名是否匹配目标域名（支持通配符）
 func matchDomain(certDomain, targetDomain string) bool {
 	if certDomain == "" || targetDomain == "" {
@@ -272,6 +314,7 @@ if ($cert) {
 	if err != nil {
 		return fmt.Errorf("删除证书失败: %v, 输出: %s", err, output)
 	}
+	inv.remove(cleanThumbprint)
 
 	return nil
 }
@@ -307,6 +350,9 @@ if ($cert) {
 	if err != nil {
 		return fmt.Errorf("设置友好名称失败: %v, 输出: %s", err, output)
 	}
+	inv.update(cleanThumbprint, func(info *CertInfo) {
+		info.FriendlyName = friendlyName
+	})
 
 	return nil
 }
@@ -0,0 +1,150 @@
+package cert
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha1"
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"net"
+	"strings"
+	"time"
+)
+
+// ErrEndpointUnreachable 无法连接到 TLS 端点（端口未监听、站点已停止等）
+// 与握手后证书不一致区分开，调用方可据此跳过校验而不是判定部署失败
+var ErrEndpointUnreachable = errors.New("无法连接到 TLS 端点")
+
+// ServedCertificate TLS 握手时服务端下发的证书
+type ServedCertificate struct {
+	Thumbprint string              // 叶子证书指纹（SHA1，大写）
+	Subject    string              // 叶子证书主题
+	Chain      []*x509.Certificate // 服务端下发的全部证书，第一个为叶子证书
+}
+
+// FetchServedCertificate 连接 addr 并以 serverName 作为 SNI 完成 TLS 握手，返回服务端证书
+// 只关心下发的是哪张证书，不校验证书链是否可信
+func FetchServedCertificate(ctx context.Context, addr, serverName string, timeout time.Duration) (*ServedCertificate, error) {
+	ctx, cancel := context.WithTimeout(ctx, timeout)
+	defer cancel()
+
+	dialer := &net.Dialer{}
+	conn, err := dialer.DialContext(ctx, "tcp", addr)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrEndpointUnreachable, err)
+	}
+	defer conn.Close()
+
+	tlsConn := tls.Client(conn, &tls.Config{
+		ServerName:         serverName,
+		InsecureSkipVerify: true,
+	})
+	if err := tlsConn.HandshakeContext(ctx); err != nil {
+		return nil, fmt.Errorf("TLS 握手失败: %w", err)
+	}
+
+	peers := tlsConn.ConnectionState().PeerCertificates
+	if len(peers) == 0 {
+		return nil, fmt.Errorf("服务端未返回证书")
+	}
+
+	return &ServedCertificate{
+		Thumbprint: thumbprintOf(peers[0]),
+		Subject:    peers[0].Subject.CommonName,
+		Chain:      peers,
+	}, nil
+}
+
+// VerifyServedCertificate 检查服务端下发的证书是否为刚安装的证书，且中间证书完整
+// chainPEM 为安装时随证书提供的 CA 证书，其中非自签名的中间证书必须全部下发
+func VerifyServedCertificate(served *ServedCertificate, thumbprint, chainPEM string) error {
+	expected := strings.ToUpper(strings.ReplaceAll(thumbprint, " ", ""))
+	if served.Thumbprint != expected {
+		return fmt.Errorf("服务端证书不一致: 期望 %s, 实际 %s (%s)", expected, served.Thumbprint, served.Subject)
+	}
+
+	sent := make(map[string]bool)
+	for _, c := range served.Chain[1:] {
+		sent[thumbprintOf(c)] = true
+	}
+
+	missing := make([]string, 0)
+	for _, ca := range parseCertChain(chainPEM) {
+		if isSelfSigned(ca) {
+			// 根证书由客户端自带，服务端通常不下发
+			continue
+		}
+		if !sent[thumbprintOf(ca)] {
+			missing = append(missing, ca.Subject.CommonName)
+		}
+	}
+	if len(missing) > 0 {
+		return fmt.Errorf("服务端证书链不完整，缺少中间证书: %s", strings.Join(missing, ", "))
+	}
+	return nil
+}
+
+// CheckServedCertificate 握手并校验服务端证书，失败时按间隔重试
+// HTTP.sys 更新绑定后可能短暂仍下发旧证书，因此不一致时会重试
+// ctx 取消时立即返回 ctx 的错误（不是 ErrEndpointUnreachable），调用方不应据此判断校验结果
+func CheckServedCertificate(ctx context.Context, addr, serverName, thumbprint, chainPEM string, attempts int, interval time.Duration) error {
+	if attempts <= 0 {
+		attempts = 1
+	}
+
+	var lastErr error
+	for i := 0; i < attempts; i++ {
+		if i > 0 {
+			select {
+			case <-ctx.Done():
+			case <-time.After(interval):
+			}
+		}
+		if err := ctx.Err(); err != nil {
+			return fmt.Errorf("校验中止: %w", err)
+		}
+		served, err := FetchServedCertificate(ctx, addr, serverName, 10*time.Second)
+		if err != nil {
+			if ctx.Err() != nil {
+				return fmt.Errorf("校验中止: %w", ctx.Err())
+			}
+			lastErr = err
+			continue
+		}
+		if lastErr = VerifyServedCertificate(served, thumbprint, chainPEM); lastErr == nil {
+			return nil
+		}
+	}
+	return lastErr
+}
+
+// parseCertChain 解析 PEM 中的全部证书（忽略无法解析的块）
+func parseCertChain(chainPEM string) []*x509.Certificate {
+	certs := make([]*x509.Certificate, 0)
+	rest := []byte(chainPEM)
+	for {
+		var block *pem.Block
+		block, rest = pem.Decode(rest)
+		if block == nil {
+			break
+		}
+		if block.Type != "CERTIFICATE" {
+			continue
+		}
+		if c, err := x509.ParseCertificate(block.Bytes); err == nil {
+			certs = append(certs, c)
+		}
+	}
+	return certs
+}
+
+func isSelfSigned(c *x509.Certificate) bool {
+	return bytes.Equal(c.RawIssuer, c.RawSubject) && c.CheckSignatureFrom(c) == nil
+}
+
+func thumbprintOf(c *x509.Certificate) string {
+	return fmt.Sprintf("%X", sha1.Sum(c.Raw))
+}
@@ -0,0 +1,175 @@
+package cert
+
+import (
+	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"errors"
+	"math/big"
+	"net"
+	"strings"
+	"testing"
+	"time"
+)
+
+// testCert 测试用证书及私钥
+type testCert struct {
+	cert *x509.Certificate
+	key  *ecdsa.PrivateKey
+}
+
+func newTestCert(t *testing.T, cn string, parent *testCert, isCA bool) *testCert {
+	t.Helper()
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	serial, _ := rand.Int(rand.Reader, big.NewInt(1<<62))
+	tmpl := &x509.Certificate{
+		SerialNumber:          serial,
+		Subject:               pkix.Name{CommonName: cn},
+		NotBefore:             time.Now().Add(-time.Hour),
+		NotAfter:              time.Now().Add(time.Hour),
+		BasicConstraintsValid: true,
+		IsCA:                  isCA,
+	}
+	if isCA {
+		tmpl.KeyUsage = x509.KeyUsageCertSign
+	} else {
+		tmpl.DNSNames = []string{cn}
+		tmpl.ExtKeyUsage = []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth}
+	}
+
+	signer, signerKey := tmpl, key
+	if parent != nil {
+		signer, signerKey = parent.cert, parent.key
+	}
+	der, err := x509.CreateCertificate(rand.Reader, tmpl, signer, &key.PublicKey, signerKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+	c, err := x509.ParseCertificate(der)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return &testCert{cert: c, key: key}
+}
+
+func toPEM(certs ...*testCert) string {
+	var b strings.Builder
+	for _, c := range certs {
+		pem.Encode(&b, &pem.Block{Type: "CERTIFICATE", Bytes: c.cert.Raw})
+	}
+	return b.String()
+}
+
+// startTLSServer 启动本地 TLS 服务，下发 leaf 及 chain 中的证书，返回监听地址
+func startTLSServer(t *testing.T, leaf *testCert, chain ...*testCert) string {
+	t.Helper()
+	tlsCert := tls.Certificate{Certificate: [][]byte{leaf.cert.Raw}, PrivateKey: leaf.key}
+	for _, c := range chain {
+		tlsCert.Certificate = append(tlsCert.Certificate, c.cert.Raw)
+	}
+
+	ln, err := tls.Listen("tcp", "127.0.0.1:0", &tls.Config{Certificates: []tls.Certificate{tlsCert}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { ln.Close() })
+	go func() {
+		for {
+			conn, err := ln.Accept()
+			if err != nil {
+				return
+			}
+			go func() {
+				defer conn.Close()
+				conn.(*tls.Conn).Handshake()
+			}()
+		}
+	}()
+	return ln.Addr().String()
+}
+
+func TestCheckServedCertificate(t *testing.T) {
+	root := newTestCert(t, "Test Root", nil, true)
+	intermediate := newTestCert(t, "Test Intermediate", root, true)
+	leaf := newTestCert(t, "www.example.com", intermediate, false)
+	other := newTestCert(t, "www.example.com", intermediate, false)
+	chainPEM := toPEM(intermediate, root)
+
+	t.Run("证书一致且证书链完整", func(t *testing.T) {
+		addr := startTLSServer(t, leaf, intermediate)
+		if err := CheckServedCertificate(context.Background(), addr, "www.example.com", thumbprintOf(leaf.cert), chainPEM, 1, 0); err != nil {
+			t.Fatal(err)
+		}
+		// 指纹大小写和空格不影响比较
+		lower := strings.ToLower(thumbprintOf(leaf.cert)[:20]) + " " + thumbprintOf(leaf.cert)[20:]
+		if err := CheckServedCertificate(context.Background(), addr, "www.example.com", lower, chainPEM, 1, 0); err != nil {
+			t.Fatal(err)
+		}
+	})
+
+	t.Run("下发的不是新证书", func(t *testing.T) {
+		addr := startTLSServer(t, other, intermediate)
+		err := CheckServedCertificate(context.Background(), addr, "www.example.com", thumbprintOf(leaf.cert), chainPEM, 2, 10*time.Millisecond)
+		if err == nil || !strings.Contains(err.Error(), "不一致") {
+			t.Fatalf("期望证书不一致错误，实际 %v", err)
+		}
+		if errors.Is(err, ErrEndpointUnreachable) {
+			t.Fatal("证书不一致不应视为无法连接")
+		}
+	})
+
+	t.Run("缺少中间证书", func(t *testing.T) {
+		addr := startTLSServer(t, leaf)
+		err := CheckServedCertificate(context.Background(), addr, "www.example.com", thumbprintOf(leaf.cert), chainPEM, 1, 0)
+		if err == nil || !strings.Contains(err.Error(), "Test Intermediate") {
+			t.Fatalf("期望证书链不完整错误，实际 %v", err)
+		}
+	})
+
+	t.Run("根证书不要求下发", func(t *testing.T) {
+		addr := startTLSServer(t, leaf, intermediate)
+		if err := CheckServedCertificate(context.Background(), addr, "www.example.com", thumbprintOf(leaf.cert), toPEM(root), 1, 0); err != nil {
+			t.Fatal(err)
+		}
+	})
+
+	t.Run("端口无法连接", func(t *testing.T) {
+		ln, err := net.Listen("tcp", "127.0.0.1:0")
+		if err != nil {
+			t.Fatal(err)
+		}
+		addr := ln.Addr().String()
+		ln.Close()
+
+		err = CheckServedCertificate(context.Background(), addr, "www.example.com", thumbprintOf(leaf.cert), chainPEM, 2, 10*time.Millisecond)
+		if !errors.Is(err, ErrEndpointUnreachable) {
+			t.Fatalf("期望 ErrEndpointUnreachable，实际 %v", err)
+		}
+	})
+
+	t.Run("取消时不再重试", func(t *testing.T) {
+		addr := startTLSServer(t, other, intermediate)
+		ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+		defer cancel()
+
+		start := time.Now()
+		err := CheckServedCertificate(ctx, addr, "www.example.com", thumbprintOf(leaf.cert), chainPEM, 3, 10*time.Second)
+		if !errors.Is(err, context.DeadlineExceeded) {
+			t.Fatalf("期望 context.DeadlineExceeded，实际 %v", err)
+		}
+		if errors.Is(err, ErrEndpointUnreachable) {
+			t.Fatal("取消不应视为无法连接")
+		}
+		if elapsed := time.Since(start); elapsed > 5*time.Second {
+			t.Errorf("取消后仍在等待重试: %v", elapsed)
+		}
+	})
+}
@@ -114,9 +114,9 @@ func normalizeSerialNumber(sn string) string {
 	return sn
 }
 
-// IsCertExists 检查证书是否已存在（按序列号）
+// IsCertExists 检查证书是否已存在（按序列号，查询快照）
 func IsCertExists(serialNumber string) (bool, *CertInfo, error) {
-	certs, err := ListCertificates()
+	certs, err := CachedCertificates()
 	if err != nil {
 		return false, nil, err
 	}
@@ -0,0 +1,192 @@
+package cli
+
+import (
+	"fmt"
+	"os"
+	"strings"
+
+	"cert-deploy/cert"
+	"cert-deploy/iis"
+	"cert-deploy/util"
+)
+
+// runCertsList 列出本机证书
+func runCertsList(args []string) error {
+	fs := newFlagSet("certs list")
+	domain := fs.String("domain", "", "只列出包含该域名的证书")
+	jsonOutput := fs.Bool("json", false, "以 JSON 格式输出")
+	if _, err := parseFlags(fs, args); err != nil {
+		return err
+	}
+
+	certs, err := cert.ListCertificates()
+	if err != nil {
+		return fmt.Errorf("读取证书列表失败: %w", err)
+	}
+	if *domain != "" {
+		certs = cert.FilterByDomain(certs, *domain)
+	}
+	if *jsonOutput {
+		return printJSON(certs)
+	}
+
+	if len(certs) == 0 {
+		fmt.Println("没有证书")
+		return nil
+	}
+	for i := range certs {
+		c := &certs[i]
+		key := ""
+		if !c.HasPrivKey {
+			key = "  无私钥"
+		}
+		fmt.Printf("%s  %s  %s  %s%s\n", c.Thumbprint, c.NotAfter.Format("2006-01-02"),
+			cert.GetCertDisplayName(c), cert.GetCertStatus(c), key)
+	}
+	return nil
+}
+
+// certUsage 证书详情（certs show --json）
+type certUsage struct {
+	cert.CertInfo
+	Bindings []string `json:"bindings"` // 使用该证书的 HTTP.sys 绑定
+}
+
+// runCertsShow 显示证书详情
+func runCertsShow(args []string) error {
+	fs := newFlagSet("certs show")
+	jsonOutput := fs.Bool("json", false, "以 JSON 格式输出")
+	pos, err := parseFlags(fs, args)
+	if err != nil {
+		return err
+	}
+	if err := expectArgs(fs, pos, 1); err != nil {
+		return err
+	}
+
+	info, err := cert.GetCertByThumbprint(pos[0])
+	if err != nil {
+		return err
+	}
+	bindings, err := certBindings(info.Thumbprint)
+	if err != nil {
+		return err
+	}
+	if *jsonOutput {
+		return printJSON(certUsage{CertInfo: *info, Bindings: bindings})
+	}
+
+	fmt.Printf("指纹:     %s\n", info.Thumbprint)
+	fmt.Printf("名称:     %s\n", cert.GetCertDisplayName(info))
+	fmt.Printf("主题:     %s\n", info.Subject)
+	fmt.Printf("颁发者:   %s\n", info.Issuer)
+	fmt.Printf("序列号:   %s\n", info.SerialNumber)
+	fmt.Printf("有效期:   %s 至 %s（%s）\n", info.NotBefore.Format("2006-01-02"),
+		info.NotAfter.Format("2006-01-02"), cert.GetCertStatus(info))
+	fmt.Printf("私钥:     %v\n", info.HasPrivKey)
+	names := make([]string, 0, len(info.DNSNames)+len(info.IPAddresses))
+	for _, name := range info.DNSNames {
+		names = append(names, util.ToUnicode(name))
+	}
+	names = append(names, info.IPAddresses...)
+	if len(names) > 0 {
+		fmt.Printf("域名:     %s\n", strings.Join(names, ", "))
+	}
+	if len(bindings) > 0 {
+		fmt.Printf("绑定:     %s\n", strings.Join(bindings, ", "))
+	}
+	return nil
+}
+
+// runCertsDelete 删除证书
+func runCertsDelete(args []string) error {
+	fs := newFlagSet("certs delete")
+	force := fs.Bool("force", false, "证书仍被绑定时也删除")
+	pos, err := parseFlags(fs, args)
+	if err != nil {
+		return err
+	}
+	if err := expectArgs(fs, pos, 1); err != nil {
+		return err
+	}
+
+	info, err := cert.GetCertByThumbprint(pos[0])
+	if err != nil {
+		return err
+	}
+	bindings, err := certBindings(info.Thumbprint)
+	if err != nil {
+		return err
+	}
+	if len(bindings) > 0 {
+		if !*force {
+			return fmt.Errorf("证书仍被绑定使用: %s（使用 --force 强制删除）", strings.Join(bindings, ", "))
+		}
+		fmt.Fprintf(os.Stderr, "警告: 证书仍被绑定使用: %s\n", strings.Join(bindings, ", "))
+	}
+
+	if err := cert.DeleteCertificate(info.Thumbprint); err != nil {
+		return fmt.Errorf("删除证书失败: %w", err)
+	}
+	fmt.Printf("已删除证书: %s (%s)\n", info.Thumbprint, cert.GetCertDisplayName(info))
+	return nil
+}
+
+// certBindings 返回使用指定证书的 HTTP.sys 绑定（host:port 或 ip:port）
+func certBindings(thumbprint string) ([]string, error) {
+	sslBindings, err := iis.ListSSLBindings()
+	if err != nil {
+		return nil, fmt.Errorf("读取 SSL 绑定失败: %w", err)
+	}
+	var result []string
+	for _, b := range sslBindings {
+		if strings.EqualFold(strings.ReplaceAll(b.CertHash, " ", ""), thumbprint) {
+			result = append(result, util.DisplayHostPort(b.HostnamePort))
+		}
+	}
+	return result, nil
+}
+
+// runInstallPFX 安装 PFX 证书
+func runInstallPFX(args []string) error {
+	fs := newFlagSet("install pfx")
+	password := fs.String("password", "", "PFX 密码")
+	pos, err := parseFlags(fs, args)
+	if err != nil {
+		return err
+	}
+	if err := expectArgs(fs, pos, 1); err != nil {
+		return err
+	}
+
+	result, err := cert.InstallPFX(pos[0], *password)
+	return printInstallResult(result, err)
+}
+
+// runInstallPEM 安装 PEM 证书和私钥
+func runInstallPEM(args []string) error {
+	fs := newFlagSet("install pem")
+	password := fs.String("password", "", "私钥密码")
+	pos, err := parseFlags(fs, args)
+	if err != nil {
+		return err
+	}
+	if err := expectArgs(fs, pos, 2); err != nil {
+		return err
+	}
+
+	result, err := cert.InstallPEM(pos[0], pos[1], *password)
+	return printInstallResult(result, err)
+}
+
+// printInstallResult 输出安装结果
+func printInstallResult(result *cert.InstallResult, err error) error {
+	if err != nil {
+		return fmt.Errorf("安装证书失败: %w", err)
+	}
+	if !result.Success {
+		return fmt.Errorf("安装证书失败: %s", result.ErrorMessage)
+	}
+	fmt.Printf("已安装证书: %s\n", result.Thumbprint)
+	return nil
+}
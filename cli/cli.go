@@ -0,0 +1,200 @@
+package cli
+
+import (
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"net"
+	"os"
+	"strconv"
+	"strings"
+
+	"cert-deploy/util"
+)
+
+// command 子命令
+type command struct {
+	name    string // 命令名，多级命令以空格分隔，如 "certs list"
+	args    string // 参数说明
+	summary string
+	run     func(args []string) error
+}
+
+// commands 全部子命令（同时用于帮助输出，按此顺序显示）
+var commands []command
+
+func init() {
+	commands = []command{
+		{"sites list", "[--json]", "列出 IIS 站点和绑定", runSitesList},
+		{"certs list", "[--domain 域名] [--json]", "列出本机证书（LocalMachine\\My）", runCertsList},
+		{"certs show", "<指纹> [--json]", "显示证书详情和使用该证书的 HTTP.sys 绑定", runCertsShow},
+		{"certs delete", "<指纹> [--force]", "删除证书，证书仍被绑定时需要 --force", runCertsDelete},
+		{"install pfx", "<文件> [--password 密码]", "安装 PFX 证书", runInstallPFX},
+		{"install pem", "<证书文件> <私钥文件> [--password 密码]", "安装 PEM 证书和私钥", runInstallPEM},
+		{"bind", "<host:port> --cert <指纹> [--site 站点]", "绑定证书（补齐站点 HTTPS 绑定并校验握手）", runBind},
+		{"unbind", "<host:port> [--site 站点]", "解除证书绑定，指定站点时同时删除站点的 HTTPS 绑定", runUnbind},
+		{"orders list", "[--json]", "列出配置中的订单", runOrdersList},
+		{"orders import", "[--domain 域名] [--order ID,...] [--all] [选项]", "从部署接口导入证书并添加自动更新配置", runOrdersImport},
+		{"orders enable", "<订单ID>", "启用订单的自动部署", runOrdersEnable},
+		{"orders disable", "<订单ID>", "停用订单的自动部署", runOrdersDisable},
+		{"orders remove", "<订单ID>", "从配置中删除订单", runOrdersRemove},
+		{"task install", "[--interval 小时]", "创建计划任务", runTaskInstall},
+		{"task remove", "", "删除计划任务", runTaskRemove},
+		{"task run", "", "立即运行计划任务", runTaskRun},
+		{"deploy", "[--order ID] [--force]", "立即部署，--force 不受续签时间限制", runDeploy},
+	}
+}
+
+// IsCommand 判断第一个参数是否为子命令（否则按原有的 -auto 等选项处理）
+func IsCommand(name string) bool {
+	for _, c := range commands {
+		if strings.Fields(c.name)[0] == name {
+			return true
+		}
+	}
+	return name == "help"
+}
+
+// Run 执行子命令，返回进程退出码
+func Run(args []string) int {
+	attachConsole()
+
+	if len(args) == 0 || args[0] == "help" {
+		PrintUsage(os.Stdout)
+		return 0
+	}
+
+	cmd, rest := lookup(args)
+	if cmd == nil {
+		fmt.Fprintf(os.Stderr, "未知命令: %s\n\n", strings.Join(args, " "))
+		PrintUsage(os.Stderr)
+		return 2
+	}
+
+	if err := cmd.run(rest); err != nil {
+		if errors.Is(err, flag.ErrHelp) {
+			return 0
+		}
+		fmt.Fprintf(os.Stderr, "错误: %v\n", err)
+		return 1
+	}
+	return 0
+}
+
+// lookup 按参数查找子命令，返回剩余参数
+func lookup(args []string) (*command, []string) {
+	for i := range commands {
+		words := strings.Fields(commands[i].name)
+		if len(args) < len(words) {
+			continue
+		}
+		matched := true
+		for j, w := range words {
+			if args[j] != w {
+				matched = false
+				break
+			}
+		}
+		if matched {
+			return &commands[i], args[len(words):]
+		}
+	}
+	return nil, nil
+}
+
+// PrintUsage 输出子命令列表
+func PrintUsage(w io.Writer) {
+	fmt.Fprintln(w, "子命令:")
+	for _, c := range commands {
+		fmt.Fprintf(w, "  certdeploy.exe %s %s\n      %s\n", c.name, c.args, c.summary)
+	}
+	fmt.Fprintln(w)
+	fmt.Fprintln(w, "  选项可写作 -name 或 --name，可放在位置参数之后；orders import 选项:")
+	fmt.Fprintln(w, "    --profile 名称  --local-key  --validation file|delegation  --no-auto-update")
+}
+
+// newFlagSet 创建子命令的参数集，参数错误时输出该命令的用法
+func newFlagSet(name string) *flag.FlagSet {
+	fs := flag.NewFlagSet(name, flag.ContinueOnError)
+	fs.SetOutput(os.Stderr)
+	fs.Usage = func() {
+		for _, c := range commands {
+			if c.name == name {
+				fmt.Fprintf(os.Stderr, "用法: certdeploy.exe %s %s\n", c.name, c.args)
+			}
+		}
+		fs.PrintDefaults()
+	}
+	return fs
+}
+
+// parseFlags 解析参数，允许选项出现在位置参数之后（如 bind www.example.com:443 --cert XXX）
+// 返回位置参数
+func parseFlags(fs *flag.FlagSet, args []string) ([]string, error) {
+	var positional []string
+	for {
+		if err := fs.Parse(args); err != nil {
+			return nil, err
+		}
+		args = fs.Args()
+		if len(args) == 0 {
+			return positional, nil
+		}
+		positional = append(positional, args[0])
+		args = args[1:]
+	}
+}
+
+// expectArgs 检查位置参数个数
+func expectArgs(fs *flag.FlagSet, args []string, n int) error {
+	if len(args) != n {
+		fs.Usage()
+		return fmt.Errorf("需要 %d 个参数，实际 %d 个", n, len(args))
+	}
+	return nil
+}
+
+// parseHostPort 解析 host:port，省略端口时为 443
+// host 可以是域名（含通配符、国际化域名）或 IPv4 地址；证书绑定只处理 IPv4，IPv6 地址返回错误
+func parseHostPort(s string) (string, int, error) {
+	host, port := s, 443
+	if h, p, err := net.SplitHostPort(s); err == nil {
+		n, err := strconv.Atoi(p)
+		if err != nil || n < 1 || n > 65535 {
+			return "", 0, fmt.Errorf("无效的端口: %s", p)
+		}
+		host, port = h, n
+	}
+	if ip := net.ParseIP(host); ip != nil {
+		ip4 := ip.To4()
+		if ip4 == nil {
+			return "", 0, fmt.Errorf("不支持 IPv6 地址 %s，请使用 IPv4 地址或主机名", host)
+		}
+		return ip4.String(), port, nil
+	}
+	if err := util.ValidateDomain(host); err != nil {
+		return "", 0, fmt.Errorf("无效的主机名 %s: %w", host, err)
+	}
+	return host, port, nil
+}
+
+// parseOrderID 解析订单 ID
+func parseOrderID(s string) (int, error) {
+	id, err := strconv.Atoi(strings.TrimSpace(s))
+	if err != nil || id <= 0 {
+		return 0, fmt.Errorf("无效的订单 ID: %s", s)
+	}
+	return id, nil
+}
+
+// printJSON 以 JSON 格式输出到标准输出
+func printJSON(v any) error {
+	data, err := json.MarshalIndent(v, "", "  ")
+	if err != nil {
+		return fmt.Errorf("输出 JSON 失败: %w", err)
+	}
+	fmt.Println(string(data))
+	return nil
+}
@@ -0,0 +1,42 @@
+package cli
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestParseHostPort(t *testing.T) {
+	tests := []struct {
+		in   string
+		host string
+		port int
+		err  string // 期望错误包含的内容，空表示成功
+	}{
+		{in: "www.example.com", host: "www.example.com", port: 443},
+		{in: "www.example.com:8443", host: "www.example.com", port: 8443},
+		{in: "*.example.com:443", host: "*.example.com", port: 443},
+		{in: "192.168.1.10:443", host: "192.168.1.10", port: 443},
+		{in: "[::ffff:192.168.1.10]:443", host: "192.168.1.10", port: 443},
+		{in: "www.example.com:0", err: "无效的端口"},
+		{in: "www.example.com:https", err: "无效的端口"},
+		{in: "[::1]:443", err: "IPv6"},
+		{in: "::1", err: "IPv6"},
+		{in: "[2001:db8::1]", err: "无效的主机名"},
+	}
+	for _, tt := range tests {
+		host, port, err := parseHostPort(tt.in)
+		if tt.err != "" {
+			if err == nil || !strings.Contains(err.Error(), tt.err) {
+				t.Errorf("parseHostPort(%q) 错误 = %v，期望包含 %q", tt.in, err, tt.err)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("parseHostPort(%q) 失败: %v", tt.in, err)
+			continue
+		}
+		if host != tt.host || port != tt.port {
+			t.Errorf("parseHostPort(%q) = %s, %d，期望 %s, %d", tt.in, host, port, tt.host, tt.port)
+		}
+	}
+}
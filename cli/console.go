@@ -0,0 +1,39 @@
+package cli
+
+import (
+	"os"
+	"syscall"
+)
+
+const attachParentProcess = ^uintptr(0) // ATTACH_PARENT_PROCESS (DWORD -1)
+
+var procAttachConsole = syscall.NewLazyDLL("kernel32.dll").NewProc("AttachConsole")
+
+// attachConsole 发布版以 GUI 程序构建（-H windowsgui），没有控制台
+// 在命令提示符中运行子命令时附加到父进程的控制台，使输出可见；已重定向的输出不处理
+func attachConsole() {
+	stdout := hasStdHandle(syscall.STD_OUTPUT_HANDLE)
+	stderr := hasStdHandle(syscall.STD_ERROR_HANDLE)
+	if stdout && stderr {
+		return
+	}
+	if r, _, _ := procAttachConsole.Call(attachParentProcess); r == 0 {
+		return
+	}
+	f, err := os.OpenFile("CONOUT$", os.O_WRONLY, 0)
+	if err != nil {
+		return
+	}
+	if !stdout {
+		os.Stdout = f
+	}
+	if !stderr {
+		os.Stderr = f
+	}
+}
+
+// hasStdHandle 标准句柄是否可用（控制台程序或已重定向）
+func hasStdHandle(id int) bool {
+	h, err := syscall.GetStdHandle(id)
+	return err == nil && h != 0 && h != syscall.InvalidHandle
+}
@@ -0,0 +1,183 @@
+package cli
+
+import (
+	"fmt"
+	"log"
+	"os"
+	"strings"
+
+	"cert-deploy/cert"
+	"cert-deploy/config"
+	"cert-deploy/deploy"
+	"cert-deploy/iis"
+	"cert-deploy/util"
+)
+
+// runSitesList 列出 IIS 站点和绑定
+func runSitesList(args []string) error {
+	fs := newFlagSet("sites list")
+	jsonOutput := fs.Bool("json", false, "以 JSON 格式输出")
+	if _, err := parseFlags(fs, args); err != nil {
+		return err
+	}
+
+	sites, err := iis.ScanSites()
+	if err != nil {
+		return fmt.Errorf("扫描 IIS 站点失败: %w", err)
+	}
+	if *jsonOutput {
+		return printJSON(sites)
+	}
+
+	if len(sites) == 0 {
+		fmt.Println("没有 IIS 站点")
+		return nil
+	}
+	for _, site := range sites {
+		fmt.Printf("[%d] %s  %s\n", site.ID, site.Name, site.State)
+		for _, b := range site.Bindings {
+			fmt.Printf("    %s\n", formatBinding(b))
+		}
+		for _, app := range site.Applications {
+			fmt.Printf("    应用程序 %s  池 %s  %s\n", app.Path, app.AppPool, app.PhysicalPath)
+		}
+		if site.FTP != nil && site.FTP.CertHash != "" {
+			fmt.Printf("    FTP 证书 %s\n", site.FTP.CertHash)
+		}
+	}
+	return nil
+}
+
+// formatBinding 绑定的显示文本，如 https://www.example.com:443 (SNI) 指纹
+func formatBinding(b iis.BindingInfo) string {
+	host := util.ToUnicode(b.Host)
+	if host == "" {
+		host = b.IP
+		if host == "" || host == "*" {
+			host = "*"
+		}
+	}
+	s := fmt.Sprintf("%s://%s:%d", b.Protocol, host, b.Port)
+	if b.Protocol == "https" && b.SSLFlags&1 != 0 {
+		s += " (SNI)"
+	}
+	if b.CertHash != "" {
+		s += "  " + b.CertHash
+	}
+	return s
+}
+
+// runBind 绑定已安装的证书到 host:port
+func runBind(args []string) error {
+	fs := newFlagSet("bind")
+	thumbprint := fs.String("cert", "", "证书指纹")
+	siteName := fs.String("site", "", "IIS 站点名称（为空时按主机名查找）")
+	pos, err := parseFlags(fs, args)
+	if err != nil {
+		return err
+	}
+	if err := expectArgs(fs, pos, 1); err != nil {
+		return err
+	}
+	host, port, err := parseHostPort(pos[0])
+	if err != nil {
+		return err
+	}
+	if *thumbprint == "" {
+		fs.Usage()
+		return fmt.Errorf("需要 --cert 指定证书指纹")
+	}
+	if *siteName != "" {
+		if err := util.ValidateSiteName(*siteName); err != nil {
+			return err
+		}
+	}
+
+	info, err := cert.GetCertByThumbprint(*thumbprint)
+	if err != nil {
+		return fmt.Errorf("查找证书失败: %w", err)
+	}
+	if !info.HasPrivKey {
+		return fmt.Errorf("证书 %s 没有私钥，不能用于 HTTPS 绑定", info.Thumbprint)
+	}
+	if !info.MatchesDomain(host) {
+		fmt.Fprintf(os.Stderr, "警告: 证书 %s 不包含 %s\n", cert.GetCertDisplayName(info), util.ToUnicode(host))
+	}
+
+	cfg, err := config.Load()
+	if err != nil {
+		return fmt.Errorf("加载配置失败: %w", err)
+	}
+
+	lock, err := deploy.AcquireRunLock("cli", 0)
+	if err != nil {
+		return err
+	}
+	defer lock.Release()
+
+	log.SetOutput(os.Stderr)
+	results := deploy.BindHost(cfg, *siteName, host, port, info.Thumbprint)
+	return printResults(results)
+}
+
+// runUnbind 解除 host:port 的证书绑定
+func runUnbind(args []string) error {
+	fs := newFlagSet("unbind")
+	siteName := fs.String("site", "", "同时删除该站点的 HTTPS 绑定")
+	pos, err := parseFlags(fs, args)
+	if err != nil {
+		return err
+	}
+	if err := expectArgs(fs, pos, 1); err != nil {
+		return err
+	}
+	host, port, err := parseHostPort(pos[0])
+	if err != nil {
+		return err
+	}
+
+	cfg, err := config.Load()
+	if err != nil {
+		return fmt.Errorf("加载配置失败: %w", err)
+	}
+
+	lock, err := deploy.AcquireRunLock("cli", 0)
+	if err != nil {
+		return err
+	}
+	defer lock.Release()
+
+	binding, err := deploy.UnbindHost(cfg, *siteName, host, port)
+	if err != nil {
+		return err
+	}
+	fmt.Printf("已解除证书绑定: %s\n", binding)
+	if *siteName != "" {
+		fmt.Printf("已删除站点 %s 的 HTTPS 绑定\n", *siteName)
+	}
+	return nil
+}
+
+// printResults 输出部署结果，有失败时返回错误
+func printResults(results []deploy.Result) error {
+	failed := 0
+	for _, r := range results {
+		mark := "成功"
+		switch {
+		case !r.Success:
+			mark = "失败"
+			failed++
+		case r.Unchanged:
+			mark = "未变化"
+		}
+		line := fmt.Sprintf("[%s] %s", mark, r.Label())
+		if r.Message != "" {
+			line += ": " + r.Message
+		}
+		fmt.Println(strings.TrimSpace(line))
+	}
+	if failed > 0 {
+		return fmt.Errorf("%d 项失败", failed)
+	}
+	return nil
+}
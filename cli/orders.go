@@ -0,0 +1,385 @@
+package cli
+
+import (
+	"errors"
+	"fmt"
+	"log"
+	"os"
+	"strings"
+
+	"cert-deploy/api"
+	"cert-deploy/config"
+	"cert-deploy/deploy"
+	"cert-deploy/util"
+)
+
+// runOrdersList 列出配置中的订单
+func runOrdersList(args []string) error {
+	fs := newFlagSet("orders list")
+	jsonOutput := fs.Bool("json", false, "以 JSON 格式输出")
+	if _, err := parseFlags(fs, args); err != nil {
+		return err
+	}
+
+	cfg, err := config.Load()
+	if err != nil {
+		return fmt.Errorf("加载配置失败: %w", err)
+	}
+	if *jsonOutput {
+		return printJSON(cfg.Certificates)
+	}
+
+	if len(cfg.Certificates) == 0 {
+		fmt.Println("没有配置订单")
+		return nil
+	}
+	for _, c := range cfg.Certificates {
+		state := "启用"
+		if !c.Enabled {
+			state = "停用"
+		}
+		mode := "拉取"
+		if c.UseLocalKey {
+			mode = "本地私钥"
+		}
+		bind := "自动绑定"
+		if !c.AutoBindMode {
+			bind = fmt.Sprintf("规则 %d 条", len(c.BindRules))
+		}
+		fmt.Printf("[订单 %d] %s  %s  %s  %s  到期 %s  API %s\n", c.OrderID, util.ToUnicode(c.Domain),
+			state, mode, bind, c.ExpiresAt, config.ProfileName(c.Profile))
+	}
+	return nil
+}
+
+// runOrdersImport 从部署接口导入证书
+// 不指定 --order 或 --all 时只列出接口返回的证书
+func runOrdersImport(args []string) error {
+	fs := newFlagSet("orders import")
+	domain := fs.String("domain", "", "按域名查询（为空查询全部）")
+	orders := fs.String("order", "", "导入指定订单，多个以逗号分隔")
+	all := fs.Bool("all", false, "导入查询到的全部证书")
+	profile := fs.String("profile", "", "使用的 API 配置（默认 default）")
+	localKey := fs.Bool("local-key", false, "使用本地私钥模式续签")
+	validation := fs.String("validation", "", "本地私钥模式的验证方法: file 或 delegation")
+	noAutoUpdate := fs.Bool("no-auto-update", false, "只安装证书，不添加自动更新配置")
+	if _, err := parseFlags(fs, args); err != nil {
+		return err
+	}
+
+	switch *validation {
+	case "", config.ValidationMethodFile, config.ValidationMethodDelegation:
+	default:
+		return fmt.Errorf("无效的验证方法: %s（可选 file、delegation）", *validation)
+	}
+	if *validation != "" && !*localKey {
+		return fmt.Errorf("--validation 需要配合 --local-key 使用")
+	}
+
+	var orderIDs []int
+	if *orders != "" {
+		for _, s := range strings.Split(*orders, ",") {
+			id, err := parseOrderID(s)
+			if err != nil {
+				return err
+			}
+			orderIDs = append(orderIDs, id)
+		}
+	}
+
+	cfg, err := config.Load()
+	if err != nil {
+		return fmt.Errorf("加载配置失败: %w", err)
+	}
+	baseURL, token, err := cfg.API(*profile)
+	if err != nil {
+		return fmt.Errorf("读取 API 配置失败: %w", err)
+	}
+	client := api.NewClient(baseURL, token)
+
+	var certList []api.CertData
+	if len(orderIDs) > 0 {
+		for _, id := range orderIDs {
+			data, err := client.GetCertByOrderID(id)
+			if err != nil {
+				return fmt.Errorf("查询订单 %d 失败: %w", id, err)
+			}
+			certList = append(certList, *data)
+		}
+	} else {
+		certList, err = client.ListCertsByDomain(*domain)
+		if err != nil {
+			return fmt.Errorf("查询证书失败: %w", err)
+		}
+	}
+
+	if len(certList) == 0 {
+		fmt.Println("未找到任何证书")
+		return nil
+	}
+	if len(orderIDs) == 0 && !*all {
+		for _, c := range certList {
+			fmt.Printf("[订单 %d] %s  %s  到期 %s\n", c.OrderID, util.ToUnicode(c.Domain), c.Status, c.ExpiresAt)
+		}
+		fmt.Printf("找到 %d 个证书，使用 --order 或 --all 导入\n", len(certList))
+		return nil
+	}
+
+	// 校验验证方法与域名的兼容性（包括 SAN）
+	if *validation != "" {
+		for _, c := range certList {
+			for _, d := range append([]string{c.Domain}, c.GetDomainList()...) {
+				if errMsg := config.ValidateValidationMethod(d, *validation); errMsg != "" {
+					return fmt.Errorf("证书 [%s] 的域名 %s: %s", c.Domain, d, errMsg)
+				}
+			}
+		}
+	}
+
+	// 与 GUI、计划任务互斥
+	lock, err := deploy.AcquireRunLock("cli", 0)
+	if err != nil {
+		return err
+	}
+	defer lock.Release()
+
+	opts := deploy.ImportOptions{
+		AutoUpdate:       !*noAutoUpdate,
+		Profile:          *profile,
+		UseLocalKey:      *localKey,
+		ValidationMethod: *validation,
+	}
+	installed, skipped, failed, manual := 0, 0, 0, 0
+	for _, c := range certList {
+		if c.Status != "active" || c.Certificate == "" {
+			fmt.Printf("- %s: 证书未签发 (%s)，跳过\n", util.ToUnicode(c.Domain), c.Status)
+			skipped++
+			continue
+		}
+		r := deploy.ImportCert(c, opts)
+		for _, line := range r.Lines {
+			fmt.Println(line)
+		}
+		switch r.Status {
+		case deploy.ImportInstalled:
+			installed++
+		case deploy.ImportSkipped:
+			skipped++
+		case deploy.ImportFailed:
+			failed++
+		}
+		if r.ManualBind {
+			manual++
+		}
+	}
+
+	fmt.Printf("导入完成: 安装 %d，跳过 %d，失败 %d\n", installed, skipped, failed)
+	if manual > 0 {
+		fmt.Printf("%d 个证书没有匹配的 IIS 绑定，请使用 bind 命令手动绑定\n", manual)
+	}
+	if failed > 0 {
+		return fmt.Errorf("%d 个证书导入失败", failed)
+	}
+	return nil
+}
+
+// runOrdersEnable 启用订单
+func runOrdersEnable(args []string) error {
+	return setOrderEnabled("orders enable", args, true)
+}
+
+// runOrdersDisable 停用订单
+func runOrdersDisable(args []string) error {
+	return setOrderEnabled("orders disable", args, false)
+}
+
+// setOrderEnabled 修改订单的启用状态
+func setOrderEnabled(name string, args []string, enabled bool) error {
+	id, err := orderArg(name, args)
+	if err != nil {
+		return err
+	}
+
+	_, err = config.Update(func(cfg *config.Config) error {
+		c := cfg.GetCertificateByOrderID(id)
+		if c == nil {
+			return fmt.Errorf("订单 %d 不在配置中", id)
+		}
+		if c.Enabled == enabled {
+			return config.ErrNoChanges
+		}
+		c.Enabled = enabled
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+
+	if enabled {
+		fmt.Printf("已启用订单 %d\n", id)
+	} else {
+		fmt.Printf("已停用订单 %d\n", id)
+	}
+	return nil
+}
+
+// runOrdersRemove 从配置中删除订单
+func runOrdersRemove(args []string) error {
+	id, err := orderArg("orders remove", args)
+	if err != nil {
+		return err
+	}
+
+	_, err = config.Update(func(cfg *config.Config) error {
+		for i := range cfg.Certificates {
+			if cfg.Certificates[i].OrderID == id {
+				cfg.RemoveCertificateByIndex(i)
+				return nil
+			}
+		}
+		return fmt.Errorf("订单 %d 不在配置中", id)
+	})
+	if err != nil {
+		return err
+	}
+	fmt.Printf("已删除订单 %d（已安装的证书和绑定保持不变）\n", id)
+	return nil
+}
+
+// orderArg 解析只有一个订单 ID 参数的命令
+func orderArg(name string, args []string) (int, error) {
+	fs := newFlagSet(name)
+	pos, err := parseFlags(fs, args)
+	if err != nil {
+		return 0, err
+	}
+	if err := expectArgs(fs, pos, 1); err != nil {
+		return 0, err
+	}
+	return parseOrderID(pos[0])
+}
+
+// taskName 配置的计划任务名称
+func taskName(cfg *config.Config) string {
+	if cfg.TaskName != "" {
+		return cfg.TaskName
+	}
+	return util.DefaultTaskName
+}
+
+// runTaskInstall 创建计划任务
+func runTaskInstall(args []string) error {
+	fs := newFlagSet("task install")
+	interval := fs.Int("interval", 0, "检测间隔（小时），默认使用配置的间隔")
+	if _, err := parseFlags(fs, args); err != nil {
+		return err
+	}
+	if *interval < 0 {
+		return fmt.Errorf("检测间隔必须大于 0")
+	}
+
+	cfg, err := config.Load()
+	if err != nil {
+		return fmt.Errorf("加载配置失败: %w", err)
+	}
+	hours := *interval
+	if hours == 0 {
+		hours = cfg.CheckInterval
+	}
+	if hours <= 0 {
+		hours = 6
+	}
+
+	name := taskName(cfg)
+	if err := util.CreateTask(name, hours); err != nil {
+		return fmt.Errorf("创建任务失败: %w（请以管理员权限运行）", err)
+	}
+	if _, err := config.Update(func(latest *config.Config) error {
+		latest.AutoCheckEnabled = true
+		latest.CheckInterval = hours
+		return nil
+	}); err != nil {
+		return fmt.Errorf("保存配置失败: %w", err)
+	}
+	fmt.Printf("已创建计划任务 %s，每 %d 小时检测一次\n", name, hours)
+	return nil
+}
+
+// runTaskRemove 删除计划任务
+func runTaskRemove(args []string) error {
+	fs := newFlagSet("task remove")
+	if _, err := parseFlags(fs, args); err != nil {
+		return err
+	}
+
+	cfg, err := config.Load()
+	if err != nil {
+		return fmt.Errorf("加载配置失败: %w", err)
+	}
+	name := taskName(cfg)
+	if util.IsTaskExists(name) {
+		if err := util.DeleteTask(name); err != nil {
+			return fmt.Errorf("删除任务失败: %w（请以管理员权限运行）", err)
+		}
+	}
+	if _, err := config.Update(func(latest *config.Config) error {
+		if !latest.AutoCheckEnabled {
+			return config.ErrNoChanges
+		}
+		latest.AutoCheckEnabled = false
+		return nil
+	}); err != nil {
+		return fmt.Errorf("保存配置失败: %w", err)
+	}
+	fmt.Printf("已删除计划任务 %s\n", name)
+	return nil
+}
+
+// runTaskRun 立即运行计划任务
+func runTaskRun(args []string) error {
+	fs := newFlagSet("task run")
+	if _, err := parseFlags(fs, args); err != nil {
+		return err
+	}
+
+	cfg, err := config.Load()
+	if err != nil {
+		return fmt.Errorf("加载配置失败: %w", err)
+	}
+	name := taskName(cfg)
+	if !util.IsTaskExists(name) {
+		return fmt.Errorf("计划任务 %s 不存在，请先执行 task install", name)
+	}
+	if err := util.RunTaskNow(name); err != nil {
+		return fmt.Errorf("运行任务失败: %w", err)
+	}
+	fmt.Printf("已启动计划任务 %s，部署日志见 %s\n", name, config.GetLogDir())
+	return nil
+}
+
+// runDeploy 立即部署，日志输出到标准错误
+func runDeploy(args []string) error {
+	fs := newFlagSet("deploy")
+	orderID := fs.Int("order", 0, "只部署指定订单")
+	force := fs.Bool("force", false, "不受续签时间限制，立即部署")
+	if _, err := parseFlags(fs, args); err != nil {
+		return err
+	}
+	if *orderID < 0 {
+		return fmt.Errorf("无效的订单 ID: %d", *orderID)
+	}
+
+	log.SetOutput(os.Stderr)
+	results, err := deploy.Deploy("cli", deploy.DeployOptions{OrderID: *orderID, Force: *force})
+	if err != nil {
+		if deploy.IsAlreadyRunning(err) {
+			return errors.New("部署任务正在运行，请稍后再试")
+		}
+		return err
+	}
+	if len(results) == 0 {
+		fmt.Println("没有需要部署的证书")
+		return nil
+	}
+	return printResults(results)
+}
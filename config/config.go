@@ -6,72 +6,238 @@ import (
 	"net"
 	"os"
 	"path/filepath"
+	"time"
 )
 
 // DataDirName 数据目录名称
 const DataDirName = "CertDeploy"
 
+// 绑定规则类型
+const (
+	BindRuleHost    = ""        // 单个主机名（domain）
+	BindRuleSite    = "site"    // 站点 site_name 的所有 HTTPS 主机名
+	BindRulePattern = "pattern" // IIS 中匹配 domain（如 *.example.com）的所有 HTTPS 主机名
+)
+
 // BindRule 绑定规则
+// site/pattern 规则在部署时按 IIS 当前绑定展开为单个主机名，只包含证书覆盖的主机名
 type BindRule struct {
-	Domain   string `json:"domain"`    // 要绑定的域名
-	Port     int    `json:"port"`      // 端口，默认 443
-	SiteName string `json:"site_name"` // IIS 站点名称（可选，空则自动匹配）
+	Type       string      `json:"type,omitempty"`        // 规则类型，空为单个主机名
+	Domain     string      `json:"domain"`                // 要绑定的域名；pattern 规则为匹配模式
+	Port       int         `json:"port"`                  // 端口，默认 443；site 规则为 0 时不限端口
+	SiteName   string      `json:"site_name"`             // IIS 站点名称（可选，空则自动匹配；site 规则必填）
+	Exclude    []string    `json:"exclude,omitempty"`     // site/pattern：排除的主机名或通配符（如 admin.example.com、*.test.example.com）
+	ForceHTTPS *bool       `json:"force_https,omitempty"` // HTTP 跳转 HTTPS（nil 不管理，false 撤销）
+	HSTS       *HSTSConfig `json:"hsts,omitempty"`        // HSTS 响应头（nil 不管理）
+}
+
+// Expands 是否为部署时展开的规则（site/pattern）
+func (r BindRule) Expands() bool {
+	return r.Type == BindRuleSite || r.Type == BindRulePattern
+}
+
+// HSTSConfig HSTS 配置
+type HSTSConfig struct {
+	Enabled           bool `json:"enabled"` // false 表示撤销已写入的 HSTS 头
+	MaxAge            int  `json:"max_age"` // 秒，默认 31536000（一年）
+	IncludeSubDomains bool `json:"include_subdomains"`
+	Preload           bool `json:"preload"`
+}
+
+// HeaderValue 生成 Strict-Transport-Security 响应头的值（未启用时返回空）
+func (h *HSTSConfig) HeaderValue() string {
+	if h == nil || !h.Enabled {
+		return ""
+	}
+	maxAge := h.MaxAge
+	if maxAge <= 0 {
+		maxAge = 31536000
+	}
+	value := fmt.Sprintf("max-age=%d", maxAge)
+	if h.IncludeSubDomains {
+		value += "; includeSubDomains"
+	}
+	if h.Preload {
+		value += "; preload"
+	}
+	return value
 }
 
 // CertConfig 证书配置（以证书为维度）
 type CertConfig struct {
-	OrderID          int        `json:"order_id"`                     // 证书订单 ID
-	Domain           string     `json:"domain"`                       // 主域名（显示用）
-	Domains          []string   `json:"domains"`                      // 证书包含的所有域名
-	ExpiresAt        string     `json:"expires_at"`                   // 过期时间
-	SerialNumber     string     `json:"serial_number"`                // 证书序列号
-	Enabled          bool       `json:"enabled"`                      // 是否启用自动部署
-	BindRules        []BindRule `json:"bind_rules,omitempty"`         // 绑定规则
-	UseLocalKey      bool       `json:"use_local_key"`                // 使用本地私钥模式
-	ValidationMethod string     `json:"validation_method,omitempty"`  // 验证方法: file 或 delegation
-	AutoBindMode     bool       `json:"auto_bind_mode"`               // 自动绑定模式（按已有绑定更换证书）
+	OrderID          int          `json:"order_id"`                    // 证书订单 ID
+	Profile          string       `json:"profile,omitempty"`           // 使用的 API 配置名（空表示默认接口）
+	Domain           string       `json:"domain"`                      // 主域名（显示用）
+	Domains          []string     `json:"domains"`                     // 证书包含的所有域名
+	ExpiresAt        string       `json:"expires_at"`                  // 过期时间
+	SerialNumber     string       `json:"serial_number"`               // 证书序列号
+	Enabled          bool         `json:"enabled"`                     // 是否启用自动部署
+	BindRules        []BindRule   `json:"bind_rules,omitempty"`        // 绑定规则
+	UseLocalKey      bool         `json:"use_local_key"`               // 使用本地私钥模式
+	ValidationMethod string       `json:"validation_method,omitempty"` // 验证方法: file 或 delegation
+	AutoBindMode     bool         `json:"auto_bind_mode"`              // 自动绑定模式（按已有绑定更换证书）
+	AutoAddHTTPS     bool         `json:"auto_add_https,omitempty"`    // 自动绑定模式：为只有 HTTP 绑定的匹配站点添加 HTTPS 绑定
+	PostActions      []PostAction `json:"post_actions,omitempty"`      // 部署成功后依次执行的动作
+	Retention        *Retention   `json:"retention,omitempty"`         // 被替换证书的保留策略（nil 不清理）
+	Renewal          *Renewal     `json:"renewal,omitempty"`           // 续签时间（nil 使用全局 RenewDaysLocal/RenewDaysFetch）
+}
+
+// Renewal 单个证书的续签时间，覆盖全局配置
+// 本地私钥模式为发起续签的时间，拉取模式为开始拉取的时间
+type Renewal struct {
+	Days    int `json:"days,omitempty"`    // 到期前多少天
+	Percent int `json:"percent,omitempty"` // 剩余有效期不超过证书总有效期的百分之多少（1-99），优先于 Days
+}
+
+// Retention 被替换证书的保留策略，两个条件任一满足即删除
+type Retention struct {
+	KeepLast        int `json:"keep_last,omitempty"`         // 保留最近被替换的 N 个证书
+	DeleteAfterDays int `json:"delete_after_days,omitempty"` // 被替换 X 天后删除
+}
+
+// 部署后动作类型
+const (
+	PostActionRecyclePool = "recycle_pool" // 回收应用程序池
+	PostActionRestartSite = "restart_site" // 重启站点
+	PostActionStartSite   = "start_site"   // 站点未运行时启动
+	PostActionScript      = "script"       // 执行 PowerShell 脚本或可执行文件
+)
+
+// PostAction 部署后动作
+type PostAction struct {
+	Type    string   `json:"type"`              // 动作类型
+	Target  string   `json:"target,omitempty"`  // 应用程序池或站点名称
+	Command string   `json:"command,omitempty"` // script: 脚本（.ps1/.bat/.cmd）或可执行文件的绝对路径
+	Args    []string `json:"args,omitempty"`    // script: 命令参数
+	Timeout int      `json:"timeout,omitempty"` // 超时（秒），默认 60
 }
 
 // Config 应用配置
 type Config struct {
-	APIBaseURL       string       `json:"api_base_url"`
-	Token            string       `json:"token,omitempty"`             // 旧版明文 Token（兼容）
-	EncryptedToken   string       `json:"encrypted_token,omitempty"`  // 加密后的 Token
-	Certificates     []CertConfig `json:"certificates"`                // 证书配置
-	RenewDaysLocal   int          `json:"renew_days_local"`            // 本地私钥模式：到期前多少天发起续签（默认15）
-	RenewDaysFetch   int          `json:"renew_days_fetch"`            // 拉取模式：到期前多少天开始拉取（默认13）
-	LastCheck        string       `json:"last_check"`                  // 上次检查时间
-	AutoCheckEnabled bool         `json:"auto_check_enabled"`          // 是否启用自动部署（任务计划）
-	CheckInterval    int          `json:"check_interval"`              // 检测间隔（小时），默认6
-	TaskName         string       `json:"task_name"`                   // 任务计划名称
-	IIS7Mode         bool         `json:"iis7_mode"`                   // IIS7 兼容模式（自动检测）
+	SchemaVersion    int           `json:"schema_version"` // 配置结构版本（见 migrate.go）
+	Revision         int64         `json:"revision"`       // 修订号，每次保存加一，用于检测并发修改
+	APIBaseURL       string        `json:"api_base_url"`
+	Token            string        `json:"token,omitempty"`             // 旧版明文 Token（兼容）
+	EncryptedToken   string        `json:"encrypted_token,omitempty"`  // 加密后的 Token
+	Profiles         []APIProfile  `json:"profiles,omitempty"`          // 其他部署接口，证书通过 profile 引用
+	Certificates     []CertConfig  `json:"certificates"`                // 证书配置
+	RenewDaysLocal   int           `json:"renew_days_local"`            // 本地私钥模式：到期前多少天发起续签（默认15）
+	RenewDaysFetch   int           `json:"renew_days_fetch"`            // 拉取模式：到期前多少天开始拉取（默认13）
+	LastCheck        string        `json:"last_check"`                  // 上次检查时间
+	AutoCheckEnabled bool          `json:"auto_check_enabled"`          // 是否启用自动部署（任务计划）
+	CheckInterval    int           `json:"check_interval"`              // 检测间隔（小时），默认6
+	TaskName         string        `json:"task_name"`                   // 任务计划名称
+	IIS7Mode         bool          `json:"iis7_mode"`                   // IIS7 兼容模式（自动检测）
+	SkipTLSCheck     bool          `json:"skip_tls_check,omitempty"`    // 部署后跳过本机 TLS 握手校验
+	Workers          int           `json:"workers,omitempty"`           // 并发处理的证书数，默认 4
+	CertTimeout      int           `json:"cert_timeout,omitempty"`      // 单个证书的部署时限（秒），默认 600
+	Notify           *NotifyConfig `json:"notify,omitempty"`            // 部署结果和过期提醒通知（nil 不通知）
+}
+
+// DefaultProfile 默认 API 配置名，对应顶层的 api_base_url 和 token
+const DefaultProfile = "default"
+
+// APIProfile 部署接口配置（一台服务器部署多个账户或多个平台的证书）
+type APIProfile struct {
+	Name           string `json:"name"`
+	APIBaseURL     string `json:"api_base_url"`
+	Token          string `json:"token,omitempty"`           // 明文 Token（兼容手工编辑）
+	EncryptedToken string `json:"encrypted_token,omitempty"` // 加密后的 Token
+}
+
+func (p *APIProfile) tokenField() secretField {
+	return secretField{name: "API 配置 " + p.Name + " 的 Token", plain: &p.Token, encrypted: &p.EncryptedToken}
 }
 
 // GetToken 获取解密后的 Token
-func (c *Config) GetToken() string {
-	if c.EncryptedToken != "" {
-		if decrypted, err := DecryptToken(c.EncryptedToken); err == nil {
-			return decrypted
-		}
+func (p *APIProfile) GetToken() (string, error) {
+	return p.tokenField().get()
+}
+
+// SetToken 加密（计算机范围）并设置 Token
+func (p *APIProfile) SetToken(token string) error {
+	return p.tokenField().set(token)
+}
+
+// ProfileName 规范化证书引用的 API 配置名，空为 default
+func ProfileName(profile string) string {
+	if profile == "" {
+		return DefaultProfile
 	}
-	return c.Token
+	return profile
 }
 
-// SetToken 加密并设置 Token
-func (c *Config) SetToken(token string) error {
-	encrypted, err := EncryptToken(token)
-	if err != nil {
-		// 加密失败，返回错误而不是回退到明文存储
-		return fmt.Errorf("Token 加密失败: %w", err)
+// GetProfile 按名称获取 API 配置，default 或不存在时返回 nil
+func (c *Config) GetProfile(name string) *APIProfile {
+	for i := range c.Profiles {
+		if c.Profiles[i].Name == name {
+			return &c.Profiles[i]
+		}
 	}
-	c.EncryptedToken = encrypted
-	c.Token = "" // 清除明文
 	return nil
 }
 
+// API 返回 API 配置的接口地址和解密后的 Token，profile 为空或 default 时使用顶层配置
+func (c *Config) API(profile string) (string, string, error) {
+	name := ProfileName(profile)
+	if name == DefaultProfile {
+		token, err := c.GetToken()
+		return c.APIBaseURL, token, err
+	}
+	p := c.GetProfile(name)
+	if p == nil {
+		return "", "", fmt.Errorf("API 配置 %s 不存在", name)
+	}
+	token, err := p.GetToken()
+	return p.APIBaseURL, token, err
+}
+
+// 并发与时限默认值
+const (
+	DefaultWorkers     = 4
+	MaxWorkers         = 32
+	DefaultCertTimeout = 600
+)
+
+// WorkerCount 并发处理的证书数
+func (c *Config) WorkerCount() int {
+	if c.Workers <= 0 {
+		return DefaultWorkers
+	}
+	if c.Workers > MaxWorkers {
+		return MaxWorkers
+	}
+	return c.Workers
+}
+
+// CertDeadline 单个证书的部署时限
+func (c *Config) CertDeadline() time.Duration {
+	if c.CertTimeout <= 0 {
+		return DefaultCertTimeout * time.Second
+	}
+	return time.Duration(c.CertTimeout) * time.Second
+}
+
+// tokenField Token 的明文字段和加密字段
+func (c *Config) tokenField() secretField {
+	return secretField{name: "Token", plain: &c.Token, encrypted: &c.EncryptedToken}
+}
+
+// GetToken 获取解密后的 Token
+// 已加密但当前账户无法解密时返回错误，不回退到明文字段
+func (c *Config) GetToken() (string, error) {
+	return c.tokenField().get()
+}
+
+// SetToken 加密（计算机范围）并设置 Token
+func (c *Config) SetToken(token string) error {
+	return c.tokenField().set(token)
+}
+
 // DefaultConfig 默认配置
 func DefaultConfig() *Config {
 	return &Config{
+		SchemaVersion:    CurrentSchemaVersion,
 		APIBaseURL:       "",
 		Token:            "",
 		Certificates:     []CertConfig{},
@@ -112,49 +278,79 @@ func GetLogDir() string {
 }
 
 // Load 加载配置
+// 配置文件损坏时从最新的有效备份恢复；迁移、恢复或密钥重新加密后立即保存
 func Load() (*Config, error) {
+	cfg, dirty, err := loadFile()
+	if err != nil || !dirty {
+		return cfg, err
+	}
+
+	// 需要写回时在配置锁内重新加载，避免与其他进程的保存交错
+	lock, err := lockConfig()
+	if err != nil {
+		return nil, err
+	}
+	defer lock.Release()
+	cfg, dirty, err = loadFile()
+	if err != nil || !dirty {
+		return cfg, err
+	}
+	if err := cfg.saveLocked(); err != nil {
+		return nil, fmt.Errorf("保存迁移后的配置失败: %w", err)
+	}
+	return cfg, nil
+}
+
+// loadFile 读取并解析配置文件，dirty 表示内容有变化需要保存
+func loadFile() (*Config, bool, error) {
 	path := GetConfigPath()
 
 	data, err := os.ReadFile(path)
 	if err != nil {
 		if os.IsNotExist(err) {
-			return DefaultConfig(), nil
+			return DefaultConfig(), false, nil
 		}
-		return nil, err
+		return nil, false, err
 	}
 
-	var cfg Config
-	if err := json.Unmarshal(data, &cfg); err != nil {
-		return nil, err
+	recovered := false
+	if _, err := decodeRaw(data); err != nil {
+		data, err = recoverFromBackup(path, err)
+		if err != nil {
+			return nil, false, err
+		}
+		recovered = true
 	}
 
-	// 设置默认值（不设置 APIBaseURL 和 Token 的默认值，由用户配置）
-	if cfg.RenewDaysLocal == 0 {
-		cfg.RenewDaysLocal = 15 // 本地私钥模式：到期前15天发起续签
-	}
-	if cfg.RenewDaysFetch == 0 {
-		cfg.RenewDaysFetch = 13 // 拉取模式：到期前13天开始拉取
+	// 旧版本配置按顺序迁移（先备份原文件），比程序新的配置拒绝加载
+	migrated, err := migrateConfig(path, data)
+	if err != nil {
+		return nil, false, err
 	}
-	if cfg.CheckInterval == 0 {
-		cfg.CheckInterval = 6
+	if migrated != nil {
+		data = migrated
 	}
-	if cfg.TaskName == "" {
-		cfg.TaskName = "CertDeployIIS"
+
+	var cfg Config
+	if err := json.Unmarshal(data, &cfg); err != nil {
+		return nil, false, err
 	}
 
-	return &cfg, nil
+	// 旧版按用户加密的密钥重新加密为计算机范围，计划任务（SYSTEM）也能解密
+	upgraded := cfg.UpgradeSecrets()
+
+	return &cfg, recovered || migrated != nil || upgraded, nil
 }
 
 // Save 保存配置
+// 磁盘上的配置在加载后已被其他进程或窗口保存过时返回 ErrConfigConflict，不覆盖
 func (c *Config) Save() error {
-	path := GetConfigPath()
-
-	data, err := json.MarshalIndent(c, "", "  ")
+	lock, err := lockConfig()
 	if err != nil {
 		return err
 	}
-
-	return os.WriteFile(path, data, 0600)
+	defer lock.Release()
+	return c.saveLocked()
 }
 
 // AddCertificate 添加证书配置
@@ -2,85 +2,147 @@ package config
 
 import (
 	"encoding/base64"
-	"syscall"
-	"unsafe"
+	"errors"
+	"fmt"
+	"strings"
 )
 
-var (
-	dllCrypt32  = syscall.NewLazyDLL("Crypt32.dll")
-	dllKernel32 = syscall.NewLazyDLL("Kernel32.dll")
-
-	procEncryptData = dllCrypt32.NewProc("CryptProtectData")
-	procDecryptData = dllCrypt32.NewProc("CryptUnprotectData")
-	procLocalFree   = dllKernel32.NewProc("LocalFree")
+// DPAPI 标志
+const (
+	cryptProtectUIForbidden  = 0x1
+	cryptProtectLocalMachine = 0x4
 )
 
-type dataBlob struct {
-	cbData uint32
-	pbData *byte
-}
+// machineSecretPrefix 计算机范围加密数据的前缀
+// 无前缀的旧数据为当前用户范围、无附加熵，只有加密它的 Windows 用户能解密
+const machineSecretPrefix = "dpapi-machine:"
+
+// secretEntropy 附加熵，同一计算机上的其他程序调用 DPAPI 无法直接解密本程序的数据
+var secretEntropy = []byte("cert-deploy-iis/config-secret/v1")
 
-// EncryptToken 使用 DPAPI 加密 Token
-func EncryptToken(plaintext string) (string, error) {
+// ErrUserScopedSecret 旧版按用户加密的数据无法被当前账户解密（如计划任务以 SYSTEM 运行）
+var ErrUserScopedSecret = errors.New("数据由其他 Windows 用户加密，当前账户无法解密，请在 GUI 中重新保存")
+
+// EncryptSecret 使用 DPAPI 计算机范围加密配置中的密钥（Token、SMTP 密码等）
+// 本机任何账户（GUI 用户、计划任务的 SYSTEM）都能解密，复制到其他计算机无法解密
+func EncryptSecret(plaintext string) (string, error) {
 	if plaintext == "" {
 		return "", nil
 	}
-
-	input := []byte(plaintext)
-	inputBlob := dataBlob{
-		cbData: uint32(len(input)),
-		pbData: &input[0],
-	}
-
-	var outputBlob dataBlob
-	r, _, err := procEncryptData.Call(
-		uintptr(unsafe.Pointer(&inputBlob)),
-		0, 0, 0, 0,
-		0,
-		uintptr(unsafe.Pointer(&outputBlob)),
-	)
-	if r == 0 {
+	output, err := dpapiProtect([]byte(plaintext), secretEntropy, cryptProtectLocalMachine|cryptProtectUIForbidden)
+	if err != nil {
 		return "", err
 	}
-	defer procLocalFree.Call(uintptr(unsafe.Pointer(outputBlob.pbData)))
-
-	output := make([]byte, outputBlob.cbData)
-	copy(output, unsafe.Slice(outputBlob.pbData, outputBlob.cbData))
-
-	return base64.StdEncoding.EncodeToString(output), nil
+	return machineSecretPrefix + base64.StdEncoding.EncodeToString(output), nil
 }
 
-// DecryptToken 使用 DPAPI 解密 Token
-func DecryptToken(encrypted string) (string, error) {
+// DecryptSecret 解密 EncryptSecret 的结果，兼容旧版按用户加密的数据
+func DecryptSecret(encrypted string) (string, error) {
 	if encrypted == "" {
 		return "", nil
 	}
 
+	if IsMachineScoped(encrypted) {
+		input, err := base64.StdEncoding.DecodeString(strings.TrimPrefix(encrypted, machineSecretPrefix))
+		if err != nil {
+			return "", fmt.Errorf("加密数据格式错误: %w", err)
+		}
+		output, err := dpapiUnprotect(input, secretEntropy)
+		if err != nil {
+			return "", fmt.Errorf("解密失败（数据可能来自其他计算机）: %w", err)
+		}
+		return string(output), nil
+	}
+
+	// 旧版：当前用户范围、无附加熵
 	input, err := base64.StdEncoding.DecodeString(encrypted)
 	if err != nil {
-		// 可能是旧版明文 Token，直接返回
-		return encrypted, nil
+		return "", fmt.Errorf("加密数据格式错误: %w", err)
+	}
+	output, err := dpapiUnprotect(input, nil)
+	if err != nil {
+		return "", fmt.Errorf("%w: %v", ErrUserScopedSecret, err)
 	}
+	return string(output), nil
+}
 
-	inputBlob := dataBlob{
-		cbData: uint32(len(input)),
-		pbData: &input[0],
+// IsMachineScoped 加密数据是否为计算机范围
+func IsMachineScoped(encrypted string) bool {
+	return strings.HasPrefix(encrypted, machineSecretPrefix)
+}
+
+// secretField 配置中一项加密存储的密钥
+// plain 为兼容旧版/手工编辑的明文字段，encrypted 为加密字段，两者只保留一个
+type secretField struct {
+	name      string
+	plain     *string
+	encrypted *string
+}
+
+// get 读取密钥：有加密值时必须能解密，不回退到明文字段
+func (f secretField) get() (string, error) {
+	if *f.encrypted != "" {
+		value, err := DecryptSecret(*f.encrypted)
+		if err != nil {
+			return "", fmt.Errorf("解密%s失败: %w", f.name, err)
+		}
+		return value, nil
+	}
+	return *f.plain, nil
+}
+
+// set 加密并保存密钥，清除明文
+func (f secretField) set(value string) error {
+	encrypted, err := EncryptSecret(value)
+	if err != nil {
+		// 加密失败，返回错误而不是回退到明文存储
+		return fmt.Errorf("%s加密失败: %w", f.name, err)
 	}
+	*f.encrypted = encrypted
+	*f.plain = ""
+	return nil
+}
 
-	var outputBlob dataBlob
-	r, _, err := procDecryptData.Call(
-		uintptr(unsafe.Pointer(&inputBlob)),
-		0, 0, 0, 0, 0,
-		uintptr(unsafe.Pointer(&outputBlob)),
-	)
-	if r == 0 {
-		// 解密失败，可能是明文 Token
-		return encrypted, nil
+// upgrade 把旧版按用户加密的数据重新加密为计算机范围
+// 当前账户无法解密的旧数据保持不变（读取时报错，提示在 GUI 中重新保存）
+// 明文字段在配置迁移（migrateV2、migrateV3）时加密，之后手工填写的明文保持兼容
+func (f secretField) upgrade() bool {
+	if *f.encrypted == "" || IsMachineScoped(*f.encrypted) {
+		return false
 	}
-	defer procLocalFree.Call(uintptr(unsafe.Pointer(outputBlob.pbData)))
+	value, err := DecryptSecret(*f.encrypted)
+	if err != nil {
+		return false
+	}
+	return f.set(value) == nil
+}
 
-	output := make([]byte, outputBlob.cbData)
-	copy(output, unsafe.Slice(outputBlob.pbData, outputBlob.cbData))
+// secretFields 配置中所有加密存储的密钥，新增密钥字段时在此登记
+func (c *Config) secretFields() []secretField {
+	fields := []secretField{c.tokenField()}
+	for i := range c.Profiles {
+		fields = append(fields, c.Profiles[i].tokenField())
+	}
+	if c.Notify != nil {
+		for i := range c.Notify.Channels {
+			ch := &c.Notify.Channels[i]
+			fields = append(fields, ch.urlField(), ch.signSecretField())
+			if ch.SMTP != nil {
+				fields = append(fields, ch.SMTP.secretField("通知渠道 "+ch.Name+" 的 SMTP 密码"))
+			}
+		}
+	}
+	return fields
+}
 
-	return string(output), nil
+// UpgradeSecrets 把配置中旧版按用户加密的密钥重新加密为计算机范围
+// 返回是否有修改（需要保存）
+func (c *Config) UpgradeSecrets() bool {
+	changed := false
+	for _, f := range c.secretFields() {
+		if f.upgrade() {
+			changed = true
+		}
+	}
+	return changed
 }
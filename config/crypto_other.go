@@ -0,0 +1,24 @@
+//go:build !windows
+
+package config
+
+import (
+	"bytes"
+	"errors"
+)
+
+// 非 Windows 平台没有 DPAPI，以下实现只用于在其他平台运行单元测试，不提供任何保护
+// 输出为附加熵加明文，解密时校验附加熵，与 DPAPI 一样区分计算机范围和旧版用户范围的数据
+
+// dpapiProtect 测试用替身：附加熵 + 明文
+func dpapiProtect(data, entropy []byte, flags uintptr) ([]byte, error) {
+	return append(append([]byte{}, entropy...), data...), nil
+}
+
+// dpapiUnprotect 测试用替身：附加熵不匹配时失败
+func dpapiUnprotect(data, entropy []byte) ([]byte, error) {
+	if !bytes.HasPrefix(data, entropy) {
+		return nil, errors.New("附加熵不匹配")
+	}
+	return append([]byte{}, data[len(entropy):]...), nil
+}
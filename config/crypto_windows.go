@@ -0,0 +1,79 @@
+package config
+
+import (
+	"syscall"
+	"unsafe"
+)
+
+var (
+	dllCrypt32  = syscall.NewLazyDLL("Crypt32.dll")
+	dllKernel32 = syscall.NewLazyDLL("Kernel32.dll")
+
+	procEncryptData = dllCrypt32.NewProc("CryptProtectData")
+	procDecryptData = dllCrypt32.NewProc("CryptUnprotectData")
+	procLocalFree   = dllKernel32.NewProc("LocalFree")
+)
+
+type dataBlob struct {
+	cbData uint32
+	pbData *byte
+}
+
+func newBlob(data []byte) *dataBlob {
+	if len(data) == 0 {
+		return &dataBlob{}
+	}
+	return &dataBlob{cbData: uint32(len(data)), pbData: &data[0]}
+}
+
+func (b *dataBlob) bytes() []byte {
+	output := make([]byte, b.cbData)
+	copy(output, unsafe.Slice(b.pbData, b.cbData))
+	return output
+}
+
+// dpapiProtect 调用 CryptProtectData
+func dpapiProtect(data, entropy []byte, flags uintptr) ([]byte, error) {
+	var entropyBlob *dataBlob
+	if len(entropy) > 0 {
+		entropyBlob = newBlob(entropy)
+	}
+
+	var outputBlob dataBlob
+	r, _, err := procEncryptData.Call(
+		uintptr(unsafe.Pointer(newBlob(data))),
+		0,
+		uintptr(unsafe.Pointer(entropyBlob)),
+		0, 0,
+		flags,
+		uintptr(unsafe.Pointer(&outputBlob)),
+	)
+	if r == 0 {
+		return nil, err
+	}
+	defer procLocalFree.Call(uintptr(unsafe.Pointer(outputBlob.pbData)))
+	return outputBlob.bytes(), nil
+}
+
+// dpapiUnprotect 调用 CryptUnprotectData
+func dpapiUnprotect(data, entropy []byte) ([]byte, error) {
+	var entropyBlob *dataBlob
+	if len(entropy) > 0 {
+		entropyBlob = newBlob(entropy)
+	}
+
+	var outputBlob dataBlob
+	r, _, err := procDecryptData.Call(
+		uintptr(unsafe.Pointer(newBlob(data))),
+		0,
+		uintptr(unsafe.Pointer(entropyBlob)),
+		0, 0,
+		cryptProtectUIForbidden,
+		uintptr(unsafe.Pointer(&outputBlob)),
+	)
+	if r == 0 {
+		return nil, err
+	}
+	defer procLocalFree.Call(uintptr(unsafe.Pointer(outputBlob.pbData)))
+	return outputBlob.bytes(), nil
+}
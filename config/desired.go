@@ -0,0 +1,428 @@
+package config
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"reflect"
+	"sort"
+	"strings"
+
+	"cert-deploy/util"
+
+	"gopkg.in/yaml.v3"
+)
+
+// DesiredState 声明式配置文件（-apply），描述服务器应有的部署配置
+// 同一份文件可以下发到多台服务器，重复应用结果相同；文件中不保存 Token
+type DesiredState struct {
+	Profiles       []DesiredProfile `json:"profiles,omitempty"`         // API 配置，名称 default 对应顶层接口
+	Certificates   []DesiredCert    `json:"certificates"`               // 证书配置
+	RenewDaysLocal int              `json:"renew_days_local,omitempty"` // 为 0 时不修改
+	RenewDaysFetch int              `json:"renew_days_fetch,omitempty"` // 为 0 时不修改
+	Schedule       *DesiredSchedule `json:"schedule,omitempty"`         // 计划任务（nil 不管理）
+	Prune          bool             `json:"prune,omitempty"`            // 删除文件中没有的证书和 API 配置
+}
+
+// DesiredProfile 声明式 API 配置，Token 只能从环境变量或文件读取
+// 两者都不设置时保留服务器上已保存的 Token
+type DesiredProfile struct {
+	Name       string `json:"name"`
+	APIBaseURL string `json:"api_base_url"`
+	TokenEnv   string `json:"token_env,omitempty"`  // 保存 Token 的环境变量名
+	TokenFile  string `json:"token_file,omitempty"` // 保存 Token 的文件路径（如部署工具下发的临时文件）
+}
+
+// DesiredCert 声明式证书配置，字段含义与 CertConfig 相同
+// 过期时间、序列号等运行时字段由程序维护，不在文件中声明
+type DesiredCert struct {
+	OrderID          int          `json:"order_id"`
+	Profile          string       `json:"profile,omitempty"`
+	Domain           string       `json:"domain"`
+	Domains          []string     `json:"domains,omitempty"` // 为空时只包含 domain
+	Enabled          *bool        `json:"enabled,omitempty"` // 默认启用
+	UseLocalKey      bool         `json:"use_local_key,omitempty"`
+	ValidationMethod string       `json:"validation_method,omitempty"`
+	AutoBindMode     bool         `json:"auto_bind_mode,omitempty"`
+	AutoAddHTTPS     bool         `json:"auto_add_https,omitempty"`
+	BindRules        []BindRule   `json:"bind_rules,omitempty"`
+	PostActions      []PostAction `json:"post_actions,omitempty"`
+	Retention        *Retention   `json:"retention,omitempty"`
+	Renewal          *Renewal     `json:"renewal,omitempty"`
+}
+
+// DesiredSchedule 计划任务
+type DesiredSchedule struct {
+	Enabled  bool   `json:"enabled"`
+	Interval int    `json:"interval,omitempty"`  // 检测间隔（小时），为 0 时不修改
+	TaskName string `json:"task_name,omitempty"` // 为空时不修改
+}
+
+// 变更类型
+const (
+	ChangeAdd    = "+"
+	ChangeUpdate = "~"
+	ChangeRemove = "-"
+)
+
+// Change 应用声明式配置产生的一项变更
+type Change struct {
+	Op     string `json:"op"`
+	Target string `json:"target"`
+	Detail string `json:"detail,omitempty"`
+}
+
+// String 输出为 "~ 证书 example.com（订单 123）: enabled: true => false"
+func (c Change) String() string {
+	if c.Detail == "" {
+		return c.Op + " " + c.Target
+	}
+	return c.Op + " " + c.Target + ": " + c.Detail
+}
+
+// LoadDesiredState 读取声明式配置文件，.yaml/.yml 按 YAML 解析，其他按 JSON 解析
+// 未知字段和明文 Token 报错
+func LoadDesiredState(path string) (*DesiredState, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("读取声明式配置失败: %w", err)
+	}
+
+	switch strings.ToLower(filepath.Ext(path)) {
+	case ".yaml", ".yml":
+		var doc interface{}
+		if err := yaml.Unmarshal(data, &doc); err != nil {
+			return nil, fmt.Errorf("解析 YAML 失败: %w", err)
+		}
+		if data, err = json.Marshal(doc); err != nil {
+			return nil, fmt.Errorf("转换 YAML 失败: %w", err)
+		}
+	}
+
+	raw, err := decodeRaw(data)
+	if err != nil {
+		return nil, fmt.Errorf("解析声明式配置失败: %w", err)
+	}
+	if err := checkNoPlainToken(raw); err != nil {
+		return nil, err
+	}
+
+	var d DesiredState
+	decoder := json.NewDecoder(bytes.NewReader(data))
+	decoder.DisallowUnknownFields()
+	if err := decoder.Decode(&d); err != nil {
+		return nil, fmt.Errorf("解析声明式配置失败: %w", err)
+	}
+	if err := d.validate(); err != nil {
+		return nil, err
+	}
+	return &d, nil
+}
+
+// checkNoPlainToken 声明式配置不允许包含 Token（明文或本机加密值）
+func checkNoPlainToken(raw map[string]interface{}) error {
+	const hint = "声明式配置不能包含 Token，请使用 token_env 或 token_file"
+	for _, key := range []string{"token", "encrypted_token"} {
+		if _, ok := raw[key]; ok {
+			return fmt.Errorf("%s（顶层 %s）", hint, key)
+		}
+	}
+	profiles, _ := raw["profiles"].([]interface{})
+	for i, p := range profiles {
+		profile, _ := p.(map[string]interface{})
+		for _, key := range []string{"token", "encrypted_token"} {
+			if _, ok := profile[key]; ok {
+				return fmt.Errorf("%s（profiles[%d].%s）", hint, i, key)
+			}
+		}
+	}
+	return nil
+}
+
+// validate 检查必填字段和重复项
+func (d *DesiredState) validate() error {
+	names := make(map[string]bool)
+	for i, p := range d.Profiles {
+		if p.Name == "" {
+			return fmt.Errorf("profiles[%d]: 缺少 name", i)
+		}
+		if names[p.Name] {
+			return fmt.Errorf("profiles[%d]: API 配置 %s 重复", i, p.Name)
+		}
+		names[p.Name] = true
+		if p.TokenEnv != "" && p.TokenFile != "" {
+			return fmt.Errorf("API 配置 %s: token_env 和 token_file 只能设置一个", p.Name)
+		}
+	}
+
+	orders := make(map[int]bool)
+	for i, c := range d.Certificates {
+		if c.OrderID <= 0 {
+			return fmt.Errorf("certificates[%d]: 缺少 order_id", i)
+		}
+		if c.Domain == "" {
+			return fmt.Errorf("certificates[%d]: 缺少 domain", i)
+		}
+		if orders[c.OrderID] {
+			return fmt.Errorf("certificates[%d]: 订单 %d 重复", i, c.OrderID)
+		}
+		orders[c.OrderID] = true
+	}
+
+	if d.Schedule != nil && d.Schedule.TaskName != "" {
+		if err := util.ValidateTaskName(d.Schedule.TaskName); err != nil {
+			return fmt.Errorf("schedule.task_name: %w", err)
+		}
+	}
+	return nil
+}
+
+// readToken 从环境变量或文件读取 Token，未设置来源时返回 false
+func (p DesiredProfile) readToken() (string, bool, error) {
+	switch {
+	case p.TokenEnv != "":
+		token := strings.TrimSpace(os.Getenv(p.TokenEnv))
+		if token == "" {
+			return "", false, fmt.Errorf("API 配置 %s: 环境变量 %s 未设置", p.Name, p.TokenEnv)
+		}
+		return token, true, nil
+	case p.TokenFile != "":
+		data, err := os.ReadFile(p.TokenFile)
+		if err != nil {
+			return "", false, fmt.Errorf("API 配置 %s: 读取 Token 文件失败: %w", p.Name, err)
+		}
+		token := strings.TrimSpace(string(data))
+		if token == "" {
+			return "", false, fmt.Errorf("API 配置 %s: Token 文件为空", p.Name)
+		}
+		return token, true, nil
+	}
+	return "", false, nil
+}
+
+// toCertConfig 在已有配置上应用声明的字段，保留过期时间、序列号等运行时字段
+func (dc DesiredCert) toCertConfig(existing *CertConfig) CertConfig {
+	var c CertConfig
+	if existing != nil {
+		c = *existing
+	} else {
+		c.OrderID = dc.OrderID
+	}
+	c.Profile = dc.Profile
+	if c.Profile == DefaultProfile {
+		c.Profile = ""
+	}
+	c.Domain = dc.Domain
+	c.Domains = dc.Domains
+	if len(c.Domains) == 0 {
+		c.Domains = []string{dc.Domain}
+	}
+	c.Enabled = dc.Enabled == nil || *dc.Enabled
+	c.UseLocalKey = dc.UseLocalKey
+	c.ValidationMethod = dc.ValidationMethod
+	c.AutoBindMode = dc.AutoBindMode
+	c.AutoAddHTTPS = dc.AutoAddHTTPS
+	c.BindRules = make([]BindRule, len(dc.BindRules))
+	for i, rule := range dc.BindRules {
+		if rule.Port == 0 && !rule.Expands() {
+			rule.Port = 443
+		}
+		c.BindRules[i] = rule
+	}
+	if len(c.BindRules) == 0 {
+		c.BindRules = nil
+	}
+	c.PostActions = dc.PostActions
+	c.Retention = dc.Retention
+	c.Renewal = dc.Renewal
+	return c
+}
+
+// ApplyDesired 把声明式配置合并到 cfg，返回变更列表（没有变更时为空）
+// 证书先按订单 ID 匹配，再按主域名匹配（本地私钥模式续签后订单 ID 会变化，保留新订单 ID）
+// 变更明细不包含 Token
+func ApplyDesired(cfg *Config, d *DesiredState) ([]Change, error) {
+	var changes []Change
+
+	// API 配置
+	keep := make(map[string]bool)
+	for _, dp := range d.Profiles {
+		keep[dp.Name] = true
+		target := "API 配置 " + dp.Name
+
+		token, hasToken, err := dp.readToken()
+		if err != nil {
+			return nil, err
+		}
+
+		var baseURL *string
+		var field secretField
+		added := false
+		if dp.Name == DefaultProfile {
+			baseURL, field = &cfg.APIBaseURL, cfg.tokenField()
+		} else {
+			p := cfg.GetProfile(dp.Name)
+			if p == nil {
+				cfg.Profiles = append(cfg.Profiles, APIProfile{Name: dp.Name})
+				p = &cfg.Profiles[len(cfg.Profiles)-1]
+				added = true
+				changes = append(changes, Change{Op: ChangeAdd, Target: target, Detail: dp.APIBaseURL})
+			}
+			baseURL, field = &p.APIBaseURL, p.tokenField()
+		}
+
+		if *baseURL != dp.APIBaseURL {
+			if !added {
+				changes = append(changes, Change{Op: ChangeUpdate, Target: target, Detail: fmt.Sprintf("api_base_url: %s => %s", *baseURL, dp.APIBaseURL)})
+			}
+			*baseURL = dp.APIBaseURL
+		}
+		if hasToken {
+			// 无法解密的旧 Token 视为不同，重新加密保存
+			if current, err := field.get(); err != nil || current != token {
+				if err := field.set(token); err != nil {
+					return nil, err
+				}
+				changes = append(changes, Change{Op: ChangeUpdate, Target: target, Detail: "Token 已更新"})
+			}
+		}
+	}
+	if d.Prune {
+		profiles := cfg.Profiles[:0]
+		for _, p := range cfg.Profiles {
+			if keep[p.Name] {
+				profiles = append(profiles, p)
+				continue
+			}
+			changes = append(changes, Change{Op: ChangeRemove, Target: "API 配置 " + p.Name})
+		}
+		cfg.Profiles = profiles
+	}
+
+	// 证书引用的 API 配置必须存在
+	for _, dc := range d.Certificates {
+		if name := ProfileName(dc.Profile); name != DefaultProfile && cfg.GetProfile(name) == nil {
+			return nil, fmt.Errorf("证书 %s: API 配置 %s 不存在", dc.Domain, name)
+		}
+	}
+
+	// 证书
+	matched := make(map[int]bool) // 已匹配的现有证书索引
+	for _, dc := range d.Certificates {
+		index := -1
+		for i := range cfg.Certificates {
+			if !matched[i] && cfg.Certificates[i].OrderID == dc.OrderID {
+				index = i
+				break
+			}
+		}
+		if index < 0 {
+			for i := range cfg.Certificates {
+				if !matched[i] && util.EqualDomain(cfg.Certificates[i].Domain, dc.Domain) {
+					index = i
+					break
+				}
+			}
+		}
+
+		if index < 0 {
+			c := dc.toCertConfig(nil)
+			cfg.Certificates = append(cfg.Certificates, c)
+			matched[len(cfg.Certificates)-1] = true
+			changes = append(changes, Change{Op: ChangeAdd, Target: certTarget(c)})
+			continue
+		}
+
+		matched[index] = true
+		old := cfg.Certificates[index]
+		c := dc.toCertConfig(&old)
+		if diff := diffFields(old, c); len(diff) > 0 {
+			cfg.Certificates[index] = c
+			changes = append(changes, Change{Op: ChangeUpdate, Target: certTarget(c), Detail: strings.Join(diff, "; ")})
+		}
+	}
+	if d.Prune {
+		certs := make([]CertConfig, 0, len(cfg.Certificates))
+		for i, c := range cfg.Certificates {
+			if matched[i] {
+				certs = append(certs, c)
+				continue
+			}
+			changes = append(changes, Change{Op: ChangeRemove, Target: certTarget(c)})
+		}
+		cfg.Certificates = certs
+	}
+
+	// 续签时间和计划任务
+	setInt := func(target string, field *int, value int) {
+		if value > 0 && *field != value {
+			changes = append(changes, Change{Op: ChangeUpdate, Target: target, Detail: fmt.Sprintf("%d => %d", *field, value)})
+			*field = value
+		}
+	}
+	setInt("renew_days_local", &cfg.RenewDaysLocal, d.RenewDaysLocal)
+	setInt("renew_days_fetch", &cfg.RenewDaysFetch, d.RenewDaysFetch)
+	if s := d.Schedule; s != nil {
+		if cfg.AutoCheckEnabled != s.Enabled {
+			changes = append(changes, Change{Op: ChangeUpdate, Target: "schedule.enabled", Detail: fmt.Sprintf("%v => %v", cfg.AutoCheckEnabled, s.Enabled)})
+			cfg.AutoCheckEnabled = s.Enabled
+		}
+		setInt("schedule.interval", &cfg.CheckInterval, s.Interval)
+		if s.TaskName != "" && cfg.TaskName != s.TaskName {
+			changes = append(changes, Change{Op: ChangeUpdate, Target: "schedule.task_name", Detail: fmt.Sprintf("%s => %s", cfg.TaskName, s.TaskName)})
+			cfg.TaskName = s.TaskName
+		}
+	}
+
+	return changes, nil
+}
+
+func certTarget(c CertConfig) string {
+	return fmt.Sprintf("证书 %s（订单 %d）", c.Domain, c.OrderID)
+}
+
+// diffFields 按 JSON 字段比较两个证书配置，返回变化的字段（简单值附带新旧值）
+func diffFields(old, updated CertConfig) []string {
+	oldMap, newMap := fieldMap(old), fieldMap(updated)
+	keys := make([]string, 0, len(newMap))
+	for key := range oldMap {
+		keys = append(keys, key)
+	}
+	for key := range newMap {
+		if _, ok := oldMap[key]; !ok {
+			keys = append(keys, key)
+		}
+	}
+	sort.Strings(keys)
+
+	var diff []string
+	for _, key := range keys {
+		o, n := oldMap[key], newMap[key]
+		if reflect.DeepEqual(o, n) {
+			continue
+		}
+		if isScalar(o) && isScalar(n) {
+			diff = append(diff, fmt.Sprintf("%s: %v => %v", key, o, n))
+		} else {
+			diff = append(diff, key)
+		}
+	}
+	return diff
+}
+
+func fieldMap(c CertConfig) map[string]interface{} {
+	data, _ := json.Marshal(c)
+	var m map[string]interface{}
+	json.Unmarshal(data, &m)
+	return m
+}
+
+func isScalar(v interface{}) bool {
+	switch v.(type) {
+	case map[string]interface{}, []interface{}:
+		return false
+	}
+	return true
+}
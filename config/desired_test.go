@@ -0,0 +1,303 @@
+package config
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// writeDesired 把声明式配置写入临时文件，name 决定按 JSON 还是 YAML 解析
+func writeDesired(t *testing.T, name, data string) string {
+	t.Helper()
+	path := filepath.Join(t.TempDir(), name)
+	if err := os.WriteFile(path, []byte(data), 0600); err != nil {
+		t.Fatal(err)
+	}
+	return path
+}
+
+func TestLoadDesiredState(t *testing.T) {
+	tests := []struct {
+		name    string
+		file    string
+		data    string
+		wantErr string // 为空表示应加载成功
+	}{
+		{
+			name: "JSON",
+			file: "desired.json",
+			data: `{"certificates": [{"order_id": 1, "domain": "www.example.com"}], "prune": true}`,
+		},
+		{
+			name: "YAML",
+			file: "desired.yaml",
+			data: "profiles:\n  - name: default\n    api_base_url: https://api.example.com\n    token_env: CERT_TOKEN\n" +
+				"certificates:\n  - order_id: 1\n    domain: www.example.com\n",
+		},
+		{
+			name:    "未知字段",
+			file:    "desired.json",
+			data:    `{"certificates": [], "renew_day_local": 10}`,
+			wantErr: "renew_day_local",
+		},
+		{
+			name:    "YAML 中的未知字段",
+			file:    "desired.yml",
+			data:    "certificates:\n  - order_id: 1\n    domain: www.example.com\n    bind_rule: []\n",
+			wantErr: "bind_rule",
+		},
+		{
+			name:    "顶层明文 Token",
+			file:    "desired.json",
+			data:    `{"token": "abc", "certificates": []}`,
+			wantErr: "顶层 token",
+		},
+		{
+			name:    "API 配置中的加密 Token",
+			file:    "desired.json",
+			data:    `{"profiles": [{"name": "eu", "api_base_url": "https://eu.example.com", "encrypted_token": "x"}], "certificates": []}`,
+			wantErr: "profiles[0].encrypted_token",
+		},
+		{
+			name:    "token_env 和 token_file 同时设置",
+			file:    "desired.json",
+			data:    `{"profiles": [{"name": "eu", "token_env": "A", "token_file": "b.txt"}], "certificates": []}`,
+			wantErr: "只能设置一个",
+		},
+		{
+			name:    "订单重复",
+			file:    "desired.json",
+			data:    `{"certificates": [{"order_id": 1, "domain": "a.example.com"}, {"order_id": 1, "domain": "b.example.com"}]}`,
+			wantErr: "订单 1 重复",
+		},
+		{
+			name:    "缺少 domain",
+			file:    "desired.json",
+			data:    `{"certificates": [{"order_id": 1}]}`,
+			wantErr: "缺少 domain",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			d, err := LoadDesiredState(writeDesired(t, tt.file, tt.data))
+			if tt.wantErr == "" {
+				if err != nil {
+					t.Fatal(err)
+				}
+				if len(d.Certificates) != 1 || d.Certificates[0].Domain != "www.example.com" {
+					t.Errorf("证书 = %+v", d.Certificates)
+				}
+				return
+			}
+			if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+				t.Errorf("错误 = %v，期望包含 %q", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestDesiredProfileReadToken(t *testing.T) {
+	t.Setenv("CERT_DEPLOY_TEST_TOKEN", "  env-token\n")
+	t.Setenv("CERT_DEPLOY_TEST_EMPTY", "")
+	tokenFile := writeDesired(t, "token.txt", "file-token\r\n")
+	emptyFile := writeDesired(t, "empty.txt", "\n")
+
+	tests := []struct {
+		name    string
+		profile DesiredProfile
+		want    string
+		has     bool
+		wantErr string
+	}{
+		{name: "未设置来源"},
+		{name: "环境变量", profile: DesiredProfile{TokenEnv: "CERT_DEPLOY_TEST_TOKEN"}, want: "env-token", has: true},
+		{name: "环境变量为空", profile: DesiredProfile{TokenEnv: "CERT_DEPLOY_TEST_EMPTY"}, wantErr: "未设置"},
+		{name: "文件", profile: DesiredProfile{TokenFile: tokenFile}, want: "file-token", has: true},
+		{name: "文件为空", profile: DesiredProfile{TokenFile: emptyFile}, wantErr: "Token 文件为空"},
+		{name: "文件不存在", profile: DesiredProfile{TokenFile: filepath.Join(t.TempDir(), "missing.txt")}, wantErr: "读取 Token 文件失败"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tt.profile.Name = "eu"
+			token, has, err := tt.profile.readToken()
+			if tt.wantErr != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+					t.Errorf("错误 = %v，期望包含 %q", err, tt.wantErr)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if token != tt.want || has != tt.has {
+				t.Errorf("readToken = %q, %v，期望 %q, %v", token, has, tt.want, tt.has)
+			}
+		})
+	}
+}
+
+// desiredBase 应用声明式配置前的服务器配置
+func desiredBase(t *testing.T) *Config {
+	t.Helper()
+	cfg := DefaultConfig()
+	cfg.APIBaseURL = "https://api.example.com"
+	if err := cfg.SetToken("old-token"); err != nil {
+		t.Fatal(err)
+	}
+	cfg.Profiles = []APIProfile{{Name: "eu", APIBaseURL: "https://eu.example.com"}}
+	cfg.Certificates = []CertConfig{
+		{OrderID: 1, Domain: "www.example.com", Domains: []string{"www.example.com"}, Enabled: true, ExpiresAt: "2026-06-01",
+			BindRules: []BindRule{{Domain: "www.example.com", Port: 443}}},
+		{OrderID: 2, Domain: "old.example.com", Domains: []string{"old.example.com"}, Enabled: true},
+	}
+	return cfg
+}
+
+func changeStrings(changes []Change) []string {
+	lines := make([]string, len(changes))
+	for i, c := range changes {
+		lines[i] = c.String()
+	}
+	return lines
+}
+
+func TestApplyDesired(t *testing.T) {
+	t.Setenv("CERT_DEPLOY_TEST_TOKEN", "new-token")
+	disabled := false
+
+	tests := []struct {
+		name    string
+		desired DesiredState
+		want    []string // 期望的变更列表
+		check   func(t *testing.T, cfg *Config)
+		wantErr string
+	}{
+		{
+			name: "与现有配置相同时没有变更",
+			desired: DesiredState{
+				Profiles: []DesiredProfile{{Name: DefaultProfile, APIBaseURL: "https://api.example.com"}},
+				Certificates: []DesiredCert{
+					{OrderID: 1, Domain: "www.example.com", BindRules: []BindRule{{Domain: "www.example.com"}}},
+				},
+			},
+		},
+		{
+			name: "修改证书字段，保留运行时字段",
+			desired: DesiredState{Certificates: []DesiredCert{
+				{OrderID: 1, Domain: "www.example.com", Enabled: &disabled, BindRules: []BindRule{{Domain: "www.example.com"}}},
+			}},
+			want: []string{"~ 证书 www.example.com（订单 1）: enabled: true => false"},
+			check: func(t *testing.T, cfg *Config) {
+				if cfg.Certificates[0].ExpiresAt != "2026-06-01" {
+					t.Errorf("运行时字段 expires_at 被覆盖: %q", cfg.Certificates[0].ExpiresAt)
+				}
+			},
+		},
+		{
+			name: "按主域名匹配续签后的订单",
+			desired: DesiredState{Certificates: []DesiredCert{
+				{OrderID: 9, Domain: "WWW.example.com", BindRules: []BindRule{{Domain: "www.example.com"}}},
+			}},
+			want: []string{"~ 证书 WWW.example.com（订单 1）: domain: www.example.com => WWW.example.com; domains"},
+			check: func(t *testing.T, cfg *Config) {
+				if len(cfg.Certificates) != 2 || cfg.Certificates[0].OrderID != 1 {
+					t.Errorf("应保留现有订单 ID: %+v", cfg.Certificates)
+				}
+			},
+		},
+		{
+			name: "新增证书和 API 配置",
+			desired: DesiredState{
+				Profiles:     []DesiredProfile{{Name: "us", APIBaseURL: "https://us.example.com"}},
+				Certificates: []DesiredCert{{OrderID: 3, Profile: "us", Domain: "new.example.com"}},
+			},
+			want: []string{"+ API 配置 us: https://us.example.com", "+ 证书 new.example.com（订单 3）"},
+			check: func(t *testing.T, cfg *Config) {
+				if len(cfg.Certificates) != 3 || len(cfg.Profiles) != 2 {
+					t.Errorf("不带 prune 时不应删除: 证书 %d 个，API 配置 %d 个", len(cfg.Certificates), len(cfg.Profiles))
+				}
+			},
+		},
+		{
+			name: "prune 删除文件中没有的证书和 API 配置",
+			desired: DesiredState{
+				Prune:        true,
+				Certificates: []DesiredCert{{OrderID: 1, Domain: "www.example.com", BindRules: []BindRule{{Domain: "www.example.com"}}}},
+			},
+			want: []string{"- API 配置 eu", "- 证书 old.example.com（订单 2）"},
+			check: func(t *testing.T, cfg *Config) {
+				if len(cfg.Certificates) != 1 || len(cfg.Profiles) != 0 {
+					t.Errorf("prune 后: 证书 %d 个，API 配置 %d 个", len(cfg.Certificates), len(cfg.Profiles))
+				}
+			},
+		},
+		{
+			name: "从环境变量更新 Token，变更明细不包含 Token",
+			desired: DesiredState{Profiles: []DesiredProfile{
+				{Name: DefaultProfile, APIBaseURL: "https://api2.example.com", TokenEnv: "CERT_DEPLOY_TEST_TOKEN"},
+			}},
+			want: []string{
+				"~ API 配置 default: api_base_url: https://api.example.com => https://api2.example.com",
+				"~ API 配置 default: Token 已更新",
+			},
+			check: func(t *testing.T, cfg *Config) {
+				if token, err := cfg.GetToken(); err != nil || token != "new-token" {
+					t.Errorf("Token = %q（%v）", token, err)
+				}
+				if cfg.Token != "" || !IsMachineScoped(cfg.EncryptedToken) {
+					t.Error("Token 应加密保存")
+				}
+			},
+		},
+		{
+			name: "续签天数和计划任务",
+			desired: DesiredState{
+				RenewDaysLocal: 20,
+				Schedule:       &DesiredSchedule{Enabled: true, Interval: 12, TaskName: "CertDeployIIS"},
+			},
+			want: []string{"~ renew_days_local: 15 => 20", "~ schedule.enabled: false => true", "~ schedule.interval: 6 => 12"},
+		},
+		{
+			name:    "证书引用不存在的 API 配置",
+			desired: DesiredState{Certificates: []DesiredCert{{OrderID: 3, Profile: "missing", Domain: "new.example.com"}}},
+			wantErr: "API 配置 missing 不存在",
+		},
+		{
+			name:    "Token 环境变量未设置",
+			desired: DesiredState{Profiles: []DesiredProfile{{Name: "eu", TokenEnv: "CERT_DEPLOY_TEST_MISSING"}}},
+			wantErr: "环境变量 CERT_DEPLOY_TEST_MISSING 未设置",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cfg := desiredBase(t)
+			changes, err := ApplyDesired(cfg, &tt.desired)
+			if tt.wantErr != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+					t.Errorf("错误 = %v，期望包含 %q", err, tt.wantErr)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			got := changeStrings(changes)
+			if strings.Join(got, "\n") != strings.Join(tt.want, "\n") {
+				t.Errorf("变更列表:\n%s\n期望:\n%s", strings.Join(got, "\n"), strings.Join(tt.want, "\n"))
+			}
+			if tt.check != nil {
+				tt.check(t, cfg)
+			}
+
+			// 再次应用同一份配置没有变更
+			again, err := ApplyDesired(cfg, &tt.desired)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if len(again) > 0 {
+				t.Errorf("重复应用产生变更: %v", changeStrings(again))
+			}
+		})
+	}
+}
@@ -0,0 +1,197 @@
+package config
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"time"
+)
+
+// CurrentSchemaVersion 当前程序支持的配置结构版本
+// 修改配置结构时递增，并在 migrations 末尾追加对应的迁移步骤
+const CurrentSchemaVersion = 3
+
+// ErrConfigTooNew 配置文件由更新版本的程序写入
+var ErrConfigTooNew = errors.New("配置文件版本高于程序支持的版本，请升级程序")
+
+// migration 配置迁移步骤，对原始 JSON 操作，升级到 version
+type migration struct {
+	version int
+	name    string
+	apply   func(raw map[string]interface{}) error
+}
+
+// migrations 按版本顺序排列
+var migrations = []migration{
+	{version: 1, name: "补全默认值", apply: migrateV1},
+	{version: 2, name: "加密明文密钥", apply: migrateV2},
+	{version: 3, name: "加密通知渠道地址和密钥", apply: migrateV3},
+}
+
+// schemaVersion 读取原始配置的版本号，没有 schema_version 的旧配置为 0
+func schemaVersion(raw map[string]interface{}) (int, error) {
+	value, ok := raw["schema_version"]
+	if !ok || value == nil {
+		return 0, nil
+	}
+	number, ok := value.(json.Number)
+	if !ok {
+		return 0, fmt.Errorf("schema_version 格式错误: %v", value)
+	}
+	version, err := number.Int64()
+	if err != nil {
+		return 0, fmt.Errorf("schema_version 格式错误: %w", err)
+	}
+	return int(version), nil
+}
+
+// migrateConfig 检查版本并依次执行迁移
+// 返回迁移后的 JSON；已是当前版本时返回 nil
+// 迁移前先备份原文件（config.json.v<版本>.<时间>.bak）
+func migrateConfig(path string, data []byte) ([]byte, error) {
+	raw, err := decodeRaw(data)
+	if err != nil {
+		return nil, err
+	}
+
+	version, err := schemaVersion(raw)
+	if err != nil {
+		return nil, err
+	}
+	if version > CurrentSchemaVersion {
+		return nil, fmt.Errorf("%w（配置 %d，程序 %d）", ErrConfigTooNew, version, CurrentSchemaVersion)
+	}
+	if version == CurrentSchemaVersion {
+		return nil, nil
+	}
+
+	backup := fmt.Sprintf("%s.v%d.%s.bak", path, version, time.Now().Format("20060102150405"))
+	if err := os.WriteFile(backup, data, 0600); err != nil {
+		return nil, fmt.Errorf("备份配置文件失败: %w", err)
+	}
+
+	for _, m := range migrations {
+		if m.version <= version {
+			continue
+		}
+		if err := m.apply(raw); err != nil {
+			return nil, fmt.Errorf("配置迁移到版本 %d（%s）失败: %w", m.version, m.name, err)
+		}
+		raw["schema_version"] = m.version
+	}
+
+	return json.MarshalIndent(raw, "", "  ")
+}
+
+// decodeRaw 解析为通用结构，数字保留为 json.Number（订单 ID 等不经过 float64）
+func decodeRaw(data []byte) (map[string]interface{}, error) {
+	var raw map[string]interface{}
+	decoder := json.NewDecoder(bytes.NewReader(data))
+	decoder.UseNumber()
+	if err := decoder.Decode(&raw); err != nil {
+		return nil, err
+	}
+	if raw == nil {
+		raw = make(map[string]interface{})
+	}
+	return raw, nil
+}
+
+// migrateV1 补全旧版配置缺失或为零的字段（原先每次加载时临时补全）
+func migrateV1(raw map[string]interface{}) error {
+	setDefaultInt(raw, "renew_days_local", 15)
+	setDefaultInt(raw, "renew_days_fetch", 13)
+	setDefaultInt(raw, "check_interval", 6)
+	if s, _ := raw["task_name"].(string); s == "" {
+		raw["task_name"] = "CertDeployIIS"
+	}
+
+	certs, _ := raw["certificates"].([]interface{})
+	if certs == nil {
+		certs = []interface{}{}
+	}
+	for _, c := range certs {
+		certMap, ok := c.(map[string]interface{})
+		if !ok {
+			continue
+		}
+		rules, _ := certMap["bind_rules"].([]interface{})
+		for _, r := range rules {
+			if rule, ok := r.(map[string]interface{}); ok {
+				setDefaultInt(rule, "port", 443)
+			}
+		}
+	}
+	raw["certificates"] = certs
+	return nil
+}
+
+// migrateV2 明文 Token 和 SMTP 密码加密保存，清除明文字段
+func migrateV2(raw map[string]interface{}) error {
+	if err := encryptRawSecret(raw, "token", "encrypted_token"); err != nil {
+		return fmt.Errorf("Token: %w", err)
+	}
+
+	notify, _ := raw["notify"].(map[string]interface{})
+	channels, _ := notify["channels"].([]interface{})
+	for _, c := range channels {
+		ch, ok := c.(map[string]interface{})
+		if !ok {
+			continue
+		}
+		if smtp, ok := ch["smtp"].(map[string]interface{}); ok {
+			if err := encryptRawSecret(smtp, "password", "encrypted_password"); err != nil {
+				return fmt.Errorf("通知渠道 %v 的 SMTP 密码: %w", ch["name"], err)
+			}
+		}
+	}
+	return nil
+}
+
+// migrateV3 通知渠道的 Webhook 地址（带 access_token）和加签密钥加密保存
+func migrateV3(raw map[string]interface{}) error {
+	notify, _ := raw["notify"].(map[string]interface{})
+	channels, _ := notify["channels"].([]interface{})
+	for _, c := range channels {
+		ch, ok := c.(map[string]interface{})
+		if !ok {
+			continue
+		}
+		if err := encryptRawSecret(ch, "url", "encrypted_url"); err != nil {
+			return fmt.Errorf("通知渠道 %v 的 Webhook 地址: %w", ch["name"], err)
+		}
+		if err := encryptRawSecret(ch, "secret", "encrypted_secret"); err != nil {
+			return fmt.Errorf("通知渠道 %v 的加签密钥: %w", ch["name"], err)
+		}
+	}
+	return nil
+}
+
+// encryptRawSecret 明文字段非空且没有加密值时加密保存
+func encryptRawSecret(m map[string]interface{}, plainKey, encryptedKey string) error {
+	plain, _ := m[plainKey].(string)
+	if plain == "" {
+		return nil
+	}
+	if encrypted, _ := m[encryptedKey].(string); encrypted == "" {
+		value, err := EncryptSecret(plain)
+		if err != nil {
+			return err
+		}
+		m[encryptedKey] = value
+	}
+	delete(m, plainKey)
+	return nil
+}
+
+// setDefaultInt 字段缺失或为 0 时设置默认值
+func setDefaultInt(m map[string]interface{}, key string, value int) {
+	if number, ok := m[key].(json.Number); ok {
+		if n, err := number.Int64(); err == nil && n != 0 {
+			return
+		}
+	}
+	m[key] = value
+}
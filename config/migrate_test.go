@@ -0,0 +1,204 @@
+package config
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+// migrateFile 在临时目录迁移配置，返回迁移结果（已是当前版本时为 nil）和配置文件路径
+func migrateFile(t *testing.T, data string) (map[string]interface{}, string) {
+	t.Helper()
+	path := filepath.Join(t.TempDir(), "config.json")
+	migrated, err := migrateConfig(path, []byte(data))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if migrated == nil {
+		return nil, path
+	}
+	raw, err := decodeRaw(migrated)
+	if err != nil {
+		t.Fatalf("迁移结果无法解析: %v", err)
+	}
+	return raw, path
+}
+
+func backups(t *testing.T, path string) []string {
+	t.Helper()
+	matches, err := filepath.Glob(path + ".v*.bak")
+	if err != nil {
+		t.Fatal(err)
+	}
+	return matches
+}
+
+func TestMigrateV0Defaults(t *testing.T) {
+	raw, _ := migrateFile(t, `{
+		"api_base_url": "https://api.example.com",
+		"renew_days_local": 20,
+		"certificates": [
+			{"order_id": 9007199254740993, "bind_rules": [{"domain": "www.example.com"}, {"domain": "api.example.com", "port": 8443}]}
+		]
+	}`)
+
+	if got := fmt.Sprint(raw["schema_version"]); got != fmt.Sprint(CurrentSchemaVersion) {
+		t.Errorf("schema_version = %s，期望 %d", got, CurrentSchemaVersion)
+	}
+	for key, want := range map[string]string{
+		"renew_days_local": "20", // 已有的值保留
+		"renew_days_fetch": "13",
+		"check_interval":   "6",
+		"task_name":        "CertDeployIIS",
+	} {
+		if got := fmt.Sprint(raw[key]); got != want {
+			t.Errorf("%s = %s，期望 %s", key, got, want)
+		}
+	}
+
+	cert := raw["certificates"].([]interface{})[0].(map[string]interface{})
+	// 订单 ID 超过 float64 精度，迁移不能改变
+	if got := fmt.Sprint(cert["order_id"]); got != "9007199254740993" {
+		t.Errorf("order_id = %s", got)
+	}
+	rules := cert["bind_rules"].([]interface{})
+	for i, want := range []string{"443", "8443"} {
+		if got := fmt.Sprint(rules[i].(map[string]interface{})["port"]); got != want {
+			t.Errorf("bind_rules[%d].port = %s，期望 %s", i, got, want)
+		}
+	}
+}
+
+func TestMigrateV0EmptyCertificates(t *testing.T) {
+	raw, _ := migrateFile(t, `{"api_base_url": ""}`)
+	if certs, ok := raw["certificates"].([]interface{}); !ok || len(certs) != 0 {
+		t.Errorf("certificates = %v，期望空数组", raw["certificates"])
+	}
+}
+
+func TestMigrateEncryptsSecrets(t *testing.T) {
+	existing, err := EncryptSecret("kept-token")
+	if err != nil {
+		t.Skipf("当前环境无法加密: %v", err)
+	}
+
+	raw, _ := migrateFile(t, `{
+		"schema_version": 1,
+		"token": "plain-token",
+		"notify": {"channels": [
+			{"name": "ops", "type": "dingtalk", "url": "https://oapi.dingtalk.com/robot/send?access_token=abc", "secret": "SECxyz"},
+			{"name": "mail", "type": "smtp", "smtp": {"host": "smtp.example.com", "password": "mail-pass"}},
+			{"name": "kept", "type": "webhook", "url": "https://hooks.example.com/new", "encrypted_url": "`+existing+`"}
+		]}
+	}`)
+
+	assertEncrypted := func(m map[string]interface{}, plainKey, encryptedKey, want string) {
+		t.Helper()
+		if _, ok := m[plainKey]; ok {
+			t.Errorf("迁移后仍有明文 %s", plainKey)
+		}
+		encrypted, _ := m[encryptedKey].(string)
+		if !IsMachineScoped(encrypted) {
+			t.Errorf("%s 未按计算机范围加密: %q", encryptedKey, encrypted)
+		}
+		if got, err := DecryptSecret(encrypted); err != nil || got != want {
+			t.Errorf("%s 解密为 %q（%v），期望 %q", encryptedKey, got, err, want)
+		}
+	}
+
+	assertEncrypted(raw, "token", "encrypted_token", "plain-token")
+	channels := raw["notify"].(map[string]interface{})["channels"].([]interface{})
+	ops := channels[0].(map[string]interface{})
+	assertEncrypted(ops, "url", "encrypted_url", "https://oapi.dingtalk.com/robot/send?access_token=abc")
+	assertEncrypted(ops, "secret", "encrypted_secret", "SECxyz")
+	smtp := channels[1].(map[string]interface{})["smtp"].(map[string]interface{})
+	assertEncrypted(smtp, "password", "encrypted_password", "mail-pass")
+	// 已有加密值时保留加密值，丢弃明文
+	assertEncrypted(channels[2].(map[string]interface{}), "url", "encrypted_url", "kept-token")
+}
+
+func TestMigrateIdempotent(t *testing.T) {
+	if _, err := EncryptSecret("probe"); err != nil {
+		t.Skipf("当前环境无法加密: %v", err)
+	}
+	path := filepath.Join(t.TempDir(), "config.json")
+	data := `{"token": "plain-token", "certificates": [{"order_id": 1, "bind_rules": [{"domain": "www.example.com"}]}],
+		"notify": {"channels": [{"name": "ops", "type": "slack", "url": "https://hooks.slack.com/services/x"}]}}`
+
+	first, err := migrateConfig(path, []byte(data))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// 迁移结果再次加载时已是当前版本，不再迁移、不再备份
+	again, err := migrateConfig(path, first)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if again != nil {
+		t.Errorf("当前版本的配置再次迁移: %s", again)
+	}
+	if n := len(backups(t, path)); n != 1 {
+		t.Errorf("备份数 = %d，期望 1", n)
+	}
+
+	// 每个迁移步骤重复执行不改变结果（保存失败后下次加载会从头再迁移一次）
+	raw, err := decodeRaw(first)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, m := range migrations {
+		before, _ := json.Marshal(raw)
+		if err := m.apply(raw); err != nil {
+			t.Fatalf("重复执行迁移 %d 失败: %v", m.version, err)
+		}
+		after, _ := json.Marshal(raw)
+		if string(before) != string(after) {
+			t.Errorf("重复执行迁移 %d（%s）改变了配置:\n%s\n%s", m.version, m.name, before, after)
+		}
+	}
+}
+
+func TestMigrateTooNew(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "config.json")
+	data := fmt.Sprintf(`{"schema_version": %d}`, CurrentSchemaVersion+1)
+
+	_, err := migrateConfig(path, []byte(data))
+	if !errors.Is(err, ErrConfigTooNew) {
+		t.Fatalf("期望 ErrConfigTooNew，实际 %v", err)
+	}
+	if n := len(backups(t, path)); n != 0 {
+		t.Errorf("拒绝加载时不应备份，备份数 = %d", n)
+	}
+}
+
+func TestMigrateInvalidVersion(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "config.json")
+	if _, err := migrateConfig(path, []byte(`{"schema_version": "2"}`)); err == nil {
+		t.Fatal("schema_version 为字符串时应返回错误")
+	}
+}
+
+func TestMigrateBackup(t *testing.T) {
+	original := `{"schema_version": 1, "api_base_url": "https://api.example.com"}`
+	_, path := migrateFile(t, original)
+
+	files := backups(t, path)
+	if len(files) != 1 {
+		t.Fatalf("备份数 = %d，期望 1", len(files))
+	}
+	matched, _ := filepath.Match(filepath.Base(path)+".v1.*.bak", filepath.Base(files[0]))
+	if !matched {
+		t.Errorf("备份文件名 %s 不包含原版本号", filepath.Base(files[0]))
+	}
+	data, err := os.ReadFile(files[0])
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(data) != original {
+		t.Errorf("备份内容与原文件不同: %s", data)
+	}
+}
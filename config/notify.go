@@ -0,0 +1,148 @@
+package config
+
+import "fmt"
+
+// 通知渠道类型
+const (
+	NotifySMTP     = "smtp"     // 邮件
+	NotifyWebhook  = "webhook"  // 通用 JSON Webhook
+	NotifyDingTalk = "dingtalk" // 钉钉机器人
+	NotifyWeCom    = "wecom"    // 企业微信机器人
+	NotifyFeishu   = "feishu"   // 飞书机器人
+	NotifySlack    = "slack"    // Slack Incoming Webhook
+)
+
+// 通知级别
+const (
+	SeverityInfo    = "info"    // 部署成功
+	SeverityWarning = "warning" // 证书即将过期
+	SeverityError   = "error"   // 部署失败、证书已过期
+)
+
+// 通知默认值
+const (
+	DefaultExpiryWarnDays = 7
+	DefaultDedupHours     = 24
+)
+
+// NotifyConfig 部署结果和过期提醒的通知配置
+type NotifyConfig struct {
+	Channels       []NotifyChannel `json:"channels"`
+	ExpiryWarnDays int             `json:"expiry_warn_days,omitempty"` // 证书剩余天数不超过该值时提醒，默认 7
+	DedupHours     int             `json:"dedup_hours,omitempty"`      // 同一证书的同类告警在该时间内只发送一次，默认 24
+}
+
+// NotifyChannel 通知渠道
+type NotifyChannel struct {
+	Name            string            `json:"name"`                       // 渠道名称（日志和去重记录使用）
+	Type            string            `json:"type"`                       // 渠道类型
+	Enabled         bool              `json:"enabled"`                    // 是否启用
+	MinSeverity     string            `json:"min_severity,omitempty"`     // 最低通知级别，默认 warning
+	URL             string            `json:"url,omitempty"`              // Webhook 地址（明文，兼容手工编辑）
+	EncryptedURL    string            `json:"encrypted_url,omitempty"`    // 加密后的 Webhook 地址（地址中通常带有 access_token）
+	Secret          string            `json:"secret,omitempty"`           // 钉钉/飞书机器人加签密钥（明文，兼容手工编辑）
+	EncryptedSecret string            `json:"encrypted_secret,omitempty"` // 加密后的加签密钥
+	Headers         map[string]string `json:"headers,omitempty"`          // webhook: 附加请求头
+	Title           string            `json:"title,omitempty"`            // 标题模板（text/template），空则使用默认
+	Template        string            `json:"template,omitempty"`         // 正文模板（text/template），空则使用默认
+	SMTP            *SMTPConfig       `json:"smtp,omitempty"`             // smtp: 邮件服务器
+}
+
+// SMTPConfig 邮件服务器配置
+type SMTPConfig struct {
+	Host              string   `json:"host"`
+	Port              int      `json:"port"`                         // 默认 465（implicit TLS）
+	Security          string   `json:"security,omitempty"`           // tls、starttls、none，默认按端口判断
+	Username          string   `json:"username,omitempty"`           // 为空时不认证
+	Password          string   `json:"password,omitempty"`           // 明文密码（兼容手工编辑）
+	EncryptedPassword string   `json:"encrypted_password,omitempty"` // 加密后的密码
+	From              string   `json:"from"`
+	To                []string `json:"to"`
+}
+
+func (s *SMTPConfig) secretField(name string) secretField {
+	return secretField{name: name, plain: &s.Password, encrypted: &s.EncryptedPassword}
+}
+
+// GetPassword 获取解密后的 SMTP 密码
+func (s *SMTPConfig) GetPassword() (string, error) {
+	return s.secretField("SMTP 密码").get()
+}
+
+// SetPassword 加密（计算机范围）并设置 SMTP 密码
+func (s *SMTPConfig) SetPassword(password string) error {
+	return s.secretField("SMTP 密码").set(password)
+}
+
+func (ch *NotifyChannel) urlField() secretField {
+	return secretField{name: "通知渠道 " + ch.Name + " 的 Webhook 地址", plain: &ch.URL, encrypted: &ch.EncryptedURL}
+}
+
+func (ch *NotifyChannel) signSecretField() secretField {
+	return secretField{name: "通知渠道 " + ch.Name + " 的加签密钥", plain: &ch.Secret, encrypted: &ch.EncryptedSecret}
+}
+
+// GetURL 获取解密后的 Webhook 地址
+func (ch *NotifyChannel) GetURL() (string, error) {
+	return ch.urlField().get()
+}
+
+// SetURL 加密（计算机范围）并设置 Webhook 地址
+func (ch *NotifyChannel) SetURL(url string) error {
+	return ch.urlField().set(url)
+}
+
+// GetSecret 获取解密后的加签密钥
+func (ch *NotifyChannel) GetSecret() (string, error) {
+	return ch.signSecretField().get()
+}
+
+// SetSecret 加密（计算机范围）并设置加签密钥
+func (ch *NotifyChannel) SetSecret(secret string) error {
+	return ch.signSecretField().set(secret)
+}
+
+// WarnDays 过期提醒天数
+func (n *NotifyConfig) WarnDays() int {
+	if n.ExpiryWarnDays <= 0 {
+		return DefaultExpiryWarnDays
+	}
+	return n.ExpiryWarnDays
+}
+
+// DedupWindow 告警去重时间（小时）
+func (n *NotifyConfig) DedupWindow() int {
+	if n.DedupHours <= 0 {
+		return DefaultDedupHours
+	}
+	return n.DedupHours
+}
+
+// SeverityLevel 通知级别的排序值，未知级别按 warning 处理
+func SeverityLevel(severity string) int {
+	switch severity {
+	case SeverityInfo:
+		return 0
+	case SeverityError:
+		return 2
+	default:
+		return 1
+	}
+}
+
+// Validate 检查渠道配置是否完整
+func (ch *NotifyChannel) Validate() error {
+	switch ch.Type {
+	case NotifySMTP:
+		if ch.SMTP == nil || ch.SMTP.Host == "" || ch.SMTP.From == "" || len(ch.SMTP.To) == 0 {
+			return fmt.Errorf("通知渠道 %s: 邮件需要配置 smtp.host、from 和 to", ch.Name)
+		}
+	case NotifyWebhook, NotifyDingTalk, NotifyWeCom, NotifyFeishu, NotifySlack:
+		if ch.URL == "" && ch.EncryptedURL == "" {
+			return fmt.Errorf("通知渠道 %s: 未配置 url", ch.Name)
+		}
+	default:
+		return fmt.Errorf("通知渠道 %s: 不支持的类型 %q", ch.Name, ch.Type)
+	}
+	return nil
+}
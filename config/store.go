@@ -0,0 +1,145 @@
+package config
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+	"time"
+
+	"cert-deploy/util"
+)
+
+// ConfigBackups 保留的配置备份数量（config.json.1 为最近一次保存前的内容）
+const ConfigBackups = 5
+
+// 配置锁文件名（位于数据目录），GUI 和计划任务写配置时互斥
+const configLockFile = "config.lock"
+
+// ErrConfigConflict 配置在加载后已被其他进程或窗口修改
+var ErrConfigConflict = errors.New("配置已被其他程序修改，请重新加载后再保存")
+
+// ErrNoChanges Update 的回调返回此错误表示没有修改，不保存
+var ErrNoChanges = errors.New("配置没有变化")
+
+func lockConfig() (*util.FileLock, error) {
+	lock, err := util.WaitLock(filepath.Join(GetDataDir(), configLockFile), "config", 30*time.Second)
+	if err != nil {
+		return nil, fmt.Errorf("获取配置锁失败: %w", err)
+	}
+	return lock, nil
+}
+
+// Update 在配置锁内加载最新配置、修改并保存，返回保存后的配置
+// 用于长时间运行后写回少量字段的场景（如自动部署结束时更新订单 ID），不会覆盖期间其他程序的修改
+func Update(fn func(cfg *Config) error) (*Config, error) {
+	lock, err := lockConfig()
+	if err != nil {
+		return nil, err
+	}
+	defer lock.Release()
+
+	cfg, _, err := loadFile()
+	if err != nil {
+		return nil, err
+	}
+	if err := fn(cfg); err != nil {
+		if errors.Is(err, ErrNoChanges) {
+			return cfg, nil
+		}
+		return nil, err
+	}
+	if err := cfg.saveLocked(); err != nil {
+		return nil, err
+	}
+	return cfg, nil
+}
+
+// saveLocked 检查修订号后写入配置（调用方持有配置锁）
+// 写入临时文件并刷盘后替换，原文件轮转为 config.json.1..N
+func (c *Config) saveLocked() error {
+	path := GetConfigPath()
+
+	current, err := os.ReadFile(path)
+	if err == nil {
+		raw, err := decodeRaw(current)
+		if err != nil {
+			// 损坏的文件不参与轮转（避免挤掉有效备份），改名保留
+			corrupt := fmt.Sprintf("%s.corrupt-%s", path, time.Now().Format("20060102150405"))
+			if err := os.Rename(path, corrupt); err != nil {
+				return fmt.Errorf("保留损坏的配置文件失败: %w", err)
+			}
+			log.Printf("损坏的配置文件已保存为 %s", corrupt)
+		} else if revision := rawInt(raw, "revision"); revision != c.Revision {
+			return fmt.Errorf("%w（加载时修订号 %d，当前 %d）", ErrConfigConflict, c.Revision, revision)
+		}
+	}
+
+	c.Revision++
+	data, err := json.MarshalIndent(c, "", "  ")
+	if err != nil {
+		c.Revision--
+		return err
+	}
+
+	if err := rotateBackups(path); err != nil {
+		c.Revision--
+		return fmt.Errorf("备份配置文件失败: %w", err)
+	}
+	if err := util.WriteFileAtomic(path, data, 0600); err != nil {
+		c.Revision--
+		return fmt.Errorf("写入配置文件失败: %w", err)
+	}
+	return nil
+}
+
+func backupPath(path string, n int) string {
+	return fmt.Sprintf("%s.%d", path, n)
+}
+
+// rotateBackups config.json.N-1 → N，…，config.json → config.json.1
+func rotateBackups(path string) error {
+	current, err := os.ReadFile(path)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil
+		}
+		return err
+	}
+
+	for i := ConfigBackups - 1; i >= 1; i-- {
+		if err := os.Rename(backupPath(path, i), backupPath(path, i+1)); err != nil && !os.IsNotExist(err) {
+			return err
+		}
+	}
+	return util.WriteFileAtomic(backupPath(path, 1), current, 0600)
+}
+
+// recoverFromBackup 配置文件损坏时读取最新的有效备份
+// 恢复的内容由 Load 立即保存，损坏的文件在保存时改名为 config.json.corrupt-<时间> 保留
+func recoverFromBackup(path string, parseErr error) ([]byte, error) {
+	for i := 1; i <= ConfigBackups; i++ {
+		data, err := os.ReadFile(backupPath(path, i))
+		if err != nil {
+			continue
+		}
+		if _, err := decodeRaw(data); err != nil {
+			continue
+		}
+		log.Printf("配置文件损坏（%v），从备份 %s 恢复", parseErr, backupPath(path, i))
+		return data, nil
+	}
+	return nil, fmt.Errorf("配置文件损坏且没有可用的备份: %w", parseErr)
+}
+
+// rawInt 读取原始 JSON 中的整数字段（缺失或格式错误时为 0）
+func rawInt(raw map[string]interface{}, key string) int64 {
+	number, ok := raw[key].(json.Number)
+	if !ok {
+		return 0
+	}
+	n, _ := number.Int64()
+	return n
+}
@@ -0,0 +1,147 @@
+package deploy
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+
+	"cert-deploy/config"
+	"cert-deploy/iis"
+	"cert-deploy/util"
+)
+
+// 部署后动作默认超时
+const defaultPostActionTimeout = 60 * time.Second
+
+// 写入 Result 的输出上限，避免脚本大量输出撑爆日志
+const maxActionOutput = 4096
+
+// runPostActions 执行证书配置的部署后动作，每个动作生成一条结果
+// 只有本次至少一个绑定成功更新时才执行（绑定均未变化时不执行）
+// ctx 为单证书部署时限，超时后正在执行的命令被结束，剩余动作记为失败
+func runPostActions(ctx context.Context, certCfg config.CertConfig, deployResults []Result, plan *Plan) []Result {
+	if len(certCfg.PostActions) == 0 {
+		return nil
+	}
+
+	var deployed *Result
+	domains := make([]string, 0)
+	for i, r := range deployResults {
+		if !r.Success || r.Unchanged {
+			continue
+		}
+		if deployed == nil || (deployed.OldThumbprint == "" && r.OldThumbprint != "") {
+			deployed = &deployResults[i]
+		}
+		// 规则模式下同一域名可能对应多个站点
+		if !slices.Contains(domains, r.Domain) {
+			domains = append(domains, r.Domain)
+		}
+	}
+	if deployed == nil {
+		log.Printf("证书 %s 没有更新的绑定，跳过部署后动作", certCfg.Domain)
+		return nil
+	}
+
+	env := []string{
+		"CERTDEPLOY_ORDER_ID=" + strconv.Itoa(deployed.OrderID),
+		"CERTDEPLOY_THUMBPRINT=" + deployed.Thumbprint,
+		"CERTDEPLOY_OLD_THUMBPRINT=" + deployed.OldThumbprint,
+		"CERTDEPLOY_DOMAINS=" + strings.Join(domains, ","),
+	}
+
+	results := make([]Result, 0, len(certCfg.PostActions))
+	for _, action := range certCfg.PostActions {
+		timeout := defaultPostActionTimeout
+		if action.Timeout > 0 {
+			timeout = time.Duration(action.Timeout) * time.Second
+		}
+
+		name := postActionName(action)
+		if plan.Active() {
+			plan.Add(Action{Kind: ActionPostAction, OrderID: deployed.OrderID, Domain: certCfg.Domain, Target: name, Detail: fmt.Sprintf("超时 %v", timeout)})
+			continue
+		}
+		log.Printf("执行部署后动作: %s", name)
+
+		output, err := runPostAction(ctx, action, env, timeout)
+		output = truncateOutput(strings.TrimSpace(output))
+
+		result := Result{
+			Domain:     certCfg.Domain,
+			Success:    err == nil,
+			Message:    fmt.Sprintf("部署后动作 %s 完成", name),
+			Thumbprint: deployed.Thumbprint,
+			OrderID:    deployed.OrderID,
+			Output:     output,
+		}
+		if err != nil {
+			log.Printf("部署后动作 %s 失败: %v", name, err)
+			result.Message = fmt.Sprintf("部署后动作 %s 失败: %v", name, err)
+		}
+		if output != "" {
+			log.Printf("部署后动作 %s 输出:\n%s", name, output)
+		}
+		results = append(results, result)
+	}
+	return results
+}
+
+// runPostAction 执行单个部署后动作
+func runPostAction(ctx context.Context, action config.PostAction, env []string, timeout time.Duration) (string, error) {
+	switch action.Type {
+	case config.PostActionRecyclePool:
+		return iis.RecycleAppPool(ctx, action.Target, timeout)
+	case config.PostActionRestartSite:
+		return iis.RestartSite(ctx, action.Target, timeout)
+	case config.PostActionStartSite:
+		return iis.EnsureSiteStarted(ctx, action.Target, timeout)
+	case config.PostActionScript:
+		return runScriptAction(ctx, action, env, timeout)
+	default:
+		return "", fmt.Errorf("未知的动作类型: %s", action.Type)
+	}
+}
+
+// runScriptAction 执行用户脚本，按扩展名选择解释器
+func runScriptAction(ctx context.Context, action config.PostAction, env []string, timeout time.Duration) (string, error) {
+	command := action.Command
+	if !filepath.IsAbs(command) {
+		return "", fmt.Errorf("脚本路径必须为绝对路径: %s", command)
+	}
+	if _, err := os.Stat(command); err != nil {
+		return "", fmt.Errorf("脚本不存在: %w", err)
+	}
+
+	switch strings.ToLower(filepath.Ext(command)) {
+	case ".ps1":
+		args := append([]string{"-NoProfile", "-NonInteractive", "-ExecutionPolicy", "Bypass", "-File", command}, action.Args...)
+		return util.RunCmdWithTimeout(ctx, timeout, env, "powershell", args...)
+	case ".bat", ".cmd":
+		args := append([]string{"/c", command}, action.Args...)
+		return util.RunCmdWithTimeout(ctx, timeout, env, "cmd", args...)
+	default:
+		return util.RunCmdWithTimeout(ctx, timeout, env, command, action.Args...)
+	}
+}
+
+// postActionName 动作显示名称
+func postActionName(action config.PostAction) string {
+	if action.Type == config.PostActionScript {
+		return fmt.Sprintf("%s(%s)", action.Type, filepath.Base(action.Command))
+	}
+	return fmt.Sprintf("%s(%s)", action.Type, action.Target)
+}
+
+func truncateOutput(output string) string {
+	if len(output) <= maxActionOutput {
+		return output
+	}
+	return strings.ToValidUTF8(output[:maxActionOutput], "") + "\n...（输出已截断）"
+}
@@ -1,11 +1,17 @@
 ﻿package deploy
 
 import (
+	"context"
+	"errors"
 	"fmt"
 	"log"
+	"net"
 	"os"
 	"path/filepath"
+	"sort"
+	"strconv"
 	"strings"
+	"sync"
 	"time"
 
 	"cert-deploy/api"
@@ -20,15 +26,38 @@ var orderStore = cert.NewOrderStore()
 
 // Result 部署结果
 type Result struct {
-	Domain     string
-	Success    bool
-	Message    string
-	Thumbprint string
-	OrderID    int
+	Domain        string
+	SiteName      string // 规则模式：证书所服务的 IIS 站点（没有站点使用该主机名时为空）
+	Success       bool
+	Message       string
+	Thumbprint    string
+	OldThumbprint string // 绑定前的证书指纹
+	OrderID       int
+	Output        string // 部署后动作的输出
+	Unchanged     bool   // 证书已安装且已绑定，本次未做修改（不发送回调）
+}
+
+// Label 结果的显示名称：域名，带站点时附加站点名
+func (r Result) Label() string {
+	if r.SiteName == "" {
+		return util.ToUnicode(r.Domain)
+	}
+	return fmt.Sprintf("%s (站点: %s)", util.ToUnicode(r.Domain), r.SiteName)
+}
+
+// DeployOptions 部署选项（命令行 deploy 子命令）
+type DeployOptions struct {
+	OrderID int  // 只部署该订单，0 表示所有启用的证书
+	Force   bool // 不受续签/拉取时间限制，立即部署
 }
 
 // AutoDeploy 自动部署证书（证书维度）
 func AutoDeploy(cfg *config.Config) []Result {
+	return autoDeploy(cfg, DeployOptions{}, nil)
+}
+
+// autoDeploy 部署流程，plan 非 nil 时为预演模式，只记录动作
+func autoDeploy(cfg *config.Config, opts DeployOptions, plan *Plan) []Result {
 	results := make([]Result, 0)
 
 	if len(cfg.Certificates) == 0 {
@@ -36,12 +65,19 @@ func AutoDeploy(cfg *config.Config) []Result {
 		return results
 	}
 
-	if cfg.GetToken() == "" {
-		log.Println("未配置 API Token")
+	// 每个 API 配置一个客户端，无法读取 Token 的配置跳过引用它的证书
+	clients, failed := newAPIClients(cfg, opts.OrderID)
+	results = append(results, failed...)
+	if len(clients) == 0 {
+		if len(results) > 0 && !plan.Active() {
+			sendNotifications(cfg, results)
+		}
 		return results
 	}
 
-	client := api.NewClient(cfg.APIBaseURL, cfg.GetToken())
+	// 证书存储和 IIS 绑定每次运行重新加载一次，之后的查询都使用快照
+	cert.InvalidateInventory()
+	iis.InvalidateInventory()
 
 	// 检测 IIS 版本
 	isIIS7 := iis.IsIIS7() || cfg.IIS7Mode
@@ -49,6 +85,11 @@ func AutoDeploy(cfg *config.Config) []Result {
 		log.Println("检测到 IIS7 兼容模式")
 	}
 
+	// 清理已移出配置的订单遗留的中断部署
+	if !plan.Active() {
+		recoverInterruptedDeploys(cfg.Certificates)
+	}
+
 	// 检查域名冲突
 	conflicts := checkDomainConflicts(cfg.Certificates)
 	if len(conflicts) > 0 {
@@ -57,175 +98,332 @@ func AutoDeploy(cfg *config.Config) []Result {
 		}
 	}
 
-	// 遍历证书配置
-	for i, certCfg := range cfg.Certificates {
-		if !certCfg.Enabled {
+	env := &runEnv{
+		isIIS7:         isIIS7,
+		verifyTLS:      !cfg.SkipTLSCheck,
+		conflicts:      conflicts,
+		allCerts:       append([]config.CertConfig(nil), cfg.Certificates...),
+		renewDaysLocal: cfg.RenewDaysLocal,
+		renewDaysFetch: cfg.RenewDaysFetch,
+		force:          opts.Force,
+	}
+
+	// 并发处理证书，每个证书独立计时
+	workers := cfg.WorkerCount()
+	timeout := cfg.CertDeadline()
+	log.Printf("并发处理证书: %d 个 worker，单证书时限 %v", workers, timeout)
+
+	outcomes := make([]certOutcome, len(env.allCerts))
+	sem := make(chan struct{}, workers)
+	var wg sync.WaitGroup
+	for i, certCfg := range env.allCerts {
+		if !certCfg.Enabled || (opts.OrderID > 0 && certCfg.OrderID != opts.OrderID) {
 			continue
 		}
+		client := clients[config.ProfileName(certCfg.Profile)]
+		if client == nil {
+			continue
+		}
+		wg.Add(1)
+		sem <- struct{}{}
+		go func(i int, certCfg config.CertConfig) {
+			defer wg.Done()
+			defer func() { <-sem }()
+			ctx, cancel := context.WithTimeout(context.Background(), timeout)
+			defer cancel()
+			outcomes[i] = processCert(ctx, env.withClient(client.WithContext(ctx)), certCfg, plan.fork())
+		}(i, certCfg)
+	}
+	wg.Wait()
 
-		log.Printf("检查证书: %s (订单: %d, 本地私钥: %v)", certCfg.Domain, certCfg.OrderID, certCfg.UseLocalKey)
+	// 旧证书清理在全部绑定完成后执行，“是否仍在使用”的判断不会与其他证书的绑定交错
+	for i, o := range outcomes {
+		applyRetention(env.allCerts[i], o.orderID, o.plan)
+	}
 
-		var certData *api.CertData
-		var privateKey string
-		var err error
+	// 按配置顺序汇总结果，保证输出稳定
+	for _, o := range outcomes {
+		results = append(results, o.results...)
+		plan.merge(o.plan)
+	}
 
-		if certCfg.UseLocalKey {
-			// 本地私钥模式：到期前 > RenewDaysLocal 天发起续签
-			// 目的：抢在服务端自动续签（14天）之前，由本地发起 CSR
-			var reason string
-			certData, privateKey, reason, err = handleLocalKeyMode(client, &cfg.Certificates[i], cfg.RenewDaysLocal)
-			if err != nil {
-				log.Printf("本地私钥模式处理失败: %v", err)
-				results = append(results, Result{
-					Domain:  certCfg.Domain,
-					Success: false,
-					Message: fmt.Sprintf("本地私钥模式失败: %v", err),
-					OrderID: certCfg.OrderID,
-				})
+	// 预演模式不修改配置
+	if plan.Active() {
+		return results
+	}
+
+	// 订单 ID（本地私钥模式重新提交 CSR 后）、实际过期时间和检查时间写回配置
+	// 部署期间 GUI 可能保存过配置，在配置锁内合并到最新配置，按原订单 ID 匹配证书
+	cfg.LastCheck = time.Now().Format("2006-01-02 15:04:05")
+	_, err := config.Update(func(latest *config.Config) error {
+		latest.LastCheck = cfg.LastCheck
+		for i, o := range outcomes {
+			c := latest.GetCertificateByOrderID(env.allCerts[i].OrderID)
+			if c == nil {
 				continue
 			}
-			if certData == nil {
-				if reason != "" {
-					log.Printf("证书 %s 跳过: %s", certCfg.Domain, reason)
-				}
-				continue
+			if o.orderID > 0 {
+				c.OrderID = o.orderID
 			}
-		} else {
-			// 拉取模式：到期前 < RenewDaysFetch 天开始拉取
-			// 目的：等服务端自动续签（14天）完成后再拉取
-			certData, err = client.GetCertByOrderID(certCfg.OrderID)
-			if err != nil {
-				log.Printf("获取证书失败: %v", err)
-				results = append(results, Result{
-					Domain:  certCfg.Domain,
-					Success: false,
-					Message: fmt.Sprintf("获取证书失败: %v", err),
-					OrderID: certCfg.OrderID,
-				})
-				continue
+			if o.expires != "" {
+				c.ExpiresAt = o.expires
 			}
+		}
+		return nil
+	})
+	if err != nil {
+		log.Printf("保存配置失败: %v", err)
+	}
+	for i, o := range outcomes {
+		if o.orderID > 0 {
+			cfg.Certificates[i].OrderID = o.orderID
+		}
+		if o.expires != "" {
+			cfg.Certificates[i].ExpiresAt = o.expires
+		}
+	}
 
-			// 检查证书状态
-			if certData.Status != "active" {
-				log.Printf("证书状态非活跃: %s", certData.Status)
-				results = append(results, Result{
-					Domain:  certCfg.Domain,
-					Success: false,
-					Message: fmt.Sprintf("证书状态: %s", certData.Status),
-					OrderID: certData.OrderID,
-				})
-				continue
-			}
+	sendNotifications(cfg, results)
 
-			// 拉取模式：检查是否到了拉取时间
-			expiresAt, err := time.Parse("2006-01-02", certData.ExpiresAt)
-			if err != nil {
-				log.Printf("解析过期时间失败: %v", err)
-				continue
-			}
+	return results
+}
 
-			daysUntilExpiry := int(time.Until(expiresAt).Hours() / 24)
-			if daysUntilExpiry > cfg.RenewDaysFetch {
-				log.Printf("证书 %s 还有 %d 天过期，等待服务端续签（<=%d天后拉取）", certData.Domain, daysUntilExpiry, cfg.RenewDaysFetch)
-				continue
+// newAPIClients 为启用的证书引用的 API 配置创建客户端，orderID 非 0 时只处理该订单
+// Token 无法解密或 API 配置不存在时记为失败结果；未配置 Token 时只记录日志（与未启用相同）
+func newAPIClients(cfg *config.Config, orderID int) (map[string]*api.Client, []Result) {
+	clients := make(map[string]*api.Client)
+	checked := make(map[string]bool)
+	var results []Result
+	for _, certCfg := range cfg.Certificates {
+		name := config.ProfileName(certCfg.Profile)
+		if !certCfg.Enabled || checked[name] || (orderID > 0 && certCfg.OrderID != orderID) {
+			continue
+		}
+		checked[name] = true
+
+		baseURL, token, err := cfg.API(name)
+		if err != nil {
+			// 计划任务无法解密 Token 时记为失败，不当作未配置
+			log.Printf("读取 API 配置 %s 失败: %v", name, err)
+			domain := "API Token"
+			if name != config.DefaultProfile {
+				domain = "API 配置 " + name
 			}
+			results = append(results, Result{Domain: domain, Success: false, Message: err.Error()})
+			continue
+		}
+		if token == "" {
+			log.Printf("API 配置 %s 未配置 Token", name)
+			continue
+		}
+		clients[name] = api.NewClient(baseURL, token)
+	}
+	return clients, results
+}
 
-			log.Printf("证书 %s 将在 %d 天后过期，开始拉取部署...", certData.Domain, daysUntilExpiry)
-			privateKey = certData.PrivateKey
+// runEnv 一次部署中各证书共享的只读上下文
+type runEnv struct {
+	client         *api.Client // 当前证书使用的 API 客户端（见 withClient）
+	isIIS7         bool
+	verifyTLS      bool // 绑定后通过 TLS 握手校验实际下发的证书
+	conflicts      map[string][]int
+	allCerts       []config.CertConfig // 配置快照，worker 之间只读
+	renewDaysLocal int
+	renewDaysFetch int
+	force          bool // 不受续签/拉取时间限制
+}
+
+// withClient 返回使用指定 API 客户端的副本
+func (e *runEnv) withClient(client *api.Client) *runEnv {
+	env := *e
+	env.client = client
+	return &env
+}
+
+// certOutcome 单个证书的处理结果
+type certOutcome struct {
+	results []Result
+	plan    *Plan  // 预演模式下该证书的动作
+	orderID int    // 处理后的订单 ID（本地私钥模式可能变化）
+	expires string // 部署成功后证书的实际过期时间，写回配置
+}
+
+// processCert 处理单个证书：获取、安装、绑定、部署后动作
+// certCfg 为副本，订单 ID 的变化通过返回值带回，由调用方统一写回配置
+func processCert(ctx context.Context, env *runEnv, certCfg config.CertConfig, plan *Plan) certOutcome {
+	out := certOutcome{plan: plan, orderID: certCfg.OrderID}
+	prevOrderID := certCfg.OrderID
+	fail := func(message string, orderID int) certOutcome {
+		out.results = append(out.results, Result{
+			Domain:  certCfg.Domain,
+			Success: false,
+			Message: message,
+			OrderID: orderID,
+		})
+		return out
+	}
+
+	log.Printf("检查证书: %s (订单: %d, 本地私钥: %v)", certCfg.Domain, certCfg.OrderID, certCfg.UseLocalKey)
+
+	var certData *api.CertData
+	var privateKey string
+	var err error
+
+	// 上次部署中断时不受续签时间限制，继续完成部署
+	pending := loadPendingState(certCfg.OrderID)
+
+	if certCfg.UseLocalKey {
+		// 本地私钥模式：到期前 > RenewDaysLocal 天发起续签
+		// 目的：抢在服务端自动续签（14天）之前，由本地发起 CSR
+		var reason string
+		certData, privateKey, reason, err = handleLocalKeyMode(env.client, &certCfg, env.renewDaysLocal, pending != nil, env.force, plan)
+		out.orderID = certCfg.OrderID
+		if err != nil {
+			log.Printf("本地私钥模式处理失败: %v", err)
+			return fail(fmt.Sprintf("本地私钥模式失败: %v", err), certCfg.OrderID)
+		}
+		if certData == nil {
+			if reason != "" {
+				log.Printf("证书 %s 跳过: %s", certCfg.Domain, reason)
+				plan.Add(Action{Kind: ActionSkip, OrderID: certCfg.OrderID, Domain: certCfg.Domain, Detail: reason})
+			}
+			return out
+		}
+		out.orderID = certData.OrderID
+	} else {
+		// 拉取模式：到期前 < RenewDaysFetch 天开始拉取
+		// 目的：等服务端自动续签（14天）完成后再拉取
+		certData, err = env.client.GetCertByOrderID(certCfg.OrderID)
+		if err != nil {
+			log.Printf("获取证书失败: %v", err)
+			return fail(fmt.Sprintf("获取证书失败: %v", err), certCfg.OrderID)
 		}
 
-		log.Printf("证书 %s 开始部署...", certData.Domain)
+		// 检查证书状态
+		if certData.Status != "active" {
+			log.Printf("证书状态非活跃: %s", certData.Status)
+			return fail(fmt.Sprintf("证书状态: %s", certData.Status), certData.OrderID)
+		}
 
-		// 根据模式选择部署方式
-		var deployResults []Result
-		if certCfg.AutoBindMode {
-			// 自动绑定模式：按已有绑定更换证书
-			deployResults = deployCertAutoMode(certData, privateKey, certCfg, client, isIIS7)
-		} else {
-			// 规则绑定模式：按配置的绑定规则部署
-			deployResults = deployCertWithRules(certData, privateKey, certCfg, client, isIIS7, conflicts, cfg.Certificates)
+		// 拉取模式：检查是否到了拉取时间
+		notBefore, notAfter, err := certValidity(certData)
+		if err != nil {
+			log.Printf("无法确定证书 %s 的过期时间: %v", certCfg.Domain, err)
+			return fail(fmt.Sprintf("无法确定过期时间: %v", err), certData.OrderID)
 		}
-		results = append(results, deployResults...)
 
-		// 更新配置中的订单 ID
-		if certCfg.UseLocalKey && certCfg.OrderID != certData.OrderID {
-			cfg.Certificates[i].OrderID = certData.OrderID
+		decision := decideRenewal(renewalInput{
+			GlobalDays: env.renewDaysFetch,
+			Override:   certCfg.Renewal,
+			NotBefore:  notBefore,
+			NotAfter:   notAfter,
+			Resume:     pending != nil,
+			Force:      env.force,
+			Now:        time.Now(),
+		})
+		if !decision.Due {
+			log.Printf("证书 %s 还有 %d 天过期，等待服务端续签（剩余 %s 时拉取）", certData.Domain, decision.DaysLeft, decision.Threshold)
+			plan.Add(Action{Kind: ActionSkip, OrderID: certData.OrderID, Domain: certCfg.Domain, Detail: decision.Reason})
+			return out
 		}
+
+		log.Printf("证书 %s 将在 %d 天后过期，开始拉取部署...", certData.Domain, decision.DaysLeft)
+		privateKey = certData.PrivateKey
 	}
 
-	// 更新检查时间
-	cfg.LastCheck = time.Now().Format("2006-01-02 15:04:05")
-	cfg.Save()
+	if ctx.Err() != nil {
+		return fail(errCertTimeout.Error(), certData.OrderID)
+	}
 
-	return results
+	log.Printf("证书 %s 开始部署...", certData.Domain)
+	tr := beginDeployState(certData, pending, plan)
+
+	// 根据模式选择部署方式
+	var deployResults []Result
+	if certCfg.AutoBindMode {
+		// 自动绑定模式：按已有绑定更换证书
+		deployResults = deployCertAutoMode(ctx, env, certData, privateKey, certCfg, plan, tr)
+	} else {
+		// 规则绑定模式：按配置的绑定规则部署
+		deployResults = deployCertWithRules(ctx, env, certData, privateKey, certCfg, plan, tr)
+	}
+	out.results = append(out.results, deployResults...)
+
+	// 部署后动作（至少有一个绑定成功时执行）
+	if ctx.Err() != nil && len(certCfg.PostActions) > 0 {
+		log.Printf("证书 %s %v，跳过部署后动作", certCfg.Domain, errCertTimeout)
+		out.results = append(out.results, Result{Domain: certCfg.Domain, Success: false, Message: errCertTimeout.Error() + "，未执行部署后动作", OrderID: certData.OrderID})
+	} else {
+		out.results = append(out.results, runPostActions(ctx, certCfg, deployResults, plan)...)
+	}
+	tr.finish(deployResults)
+	recordReplacement(prevOrderID, certData, deployResults, plan)
+	for _, r := range deployResults {
+		if r.Success {
+			out.expires = certExpiresAt(certData)
+			break
+		}
+	}
+
+	return out
 }
 
+// errCertTimeout 超过单证书部署时限
+var errCertTimeout = errors.New("超过单证书部署时限")
+
 // deployCertWithRules 使用绑定规则部署证书
-func deployCertWithRules(certData *api.CertData, privateKey string, certCfg config.CertConfig, client *api.Client, isIIS7 bool, conflicts map[string][]int, allCerts []config.CertConfig) []Result {
+// ctx: 单证书部署时限，超时后剩余的绑定不再执行
+// plan: 非 nil 时只记录动作（预演）
+// tr: 部署进度，每一步落盘用于中断后恢复
+func deployCertWithRules(ctx context.Context, env *runEnv, certData *api.CertData, privateKey string, certCfg config.CertConfig, plan *Plan, tr *stateTracker) []Result {
 	results := make([]Result, 0)
 
-	// 转换 PEM 到 PFX
-	pfxPath, err := cert.PEMToPFX(
-		certData.Certificate,
-		privateKey,
-		certData.CACert,
-		"",
-	)
-	if err != nil {
-		log.Printf("转换 PFX 失败: %v", err)
-		for _, rule := range certCfg.BindRules {
-			results = append(results, Result{
-				Domain:  rule.Domain,
-				Success: false,
-				Message: fmt.Sprintf("转换 PFX 失败: %v", err),
-				OrderID: certData.OrderID,
-			})
-		}
-		return results
+	// 转换并安装证书
+	thumbprint, err := installCert(certData, privateKey, plan, tr)
+	if err == nil && ctx.Err() != nil {
+		err = errCertTimeout
 	}
-	defer os.Remove(pfxPath)
-
-	// 安装证书
-	installResult, err := cert.InstallPFX(pfxPath, "")
-	if err != nil || !installResult.Success {
-		errMsg := ""
-		if err != nil {
-			errMsg = err.Error()
-		} else {
-			errMsg = installResult.ErrorMessage
-		}
-		log.Printf("安装证书失败: %s", errMsg)
+	if err != nil {
+		log.Printf("%v", err)
+		tr.fail(err)
 		for _, rule := range certCfg.BindRules {
 			results = append(results, Result{
 				Domain:  rule.Domain,
 				Success: false,
-				Message: fmt.Sprintf("安装证书失败: %s", errMsg),
+				Message: err.Error(),
 				OrderID: certData.OrderID,
 			})
 		}
 		return results
 	}
 
-	thumbprint := installResult.Thumbprint
-	log.Printf("证书安装成功: %s", thumbprint)
-
 	// IIS7 处理：修改友好名称
-	if isIIS7 && len(certCfg.BindRules) > 0 {
+	if env.isIIS7 && len(certCfg.BindRules) > 0 {
 		wildcardName := cert.GetWildcardName(certCfg.Domain)
-		if err := cert.SetFriendlyName(thumbprint, wildcardName); err != nil {
+		if plan.Active() {
+			plan.Add(Action{Kind: ActionFriendlyName, OrderID: certData.OrderID, Domain: certCfg.Domain, NewHash: thumbprint, Detail: wildcardName})
+		} else if err := cert.SetFriendlyName(thumbprint, wildcardName); err != nil {
 			log.Printf("设置友好名称失败: %v", err)
 		} else {
 			log.Printf("已设置友好名称: %s", wildcardName)
+			tr.advance(cert.StepFriendlyName)
 		}
 	}
 
-	// 绑定到 IIS
-	for _, rule := range certCfg.BindRules {
+	// 绑定到 IIS（site/pattern 规则按当前 IIS 绑定展开）
+	tr.advance(cert.StepBinding)
+	for _, rule := range expandBindRules(env, certCfg, plan, certData.OrderID) {
+		if ctx.Err() != nil {
+			results = append(results, Result{Domain: rule.Domain, Success: false, Message: errCertTimeout.Error() + "，未绑定", Thumbprint: thumbprint, OrderID: certData.OrderID})
+			continue
+		}
+
 		// 检查是否有域名冲突，如果有则检查是否应该使用此证书
-		if conflictIndexes, hasConflict := conflicts[rule.Domain]; hasConflict {
-			bestCert := selectBestCertForDomainByIndexes(conflictIndexes, allCerts)
+		if conflictIndexes, hasConflict := env.conflicts[util.ToASCII(rule.Domain)]; hasConflict {
+			bestCert := selectBestCertForDomainByIndexes(conflictIndexes, env.allCerts)
 			if bestCert == nil || bestCert.OrderID != certCfg.OrderID {
 				log.Printf("域名 %s 存在冲突，跳过（将由其他证书处理）", rule.Domain)
+				plan.Add(Action{Kind: ActionSkip, OrderID: certData.OrderID, Domain: rule.Domain, Detail: "域名冲突，由其他证书处理"})
 				continue
 			}
 		}
@@ -236,47 +434,242 @@ func deployCertWithRules(certData *api.CertData, privateKey string, certCfg conf
 		}
 
 		log.Printf("绑定证书到 %s:%d", rule.Domain, port)
+		results = append(results, bindRule(ctx, env, certData, thumbprint, rule, port, plan, tr)...)
+	}
+	tr.advance(cert.StepBound)
 
-		var bindErr error
-		if isIIS7 {
-			// IIS7 使用 IP:Port 绑定
-			bindErr = iis.BindCertificateByIP("0.0.0.0", port, thumbprint)
-		} else {
-			// IIS8+ 使用 SNI 绑定
-			bindErr = iis.BindCertificate(rule.Domain, port, thumbprint)
+	return results
+}
+
+// bindRule 按绑定规则部署：解析目标站点，确保站点有 HTTPS 绑定且 sslFlags 正确，再绑定证书
+// 每个站点一条结果；没有站点使用该主机名时只绑定 HTTP.sys 证书（结果不带站点）
+// IIS7 使用 IP:Port 绑定，不按主机名管理站点绑定
+// ctx 为单证书部署时限，netsh 绑定和握手校验在其到期时中止
+func bindRule(ctx context.Context, env *runEnv, certData *api.CertData, thumbprint string, rule config.BindRule, port int, plan *Plan, tr *stateTracker) []Result {
+	orderID := certData.OrderID
+	failAll := func(siteNames []string, message string) []Result {
+		if len(siteNames) == 0 {
+			siteNames = []string{rule.SiteName}
+		}
+		results := make([]Result, 0, len(siteNames))
+		for _, name := range siteNames {
+			results = append(results, Result{Domain: rule.Domain, SiteName: name, Success: false, Message: message, Thumbprint: thumbprint, OrderID: orderID})
 		}
+		sendCallback(env.client, orderID, rule.Domain, false, message, plan)
+		return results
+	}
 
-		if bindErr != nil {
-			log.Printf("绑定失败: %v", bindErr)
-			results = append(results, Result{
-				Domain:     rule.Domain,
-				Success:    false,
-				Message:    fmt.Sprintf("绑定失败: %v", bindErr),
-				Thumbprint: thumbprint,
-				OrderID:    certData.OrderID,
-			})
-			sendCallback(client, certData.OrderID, rule.Domain, false, "绑定失败: "+bindErr.Error())
+	// IP 证书没有主机名可供 SNI 选择，绑定到该 IP 的 ipport
+	isIP := net.ParseIP(rule.Domain) != nil
+	target := bindTarget{Host: rule.Domain, Port: port, ByIP: isIP, ServerName: rule.Domain}
+	var siteNames []string
+	if env.isIIS7 {
+		if !isIP {
+			target.Host = "0.0.0.0"
+		}
+		target.ByIP = true
+	} else {
+		var err error
+		siteNames, err = ruleSites(rule, port)
+		if err != nil {
+			log.Printf("绑定失败: %v", err)
+			return failAll(nil, fmt.Sprintf("绑定失败: %v", err))
+		}
+		if len(siteNames) == 0 {
+			log.Printf("警告: 没有站点使用主机名 %s，只绑定 HTTP.sys 证书", rule.Domain)
+		}
+	}
+
+	// 先准备站点绑定，HTTP.sys 证书绑定后握手校验才能访问到站点
+	notes := make(map[string]string)
+	siteErrs := make(map[string]error)
+	for _, name := range siteNames {
+		note, err := ensureSiteBinding(name, rule.Domain, port, plan, orderID)
+		if err != nil {
+			log.Printf("站点 %s 绑定失败: %v", name, err)
+			siteErrs[name] = err
+			continue
+		}
+		notes[name] = note
+	}
+	if len(siteNames) > 0 && len(notes) == 0 {
+		results := make([]Result, 0, len(siteNames))
+		for _, name := range siteNames {
+			results = append(results, Result{Domain: rule.Domain, SiteName: name, Success: false, Message: fmt.Sprintf("站点绑定失败: %v", siteErrs[name]), Thumbprint: thumbprint, OrderID: orderID})
+		}
+		sendCallback(env.client, orderID, rule.Domain, false, "站点绑定失败: "+siteErrs[siteNames[0]].Error(), plan)
+		return results
+	}
+
+	bound, bindErr := bindAndVerify(ctx, target, thumbprint, certData.CACert, env.verifyTLS, plan, orderID, tr)
+	oldThumbprint, unchanged := bound.OldHash, bound.Unchanged
+	if bindErr != nil {
+		log.Printf("绑定失败: %v", bindErr)
+		return failAll(siteNames, fmt.Sprintf("绑定失败: %v", bindErr))
+	}
+
+	if len(siteNames) == 0 {
+		siteNames = []string{rule.SiteName}
+	}
+	results := make([]Result, 0, len(siteNames))
+	changed := !unchanged
+	for _, name := range siteNames {
+		if err, failed := siteErrs[name]; failed {
+			results = append(results, Result{Domain: rule.Domain, SiteName: name, Success: false, Message: fmt.Sprintf("站点绑定失败: %v", err), Thumbprint: thumbprint, OrderID: orderID})
+			continue
+		}
+
+		message := "部署成功"
+		siteUnchanged := unchanged && notes[name] == ""
+		if siteUnchanged {
+			message = "证书未变化"
 		} else {
-			log.Printf("绑定成功: %s", rule.Domain)
-			results = append(results, Result{
-				Domain:     rule.Domain,
-				Success:    true,
-				Message:    "部署成功",
-				Thumbprint: thumbprint,
-				OrderID:    certData.OrderID,
-			})
-			sendCallback(client, certData.OrderID, rule.Domain, true, "")
+			changed = true
+			log.Printf("绑定成功: %s (站点: %s)", rule.Domain, name)
+		}
+		if notes[name] != "" {
+			message = fmt.Sprintf("%s（%s）", message, notes[name])
+		}
+		message = withNote(message, bound.Note)
+		if name == "" && !env.isIIS7 {
+			message += "（没有站点使用该主机名，只绑定了 HTTP.sys 证书）"
+		}
+
+		// 跳转和 HSTS 属于附加配置，失败不影响证书部署结果
+		siteRule := rule
+		siteRule.SiteName = name
+		if err := applyHTTPSPolicy(siteRule, port, plan, orderID); err != nil {
+			log.Printf("警告: %v", err)
+			message = fmt.Sprintf("%s（%v）", message, err)
 		}
+		results = append(results, Result{
+			Domain:        rule.Domain,
+			SiteName:      name,
+			Success:       true,
+			Message:       message,
+			Thumbprint:    thumbprint,
+			OldThumbprint: oldThumbprint,
+			OrderID:       orderID,
+			Unchanged:     siteUnchanged,
+		})
 	}
 
+	// 未变化的绑定不重复回调
+	if changed {
+		sendCallback(env.client, orderID, rule.Domain, true, "", plan)
+	}
 	return results
 }
 
+// installCert 转换 PFX 并安装证书，返回证书指纹
+// 同一证书已在本机存储中（序列号和指纹一致且带私钥）时直接复用，不重复导入
+// 预演模式下只从 PEM 计算指纹
+func installCert(certData *api.CertData, privateKey string, plan *Plan, tr *stateTracker) (string, error) {
+	if thumbprint := tr.installedThumbprint(); thumbprint != "" {
+		log.Printf("证书已在上次部署中安装: %s", thumbprint)
+		return thumbprint, nil
+	}
+
+	parsed, err := cert.ParseCertificate(certData.Certificate)
+	if err != nil {
+		return "", fmt.Errorf("解析证书失败: %w", err)
+	}
+	thumbprint, err := cert.GetCertThumbprint(certData.Certificate)
+	if err != nil {
+		return "", fmt.Errorf("解析证书失败: %w", err)
+	}
+
+	exists, existing, err := cert.IsCertExists(parsed.SerialNumber.Text(16))
+	if err != nil {
+		log.Printf("查询证书存储失败: %v", err)
+	}
+	if exists && strings.EqualFold(existing.Thumbprint, thumbprint) && existing.HasPrivKey {
+		log.Printf("证书已在本机存储中，直接使用: %s", thumbprint)
+		plan.Add(Action{Kind: ActionSkip, OrderID: certData.OrderID, Domain: certData.Domain, NewHash: thumbprint, Detail: "证书已安装"})
+		// 不是本次安装的证书，中断清理时不删除
+		tr.markInstalled(thumbprint, true)
+		return thumbprint, nil
+	}
+
+	if plan.Active() {
+		plan.Add(Action{Kind: ActionInstallCert, OrderID: certData.OrderID, Domain: certData.Domain, NewHash: thumbprint, Detail: "LocalMachine\\My"})
+		return thumbprint, nil
+	}
+
+	pfxPath, err := cert.PEMToPFX(certData.Certificate, privateKey, certData.CACert, "")
+	if err != nil {
+		return "", fmt.Errorf("转换 PFX 失败: %v", err)
+	}
+	defer os.Remove(pfxPath)
+
+	installResult, err := cert.InstallPFX(pfxPath, "")
+	if err != nil {
+		return "", fmt.Errorf("安装证书失败: %v", err)
+	}
+	if !installResult.Success {
+		return "", fmt.Errorf("安装证书失败: %s", installResult.ErrorMessage)
+	}
+
+	log.Printf("证书安装成功: %s", installResult.Thumbprint)
+	tr.markInstalled(installResult.Thumbprint, false)
+	return installResult.Thumbprint, nil
+}
+
+// applyHTTPSPolicy 按绑定规则配置 HTTP 跳转和 HSTS
+func applyHTTPSPolicy(rule config.BindRule, port int, plan *Plan, orderID int) error {
+	if rule.ForceHTTPS == nil && rule.HSTS == nil {
+		return nil
+	}
+
+	policy := iis.HTTPSPolicy{ForceHTTPS: rule.ForceHTTPS}
+	if rule.HSTS != nil {
+		value := rule.HSTS.HeaderValue()
+		policy.HSTS = &value
+	}
+
+	siteName := rule.SiteName
+	if siteName == "" {
+		httpsMatches, _, err := iis.FindMatchingBindings([]string{rule.Domain})
+		if err != nil {
+			return fmt.Errorf("查找站点失败: %w", err)
+		}
+		for _, m := range httpsMatches {
+			if m.Port == port {
+				siteName = m.SiteName
+				break
+			}
+		}
+		if siteName == "" {
+			return fmt.Errorf("未找到域名 %s 的 HTTPS 站点，跳过跳转和 HSTS 配置", rule.Domain)
+		}
+	}
+
+	if plan.Active() {
+		detail := make([]string, 0, 2)
+		if policy.ForceHTTPS != nil {
+			detail = append(detail, fmt.Sprintf("force_https=%v", *policy.ForceHTTPS))
+		}
+		if policy.HSTS != nil {
+			detail = append(detail, fmt.Sprintf("hsts=%q", *policy.HSTS))
+		}
+		plan.Add(Action{Kind: ActionHTTPSPolicy, OrderID: orderID, Domain: rule.Domain, Target: siteName, Detail: strings.Join(detail, ", ")})
+		return nil
+	}
+
+	// 多个证书可能共用同一站点的 web.config
+	bindMu.Lock()
+	defer bindMu.Unlock()
+	return iis.ApplyHTTPSPolicy(siteName, rule.Domain, port, policy)
+}
+
 // handleLocalKeyMode 处理本地私钥模式
-// renewDays: 到期前多少天发起续签（默认15天，需大于服务端自动续签的14天）
+// renewDays: 全局续签天数（默认15天，需大于服务端自动续签的14天），证书配置的 Renewal 优先
 // 返回: 证书数据, 私钥, 跳过原因, 错误
 // 当返回 certData=nil 且 error=nil 时，reason 说明跳过原因
-func handleLocalKeyMode(client *api.Client, certCfg *config.CertConfig, renewDays int) (*api.CertData, string, string, error) {
+// resume: 上次部署中断，跳过续签时间检查
+// force: 强制部署，跳过续签时间检查（使用当前证书，不重新提交 CSR）
+// plan: 非 nil 时不写验证文件、不提交 CSR，只记录动作
+func handleLocalKeyMode(client *api.Client, certCfg *config.CertConfig, renewDays int, resume, force bool, plan *Plan) (*api.CertData, string, string, error) {
 	// 校验验证方法（校验证书的所有域名包括 SAN）
 	if certCfg.ValidationMethod != "" {
 		if errMsg := config.ValidateValidationMethod(certCfg.Domain, certCfg.ValidationMethod); errMsg != "" {
@@ -297,7 +690,9 @@ func handleLocalKeyMode(client *api.Client, certCfg *config.CertConfig, renewDay
 			// 处理中状态：检查是否需要文件验证
 			if certData.File != nil && certData.File.Path != "" {
 				log.Printf("订单 %d 需要文件验证", certCfg.OrderID)
-				if err := handleFileValidation(certCfg.Domain, certData.File); err != nil {
+				if plan.Active() {
+					plan.Add(Action{Kind: ActionFileValidation, OrderID: certCfg.OrderID, Domain: certCfg.Domain, Target: certData.File.Path})
+				} else if err := handleFileValidation(certCfg.Domain, certData.File); err != nil {
 					log.Printf("创建验证文件失败: %v", err)
 				} else {
 					log.Printf("验证文件已创建，等待 CA 验证")
@@ -308,16 +703,25 @@ func handleLocalKeyMode(client *api.Client, certCfg *config.CertConfig, renewDay
 			return nil, "", "CSR 已提交，等待签发", nil
 		} else if certData.Status == "active" {
 			// 检查证书是否需要续签
-			expiresAt, err := time.Parse("2006-01-02", certData.ExpiresAt)
+			notBefore, notAfter, err := certValidity(certData)
 			if err != nil {
-				log.Printf("解析过期时间失败: %v，继续检查私钥", err)
+				log.Printf("无法确定证书过期时间: %v，继续检查私钥", err)
 			} else {
-				daysUntilExpiry := int(time.Until(expiresAt).Hours() / 24)
-				if daysUntilExpiry > renewDays {
-					log.Printf("证书 %s 还有 %d 天过期，未到续签时间（>%d天）", certData.Domain, daysUntilExpiry, renewDays)
-					return nil, "", fmt.Sprintf("未到续签时间（还有 %d 天）", daysUntilExpiry), nil
+				decision := decideRenewal(renewalInput{
+					LocalKey:   true,
+					GlobalDays: renewDays,
+					Override:   certCfg.Renewal,
+					NotBefore:  notBefore,
+					NotAfter:   notAfter,
+					Resume:     resume,
+					Force:      force,
+					Now:        time.Now(),
+				})
+				if !decision.Due {
+					log.Printf("证书 %s 还有 %d 天过期，未到续签时间（剩余 %s 时续签）", certData.Domain, decision.DaysLeft, decision.Threshold)
+					return nil, "", decision.Reason, nil
 				}
-				log.Printf("证书 %s 还有 %d 天过期，需要续签（<=%d天）", certData.Domain, daysUntilExpiry, renewDays)
+				log.Printf("证书 %s 还有 %d 天过期，需要续签（剩余 %s 时续签）", certData.Domain, decision.DaysLeft, decision.Threshold)
 			}
 
 			// 检查本地是否有私钥
@@ -333,12 +737,18 @@ func handleLocalKeyMode(client *api.Client, certCfg *config.CertConfig, renewDay
 					log.Printf("验证密钥匹配失败: %v", err)
 				} else if matched {
 					log.Printf("使用本地私钥（订单 %d）", certCfg.OrderID)
-					orderStore.SaveCertificate(certCfg.OrderID, certData.Certificate, certData.CACert)
-					updateOrderMeta(certCfg.OrderID, certData)
+					if !plan.Active() {
+						orderStore.SaveCertificate(certCfg.OrderID, certData.Certificate, certData.CACert)
+						updateOrderMeta(certCfg.OrderID, certData)
+					}
 					return certData, localKey, "", nil
 				} else {
 					log.Printf("本地私钥与证书不匹配，需要重新生成 CSR")
-					orderStore.DeleteOrder(certCfg.OrderID)
+					if plan.Active() {
+						plan.Add(Action{Kind: ActionDeleteLocalKey, OrderID: certCfg.OrderID, Domain: certCfg.Domain, Detail: "本地私钥与证书不匹配"})
+					} else {
+						orderStore.DeleteOrder(certCfg.OrderID)
+					}
 				}
 			}
 			// 没有本地私钥，但证书已签发
@@ -350,6 +760,11 @@ func handleLocalKeyMode(client *api.Client, certCfg *config.CertConfig, renewDay
 	}
 
 	// 需要生成新的 CSR 并提交
+	if plan.Active() {
+		plan.Add(Action{Kind: ActionSubmitCSR, OrderID: certCfg.OrderID, Domain: certCfg.Domain, Detail: strings.Join(certCfg.Domains, ", ")})
+		return nil, "", "", nil
+	}
+
 	log.Printf("生成新的 CSR")
 	keyPEM, csrPEM, err := cert.GenerateCSR(certCfg.Domain, certCfg.Domains)
 	if err != nil {
@@ -396,14 +811,19 @@ func handleLocalKeyMode(client *api.Client, certCfg *config.CertConfig, renewDay
 
 // checkDomainConflicts 检查域名冲突（同一域名配置在多个证书中）
 func checkDomainConflicts(certs []config.CertConfig) map[string][]int {
-	conflicts := make(map[string][]int) // domain -> []certIndex
+	conflicts := make(map[string][]int) // domain（A-label）-> []certIndex
 
 	for i, cert := range certs {
 		if !cert.Enabled {
 			continue
 		}
 		for _, rule := range cert.BindRules {
-			conflicts[rule.Domain] = append(conflicts[rule.Domain], i)
+			// site/pattern 规则部署时展开，展开后的主机名按 isPreferredCertForHost 判断
+			if rule.Expands() {
+				continue
+			}
+			key := util.ToASCII(rule.Domain)
+			conflicts[key] = append(conflicts[key], i)
 		}
 	}
 
@@ -466,34 +886,59 @@ func parseCertExpiry(value string) (time.Time, bool) {
 	if value == "" {
 		return time.Time{}, false
 	}
-	parsed, err := time.Parse("2006-01-02", value)
+	parsed, err := cert.ParseExpiresAt(value)
 	if err != nil {
 		return time.Time{}, false
 	}
 	return parsed, true
 }
+
+// updateOrderMeta 更新订单元数据，保留已记录的证书指纹和被替换证书列表
 func updateOrderMeta(orderID int, certData *api.CertData) {
-	meta := &cert.OrderMeta{
-		OrderID:      orderID,
-		Domain:       certData.Domain,
-		Domains:      certData.GetDomainList(),
-		Status:       certData.Status,
-		ExpiresAt:    certData.ExpiresAt,
-		CreatedAt:    certData.CreatedAt,
-		LastDeployed: time.Now().Format("2006-01-02 15:04:05"),
+	meta, err := orderStore.LoadMeta(orderID)
+	if err != nil {
+		meta = newOrderMeta(orderID, certData)
+	} else {
+		meta.Domain = certData.Domain
+		meta.Domains = certData.GetDomainList()
+		meta.Status = certData.Status
+		meta.ExpiresAt = certExpiresAt(certData)
+		meta.CreatedAt = certData.CreatedAt
 	}
+	meta.LastDeployed = time.Now().Format("2006-01-02 15:04:05")
 	if err := orderStore.SaveMeta(orderID, meta); err != nil {
 		log.Printf("保存订单元数据失败: %v", err)
 	}
 }
 
+// newOrderMeta 根据证书数据创建订单元数据
+func newOrderMeta(orderID int, certData *api.CertData) *cert.OrderMeta {
+	return &cert.OrderMeta{
+		OrderID:   orderID,
+		Domain:    certData.Domain,
+		Domains:   certData.GetDomainList(),
+		Status:    certData.Status,
+		ExpiresAt: certExpiresAt(certData),
+		CreatedAt: certData.CreatedAt,
+	}
+}
+
 // sendCallback 发送部署回调
-func sendCallback(client *api.Client, orderID int, domain string, success bool, message string) {
+func sendCallback(client *api.Client, orderID int, domain string, success bool, message string, plan *Plan) {
 	status := "success"
 	if !success {
 		status = "failure"
 	}
 
+	if plan.Active() {
+		plan.Add(Action{Kind: ActionCallback, OrderID: orderID, Domain: domain, Detail: status})
+		return
+	}
+	if client == nil {
+		// 手动绑定（命令行 bind）没有订单，不回调
+		return
+	}
+
 	req := &api.CallbackRequest{
 		OrderID:    orderID,
 		Domain:     domain,
@@ -510,30 +955,29 @@ func sendCallback(client *api.Client, orderID int, domain string, success bool,
 
 // CheckAndDeploy 检查并部署（命令行模式入口）
 func CheckAndDeploy() error {
-	cfg, err := config.Load()
+	results, err := Deploy("auto", DeployOptions{})
 	if err != nil {
-		return fmt.Errorf("加载配置失败: %v", err)
+		return err
 	}
 
-	if len(cfg.Certificates) == 0 {
-		return fmt.Errorf("没有配置任何证书，请先运行 GUI 模式添加配置")
-	}
-
-	results := AutoDeploy(cfg)
-
 	successCount := 0
+	unchangedCount := 0
 	failCount := 0
 	for _, r := range results {
-		if r.Success {
+		switch {
+		case r.Unchanged:
+			unchangedCount++
+			log.Printf("[未变化] %s: %s", r.Label(), r.Message)
+		case r.Success:
 			successCount++
-			log.Printf("[成功] %s: %s", r.Domain, r.Message)
-		} else {
+			log.Printf("[成功] %s: %s", r.Label(), r.Message)
+		default:
 			failCount++
-			log.Printf("[失败] %s: %s", r.Domain, r.Message)
+			log.Printf("[失败] %s: %s", r.Label(), r.Message)
 		}
 	}
 
-	log.Printf("部署完成: 成功 %d, 失败 %d", successCount, failCount)
+	log.Printf("部署完成: 成功 %d, 未变化 %d, 失败 %d", successCount, unchangedCount, failCount)
 
 	if failCount > 0 {
 		return fmt.Errorf("部分证书部署失败")
@@ -542,32 +986,51 @@ func CheckAndDeploy() error {
 	return nil
 }
 
-// deployCertAutoMode 自动绑定模式部署
-// 查找 IIS 中已有的 SSL 绑定，更换证书
-func deployCertAutoMode(certData *api.CertData, privateKey string, certCfg config.CertConfig, client *api.Client, isIIS7 bool) []Result {
-	results := make([]Result, 0)
+// Deploy 获取部署锁后按选项部署配置中的证书（计划任务和命令行 deploy 子命令共用）
+// owner 为部署锁的持有者；GUI 正在部署时等待其完成，避免重复提交 CSR、互相覆盖配置
+func Deploy(owner string, opts DeployOptions) ([]Result, error) {
+	lock, err := AcquireRunLock(owner, 30*time.Minute)
+	if err != nil {
+		return nil, err
+	}
+	defer lock.Release()
 
-	// 1. 转换并安装证书
-	pfxPath, err := cert.PEMToPFX(certData.Certificate, privateKey, certData.CACert, "")
+	cfg, err := config.Load()
 	if err != nil {
-		log.Printf("转换 PFX 失败: %v", err)
-		return []Result{{Domain: certCfg.Domain, Success: false, Message: fmt.Sprintf("转换 PFX 失败: %v", err), OrderID: certData.OrderID}}
+		return nil, fmt.Errorf("加载配置失败: %v", err)
 	}
-	defer os.Remove(pfxPath)
 
-	installResult, err := cert.InstallPFX(pfxPath, "")
-	if err != nil || !installResult.Success {
-		errMsg := "安装失败"
-		if err != nil {
-			errMsg = err.Error()
-		} else if installResult.ErrorMessage != "" {
-			errMsg = installResult.ErrorMessage
+	if len(cfg.Certificates) == 0 {
+		return nil, fmt.Errorf("没有配置任何证书，请先运行 GUI 模式添加配置")
+	}
+	if opts.OrderID > 0 {
+		c := cfg.GetCertificateByOrderID(opts.OrderID)
+		if c == nil {
+			return nil, fmt.Errorf("订单 %d 不在配置中", opts.OrderID)
+		}
+		if !c.Enabled {
+			return nil, fmt.Errorf("订单 %d 已停用", opts.OrderID)
 		}
-		return []Result{{Domain: certCfg.Domain, Success: false, Message: errMsg, OrderID: certData.OrderID}}
 	}
 
-	thumbprint := installResult.Thumbprint
-	log.Printf("证书安装成功: %s", thumbprint)
+	return autoDeploy(cfg, opts, nil), nil
+}
+
+// deployCertAutoMode 自动绑定模式部署
+// 查找 IIS 中已有的 SSL 绑定，更换证书
+func deployCertAutoMode(ctx context.Context, env *runEnv, certData *api.CertData, privateKey string, certCfg config.CertConfig, plan *Plan, tr *stateTracker) []Result {
+	results := make([]Result, 0)
+
+	// 1. 转换并安装证书
+	thumbprint, err := installCert(certData, privateKey, plan, tr)
+	if err == nil && ctx.Err() != nil {
+		err = errCertTimeout
+	}
+	if err != nil {
+		log.Printf("%v", err)
+		tr.fail(err)
+		return []Result{{Domain: certCfg.Domain, Success: false, Message: err.Error(), OrderID: certData.OrderID}}
+	}
 
 	// 2. 查找 IIS 中匹配的绑定
 	allDomains := certCfg.Domains
@@ -580,39 +1043,160 @@ func deployCertAutoMode(certData *api.CertData, privateKey string, certCfg confi
 		log.Printf("查找 IIS 绑定失败: %v", err)
 	}
 
-	if len(matchedBindings) == 0 {
+	// 查找只有 HTTP 绑定的匹配站点（需开启 AutoAddHTTPS）
+	var httpMatches []iis.HttpBindingMatch
+	if certCfg.AutoAddHTTPS {
+		if env.isIIS7 {
+			log.Printf("IIS7 兼容模式不支持 SNI，跳过自动添加 HTTPS 绑定")
+		} else {
+			_, httpMatches, err = iis.FindMatchingBindings(allDomains)
+			if err != nil {
+				log.Printf("查找 HTTP 绑定失败: %v", err)
+			}
+		}
+	}
+
+	if len(matchedBindings) == 0 && len(httpMatches) == 0 {
 		log.Printf("未找到 IIS 中的 SSL 绑定，跳过")
 		return results
 	}
 
 	// 3. 更新匹配的绑定
-	for domain, binding := range matchedBindings {
+	tr.advance(cert.StepBinding)
+	// 按域名排序，保证结果顺序稳定
+	domains := make([]string, 0, len(matchedBindings))
+	for domain := range matchedBindings {
+		domains = append(domains, domain)
+	}
+	sort.Strings(domains)
+
+	for _, domain := range domains {
+		binding := matchedBindings[domain]
+		if ctx.Err() != nil {
+			results = append(results, Result{Domain: domain, Success: false, Message: errCertTimeout.Error() + "，未绑定", Thumbprint: thumbprint, OrderID: certData.OrderID})
+			continue
+		}
+
 		host := iis.ParseHostFromBinding(binding.HostnamePort)
 		port := iis.ParsePortFromBinding(binding.HostnamePort)
 
 		log.Printf("更新绑定: %s:%d", host, port)
 
-		var bindErr error
-		if isIIS7 || isIPBinding(binding.HostnamePort) {
-			bindErr = iis.BindCertificateByIP(host, port, thumbprint)
-		} else {
-			bindErr = iis.BindCertificate(host, port, thumbprint)
+		target := bindTarget{
+			Host:       host,
+			Port:       port,
+			ByIP:       env.isIIS7 || isIPBinding(binding.HostnamePort),
+			ServerName: domain,
 		}
+		bound, bindErr := bindAndVerify(ctx, target, thumbprint, certData.CACert, env.verifyTLS, plan, certData.OrderID, tr)
+		oldThumbprint, unchanged := bound.OldHash, bound.Unchanged
 
 		if bindErr != nil {
 			log.Printf("绑定失败: %v", bindErr)
 			results = append(results, Result{Domain: domain, Success: false, Message: bindErr.Error(), Thumbprint: thumbprint, OrderID: certData.OrderID})
-			sendCallback(client, certData.OrderID, domain, false, bindErr.Error())
+			sendCallback(env.client, certData.OrderID, domain, false, bindErr.Error(), plan)
+		} else if unchanged {
+			// 未变化的绑定不重复回调
+			results = append(results, Result{Domain: domain, Success: true, Message: "证书未变化", Thumbprint: thumbprint, OldThumbprint: oldThumbprint, OrderID: certData.OrderID, Unchanged: true})
 		} else {
 			log.Printf("绑定成功: %s", domain)
-			results = append(results, Result{Domain: domain, Success: true, Message: "部署成功", Thumbprint: thumbprint, OrderID: certData.OrderID})
-			sendCallback(client, certData.OrderID, domain, true, "")
+			results = append(results, Result{Domain: domain, Success: true, Message: withNote("部署成功", bound.Note), Thumbprint: thumbprint, OldThumbprint: oldThumbprint, OrderID: certData.OrderID})
+			sendCallback(env.client, certData.OrderID, domain, true, "", plan)
+		}
+	}
+
+	// 4. 为只有 HTTP 绑定的站点添加 HTTPS 绑定
+	for _, match := range httpMatches {
+		if _, exists := matchedBindings[match.Host]; exists {
+			continue
+		}
+		if ctx.Err() != nil {
+			results = append(results, Result{Domain: match.Host, Success: false, Message: errCertTimeout.Error() + "，未添加 HTTPS 绑定", Thumbprint: thumbprint, OrderID: certData.OrderID})
+			continue
+		}
+		if !isPreferredCertForHost(match.Host, certCfg, env.allCerts) {
+			log.Printf("域名 %s 已由其他证书管理，跳过添加 HTTPS 绑定", match.Host)
+			continue
+		}
+
+		log.Printf("添加 HTTPS 绑定: %s:%d (站点: %s)", match.Host, match.Port, match.SiteName)
+
+		var bindErr error
+		if plan.Active() {
+			plan.Add(Action{Kind: ActionAddBinding, OrderID: certData.OrderID, Domain: match.Host, Target: fmt.Sprintf("%s (站点: %s)", net.JoinHostPort(match.Host, strconv.Itoa(match.Port)), match.SiteName)})
+		} else {
+			bindMu.Lock()
+			bindErr = iis.AddHttpsBindingWithCert(match.SiteName, match.Host, match.Port, thumbprint)
+			bindMu.Unlock()
+		}
+		var bound bindOutcome
+		if bindErr == nil {
+			target := bindTarget{Host: match.Host, Port: match.Port, ServerName: match.Host}
+			bound, bindErr = bindAndVerify(ctx, target, thumbprint, certData.CACert, env.verifyTLS, plan, certData.OrderID, tr)
+		}
+
+		if bindErr != nil {
+			log.Printf("添加 HTTPS 绑定失败: %v", bindErr)
+			results = append(results, Result{Domain: match.Host, Success: false, Message: fmt.Sprintf("添加 HTTPS 绑定失败: %v", bindErr), Thumbprint: thumbprint, OrderID: certData.OrderID})
+			sendCallback(env.client, certData.OrderID, match.Host, false, bindErr.Error(), plan)
+		} else {
+			log.Printf("已添加 HTTPS 绑定: %s (站点: %s)", match.Host, match.SiteName)
+			results = append(results, Result{Domain: match.Host, Success: true, Message: withNote(fmt.Sprintf("已添加 HTTPS 绑定 (站点: %s)", match.SiteName), bound.Note), Thumbprint: thumbprint, OrderID: certData.OrderID})
+			sendCallback(env.client, certData.OrderID, match.Host, true, "", plan)
 		}
 	}
+	tr.advance(cert.StepBound)
 
 	return results
 }
 
+// withNote 在结果消息后附加说明
+func withNote(message, note string) string {
+	if note == "" {
+		return message
+	}
+	return fmt.Sprintf("%s（%s）", message, note)
+}
+
+// isPreferredCertForHost 判断主机是否应由当前证书负责
+// 多个启用的证书都覆盖该主机时，按到期最晚的规则选出一个，避免互相覆盖
+func isPreferredCertForHost(host string, certCfg config.CertConfig, allCerts []config.CertConfig) bool {
+	indexes := make([]int, 0)
+	for i, c := range allCerts {
+		if !c.Enabled {
+			continue
+		}
+		if certCoversHost(c, host) {
+			indexes = append(indexes, i)
+		}
+	}
+	if len(indexes) <= 1 {
+		return true
+	}
+
+	best := selectBestCertForDomainByIndexes(indexes, allCerts)
+	return best == nil || best.OrderID == certCfg.OrderID
+}
+
+// certCoversHost 检查证书配置（域名列表或绑定规则）是否覆盖主机
+func certCoversHost(c config.CertConfig, host string) bool {
+	domains := c.Domains
+	if len(domains) == 0 && c.Domain != "" {
+		domains = []string{c.Domain}
+	}
+	for _, d := range domains {
+		if iis.MatchDomainForBinding(host, d) {
+			return true
+		}
+	}
+	for _, rule := range c.BindRules {
+		if util.EqualDomain(rule.Domain, host) {
+			return true
+		}
+	}
+	return false
+}
+
 // handleFileValidation 处理文件验证
 // 在 IIS 站点目录下创建验证文件
 func handleFileValidation(domain string, file *api.FileValidation) error {
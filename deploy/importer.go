@@ -0,0 +1,197 @@
+package deploy
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"os"
+
+	"cert-deploy/api"
+	"cert-deploy/cert"
+	"cert-deploy/config"
+	"cert-deploy/iis"
+)
+
+// ImportOptions 从接口导入证书的选项（GUI 导入对话框和命令行 orders import 共用）
+type ImportOptions struct {
+	AutoUpdate       bool   // 添加自动更新配置
+	Profile          string // 证书使用的 API 配置（空为 default）
+	UseLocalKey      bool
+	ValidationMethod string
+}
+
+// ImportStatus 单个证书的导入状态
+type ImportStatus int
+
+const (
+	ImportInstalled ImportStatus = iota // 已安装
+	ImportSkipped                       // 证书已存在
+	ImportFailed                        // 转换或安装失败
+)
+
+// ImportResult 单个证书的导入结果
+type ImportResult struct {
+	Status     ImportStatus
+	Thumbprint string
+	ManualBind bool     // 没有匹配的 IIS 绑定，需要手动绑定
+	Lines      []string // 处理过程，每行一条
+}
+
+// ImportCert 安装接口返回的证书，绑定到匹配的 IIS 站点，按选项添加自动更新配置
+// 证书已存在（按序列号）时不重复安装，只补齐缺失的 HTTPS 绑定和配置
+// 调用方负责持有部署锁
+func ImportCert(data api.CertData, opts ImportOptions) ImportResult {
+	var r ImportResult
+	add := func(format string, args ...any) {
+		r.Lines = append(r.Lines, fmt.Sprintf(format, args...))
+	}
+
+	allDomains := data.GetDomainList()
+	if len(allDomains) == 0 && data.Domain != "" {
+		allDomains = []string{data.Domain}
+	}
+
+	// 检查证书是否已存在（按序列号）
+	serialNumber, err := cert.GetCertSerialNumber(data.Certificate)
+	if err == nil {
+		exists, existingCert, _ := cert.IsCertExists(serialNumber)
+		if exists && existingCert != nil {
+			r.Status = ImportSkipped
+			r.Thumbprint = existingCert.Thumbprint
+			add("- %s: 已存在 (指纹: %s...)", data.Domain, existingCert.Thumbprint[:16])
+
+			// 即使证书已存在，也检查并保存自动部署配置
+			if opts.AutoUpdate {
+				added, err := addImportedConfig(data, serialNumber, opts)
+				if err != nil {
+					add("  ! 保存自动更新配置失败: %v", err)
+				} else if added {
+					add("  → 已添加自动更新配置")
+				}
+			}
+
+			// 证书已存在，但仍需检查并添加缺失的 HTTPS 绑定
+			add("  [检查绑定] 证书域名: %v", allDomains)
+			_, httpMatches, _ := iis.FindMatchingBindings(allDomains)
+			if len(httpMatches) > 0 {
+				add("  [检查绑定] 发现 %d 个 HTTP 绑定需要添加 HTTPS", len(httpMatches))
+				for _, match := range httpMatches {
+					if err := iis.AddHttpsBinding(match.SiteName, match.Host, match.Port); err != nil {
+						add("  ! 添加HTTPS绑定失败 %s: %v", match.Host, err)
+						continue
+					}
+					if err := iis.BindCertificate(context.Background(), match.Host, match.Port, r.Thumbprint); err == nil {
+						add("  → 已添加绑定: %s:%d (站点: %s)", match.Host, match.Port, match.SiteName)
+					} else {
+						add("  ! 绑定证书失败 %s: %v", match.Host, err)
+					}
+				}
+			}
+			return r
+		}
+	}
+
+	// 将 PEM 转换为 PFX
+	pfxPath, err := cert.PEMToPFX(data.Certificate, data.PrivateKey, data.CACert, "")
+	if err != nil {
+		r.Status = ImportFailed
+		add("✗ %s: 转换失败 - %v", data.Domain, err)
+		return r
+	}
+
+	// 安装 PFX
+	result, err := cert.InstallPFX(pfxPath, "")
+	os.Remove(pfxPath)
+	if err != nil {
+		r.Status = ImportFailed
+		add("✗ %s: 安装失败 - %v", data.Domain, err)
+		return r
+	}
+	if !result.Success {
+		r.Status = ImportFailed
+		add("✗ %s: %s", data.Domain, result.ErrorMessage)
+		return r
+	}
+
+	r.Status = ImportInstalled
+	r.Thumbprint = result.Thumbprint
+	add("✓ %s: %s", data.Domain, result.Thumbprint)
+
+	// 尝试默认绑定
+	httpsMatches, httpMatches, findErr := iis.FindMatchingBindings(allDomains)
+	if findErr != nil {
+		add("  ! 查找绑定失败: %v", findErr)
+	}
+
+	// 1. 更新已有的 HTTPS 绑定
+	for _, match := range httpsMatches {
+		var bindErr error
+		if net.ParseIP(match.Host) != nil {
+			bindErr = iis.BindCertificateByIP(context.Background(), match.Host, match.Port, r.Thumbprint)
+		} else {
+			bindErr = iis.BindCertificate(context.Background(), match.Host, match.Port, r.Thumbprint)
+		}
+		if bindErr == nil {
+			add("  → 已更新绑定: %s:%d", match.Host, match.Port)
+		} else {
+			add("  ! 更新绑定失败 %s:%d: %v", match.Host, match.Port, bindErr)
+		}
+	}
+
+	// 2. 为 HTTP 绑定添加 HTTPS 绑定
+	for _, match := range httpMatches {
+		if err := iis.AddHttpsBinding(match.SiteName, match.Host, match.Port); err != nil {
+			add("  ! 添加HTTPS绑定失败 %s: %v", match.Host, err)
+			continue
+		}
+		if err := iis.BindCertificate(context.Background(), match.Host, match.Port, r.Thumbprint); err == nil {
+			add("  → 已添加绑定: %s:%d (站点: %s)", match.Host, match.Port, match.SiteName)
+		} else {
+			add("  ! 绑定证书失败 %s: %v", match.Host, err)
+		}
+	}
+
+	// 如果没有任何绑定，记录需要手动绑定
+	if len(httpsMatches) == 0 && len(httpMatches) == 0 {
+		add("  ! 未找到匹配的 IIS 绑定，请手动绑定")
+		r.ManualBind = true
+	}
+
+	if opts.AutoUpdate {
+		if _, err := addImportedConfig(data, serialNumber, opts); err != nil {
+			add("  ! 保存自动更新配置失败: %v", err)
+		}
+	}
+	return r
+}
+
+// addImportedConfig 为导入的证书添加自动更新配置，订单已在配置中时不修改
+// 返回是否新增了配置
+func addImportedConfig(data api.CertData, serialNumber string, opts ImportOptions) (bool, error) {
+	added := false
+	_, err := config.Update(func(cfg *config.Config) error {
+		if cfg.GetCertificateByOrderID(data.OrderID) != nil {
+			return config.ErrNoChanges
+		}
+		profile := opts.Profile
+		if profile == config.DefaultProfile {
+			profile = ""
+		}
+		cfg.AddCertificate(config.CertConfig{
+			OrderID:          data.OrderID,
+			Domain:           data.Domain,
+			Domains:          data.GetDomainList(),
+			ExpiresAt:        data.ExpiresAt,
+			SerialNumber:     serialNumber,
+			Enabled:          true,
+			Profile:          profile,
+			UseLocalKey:      opts.UseLocalKey,
+			ValidationMethod: opts.ValidationMethod,
+			AutoBindMode:     true,
+			BindRules:        []config.BindRule{},
+		})
+		added = true
+		return nil
+	})
+	return added, err
+}
@@ -0,0 +1,29 @@
+package deploy
+
+import (
+	"errors"
+	"path/filepath"
+	"time"
+
+	"cert-deploy/config"
+	"cert-deploy/util"
+)
+
+// 部署锁文件名（位于数据目录）
+const runLockFile = "deploy.lock"
+
+// AcquireRunLock 获取部署锁，保证同一时间只有一个进程执行部署
+// GUI 后台任务和计划任务（-auto）共用此锁；wait 为 0 时不等待
+func AcquireRunLock(owner string, wait time.Duration) (*util.FileLock, error) {
+	path := filepath.Join(config.GetDataDir(), runLockFile)
+	if wait <= 0 {
+		return util.TryLock(path, owner)
+	}
+	return util.WaitLock(path, owner, wait)
+}
+
+// IsAlreadyRunning 判断错误是否为已有部署任务在运行
+func IsAlreadyRunning(err error) bool {
+	var locked *util.LockedError
+	return errors.As(err, &locked)
+}
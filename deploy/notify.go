@@ -0,0 +1,90 @@
+package deploy
+
+import (
+	"fmt"
+	"time"
+
+	"cert-deploy/cert"
+	"cert-deploy/config"
+	"cert-deploy/notify"
+)
+
+// sendNotifications 发送本次部署结果和证书过期提醒
+func sendNotifications(cfg *config.Config, results []Result) {
+	if cfg.Notify == nil || len(cfg.Notify.Channels) == 0 {
+		return
+	}
+
+	now := time.Now()
+	events := make([]notify.Event, 0)
+	deployed := make(map[int]bool)
+	for _, r := range results {
+		if r.Unchanged {
+			continue
+		}
+		e := notify.Event{
+			Kind:       notify.KindDeployFailed,
+			Severity:   config.SeverityError,
+			OrderID:    r.OrderID,
+			Domain:     r.Label(),
+			Message:    r.Message,
+			Thumbprint: r.Thumbprint,
+			Time:       now,
+		}
+		if r.Success {
+			e.Kind = notify.KindDeploySuccess
+			e.Severity = config.SeverityInfo
+			deployed[r.OrderID] = true
+		}
+		events = append(events, e)
+	}
+
+	// 本次已部署新证书的订单不再提醒过期
+	warnDays := cfg.Notify.WarnDays()
+	for _, certCfg := range cfg.Certificates {
+		if !certCfg.Enabled || deployed[certCfg.OrderID] {
+			continue
+		}
+		expiresAt, thumbprint, ok := deployedExpiry(certCfg)
+		if !ok {
+			continue
+		}
+		daysLeft := cert.DaysUntil(expiresAt, now)
+		if daysLeft > warnDays {
+			continue
+		}
+		e := notify.Event{
+			Kind:       notify.KindExpiring,
+			Severity:   config.SeverityWarning,
+			OrderID:    certCfg.OrderID,
+			Domain:     certCfg.Domain,
+			Message:    fmt.Sprintf("证书还有 %d 天过期", daysLeft),
+			Thumbprint: thumbprint,
+			ExpiresAt:  expiresAt.Format("2006-01-02 15:04:05"),
+			DaysLeft:   daysLeft,
+			Time:       now,
+		}
+		if expiresAt.Before(now) {
+			e.Kind = notify.KindExpired
+			e.Severity = config.SeverityError
+			e.Message = "证书已过期"
+		}
+		events = append(events, e)
+	}
+
+	notify.Send(cfg.Notify, events)
+}
+
+// deployedExpiry 订单当前部署证书的过期时间
+// 优先取本机证书存储中的证书，未记录指纹时使用配置中的过期日期
+func deployedExpiry(certCfg config.CertConfig) (time.Time, string, bool) {
+	if meta, err := orderStore.LoadMeta(certCfg.OrderID); err == nil && meta.Thumbprint != "" {
+		if info, err := cert.GetCertByThumbprint(meta.Thumbprint); err == nil {
+			return info.NotAfter, info.Thumbprint, true
+		}
+	}
+	if expiresAt, err := cert.ParseExpiresAt(certCfg.ExpiresAt); err == nil {
+		return expiresAt, "", true
+	}
+	return time.Time{}, "", false
+}
@@ -0,0 +1,171 @@
+package deploy
+
+import (
+	"encoding/json"
+	"fmt"
+	"strings"
+	"sync"
+	"time"
+
+	"cert-deploy/config"
+)
+
+// ActionKind 计划动作类型
+type ActionKind string
+
+const (
+	ActionSubmitCSR      ActionKind = "submit_csr"       // 生成私钥并提交 CSR
+	ActionFileValidation ActionKind = "file_validation"  // 写入文件验证内容
+	ActionDeleteLocalKey ActionKind = "delete_local_key" // 删除与证书不匹配的本地私钥
+	ActionInstallCert    ActionKind = "install_cert"     // 安装证书到本机存储
+	ActionExpandRule     ActionKind = "expand_rule"      // 展开 site/pattern 绑定规则
+	ActionFriendlyName   ActionKind = "friendly_name"    // 设置证书友好名称（IIS7）
+	ActionAddBinding     ActionKind = "add_binding"      // 为站点添加 HTTPS 绑定
+	ActionSSLFlags       ActionKind = "ssl_flags"        // 修改站点 HTTPS 绑定的 sslFlags
+	ActionBind           ActionKind = "bind"             // 绑定或更换 SSL 证书
+	ActionHTTPSPolicy    ActionKind = "https_policy"     // 配置 HTTP 跳转和 HSTS
+	ActionCallback       ActionKind = "callback"         // 发送部署回调
+	ActionPostAction     ActionKind = "post_action"      // 执行部署后动作
+	ActionDeleteCert     ActionKind = "delete_cert"      // 按保留策略删除被替换的旧证书
+	ActionSkip           ActionKind = "skip"             // 跳过（未到续签时间、冲突等）
+)
+
+var actionKindNames = map[ActionKind]string{
+	ActionSubmitCSR:      "提交 CSR",
+	ActionFileValidation: "文件验证",
+	ActionDeleteLocalKey: "删除本地私钥",
+	ActionInstallCert:    "安装证书",
+	ActionExpandRule:     "展开绑定规则",
+	ActionFriendlyName:   "设置友好名称",
+	ActionAddBinding:     "添加 HTTPS 绑定",
+	ActionSSLFlags:       "修改 sslFlags",
+	ActionBind:           "绑定证书",
+	ActionHTTPSPolicy:    "配置跳转/HSTS",
+	ActionCallback:       "发送回调",
+	ActionPostAction:     "部署后动作",
+	ActionDeleteCert:     "删除旧证书",
+	ActionSkip:           "跳过",
+}
+
+// Action 计划中的一个动作
+type Action struct {
+	Kind    ActionKind `json:"kind"`
+	OrderID int        `json:"order_id"`
+	Domain  string     `json:"domain,omitempty"`
+	Target  string     `json:"target,omitempty"`   // host:port、站点或应用程序池
+	OldHash string     `json:"old_hash,omitempty"` // 当前绑定的证书指纹
+	NewHash string     `json:"new_hash,omitempty"` // 将要绑定的证书指纹
+	Detail  string     `json:"detail,omitempty"`
+}
+
+// Plan 预演计划
+// 为 nil 时表示正常部署；非 nil 时各部署步骤只记录动作，不产生副作用
+type Plan struct {
+	GeneratedAt string   `json:"generated_at"`
+	Actions     []Action `json:"actions"`
+
+	mu sync.Mutex
+}
+
+// NewPlan 创建空计划
+func NewPlan() *Plan {
+	return &Plan{
+		GeneratedAt: time.Now().Format("2006-01-02 15:04:05"),
+		Actions:     make([]Action, 0),
+	}
+}
+
+// Active 是否处于预演模式
+func (p *Plan) Active() bool {
+	return p != nil
+}
+
+// Add 记录动作（nil 计划忽略）
+func (p *Plan) Add(action Action) {
+	if p == nil {
+		return
+	}
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.Actions = append(p.Actions, action)
+}
+
+// fork 为单个证书创建子计划，并发处理时各自记录，结束后按配置顺序合并
+func (p *Plan) fork() *Plan {
+	if p == nil {
+		return nil
+	}
+	return &Plan{GeneratedAt: p.GeneratedAt}
+}
+
+// merge 追加子计划的动作
+func (p *Plan) merge(child *Plan) {
+	if p == nil || child == nil {
+		return
+	}
+	child.mu.Lock()
+	actions := child.Actions
+	child.mu.Unlock()
+
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.Actions = append(p.Actions, actions...)
+}
+
+// JSON 输出 JSON 格式
+func (p *Plan) JSON() ([]byte, error) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	return json.MarshalIndent(p, "", "  ")
+}
+
+// String 输出可读格式
+func (p *Plan) String() string {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	var sb strings.Builder
+	fmt.Fprintf(&sb, "部署预演（%s），共 %d 项:\n", p.GeneratedAt, len(p.Actions))
+	if len(p.Actions) == 0 {
+		sb.WriteString("  无需执行任何操作\n")
+	}
+	for i, a := range p.Actions {
+		name := actionKindNames[a.Kind]
+		if name == "" {
+			name = string(a.Kind)
+		}
+		fmt.Fprintf(&sb, "%3d. [订单 %d] %s", i+1, a.OrderID, name)
+		if a.Domain != "" {
+			fmt.Fprintf(&sb, " %s", a.Domain)
+		}
+		if a.Target != "" && a.Target != a.Domain {
+			fmt.Fprintf(&sb, " -> %s", a.Target)
+		}
+		switch {
+		case a.OldHash != "" && a.NewHash != "":
+			fmt.Fprintf(&sb, "（%s => %s）", shortHash(a.OldHash), shortHash(a.NewHash))
+		case a.NewHash != "":
+			fmt.Fprintf(&sb, "（新证书 %s）", shortHash(a.NewHash))
+		}
+		if a.Detail != "" {
+			fmt.Fprintf(&sb, ": %s", a.Detail)
+		}
+		sb.WriteString("\n")
+	}
+	return sb.String()
+}
+
+func shortHash(hash string) string {
+	if len(hash) > 16 {
+		return strings.ToUpper(hash[:16]) + "..."
+	}
+	return strings.ToUpper(hash)
+}
+
+// PlanAutoDeploy 按 AutoDeploy 的决策逻辑生成预演计划，不安装证书、不修改绑定和配置
+// 仍会调用接口查询证书、读取当前 IIS 绑定
+func PlanAutoDeploy(cfg *config.Config) *Plan {
+	plan := NewPlan()
+	autoDeploy(cfg, DeployOptions{}, plan)
+	return plan
+}
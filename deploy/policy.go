@@ -0,0 +1,83 @@
+package deploy
+
+import (
+	"fmt"
+	"time"
+
+	"cert-deploy/api"
+	"cert-deploy/cert"
+	"cert-deploy/config"
+)
+
+// renewalInput 续签判断的输入
+type renewalInput struct {
+	LocalKey   bool            // 本地私钥模式（判断续签时间），否则为拉取模式（判断拉取时间）
+	GlobalDays int             // 全局天数：RenewDaysLocal 或 RenewDaysFetch
+	Override   *config.Renewal // 证书配置的续签时间（nil 使用全局天数）
+	NotBefore  time.Time       // 证书生效时间（零值表示未知，百分比回退到天数）
+	NotAfter   time.Time       // 证书过期时间
+	Resume     bool            // 上次部署中断，不受续签时间限制
+	Force      bool            // 强制部署，不受续签时间限制
+	Now        time.Time
+}
+
+// renewalDecision 续签判断结果
+type renewalDecision struct {
+	Due       bool
+	DaysLeft  int
+	Threshold string // 生效的阈值说明，如“15 天”“有效期的 33%”
+	Reason    string // 未到时间时的跳过原因（用于计划和部署结果）
+}
+
+// decideRenewal 判断证书是否到了续签（本地私钥模式）或拉取（拉取模式）时间
+// 优先级：中断恢复 > 证书配置的百分比 > 证书配置的天数 > 全局天数
+// 百分比按证书实际的 NotBefore/NotAfter 计算，生效时间未知时回退到天数
+func decideRenewal(in renewalInput) renewalDecision {
+	action := "拉取"
+	if in.LocalKey {
+		action = "续签"
+	}
+
+	d := renewalDecision{DaysLeft: cert.DaysUntil(in.NotAfter, in.Now)}
+
+	days := in.GlobalDays
+	percent := 0
+	if in.Override != nil {
+		if in.Override.Days > 0 {
+			days = in.Override.Days
+		}
+		if in.Override.Percent > 0 && in.Override.Percent < 100 {
+			percent = in.Override.Percent
+		}
+	}
+
+	lifetime := in.NotAfter.Sub(in.NotBefore)
+	if percent > 0 && !in.NotBefore.IsZero() && lifetime > 0 {
+		d.Threshold = fmt.Sprintf("有效期的 %d%%", percent)
+		d.Due = in.NotAfter.Sub(in.Now) <= lifetime*time.Duration(percent)/100
+	} else {
+		d.Threshold = fmt.Sprintf("%d 天", days)
+		d.Due = d.DaysLeft <= days
+	}
+
+	if in.Resume || in.Force {
+		d.Due = true
+	}
+	if !d.Due {
+		d.Reason = fmt.Sprintf("未到%s时间（还有 %d 天）", action, d.DaysLeft)
+	}
+	return d
+}
+
+// certValidity 证书有效期：优先使用证书中的 NotBefore/NotAfter，接口返回的过期时间作为回退
+func certValidity(certData *api.CertData) (notBefore, notAfter time.Time, err error) {
+	return cert.Validity(certData.Certificate, certData.ExpiresAt)
+}
+
+// certExpiresAt 证书过期时间（ExpiresAtLayout 格式），无法确定时使用接口返回的原值
+func certExpiresAt(certData *api.CertData) string {
+	if _, notAfter, err := certValidity(certData); err == nil {
+		return cert.FormatExpiresAt(notAfter)
+	}
+	return certData.ExpiresAt
+}
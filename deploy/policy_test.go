@@ -0,0 +1,139 @@
+package deploy
+
+import (
+	"strings"
+	"testing"
+	"time"
+
+	"cert-deploy/config"
+)
+
+func TestDecideRenewal(t *testing.T) {
+	now := time.Date(2026, 1, 1, 0, 0, 0, 0, time.UTC)
+	day := 24 * time.Hour
+
+	tests := []struct {
+		name      string
+		in        renewalInput
+		due       bool
+		daysLeft  int
+		threshold string
+		reason    string // 未到时间时原因应包含的内容
+	}{
+		{
+			name:      "全局天数：已到时间",
+			in:        renewalInput{GlobalDays: 15, NotAfter: now.Add(10 * day)},
+			due:       true,
+			daysLeft:  10,
+			threshold: "15 天",
+		},
+		{
+			name:      "全局天数：未到拉取时间",
+			in:        renewalInput{GlobalDays: 15, NotAfter: now.Add(20 * day)},
+			daysLeft:  20,
+			threshold: "15 天",
+			reason:    "未到拉取时间（还有 20 天）",
+		},
+		{
+			name:      "证书配置的天数优先于全局天数",
+			in:        renewalInput{GlobalDays: 15, Override: &config.Renewal{Days: 30}, NotAfter: now.Add(20 * day)},
+			due:       true,
+			daysLeft:  20,
+			threshold: "30 天",
+		},
+		{
+			name:      "百分比：剩余有效期低于阈值",
+			in:        renewalInput{GlobalDays: 15, Override: &config.Renewal{Percent: 33}, NotBefore: now.Add(-80 * day), NotAfter: now.Add(10 * day)},
+			due:       true,
+			daysLeft:  10,
+			threshold: "有效期的 33%",
+		},
+		{
+			name: "百分比优先于天数",
+			in: renewalInput{LocalKey: true, GlobalDays: 100, Override: &config.Renewal{Days: 100, Percent: 33},
+				NotBefore: now.Add(-10 * day), NotAfter: now.Add(80 * day)},
+			daysLeft:  80,
+			threshold: "有效期的 33%",
+			reason:    "未到续签时间（还有 80 天）",
+		},
+		{
+			name:      "百分比：生效时间未知时回退到天数",
+			in:        renewalInput{GlobalDays: 15, Override: &config.Renewal{Percent: 33}, NotAfter: now.Add(10 * day)},
+			due:       true,
+			daysLeft:  10,
+			threshold: "15 天",
+		},
+		{
+			name:      "百分比：超出 1-99 时忽略",
+			in:        renewalInput{GlobalDays: 15, Override: &config.Renewal{Percent: 100}, NotBefore: now.Add(-80 * day), NotAfter: now.Add(20 * day)},
+			daysLeft:  20,
+			threshold: "15 天",
+			reason:    "还有 20 天",
+		},
+		{
+			name:      "中断恢复不受时间限制",
+			in:        renewalInput{GlobalDays: 15, NotAfter: now.Add(60 * day), Resume: true},
+			due:       true,
+			daysLeft:  60,
+			threshold: "15 天",
+		},
+		{
+			name:      "强制部署不受时间限制",
+			in:        renewalInput{GlobalDays: 15, Override: &config.Renewal{Percent: 10}, NotBefore: now.Add(-day), NotAfter: now.Add(89 * day), Force: true},
+			due:       true,
+			daysLeft:  89,
+			threshold: "有效期的 10%",
+		},
+		{
+			name:      "已过期",
+			in:        renewalInput{GlobalDays: 15, NotAfter: now.Add(-36 * time.Hour)},
+			due:       true,
+			daysLeft:  -2,
+			threshold: "15 天",
+		},
+		{
+			name:      "已过期：百分比",
+			in:        renewalInput{GlobalDays: 15, Override: &config.Renewal{Percent: 33}, NotBefore: now.Add(-90 * day), NotAfter: now.Add(-time.Hour)},
+			due:       true,
+			daysLeft:  -1,
+			threshold: "有效期的 33%",
+		},
+		{
+			name:      "天数向下取整：差 1 秒满 16 天按 15 天",
+			in:        renewalInput{GlobalDays: 15, NotAfter: now.Add(16*day - time.Second)},
+			due:       true,
+			daysLeft:  15,
+			threshold: "15 天",
+		},
+		{
+			name:      "天数向下取整：满 16 天",
+			in:        renewalInput{GlobalDays: 15, NotAfter: now.Add(16 * day)},
+			daysLeft:  16,
+			threshold: "15 天",
+			reason:    "还有 16 天",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tt.in.Now = now
+			d := decideRenewal(tt.in)
+			if d.Due != tt.due {
+				t.Errorf("Due = %v，期望 %v", d.Due, tt.due)
+			}
+			if d.DaysLeft != tt.daysLeft {
+				t.Errorf("DaysLeft = %d，期望 %d", d.DaysLeft, tt.daysLeft)
+			}
+			if d.Threshold != tt.threshold {
+				t.Errorf("Threshold = %q，期望 %q", d.Threshold, tt.threshold)
+			}
+			if tt.due {
+				if d.Reason != "" {
+					t.Errorf("到期时不应有跳过原因: %q", d.Reason)
+				}
+			} else if !strings.Contains(d.Reason, tt.reason) {
+				t.Errorf("Reason = %q，期望包含 %q", d.Reason, tt.reason)
+			}
+		})
+	}
+}
@@ -0,0 +1,184 @@
+package deploy
+
+import (
+	"log"
+	"sort"
+	"strings"
+	"time"
+
+	"cert-deploy/api"
+	"cert-deploy/cert"
+	"cert-deploy/config"
+	"cert-deploy/iis"
+)
+
+// recordReplacement 记录本次部署的证书指纹（OrderMeta.Thumbprint），被替换的旧证书加入 Superseded
+// prevOrderID: 部署前配置中的订单 ID，本地私钥模式续签后订单 ID 变化，历史记录随之转移到新订单
+func recordReplacement(prevOrderID int, certData *api.CertData, deployResults []Result, plan *Plan) {
+	if plan.Active() {
+		return
+	}
+
+	thumbprint := ""
+	replaced := make([]string, 0)
+	for _, r := range deployResults {
+		if !r.Success {
+			continue
+		}
+		thumbprint = r.Thumbprint
+		if !r.Unchanged && r.OldThumbprint != "" {
+			replaced = append(replaced, r.OldThumbprint)
+		}
+	}
+	if thumbprint == "" {
+		return
+	}
+
+	meta, err := orderStore.LoadMeta(certData.OrderID)
+	if err != nil {
+		meta = newOrderMeta(certData.OrderID, certData)
+	}
+	if meta.Thumbprint != "" {
+		replaced = append(replaced, meta.Thumbprint)
+	}
+
+	if prevOrderID > 0 && prevOrderID != certData.OrderID {
+		if prev, err := orderStore.LoadMeta(prevOrderID); err == nil {
+			meta.Superseded = append(meta.Superseded, prev.Superseded...)
+			prev.Superseded = nil
+			if prev.Thumbprint != "" {
+				replaced = append(replaced, prev.Thumbprint)
+			}
+			if err := orderStore.SaveMeta(prevOrderID, prev); err != nil {
+				log.Printf("保存订单 %d 元数据失败: %v", prevOrderID, err)
+			}
+		}
+	}
+
+	now := time.Now().Format("2006-01-02 15:04:05")
+	for _, old := range replaced {
+		if strings.EqualFold(old, thumbprint) || hasSuperseded(meta.Superseded, old) {
+			continue
+		}
+		meta.Superseded = append(meta.Superseded, cert.SupersededCert{Thumbprint: strings.ToUpper(old), ReplacedAt: now})
+	}
+	meta.Thumbprint = strings.ToUpper(thumbprint)
+	meta.LastDeployed = now
+
+	if err := orderStore.SaveMeta(certData.OrderID, meta); err != nil {
+		log.Printf("保存订单元数据失败: %v", err)
+	}
+}
+
+func hasSuperseded(list []cert.SupersededCert, thumbprint string) bool {
+	for _, s := range list {
+		if strings.EqualFold(s.Thumbprint, thumbprint) {
+			return true
+		}
+	}
+	return false
+}
+
+// applyRetention 按证书配置的保留策略删除被替换的旧证书
+// 只删除没有任何 SSL 绑定引用、也不是其他订单当前证书的指纹
+func applyRetention(certCfg config.CertConfig, orderID int, plan *Plan) {
+	policy := certCfg.Retention
+	if policy == nil || (policy.KeepLast <= 0 && policy.DeleteAfterDays <= 0) || orderID <= 0 {
+		return
+	}
+
+	meta, err := orderStore.LoadMeta(orderID)
+	if err != nil || len(meta.Superseded) == 0 {
+		return
+	}
+
+	// 最近替换的排在前面
+	superseded := append([]cert.SupersededCert(nil), meta.Superseded...)
+	sort.SliceStable(superseded, func(i, j int) bool {
+		return superseded[i].ReplacedAt > superseded[j].ReplacedAt
+	})
+
+	expired := make([]cert.SupersededCert, 0)
+	for i, s := range superseded {
+		if policy.KeepLast > 0 && i >= policy.KeepLast {
+			expired = append(expired, s)
+			continue
+		}
+		if policy.DeleteAfterDays > 0 {
+			replacedAt, err := time.ParseInLocation("2006-01-02 15:04:05", s.ReplacedAt, time.Local)
+			if err == nil && time.Since(replacedAt) >= time.Duration(policy.DeleteAfterDays)*24*time.Hour {
+				expired = append(expired, s)
+			}
+		}
+	}
+	if len(expired) == 0 {
+		return
+	}
+
+	// 删除前实时确认绑定，不使用快照
+	bindings, err := iis.ListSSLBindings()
+	if err != nil {
+		log.Printf("查询 SSL 绑定失败，跳过旧证书清理: %v", err)
+		return
+	}
+	inUse := make(map[string]bool)
+	for _, b := range bindings {
+		inUse[strings.ToUpper(b.CertHash)] = true
+	}
+	for _, t := range currentThumbprints() {
+		inUse[t] = true
+	}
+
+	removed := make(map[string]bool)
+	for _, s := range expired {
+		thumbprint := strings.ToUpper(s.Thumbprint)
+		if inUse[thumbprint] {
+			log.Printf("旧证书 %s 仍在使用，暂不删除", thumbprint)
+			continue
+		}
+		if _, err := cert.GetCertByThumbprint(thumbprint); err != nil {
+			// 已不在证书存储中（手动删除等），只清理记录
+			removed[thumbprint] = true
+			continue
+		}
+		if plan.Active() {
+			plan.Add(Action{Kind: ActionDeleteCert, OrderID: orderID, Domain: certCfg.Domain, OldHash: thumbprint, Detail: "替换于 " + s.ReplacedAt})
+			continue
+		}
+		if err := cert.DeleteCertificate(thumbprint); err != nil {
+			log.Printf("删除旧证书 %s 失败: %v", thumbprint, err)
+			continue
+		}
+		log.Printf("已删除旧证书 %s（替换于 %s）", thumbprint, s.ReplacedAt)
+		removed[thumbprint] = true
+	}
+
+	if len(removed) == 0 || plan.Active() {
+		return
+	}
+	kept := meta.Superseded[:0]
+	for _, s := range meta.Superseded {
+		if !removed[strings.ToUpper(s.Thumbprint)] {
+			kept = append(kept, s)
+		}
+	}
+	meta.Superseded = kept
+	if err := orderStore.SaveMeta(orderID, meta); err != nil {
+		log.Printf("保存订单元数据失败: %v", err)
+	}
+}
+
+// currentThumbprints 所有订单当前部署的证书指纹
+func currentThumbprints() []string {
+	orderIDs, err := orderStore.ListOrders()
+	if err != nil {
+		return nil
+	}
+	result := make([]string, 0, len(orderIDs))
+	for _, id := range orderIDs {
+		if meta, err := orderStore.LoadMeta(id); err == nil && meta.Thumbprint != "" {
+			result = append(result, strings.ToUpper(meta.Thumbprint))
+		}
+	}
+	return result
+}
@@ -0,0 +1,345 @@
+package deploy
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"net"
+	"sort"
+	"strconv"
+	"strings"
+
+	"cert-deploy/api"
+	"cert-deploy/cert"
+	"cert-deploy/config"
+	"cert-deploy/iis"
+	"cert-deploy/util"
+)
+
+// sslFlags 位（applicationHost.config 的 binding/@sslFlags）
+const (
+	sslFlagSNI              = 1 // 按主机名（SNI）选择证书
+	sslFlagCentralCertStore = 2 // 使用集中式证书存储（不读取 HTTP.sys 中绑定的证书）
+)
+
+// ruleSites 解析绑定规则的目标站点
+// 指定 SiteName 时使用该站点；否则按主机名匹配：优先已有 host:port HTTPS 绑定的站点，
+// 没有时使用有该主机名 HTTP 绑定的站点（将为其添加 HTTPS 绑定）。都找不到时返回空
+// IP 规则按绑定的 IP 匹配（见 bindingServes）
+func ruleSites(rule config.BindRule, port int) ([]string, error) {
+	sites, err := iis.CachedSites()
+	if err != nil {
+		return nil, fmt.Errorf("读取 IIS 站点失败: %w", err)
+	}
+
+	if rule.SiteName != "" {
+		for _, site := range sites {
+			if site.Name == rule.SiteName {
+				return []string{site.Name}, nil
+			}
+		}
+		return nil, fmt.Errorf("站点 %s 不存在", rule.SiteName)
+	}
+
+	var httpsSites, httpSites []string
+	for _, site := range sites {
+		hasHTTPS, hasHTTP := false, false
+		for _, b := range site.Bindings {
+			if !bindingServes(b, rule.Domain) {
+				continue
+			}
+			switch {
+			case b.Protocol == "https" && b.Port == port:
+				hasHTTPS = true
+			case b.Protocol == "http":
+				hasHTTP = true
+			}
+		}
+		if hasHTTPS {
+			httpsSites = append(httpsSites, site.Name)
+		} else if hasHTTP {
+			httpSites = append(httpSites, site.Name)
+		}
+	}
+	if len(httpsSites) > 0 {
+		return httpsSites, nil
+	}
+	return httpSites, nil
+}
+
+// bindingServes 站点绑定是否接收发往 host 的请求
+// 主机名按绑定主机名比较；IP 按绑定 IP 比较，未指定 IP（*）且不带主机名的绑定也接收该 IP 的请求
+func bindingServes(b iis.BindingInfo, host string) bool {
+	ip := net.ParseIP(host)
+	if ip == nil {
+		return util.EqualDomain(b.Host, host)
+	}
+	if b.Host != "" {
+		return b.Host == host
+	}
+	return b.IP == "0.0.0.0" || ip.Equal(net.ParseIP(b.IP))
+}
+
+// siteBinding 查找站点 host:port 的 HTTPS 绑定（host 为 IP 时查找接收该 IP 请求的绑定）
+func siteBinding(siteName, host string, port int) (*iis.BindingInfo, error) {
+	sites, err := iis.CachedSites()
+	if err != nil {
+		return nil, fmt.Errorf("读取 IIS 站点失败: %w", err)
+	}
+	for _, site := range sites {
+		if site.Name != siteName {
+			continue
+		}
+		for i, b := range site.Bindings {
+			if b.Protocol == "https" && b.Port == port && bindingServes(b, host) {
+				return &site.Bindings[i], nil
+			}
+		}
+		return nil, nil
+	}
+	return nil, fmt.Errorf("站点 %s 不存在", siteName)
+}
+
+// ensureSiteBinding 确保站点有 host:port 的 HTTPS 绑定，且 sslFlags 开启 SNI
+// 已有绑定使用集中式证书存储时返回错误，不擅自关闭（证书由 CCS 提供，HTTP.sys 中绑定的证书不会被使用）
+// host 为 IP 时添加 IP:Port 绑定（不带主机名），已有绑定不修改 sslFlags
+// 返回执行的操作（空表示无需修改）；预演模式只记录动作
+func ensureSiteBinding(siteName, host string, port int, plan *Plan, orderID int) (string, error) {
+	if !plan.Active() {
+		bindMu.Lock()
+		defer bindMu.Unlock()
+	}
+
+	binding, err := siteBinding(siteName, host, port)
+	if err != nil {
+		return "", err
+	}
+	target := fmt.Sprintf("%s (站点: %s)", net.JoinHostPort(util.ToUnicode(host), strconv.Itoa(port)), siteName)
+
+	if binding == nil {
+		log.Printf("添加 HTTPS 绑定: %s", target)
+		if plan.Active() {
+			plan.Add(Action{Kind: ActionAddBinding, OrderID: orderID, Domain: host, Target: target})
+		} else if net.ParseIP(host) != nil {
+			if err := iis.AddHttpsBindingByIP(siteName, host, port); err != nil {
+				return "", err
+			}
+		} else if err := iis.AddHttpsBinding(siteName, host, port); err != nil {
+			return "", err
+		}
+		return "已添加 HTTPS 绑定", nil
+	}
+	if net.ParseIP(host) != nil {
+		return "", nil
+	}
+
+	if binding.SSLFlags&sslFlagCentralCertStore != 0 {
+		return "", fmt.Errorf("%s 使用集中式证书存储（sslFlags=%d），证书由 CCS 提供，不能绑定本机存储的证书；请在 IIS 中取消该绑定的“使用集中式证书存储”，或从绑定规则中移除", target, binding.SSLFlags)
+	}
+	flags := binding.SSLFlags | sslFlagSNI
+	if flags == binding.SSLFlags {
+		return "", nil
+	}
+	log.Printf("修改 sslFlags: %s %d => %d", target, binding.SSLFlags, flags)
+	if plan.Active() {
+		plan.Add(Action{Kind: ActionSSLFlags, OrderID: orderID, Domain: host, Target: target, Detail: fmt.Sprintf("%d => %d", binding.SSLFlags, flags)})
+	} else if err := iis.SetBindingSSLFlags(siteName, host, port, flags); err != nil {
+		return "", err
+	}
+	return fmt.Sprintf("sslFlags 已修改为 %d", flags), nil
+}
+
+// expandBindRules 把 site/pattern 规则按 IIS 当前绑定展开为单个主机名的规则
+// 只保留证书覆盖、未被排除、且应由当前证书负责的主机名；同一 host:port 只保留第一条
+// 单个主机名的规则原样保留，展开结果记录到日志和预演计划
+func expandBindRules(env *runEnv, certCfg config.CertConfig, plan *Plan, orderID int) []config.BindRule {
+	rules := make([]config.BindRule, 0, len(certCfg.BindRules))
+	seen := make(map[string]bool)
+	add := func(rule config.BindRule) bool {
+		port := rule.Port
+		if port == 0 {
+			port = 443
+		}
+		key := util.ToASCII(rule.Domain) + ":" + strconv.Itoa(port)
+		if seen[key] {
+			return false
+		}
+		seen[key] = true
+		rules = append(rules, rule)
+		return true
+	}
+
+	for _, rule := range certCfg.BindRules {
+		if !rule.Expands() {
+			add(rule)
+		}
+	}
+
+	for _, rule := range certCfg.BindRules {
+		if !rule.Expands() {
+			continue
+		}
+		name := ruleName(rule)
+
+		matches, err := matchRuleBindings(rule)
+		if err != nil {
+			log.Printf("展开绑定规则 %s 失败: %v", name, err)
+			plan.Add(Action{Kind: ActionExpandRule, OrderID: orderID, Domain: certCfg.Domain, Target: name, Detail: err.Error()})
+			continue
+		}
+
+		hosts := make([]string, 0, len(matches))
+		for _, m := range matches {
+			switch {
+			case excluded(m.Host, rule.Exclude):
+				continue
+			case !certCoversHost(certCfg, m.Host):
+				log.Printf("绑定规则 %s: 证书不包含 %s，跳过", name, util.ToUnicode(m.Host))
+				continue
+			case !isPreferredCertForHost(m.Host, certCfg, env.allCerts):
+				log.Printf("绑定规则 %s: %s 已由其他证书管理，跳过", name, util.ToUnicode(m.Host))
+				continue
+			}
+			expanded := rule
+			expanded.Type = config.BindRuleHost
+			expanded.Domain = m.Host
+			expanded.Port = m.Port
+			expanded.SiteName = m.SiteName
+			expanded.Exclude = nil
+			if add(expanded) {
+				hosts = append(hosts, net.JoinHostPort(util.ToUnicode(m.Host), strconv.Itoa(m.Port)))
+			}
+		}
+
+		detail := "没有匹配的主机名"
+		if len(hosts) > 0 {
+			detail = strings.Join(hosts, ", ")
+		}
+		log.Printf("绑定规则 %s 展开为: %s", name, detail)
+		plan.Add(Action{Kind: ActionExpandRule, OrderID: orderID, Domain: certCfg.Domain, Target: name, Detail: detail})
+	}
+	return rules
+}
+
+// ruleName 规则的显示名称
+func ruleName(rule config.BindRule) string {
+	if rule.Type == config.BindRuleSite {
+		return "site:" + rule.SiteName
+	}
+	return rule.Type + ":" + rule.Domain
+}
+
+// matchRuleBindings 查找 site/pattern 规则匹配的站点 HTTPS 绑定，按站点和主机名排序
+// site 规则：站点的所有带主机名的 HTTPS 绑定（Port 非 0 时只取该端口）
+// pattern 规则：所有站点中主机名匹配 domain、端口为 Port（默认 443）的 HTTPS 绑定
+func matchRuleBindings(rule config.BindRule) ([]iis.HttpBindingMatch, error) {
+	sites, err := iis.CachedSites()
+	if err != nil {
+		return nil, fmt.Errorf("读取 IIS 站点失败: %w", err)
+	}
+
+	port := rule.Port
+	if rule.Type == config.BindRulePattern && port == 0 {
+		port = 443
+	}
+
+	found := false
+	matches := make([]iis.HttpBindingMatch, 0)
+	for _, site := range sites {
+		if rule.Type == config.BindRuleSite {
+			if site.Name != rule.SiteName {
+				continue
+			}
+			found = true
+		}
+		for _, b := range site.Bindings {
+			if b.Protocol != "https" || b.Host == "" || (port != 0 && b.Port != port) {
+				continue
+			}
+			if rule.Type == config.BindRulePattern && !iis.MatchDomainForBinding(b.Host, rule.Domain) {
+				continue
+			}
+			matches = append(matches, iis.HttpBindingMatch{SiteName: site.Name, Host: b.Host, Port: b.Port})
+		}
+	}
+	if rule.Type == config.BindRuleSite && !found {
+		return nil, fmt.Errorf("站点 %s 不存在", rule.SiteName)
+	}
+
+	sort.Slice(matches, func(i, j int) bool {
+		if matches[i].SiteName != matches[j].SiteName {
+			return matches[i].SiteName < matches[j].SiteName
+		}
+		if matches[i].Host != matches[j].Host {
+			return matches[i].Host < matches[j].Host
+		}
+		return matches[i].Port < matches[j].Port
+	})
+	return matches, nil
+}
+
+// excluded 主机名是否匹配任一排除项（精确或通配符，与证书域名匹配规则相同）
+func excluded(host string, patterns []string) bool {
+	for _, pattern := range patterns {
+		if iis.MatchDomainForBinding(host, pattern) {
+			return true
+		}
+	}
+	return false
+}
+
+// BindHost 手动把已安装的证书绑定到 host:port（命令行 bind 子命令）
+// 与规则模式使用同一流程：确定站点、补齐站点 HTTPS 绑定、绑定 HTTP.sys 证书并握手校验
+// siteName 为空时按主机名查找站点；host 为 IP 时使用 ipport 绑定
+func BindHost(cfg *config.Config, siteName, host string, port int, thumbprint string) []Result {
+	cert.InvalidateInventory()
+	iis.InvalidateInventory()
+
+	env := &runEnv{
+		isIIS7:    iis.IsIIS7() || cfg.IIS7Mode,
+		verifyTLS: !cfg.SkipTLSCheck,
+	}
+	rule := config.BindRule{Domain: host, Port: port, SiteName: siteName}
+	return bindRule(context.Background(), env, &api.CertData{}, thumbprint, rule, port, nil, nil)
+}
+
+// UnbindHost 解除 host:port 的证书绑定（命令行 unbind 子命令），绑定方式与 BindHost 一致：
+// host 为 IP 时解除该 IP 的 ipport 绑定；IIS7 不支持 SNI，主机名的证书绑定在 0.0.0.0:port
+// siteName 不为空时同时删除该站点的 host:port HTTPS 绑定（按 IP 绑定时不支持）
+// 返回实际解除的 HTTP.sys 绑定（如 www.example.com:443、0.0.0.0:443）
+func UnbindHost(cfg *config.Config, siteName, host string, port int) (string, error) {
+	isIP := net.ParseIP(host) != nil
+	target := bindTarget{Host: host, Port: port, ByIP: isIP}
+	if iis.IsIIS7() || cfg.IIS7Mode {
+		if !isIP {
+			target.Host = "0.0.0.0"
+		}
+		target.ByIP = true
+	}
+	label := net.JoinHostPort(util.ToUnicode(target.Host), strconv.Itoa(port))
+	if siteName != "" && target.ByIP {
+		return label, fmt.Errorf("证书按 IP 绑定在 %s，不能同时删除站点绑定，请在 IIS 管理器中删除", label)
+	}
+
+	cert.InvalidateInventory()
+	iis.InvalidateInventory()
+	bindMu.Lock()
+	defer bindMu.Unlock()
+
+	var err error
+	if target.ByIP {
+		err = iis.UnbindCertificateByIP(context.Background(), target.Host, port)
+	} else {
+		err = iis.UnbindCertificate(context.Background(), target.Host, port)
+	}
+	if err != nil {
+		return label, fmt.Errorf("解除证书绑定失败: %w", err)
+	}
+
+	if siteName != "" {
+		if err := iis.RemoveHttpsBinding(siteName, host, port); err != nil {
+			return label, fmt.Errorf("已解除证书绑定，删除站点 %s 的 HTTPS 绑定失败: %w", siteName, err)
+		}
+	}
+	return label, nil
+}
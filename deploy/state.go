@@ -0,0 +1,295 @@
+package deploy
+
+import (
+	"log"
+	"strings"
+	"sync"
+	"time"
+
+	"cert-deploy/api"
+	"cert-deploy/cert"
+	"cert-deploy/config"
+	"cert-deploy/iis"
+)
+
+// Progress 部署进度通知
+type Progress struct {
+	OrderID int
+	Domain  string
+	Step    cert.DeployStep
+}
+
+var (
+	progressMu   sync.Mutex
+	progressHook func(Progress)
+)
+
+// SetProgressHook 设置部署进度回调（GUI 显示当前步骤），传 nil 取消
+func SetProgressHook(fn func(Progress)) {
+	progressMu.Lock()
+	defer progressMu.Unlock()
+	progressHook = fn
+}
+
+func notifyProgress(p Progress) {
+	progressMu.Lock()
+	fn := progressHook
+	progressMu.Unlock()
+	if fn != nil {
+		fn(p)
+	}
+}
+
+// DeployStates 读取所有订单未完成的部署进度（命令行 -status 使用），完成的部署不保留状态
+func DeployStates() ([]*cert.DeployState, error) {
+	return orderStore.ListDeployStates()
+}
+
+// stateTracker 记录单个证书的部署进度，每一步落盘，进程中断后下次运行据此恢复
+// 为 nil 时（预演模式）所有方法为空操作
+type stateTracker struct {
+	state *cert.DeployState
+}
+
+// maxResumeAttempts 中断或失败的部署最多恢复的次数，超过后清除进度，按正常续签时间处理
+const maxResumeAttempts = 3
+
+// loadPendingState 读取订单未完成的部署进度
+func loadPendingState(orderID int) *cert.DeployState {
+	if orderID <= 0 {
+		return nil
+	}
+	state, err := orderStore.LoadDeployState(orderID)
+	if err != nil {
+		log.Printf("读取订单 %d 部署状态失败: %v", orderID, err)
+		return nil
+	}
+	if state == nil || state.Finished() {
+		return nil
+	}
+	if state.Attempts >= maxResumeAttempts {
+		log.Printf("订单 %d 的部署已恢复 %d 次仍未完成（%s），放弃恢复: %s", orderID, state.Attempts, state.Step.Name(), state.Error)
+		cleanupInterruptedDeploy(state)
+		return nil
+	}
+	return state
+}
+
+// beginDeployState 开始跟踪证书部署
+// pending 为同一证书的未完成进度时继续使用；证书已变化时清理上次中断遗留的证书
+func beginDeployState(certData *api.CertData, pending *cert.DeployState, plan *Plan) *stateTracker {
+	if plan.Active() {
+		return nil
+	}
+
+	thumbprint, err := cert.GetCertThumbprint(certData.Certificate)
+	if err != nil {
+		log.Printf("计算证书指纹失败，不记录部署状态: %v", err)
+		return nil
+	}
+
+	if pending != nil {
+		if pending.OrderID == certData.OrderID && strings.EqualFold(pending.Thumbprint, thumbprint) {
+			log.Printf("恢复中断的部署: 订单 %d，上次进度: %s", pending.OrderID, pending.Step.Name())
+			pending.Error = ""
+			pending.Attempts++
+			t := &stateTracker{state: pending}
+			t.save()
+			return t
+		}
+		log.Printf("订单 %d 上次部署未完成，证书已更新，清理遗留状态", pending.OrderID)
+		cleanupInterruptedDeploy(pending)
+	}
+
+	now := time.Now().Format("2006-01-02 15:04:05")
+	t := &stateTracker{state: &cert.DeployState{
+		OrderID:    certData.OrderID,
+		Domain:     certData.Domain,
+		Step:       cert.StepFetched,
+		Thumbprint: thumbprint,
+		StartedAt:  now,
+	}}
+	t.save()
+	return t
+}
+
+func (t *stateTracker) save() {
+	if err := orderStore.SaveDeployState(t.state); err != nil {
+		log.Printf("保存部署状态失败: %v", err)
+	}
+	notifyProgress(Progress{OrderID: t.state.OrderID, Domain: t.state.Domain, Step: t.state.Step})
+}
+
+// advance 进入下一步骤（不会回退）
+func (t *stateTracker) advance(step cert.DeployStep) {
+	if t == nil || t.state.Step.Reached(step) {
+		return
+	}
+	t.state.Step = step
+	t.save()
+}
+
+// installedThumbprint 上次已安装且仍在本机存储中的证书指纹
+func (t *stateTracker) installedThumbprint() string {
+	if t == nil || !t.state.Step.Reached(cert.StepInstalled) {
+		return ""
+	}
+	if _, err := cert.GetCertByThumbprint(t.state.Thumbprint); err != nil {
+		return ""
+	}
+	return t.state.Thumbprint
+}
+
+// markInstalled 记录证书已安装
+func (t *stateTracker) markInstalled(thumbprint string, preexisting bool) {
+	if t == nil {
+		return
+	}
+	t.state.Thumbprint = thumbprint
+	t.state.Preexisting = preexisting
+	t.advance(cert.StepInstalled)
+}
+
+// rememberPrevious 在绑定前记录目标原来的证书指纹
+// 恢复部署时目标可能已换成新证书，此时返回首次记录的原指纹
+func (t *stateTracker) rememberPrevious(target, oldHash string) string {
+	if t == nil {
+		return oldHash
+	}
+	if prev, ok := t.state.Previous[target]; ok {
+		return prev
+	}
+	if t.state.Previous == nil {
+		t.state.Previous = make(map[string]string)
+	}
+	t.state.Previous[target] = oldHash
+	t.save()
+	return oldHash
+}
+
+// markBound 记录绑定目标已完成
+func (t *stateTracker) markBound(target string) {
+	if t == nil || t.state.IsBound(target) {
+		return
+	}
+	t.state.Bound = append(t.state.Bound, target)
+	t.save()
+}
+
+// fail 记录失败原因，进度保留在当前步骤，下次运行继续
+func (t *stateTracker) fail(err error) {
+	if t == nil || err == nil {
+		return
+	}
+	t.state.Error = err.Error()
+	t.save()
+}
+
+// finish 按部署结果收尾：没有任何成功的绑定时保留进度等待重试
+func (t *stateTracker) finish(results []Result) {
+	if t == nil {
+		return
+	}
+	for _, r := range results {
+		if r.Success {
+			t.done()
+			return
+		}
+	}
+	if len(results) == 0 {
+		t.done()
+		return
+	}
+	t.state.Error = results[0].Message
+	t.save()
+}
+
+// done 部署完成：通知进度后删除状态文件，不再需要恢复
+func (t *stateTracker) done() {
+	t.state.Step = cert.StepDone
+	t.state.Error = ""
+	notifyProgress(Progress{OrderID: t.state.OrderID, Domain: t.state.Domain, Step: t.state.Step})
+	if err := orderStore.DeleteDeployState(t.state.OrderID); err != nil {
+		log.Printf("删除部署状态失败: %v", err)
+	}
+}
+
+// recoverInterruptedDeploys 处理已不在配置中的订单遗留的未完成部署
+// 配置中仍存在的订单在本次部署中恢复；旧版本留下的已完成状态直接删除
+func recoverInterruptedDeploys(certs []config.CertConfig) {
+	states, err := orderStore.ListDeployStates()
+	if err != nil {
+		log.Printf("读取部署状态失败: %v", err)
+		return
+	}
+
+	active := make(map[int]bool)
+	for _, c := range certs {
+		if c.Enabled {
+			active[c.OrderID] = true
+		}
+	}
+
+	for _, state := range states {
+		if state.Finished() {
+			if err := orderStore.DeleteDeployState(state.OrderID); err != nil {
+				log.Printf("删除部署状态失败: %v", err)
+			}
+			continue
+		}
+		if active[state.OrderID] {
+			continue
+		}
+		log.Printf("订单 %d 存在中断的部署（%s），已不在启用的配置中，清理遗留状态", state.OrderID, state.Step.Name())
+		cleanupInterruptedDeploy(state)
+	}
+}
+
+// cleanupInterruptedDeploy 删除中断部署安装的、未被任何绑定使用的证书，并清除进度
+func cleanupInterruptedDeploy(state *cert.DeployState) {
+	if state.Step.Reached(cert.StepInstalled) && !state.Preexisting && state.Thumbprint != "" {
+		if !deleteUnusedCert(state.Thumbprint) {
+			return
+		}
+	}
+	if err := orderStore.DeleteDeployState(state.OrderID); err != nil {
+		log.Printf("删除部署状态失败: %v", err)
+	}
+}
+
+// deleteUnusedCert 删除未被任何绑定使用的证书，删除失败时返回 false
+// 持有 bindMu，其他 worker 不会在检查和删除之间把证书绑定上去
+func deleteUnusedCert(thumbprint string) bool {
+	bindMu.Lock()
+	defer bindMu.Unlock()
+
+	if isCertInUse(thumbprint) {
+		log.Printf("证书 %s 仍有绑定在使用，保留", thumbprint)
+		return true
+	}
+	if _, err := cert.GetCertByThumbprint(thumbprint); err != nil {
+		return true
+	}
+	if err := cert.DeleteCertificate(thumbprint); err != nil {
+		log.Printf("删除遗留证书失败: %v", err)
+		return false
+	}
+	log.Printf("已删除遗留证书: %s", thumbprint)
+	return true
+}
+
+// isCertInUse 证书是否被任何 SSL 绑定使用（查询失败时按使用中处理）
+// 用于删除证书前的判断，实时查询而不使用快照
+func isCertInUse(thumbprint string) bool {
+	bindings, err := iis.ListSSLBindings()
+	if err != nil {
+		log.Printf("查询 SSL 绑定失败: %v", err)
+		return true
+	}
+	for _, b := range bindings {
+		if strings.EqualFold(b.CertHash, thumbprint) {
+			return true
+		}
+	}
+	return false
+}
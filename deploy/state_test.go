@@ -0,0 +1,68 @@
+package deploy
+
+import (
+	"testing"
+
+	"cert-deploy/cert"
+)
+
+// useTempOrderStore 把订单目录指向临时目录
+func useTempOrderStore(t *testing.T) {
+	t.Helper()
+	saved := orderStore
+	orderStore = &cert.OrderStore{BaseDir: t.TempDir()}
+	t.Cleanup(func() { orderStore = saved })
+}
+
+func TestStateTrackerFinish(t *testing.T) {
+	tests := []struct {
+		name    string
+		results []Result
+		keep    bool // 是否保留进度等待重试
+	}{
+		{name: "全部成功", results: []Result{{Success: true}, {Success: true}}},
+		{name: "部分成功", results: []Result{{Success: false, Message: "绑定失败"}, {Success: true}}},
+		{name: "没有绑定目标"},
+		{name: "全部失败", results: []Result{{Success: false, Message: "绑定失败"}}, keep: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			useTempOrderStore(t)
+			tr := &stateTracker{state: &cert.DeployState{OrderID: 42, Domain: "www.example.com", Step: cert.StepBinding}}
+			tr.save()
+
+			tr.finish(tt.results)
+
+			state, err := orderStore.LoadDeployState(42)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !tt.keep {
+				if state != nil {
+					t.Errorf("部署完成后应删除状态文件，实际 %+v", state)
+				}
+				return
+			}
+			if state == nil || state.Finished() || state.Error != "绑定失败" {
+				t.Errorf("失败时应保留进度和错误，实际 %+v", state)
+			}
+		})
+	}
+}
+
+func TestRecoverInterruptedDeploysPrunesFinished(t *testing.T) {
+	useTempOrderStore(t)
+	if err := orderStore.SaveDeployState(&cert.DeployState{OrderID: 7, Domain: "old.example.com", Step: cert.StepDone}); err != nil {
+		t.Fatal(err)
+	}
+
+	recoverInterruptedDeploys(nil)
+
+	states, err := orderStore.ListDeployStates()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(states) != 0 {
+		t.Errorf("已完成的状态应被删除，剩余 %d 个", len(states))
+	}
+}
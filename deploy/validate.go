@@ -0,0 +1,496 @@
+package deploy
+
+import (
+	"encoding/json"
+	"fmt"
+	"net"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+
+	"cert-deploy/config"
+	"cert-deploy/iis"
+	"cert-deploy/util"
+)
+
+// IssueLevel 检查问题级别
+type IssueLevel string
+
+const (
+	IssueError   IssueLevel = "error"   // 部署会失败或行为错误
+	IssueWarning IssueLevel = "warning" // 可以部署，但可能不符合预期
+)
+
+// Issue 配置检查发现的一个问题
+type Issue struct {
+	Level   IssueLevel `json:"level"`
+	Target  string     `json:"target"` // 配置项，如 "证书 example.com（订单 123）/ 绑定 www.example.com:443"
+	Message string     `json:"message"`
+	Hint    string     `json:"hint,omitempty"` // 修复建议
+}
+
+// ValidationReport 配置检查结果
+type ValidationReport struct {
+	CheckedAt string  `json:"checked_at"`
+	Issues    []Issue `json:"issues"`
+}
+
+// Errors 错误数量
+func (r *ValidationReport) Errors() int {
+	count := 0
+	for _, issue := range r.Issues {
+		if issue.Level == IssueError {
+			count++
+		}
+	}
+	return count
+}
+
+// JSON 输出 JSON 格式
+func (r *ValidationReport) JSON() ([]byte, error) {
+	return json.MarshalIndent(r, "", "  ")
+}
+
+// String 输出可读格式
+func (r *ValidationReport) String() string {
+	var sb strings.Builder
+	errors := r.Errors()
+	fmt.Fprintf(&sb, "配置检查（%s）: %d 个错误，%d 个警告\n", r.CheckedAt, errors, len(r.Issues)-errors)
+	if len(r.Issues) == 0 {
+		sb.WriteString("  未发现问题\n")
+	}
+	for _, issue := range r.Issues {
+		level := "警告"
+		if issue.Level == IssueError {
+			level = "错误"
+		}
+		fmt.Fprintf(&sb, "[%s] %s: %s\n", level, issue.Target, issue.Message)
+		if issue.Hint != "" {
+			fmt.Fprintf(&sb, "       修复: %s\n", issue.Hint)
+		}
+	}
+	return sb.String()
+}
+
+func (r *ValidationReport) add(level IssueLevel, target, message, hint string) {
+	r.Issues = append(r.Issues, Issue{Level: level, Target: target, Message: message, Hint: hint})
+}
+
+// validator 一次检查的上下文
+type validator struct {
+	report *ValidationReport
+	sites  map[string]iis.SiteInfo // 站点名 → 站点，nil 表示无法读取 IIS 站点
+}
+
+// ValidateConfig 检查配置：密钥能否解密、域名和绑定规则是否与证书一致、站点是否存在等
+// 只读取 IIS 站点和本地订单记录，不调用接口、不做任何修改
+func ValidateConfig(cfg *config.Config) *ValidationReport {
+	v := &validator{report: &ValidationReport{
+		CheckedAt: time.Now().Format("2006-01-02 15:04:05"),
+		Issues:    make([]Issue, 0),
+	}}
+
+	if sites, err := iis.ScanSites(); err != nil {
+		v.report.add(IssueWarning, "IIS", fmt.Sprintf("无法读取 IIS 站点，跳过站点检查: %v", err), "以管理员身份运行，并确认已安装 IIS")
+	} else {
+		v.sites = make(map[string]iis.SiteInfo, len(sites))
+		for _, site := range sites {
+			v.sites[site.Name] = site
+		}
+	}
+
+	v.checkGlobal(cfg)
+	v.checkProfiles(cfg)
+	v.checkNotify(cfg)
+
+	orders := make(map[int]bool)
+	for _, c := range cfg.Certificates {
+		if c.OrderID > 0 && orders[c.OrderID] {
+			v.report.add(IssueError, fmt.Sprintf("订单 %d", c.OrderID), "重复配置", "删除重复的证书配置")
+		}
+		orders[c.OrderID] = true
+		v.checkCert(c)
+	}
+
+	// 同一域名配置在多个证书中时只有到期最晚的生效
+	conflicts := checkDomainConflicts(cfg.Certificates)
+	domains := make([]string, 0, len(conflicts))
+	for domain := range conflicts {
+		domains = append(domains, domain)
+	}
+	sort.Strings(domains)
+	for _, domain := range domains {
+		orderIDs := make([]string, 0)
+		for _, i := range conflicts[domain] {
+			orderIDs = append(orderIDs, fmt.Sprint(cfg.Certificates[i].OrderID))
+		}
+		v.report.add(IssueWarning, "绑定 "+util.ToUnicode(domain), "配置在多个证书中（订单 "+strings.Join(orderIDs, "、")+"）", "只保留一个证书的绑定规则；否则使用到期最晚的证书")
+	}
+
+	return v.report
+}
+
+// checkGlobal 全局设置
+func (v *validator) checkGlobal(cfg *config.Config) {
+	if err := util.ValidateTaskName(cfg.TaskName); err != nil {
+		v.report.add(IssueError, "task_name", err.Error(), "只使用字母、数字、下划线、连字符和点")
+	}
+	if cfg.CheckInterval <= 0 {
+		v.report.add(IssueError, "check_interval", "检测间隔必须大于 0", "设置为 6（小时）")
+	}
+	if cfg.RenewDaysLocal > 0 && cfg.RenewDaysLocal <= 14 {
+		v.report.add(IssueWarning, "renew_days_local", fmt.Sprintf("%d 天不大于服务端的 14 天，本地私钥模式可能来不及续签", cfg.RenewDaysLocal), "设置为 15 或更大")
+	}
+	if cfg.RenewDaysFetch >= 14 {
+		v.report.add(IssueWarning, "renew_days_fetch", fmt.Sprintf("%d 天不小于服务端的 14 天，拉取时服务端可能还未续签", cfg.RenewDaysFetch), "设置为 13 或更小")
+	}
+	if cfg.Workers > config.MaxWorkers {
+		v.report.add(IssueWarning, "workers", fmt.Sprintf("超过上限，按 %d 处理", config.MaxWorkers), "")
+	}
+}
+
+// checkProfiles 启用的证书引用的 API 配置必须存在且 Token 能解密
+func (v *validator) checkProfiles(cfg *config.Config) {
+	checked := make(map[string]bool)
+	for _, c := range cfg.Certificates {
+		name := config.ProfileName(c.Profile)
+		if !c.Enabled || checked[name] {
+			continue
+		}
+		checked[name] = true
+
+		target := "API 配置 " + name
+		baseURL, token, err := cfg.API(name)
+		switch {
+		case err != nil && name != config.DefaultProfile && cfg.GetProfile(name) == nil:
+			v.report.add(IssueError, target, err.Error(), "在 profiles 中添加该配置，或修改证书的 profile")
+			continue
+		case err != nil:
+			v.report.add(IssueError, target, err.Error(), "在 GUI 的部署接口设置中重新保存 Token，或使用 -apply 重新下发")
+			continue
+		case token == "":
+			v.report.add(IssueError, target, "未配置 Token，引用它的证书不会部署", "在 GUI 的部署接口设置中填写 Token")
+		}
+		if baseURL == "" {
+			v.report.add(IssueError, target, "未配置接口地址", "填写 api_base_url")
+		}
+	}
+}
+
+// checkNotify 通知渠道配置和 SMTP 密码
+func (v *validator) checkNotify(cfg *config.Config) {
+	if cfg.Notify == nil {
+		return
+	}
+	for _, ch := range cfg.Notify.Channels {
+		if !ch.Enabled {
+			continue
+		}
+		target := "通知渠道 " + ch.Name
+		if err := ch.Validate(); err != nil {
+			v.report.add(IssueError, target, err.Error(), "补全渠道配置或将 enabled 设为 false")
+			continue
+		}
+		if ch.SMTP != nil {
+			if _, err := ch.SMTP.GetPassword(); err != nil {
+				v.report.add(IssueError, target, err.Error(), "重新填写 SMTP 密码并保存")
+			}
+		}
+		if _, err := ch.GetURL(); err != nil {
+			v.report.add(IssueError, target, err.Error(), "重新填写 Webhook 地址并保存")
+		}
+		if _, err := ch.GetSecret(); err != nil {
+			v.report.add(IssueError, target, err.Error(), "重新填写加签密钥并保存")
+		}
+	}
+}
+
+// checkCert 单个证书配置
+func (v *validator) checkCert(c config.CertConfig) {
+	target := fmt.Sprintf("证书 %s（订单 %d）", c.Domain, c.OrderID)
+	if !c.Enabled {
+		return
+	}
+
+	if c.OrderID <= 0 {
+		v.report.add(IssueError, target, "缺少订单 ID", "填写 order_id")
+	}
+
+	// 证书实际包含的域名以本地订单记录为准（最近一次部署的证书），没有记录时使用配置
+	domains := c.Domains
+	if len(domains) == 0 && c.Domain != "" {
+		domains = []string{c.Domain}
+	}
+	if len(domains) == 0 {
+		v.report.add(IssueError, target, "没有配置域名", "填写 domain 和 domains")
+	}
+	for _, domain := range domains {
+		if net.ParseIP(domain) != nil {
+			continue
+		}
+		if err := util.ValidateDomain(domain); err != nil {
+			v.report.add(IssueError, target, fmt.Sprintf("域名 %s: %v", domain, err), "")
+		}
+	}
+	if meta, err := orderStore.LoadMeta(c.OrderID); err == nil && len(meta.Domains) > 0 {
+		if missing := missingDomains(domains, meta.Domains); len(missing) > 0 {
+			v.report.add(IssueWarning, target, "配置的域名不在已部署的证书中: "+strings.Join(missing, ", "), "与证书的 SAN 保持一致（domains）")
+		}
+		domains = meta.Domains
+	}
+
+	switch c.ValidationMethod {
+	case "", config.ValidationMethodFile, config.ValidationMethodDelegation:
+		for _, domain := range domains {
+			if msg := config.ValidateValidationMethod(domain, c.ValidationMethod); msg != "" {
+				v.report.add(IssueError, target, fmt.Sprintf("%s: %s", domain, msg), "通配符域名使用 delegation，IP 地址使用 file")
+			}
+		}
+	default:
+		v.report.add(IssueError, target, fmt.Sprintf("不支持的验证方法 %q", c.ValidationMethod), "使用 file 或 delegation")
+	}
+
+	if r := c.Renewal; r != nil {
+		if r.Percent < 0 || r.Percent > 99 {
+			v.report.add(IssueError, target, fmt.Sprintf("renewal.percent %d 超出范围", r.Percent), "设置为 1-99")
+		}
+		if r.Days < 0 {
+			v.report.add(IssueError, target, "renewal.days 不能为负数", "")
+		}
+	}
+	if r := c.Retention; r != nil && (r.KeepLast < 0 || r.DeleteAfterDays < 0) {
+		v.report.add(IssueError, target, "retention 不能为负数", "")
+	}
+
+	if c.AutoBindMode {
+		if len(c.BindRules) > 0 {
+			v.report.add(IssueWarning, target, "自动绑定模式下绑定规则不生效", "删除 bind_rules，或关闭 auto_bind_mode")
+		}
+	} else if len(c.BindRules) == 0 {
+		v.report.add(IssueWarning, target, "没有绑定规则，部署后不会绑定到 IIS", "添加 bind_rules，或开启 auto_bind_mode")
+	}
+
+	seen := make(map[string]bool)
+	for _, rule := range c.BindRules {
+		v.checkBindRule(target, rule, domains, seen)
+	}
+
+	for _, action := range c.PostActions {
+		v.checkPostAction(target, action)
+	}
+}
+
+// checkBindRule 绑定规则：域名在证书中、端口合法且不重复、站点存在
+func (v *validator) checkBindRule(certTarget string, rule config.BindRule, domains []string, seen map[string]bool) {
+	switch rule.Type {
+	case config.BindRuleHost:
+	case config.BindRuleSite, config.BindRulePattern:
+		v.checkExpandRule(certTarget, rule, domains)
+		return
+	default:
+		v.report.add(IssueError, certTarget+" / 绑定 "+rule.Domain, fmt.Sprintf("不支持的规则类型 %q", rule.Type), "使用 site、pattern，或不设置 type")
+		return
+	}
+
+	port := rule.Port
+	if port == 0 {
+		port = 443
+	}
+	target := fmt.Sprintf("%s / 绑定 %s:%d", certTarget, rule.Domain, port)
+
+	if ip := net.ParseIP(rule.Domain); ip != nil {
+		if ip.To4() == nil {
+			v.report.add(IssueError, target, "IP 绑定只支持 IPv4 地址", "IPv6 地址的证书需要手动绑定")
+		} else if !coversDomain(domains, rule.Domain) {
+			v.report.add(IssueError, target, "证书不包含该 IP 地址", "修改绑定地址，或使用包含该地址的证书（"+strings.Join(domains, ", ")+"）")
+		}
+	} else if err := util.ValidateHostname(rule.Domain); err != nil {
+		v.report.add(IssueError, target, err.Error(), "绑定域名必须是具体主机名，不能使用通配符")
+	} else if !coversDomain(domains, rule.Domain) {
+		v.report.add(IssueError, target, "证书不包含该域名", "修改绑定域名，或使用包含该域名的证书（"+strings.Join(domains, ", ")+"）")
+	}
+	if err := util.ValidatePort(port); err != nil {
+		v.report.add(IssueError, target, err.Error(), "")
+	}
+
+	key := util.ToASCII(rule.Domain) + ":" + fmt.Sprint(port)
+	if seen[key] {
+		v.report.add(IssueError, target, "绑定规则重复", "删除重复的规则")
+	}
+	seen[key] = true
+
+	if rule.HSTS != nil && rule.HSTS.MaxAge < 0 {
+		v.report.add(IssueError, target, "hsts.max_age 不能为负数", "")
+	}
+
+	if site := v.centralCertStoreSite(rule.Domain, port); site != "" {
+		v.report.add(IssueError, target, fmt.Sprintf("站点 %s 的 HTTPS 绑定使用集中式证书存储，部署时不会修改", site), "在 IIS 中取消该绑定的“使用集中式证书存储”，或删除该规则")
+	}
+
+	if rule.SiteName != "" {
+		if err := util.ValidateSiteName(rule.SiteName); err != nil {
+			v.report.add(IssueError, target, err.Error(), "")
+			return
+		}
+		if v.sites != nil {
+			if _, ok := v.sites[rule.SiteName]; !ok {
+				v.report.add(IssueError, target, fmt.Sprintf("站点 %s 不存在", rule.SiteName), "可用站点: "+strings.Join(v.siteNames(), ", "))
+			}
+		}
+		return
+	}
+
+	// 没有指定站点时按主机名匹配站点（HTTP 绑定的站点会添加 HTTPS 绑定），都没有时 HTTP.sys 证书不会被使用
+	if v.sites != nil && !v.hasBinding(rule.Domain, port) {
+		message := "没有站点使用该主机名"
+		if rule.ForceHTTPS != nil || rule.HSTS != nil {
+			message += "，跳转和 HSTS 配置不会生效"
+		}
+		v.report.add(IssueWarning, target, message, "在 IIS 中为站点添加绑定，或设置 site_name")
+	}
+}
+
+// checkExpandRule site/pattern 规则：站点存在、模式合法，并预览当前能展开的主机名
+func (v *validator) checkExpandRule(certTarget string, rule config.BindRule, domains []string) {
+	target := certTarget + " / 规则 " + ruleName(rule)
+
+	if rule.Type == config.BindRuleSite {
+		if rule.SiteName == "" {
+			v.report.add(IssueError, target, "site 规则未指定站点", "填写 site_name")
+			return
+		}
+		if v.sites != nil {
+			if _, ok := v.sites[rule.SiteName]; !ok {
+				v.report.add(IssueError, target, fmt.Sprintf("站点 %s 不存在", rule.SiteName), "可用站点: "+strings.Join(v.siteNames(), ", "))
+				return
+			}
+		}
+	} else if err := util.ValidateDomain(rule.Domain); err != nil {
+		v.report.add(IssueError, target, err.Error(), "domain 填写主机名或通配符，如 *.example.com")
+		return
+	}
+	if rule.Port != 0 {
+		if err := util.ValidatePort(rule.Port); err != nil {
+			v.report.add(IssueError, target, err.Error(), "")
+		}
+	}
+	for _, pattern := range rule.Exclude {
+		if err := util.ValidateDomain(pattern); err != nil {
+			v.report.add(IssueError, target, fmt.Sprintf("exclude %s: %v", pattern, err), "")
+		}
+	}
+
+	if v.sites == nil {
+		return
+	}
+	matches, err := matchRuleBindings(rule)
+	if err != nil {
+		v.report.add(IssueError, target, err.Error(), "")
+		return
+	}
+	count := 0
+	for _, m := range matches {
+		if !excluded(m.Host, rule.Exclude) && coversDomain(domains, m.Host) {
+			count++
+		}
+	}
+	if count == 0 {
+		v.report.add(IssueWarning, target, "当前没有可展开的主机名（需要证书包含、未被排除的 HTTPS 绑定）", "在 IIS 中添加 HTTPS 绑定，或检查 domain/exclude")
+	}
+}
+
+// checkPostAction 部署后动作
+func (v *validator) checkPostAction(certTarget string, action config.PostAction) {
+	target := certTarget + " / 动作 " + postActionName(action)
+	switch action.Type {
+	case config.PostActionRecyclePool:
+		if action.Target == "" {
+			v.report.add(IssueError, target, "未指定应用程序池", "填写 target")
+		}
+	case config.PostActionRestartSite, config.PostActionStartSite:
+		if action.Target == "" {
+			v.report.add(IssueError, target, "未指定站点", "填写 target")
+		} else if v.sites != nil {
+			if _, ok := v.sites[action.Target]; !ok {
+				v.report.add(IssueError, target, fmt.Sprintf("站点 %s 不存在", action.Target), "可用站点: "+strings.Join(v.siteNames(), ", "))
+			}
+		}
+	case config.PostActionScript:
+		if !filepath.IsAbs(action.Command) {
+			v.report.add(IssueError, target, "脚本路径必须为绝对路径", "填写 command 的完整路径")
+		} else if _, err := os.Stat(action.Command); err != nil {
+			v.report.add(IssueError, target, fmt.Sprintf("脚本不存在: %v", err), "")
+		}
+	default:
+		v.report.add(IssueError, target, fmt.Sprintf("未知的动作类型 %q", action.Type), "使用 recycle_pool、restart_site、start_site 或 script")
+	}
+	if action.Timeout < 0 {
+		v.report.add(IssueError, target, "timeout 不能为负数", "")
+	}
+}
+
+func (v *validator) siteNames() []string {
+	names := make([]string, 0, len(v.sites))
+	for name := range v.sites {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// hasBinding 是否有站点配置了该主机名的 HTTP 绑定或该端口的 HTTPS 绑定（与 ruleSites 一致）
+func (v *validator) hasBinding(host string, port int) bool {
+	for _, site := range v.sites {
+		for _, b := range site.Bindings {
+			if !util.EqualDomain(b.Host, host) {
+				continue
+			}
+			if b.Protocol == "http" || (b.Protocol == "https" && b.Port == port) {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// centralCertStoreSite 返回 host:port 的 HTTPS 绑定使用集中式证书存储的站点（没有时为空）
+func (v *validator) centralCertStoreSite(host string, port int) string {
+	for _, name := range v.siteNames() {
+		for _, b := range v.sites[name].Bindings {
+			if b.Protocol == "https" && b.Port == port && util.EqualDomain(b.Host, host) && b.SSLFlags&sslFlagCentralCertStore != 0 {
+				return name
+			}
+		}
+	}
+	return ""
+}
+
+// coversDomain 证书域名（支持通配符）是否包含主机名
+func coversDomain(domains []string, host string) bool {
+	for _, d := range domains {
+		if iis.MatchDomainForBinding(host, d) {
+			return true
+		}
+	}
+	return false
+}
+
+// missingDomains 返回 configured 中不在 actual 里的域名
+func missingDomains(configured, actual []string) []string {
+	var missing []string
+	for _, d := range configured {
+		found := false
+		for _, a := range actual {
+			if util.EqualDomain(d, a) {
+				found = true
+				break
+			}
+		}
+		if !found {
+			missing = append(missing, d)
+		}
+	}
+	return missing
+}
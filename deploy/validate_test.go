@@ -0,0 +1,232 @@
+package deploy
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"cert-deploy/config"
+	"cert-deploy/iis"
+)
+
+// testSites 检查用的 IIS 站点
+func testSites() map[string]iis.SiteInfo {
+	return map[string]iis.SiteInfo{
+		"Default Web Site": {Name: "Default Web Site", Bindings: []iis.BindingInfo{
+			{Protocol: "http", Port: 80, Host: "www.example.com"},
+			{Protocol: "https", Port: 443, Host: "api.example.com"},
+		}},
+		"Shop": {Name: "Shop", Bindings: []iis.BindingInfo{
+			{Protocol: "https", Port: 8443, Host: "shop.example.com"},
+			{Protocol: "https", Port: 443, Host: "ccs.example.com", SSLFlags: 3},
+		}},
+	}
+}
+
+// assertIssues 检查问题列表与期望一致（按顺序比较级别和消息片段）
+func assertIssues(t *testing.T, got []Issue, want []string) {
+	t.Helper()
+	lines := make([]string, len(got))
+	for i, issue := range got {
+		lines[i] = string(issue.Level) + ": " + issue.Message
+	}
+	if len(got) != len(want) {
+		t.Fatalf("问题数 = %d，期望 %d:\n%s", len(got), len(want), strings.Join(lines, "\n"))
+	}
+	for i, w := range want {
+		if !strings.Contains(lines[i], w) {
+			t.Errorf("问题 %d = %q，期望包含 %q", i, lines[i], w)
+		}
+	}
+}
+
+func TestCheckBindRule(t *testing.T) {
+	domains := []string{"www.example.com", "*.example.com", "192.0.2.10"}
+
+	tests := []struct {
+		name  string
+		rules []config.BindRule
+		want  []string // "级别: 消息片段"
+	}{
+		{
+			name:  "证书包含的域名",
+			rules: []config.BindRule{{Domain: "www.example.com", Port: 443}},
+		},
+		{
+			name:  "通配符覆盖一级子域名",
+			rules: []config.BindRule{{Domain: "api.example.com", Port: 443}},
+		},
+		{
+			name:  "通配符不覆盖多级子域名",
+			rules: []config.BindRule{{Domain: "a.b.example.com", Port: 443}},
+			want:  []string{"error: 证书不包含该域名", "warning: 没有站点使用该主机名"},
+		},
+		{
+			name:  "通配符不覆盖根域名",
+			rules: []config.BindRule{{Domain: "example.com", Port: 443}},
+			want:  []string{"error: 证书不包含该域名", "warning: 没有站点使用该主机名"},
+		},
+		{
+			name:  "绑定域名不能是通配符",
+			rules: []config.BindRule{{Domain: "*.example.com", Port: 443}},
+			want:  []string{"error: 主机名格式无效", "warning: 没有站点使用该主机名"},
+		},
+		{
+			name:  "证书包含的 IPv4 地址",
+			rules: []config.BindRule{{Domain: "192.0.2.10", Port: 443}},
+			want:  []string{"warning: 没有站点使用该主机名"},
+		},
+		{
+			name:  "证书不包含的 IPv4 地址",
+			rules: []config.BindRule{{Domain: "192.0.2.11", Port: 443}},
+			want:  []string{"error: 证书不包含该 IP 地址", "warning: 没有站点使用该主机名"},
+		},
+		{
+			name:  "IPv6 地址",
+			rules: []config.BindRule{{Domain: "2001:db8::1", Port: 443}},
+			want:  []string{"error: IP 绑定只支持 IPv4 地址", "warning: 没有站点使用该主机名"},
+		},
+		{
+			name:  "主机名和端口重复（端口默认 443）",
+			rules: []config.BindRule{{Domain: "www.example.com"}, {Domain: "WWW.example.com", Port: 443}},
+			want:  []string{"error: 绑定规则重复"},
+		},
+		{
+			name:  "同一主机名的不同端口不算重复",
+			rules: []config.BindRule{{Domain: "api.example.com", Port: 443}, {Domain: "api.example.com", Port: 8443}},
+			want:  []string{"warning: 没有站点使用该主机名"},
+		},
+		{
+			name:  "端口超出范围",
+			rules: []config.BindRule{{Domain: "www.example.com", Port: 70000}},
+			want:  []string{"error: "},
+		},
+		{
+			name:  "没有站点使用时提示跳转不生效",
+			rules: []config.BindRule{{Domain: "mail.example.com", Port: 443, HSTS: &config.HSTSConfig{Enabled: true, MaxAge: -1}}},
+			want:  []string{"error: hsts.max_age 不能为负数", "warning: 没有站点使用该主机名，跳转和 HSTS 配置不会生效"},
+		},
+		{
+			name:  "绑定使用集中式证书存储",
+			rules: []config.BindRule{{Domain: "ccs.example.com", Port: 443}},
+			want:  []string{"error: 站点 Shop 的 HTTPS 绑定使用集中式证书存储"},
+		},
+		{
+			name:  "指定的站点存在",
+			rules: []config.BindRule{{Domain: "mail.example.com", Port: 443, SiteName: "Shop"}},
+		},
+		{
+			name:  "指定的站点不存在",
+			rules: []config.BindRule{{Domain: "www.example.com", Port: 443, SiteName: "Blog"}},
+			want:  []string{"error: 站点 Blog 不存在"},
+		},
+		{
+			name:  "不支持的规则类型",
+			rules: []config.BindRule{{Type: "regex", Domain: "www.example.com"}},
+			want:  []string{`error: 不支持的规则类型 "regex"`},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			v := &validator{report: &ValidationReport{}, sites: testSites()}
+			seen := make(map[string]bool)
+			for _, rule := range tt.rules {
+				v.checkBindRule("证书", rule, domains, seen)
+			}
+			assertIssues(t, v.report.Issues, tt.want)
+		})
+	}
+}
+
+func TestCheckExpandRule(t *testing.T) {
+	// 无法读取 IIS 站点时只检查规则本身，不展开主机名
+	tests := []struct {
+		name  string
+		sites map[string]iis.SiteInfo
+		rule  config.BindRule
+		want  []string
+	}{
+		{
+			name: "pattern 规则",
+			rule: config.BindRule{Type: config.BindRulePattern, Domain: "*.example.com", Exclude: []string{"admin.example.com"}},
+		},
+		{
+			name: "pattern 规则的模式不合法",
+			rule: config.BindRule{Type: config.BindRulePattern, Domain: "*.*.example.com"},
+			want: []string{"error: "},
+		},
+		{
+			name: "exclude 不合法",
+			rule: config.BindRule{Type: config.BindRulePattern, Domain: "*.example.com", Exclude: []string{"bad host"}},
+			want: []string{"error: exclude bad host"},
+		},
+		{
+			name: "端口超出范围",
+			rule: config.BindRule{Type: config.BindRulePattern, Domain: "*.example.com", Port: -1},
+			want: []string{"error: "},
+		},
+		{
+			name: "site 规则未指定站点",
+			rule: config.BindRule{Type: config.BindRuleSite},
+			want: []string{"error: site 规则未指定站点"},
+		},
+		{
+			name: "site 规则：无法读取站点时不检查站点是否存在",
+			rule: config.BindRule{Type: config.BindRuleSite, SiteName: "Blog"},
+		},
+		{
+			name:  "site 规则的站点不存在",
+			sites: testSites(),
+			rule:  config.BindRule{Type: config.BindRuleSite, SiteName: "Blog"},
+			want:  []string{"error: 站点 Blog 不存在"},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			v := &validator{report: &ValidationReport{}, sites: tt.sites}
+			v.checkBindRule("证书", tt.rule, []string{"*.example.com"}, make(map[string]bool))
+			assertIssues(t, v.report.Issues, tt.want)
+			for _, issue := range v.report.Issues {
+				if !strings.Contains(issue.Target, "规则 "+ruleName(tt.rule)) {
+					t.Errorf("Target = %q，期望包含规则名", issue.Target)
+				}
+			}
+		})
+	}
+}
+
+func TestCheckPostAction(t *testing.T) {
+	script := filepath.Join(t.TempDir(), "reload.ps1")
+	if err := os.WriteFile(script, []byte("exit 0"), 0600); err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name   string
+		action config.PostAction
+		want   []string
+	}{
+		{name: "回收应用程序池", action: config.PostAction{Type: config.PostActionRecyclePool, Target: "DefaultAppPool"}},
+		{name: "未指定应用程序池", action: config.PostAction{Type: config.PostActionRecyclePool}, want: []string{"error: 未指定应用程序池"}},
+		{name: "重启站点", action: config.PostAction{Type: config.PostActionRestartSite, Target: "Shop"}},
+		{name: "启动不存在的站点", action: config.PostAction{Type: config.PostActionStartSite, Target: "Blog"}, want: []string{"error: 站点 Blog 不存在"}},
+		{name: "未指定站点", action: config.PostAction{Type: config.PostActionRestartSite}, want: []string{"error: 未指定站点"}},
+		{name: "脚本", action: config.PostAction{Type: config.PostActionScript, Command: script}},
+		{name: "脚本为相对路径", action: config.PostAction{Type: config.PostActionScript, Command: "reload.ps1"}, want: []string{"error: 脚本路径必须为绝对路径"}},
+		{name: "脚本不存在", action: config.PostAction{Type: config.PostActionScript, Command: script + ".missing"}, want: []string{"error: 脚本不存在"}},
+		{name: "未知类型", action: config.PostAction{Type: "reboot"}, want: []string{`error: 未知的动作类型 "reboot"`}},
+		{
+			name:   "超时为负数",
+			action: config.PostAction{Type: config.PostActionRecyclePool, Target: "DefaultAppPool", Timeout: -1},
+			want:   []string{"error: timeout 不能为负数"},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			v := &validator{report: &ValidationReport{}, sites: testSites()}
+			v.checkPostAction("证书", tt.action)
+			assertIssues(t, v.report.Issues, tt.want)
+		})
+	}
+}
@@ -0,0 +1,190 @@
+package deploy
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"net"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"cert-deploy/cert"
+	"cert-deploy/iis"
+	"cert-deploy/util"
+)
+
+// TLS 握手校验重试参数
+const (
+	handshakeAttempts = 3
+	handshakeInterval = 2 * time.Second
+)
+
+// bindMu 串行化 HTTP.sys 绑定和站点配置修改
+// 证书并发处理时，netsh/appcmd 同时修改会互相覆盖；握手校验耗时较长，不持有此锁
+var bindMu sync.Mutex
+
+// bindTarget 证书绑定目标
+type bindTarget struct {
+	Host       string // SNI 绑定的主机名，或 IP 绑定的 IP（0.0.0.0 表示全部）
+	Port       int
+	ByIP       bool   // IP:Port 绑定（非 SNI）
+	ServerName string // 握手时使用的 SNI 名称
+}
+
+// bindOutcome 绑定结果
+type bindOutcome struct {
+	OldHash   string // 绑定前的证书指纹（无原绑定时为空）
+	Unchanged bool   // 本次部署前就已绑定该证书（不需要回调）
+	Note      string // 需要写入 Result.Message 的说明，如未能完成握手校验
+}
+
+// bindAndVerify 绑定证书，并通过本机 TLS 握手确认客户端实际拿到的是新证书和完整证书链
+// 校验失败时回滚到绑定前的证书（有原绑定时）；端点无法连接时绑定保留，但在 Note 中注明未校验
+// 预演模式只记录动作；目标已绑定该证书时不再重复绑定
+// tr 记录原指纹和绑定进度，恢复中断的部署时仍能回滚到最初的证书
+// 只在修改绑定时持有 bindMu，握手校验期间其他证书可以继续绑定
+// ctx 取消后不再开始绑定；校验中止时绑定保留、不记录完成，下次运行恢复部署时补做校验
+func bindAndVerify(ctx context.Context, target bindTarget, thumbprint, chainPEM string, verify bool, plan *Plan, orderID int, tr *stateTracker) (out bindOutcome, err error) {
+	locked := false
+	unlock := func() {
+		if locked {
+			bindMu.Unlock()
+			locked = false
+		}
+	}
+	if !plan.Active() {
+		bindMu.Lock()
+		locked = true
+	}
+	defer unlock()
+
+	target.Host = util.ToASCII(target.Host)
+	key := net.JoinHostPort(target.Host, strconv.Itoa(target.Port))
+	currentHash := currentBindingHash(target)
+	out.OldHash = tr.rememberPrevious(key, currentHash)
+	alreadyBound := strings.EqualFold(currentHash, thumbprint)
+
+	if alreadyBound && strings.EqualFold(out.OldHash, thumbprint) {
+		log.Printf("%s 已绑定当前证书，跳过", util.DisplayHostPort(key))
+		plan.Add(Action{Kind: ActionSkip, OrderID: orderID, Domain: target.ServerName, Target: key, NewHash: thumbprint, Detail: "已绑定当前证书"})
+		tr.markBound(key)
+		out.Unchanged = true
+		return out, nil
+	}
+
+	if plan.Active() {
+		detail := "SNI"
+		if target.ByIP {
+			detail = "IP:Port"
+		}
+		if verify {
+			detail += "，绑定后 TLS 握手校验"
+		}
+		plan.Add(Action{
+			Kind:    ActionBind,
+			OrderID: orderID,
+			Domain:  target.ServerName,
+			Target:  key,
+			OldHash: out.OldHash,
+			NewHash: thumbprint,
+			Detail:  detail,
+		})
+		return out, nil
+	}
+
+	// 中断恢复时绑定可能已在上次完成，只需补做校验
+	if !alreadyBound {
+		if err = bindTargetCert(ctx, target, thumbprint); err != nil {
+			return out, err
+		}
+	}
+	if !verify {
+		tr.markBound(key)
+		return out, nil
+	}
+	unlock()
+
+	addr := handshakeAddr(target)
+	serverName := handshakeServerName(target.ServerName)
+	err = cert.CheckServedCertificate(ctx, addr, serverName, thumbprint, chainPEM, handshakeAttempts, handshakeInterval)
+	if err == nil {
+		log.Printf("TLS 握手校验通过: %s (%s)", addr, serverName)
+		tr.markBound(key)
+		return out, nil
+	}
+	if ctx.Err() != nil {
+		return out, fmt.Errorf("TLS 握手校验未完成: %v（绑定已保留，下次运行继续校验）", err)
+	}
+	if errors.Is(err, cert.ErrEndpointUnreachable) {
+		// 站点未启动、端口被拦截等情况无法校验，绑定保留，但结果中注明未校验
+		log.Printf("警告: 未完成 TLS 握手校验: %v", err)
+		tr.markBound(key)
+		out.Note = fmt.Sprintf("未校验: %v", err)
+		return out, nil
+	}
+
+	log.Printf("TLS 握手校验失败: %v", err)
+	if out.OldHash == "" || strings.EqualFold(out.OldHash, thumbprint) {
+		return out, fmt.Errorf("TLS 握手校验失败: %v（无原绑定，未回滚）", err)
+	}
+
+	bindMu.Lock()
+	locked = true
+	if current := currentBindingHash(target); !strings.EqualFold(current, thumbprint) {
+		// 校验期间绑定已被修改，不覆盖
+		return out, fmt.Errorf("TLS 握手校验失败: %v（绑定已变为 %s，未回滚）", err, current)
+	}
+	if rollbackErr := bindTargetCert(context.WithoutCancel(ctx), target, out.OldHash); rollbackErr != nil {
+		return out, fmt.Errorf("TLS 握手校验失败: %v（回滚失败: %v）", err, rollbackErr)
+	}
+	log.Printf("已回滚到原证书: %s", out.OldHash)
+	return out, fmt.Errorf("TLS 握手校验失败: %v（已回滚到原证书 %s）", err, out.OldHash)
+}
+
+// bindTargetCert 按绑定类型（SNI 或 IP:Port）绑定证书，调用方持有 bindMu
+func bindTargetCert(ctx context.Context, target bindTarget, thumbprint string) error {
+	if target.ByIP {
+		return iis.BindCertificateByIP(ctx, target.Host, target.Port, thumbprint)
+	}
+	return iis.BindCertificate(ctx, target.Host, target.Port, thumbprint)
+}
+
+// currentBindingHash 获取绑定目标当前的证书指纹
+func currentBindingHash(target bindTarget) string {
+	var binding *iis.SSLBinding
+	var err error
+	if target.ByIP {
+		binding, err = iis.GetBindingForIP(target.Host, target.Port)
+	} else {
+		binding, err = iis.GetBindingForHost(target.Host, target.Port)
+	}
+	if err != nil || binding == nil {
+		return ""
+	}
+	return binding.CertHash
+}
+
+// handshakeAddr 本机握手地址，全部 IP 的绑定连接回环地址
+func handshakeAddr(target bindTarget) string {
+	host := "127.0.0.1"
+	if target.ByIP && target.Host != "" && target.Host != "0.0.0.0" {
+		host = target.Host
+	}
+	port := target.Port
+	if port == 0 {
+		port = 443
+	}
+	return net.JoinHostPort(host, strconv.Itoa(port))
+}
+
+// handshakeServerName 通配符域名替换为任意一级子域名用于 SNI（国际化域名使用 A-label）
+func handshakeServerName(name string) string {
+	name = util.ToASCII(name)
+	if strings.HasPrefix(name, "*.") {
+		return "certdeploy-check" + name[1:]
+	}
+	return name
+}
@@ -5,8 +5,12 @@ go 1.24.0
 require (
 	github.com/rodrigocfd/windigo v0.2.3
 	github.com/youmark/pkcs8 v0.0.0-20240726163527-a2c0da244d78
+	golang.org/x/net v0.24.0
 	golang.org/x/text v0.33.0
+	gopkg.in/yaml.v3 v3.0.1
 	software.sslmate.com/src/go-pkcs12 v0.7.0
 )
 
-require golang.org/x/crypto v0.22.0 // indirect
+require (
+	golang.org/x/crypto v0.22.0 // indirect
+)
@@ -1,13 +1,17 @@
 package iis
 
 import (
+	"context"
 	"encoding/xml"
 	"fmt"
+	"net"
 	"os"
 	"path/filepath"
 	"strconv"
 	"strings"
+	"time"
 
+	"cert-deploy/iis/iisconfig"
 	"cert-deploy/util"
 )
 
@@ -89,8 +93,17 @@ func CheckIISInstalled() error {
 	return nil
 }
 
-// ScanSites 扫描所有 IIS 站点
+// ScanSites 扫描所有 IIS 站点（实时查询，同时刷新快照）
 func ScanSites() ([]SiteInfo, error) {
+	sites, err := scanSites()
+	if err != nil {
+		return nil, err
+	}
+	inv.setSites(sites)
+	return sites, nil
+}
+
+func scanSites() ([]SiteInfo, error) {
 	if err := CheckIISInstalled(); err != nil {
 		return nil, err
 	}
@@ -117,6 +130,11 @@ func ScanSites() ([]SiteInfo, error) {
 		sites = append(sites, site)
 	}
 
+	// appcmd 输出不含 sslFlags、应用程序和 FTP 设置，从 applicationHost.config 补全（读取失败不影响扫描结果）
+	if appHost, err := LoadAppHostConfig(); err == nil {
+		applyAppHost(sites, appHost)
+	}
+
 	return sites, nil
 }
 
@@ -159,7 +177,7 @@ func parseBindings(bindingsStr string) []BindingInfo {
 
 		host := ""
 		if len(colonParts) > 2 {
-			host = colonParts[2]
+			host = util.ToASCII(colonParts[2])
 		}
 
 		binding := BindingInfo{
@@ -181,12 +199,15 @@ func AddHttpsBinding(siteName, host string, port int) error {
 		port = 443
 	}
 
+	// 国际化域名使用 A-label
+	host = util.ToASCII(host)
+
 	// 参数验证
 	if err := validateBindingParams(siteName, host, port); err != nil {
 		return err
 	}
 
-	bindingInfo := fmt.Sprintf("*:%d:%s", port, host)
+	bindingInfo := iisconfig.FormatBindingInformation("*", port, host)
 	// sslFlags=1 表示启用 SNI（服务器名称指示）
 	output, err := util.RunCmdCombined(getAppcmdPath(), "set", "site",
 		fmt.Sprintf("/site.name:%s", siteName),
@@ -195,6 +216,34 @@ func AddHttpsBinding(siteName, host string, port int) error {
 	if err != nil {
 		return fmt.Errorf("添加绑定失败: %v, 输出: %s", err, output)
 	}
+	inv.addSiteBinding(siteName, newHTTPSBinding(host, port))
+
+	return nil
+}
+
+// AddHttpsBindingByIP 添加 IP:Port 的 HTTPS 绑定（不带主机名、不启用 SNI，用于 IP 证书）
+func AddHttpsBindingByIP(siteName, ip string, port int) error {
+	if port == 0 {
+		port = 443
+	}
+
+	// 参数验证
+	if err := validateBindingParams(siteName, "", port); err != nil {
+		return err
+	}
+	if err := util.ValidateIPv4(ip); err != nil {
+		return fmt.Errorf("无效的 IP 地址: %w", err)
+	}
+
+	bindingInfo := iisconfig.FormatBindingInformation(ip, port, "")
+	output, err := util.RunCmdCombined(getAppcmdPath(), "set", "site",
+		fmt.Sprintf("/site.name:%s", siteName),
+		fmt.Sprintf("/+bindings.[protocol='https',bindingInformation='%s']", bindingInfo))
+
+	if err != nil {
+		return fmt.Errorf("添加绑定失败: %v, 输出: %s", err, output)
+	}
+	inv.addSiteBinding(siteName, BindingInfo{Protocol: "https", IP: ip, Port: port, HasSSL: true})
 
 	return nil
 }
@@ -205,6 +254,9 @@ func AddHttpsBindingWithCert(siteName, host string, port int, certHash string) e
 		port = 443
 	}
 
+	// 国际化域名使用 A-label
+	host = util.ToASCII(host)
+
 	// 参数验证
 	if err := validateBindingParams(siteName, host, port); err != nil {
 		return err
@@ -217,7 +269,7 @@ func AddHttpsBindingWithCert(siteName, host string, port int, certHash string) e
 	certHash = strings.ReplaceAll(certHash, " ", "")
 	certHash = strings.ReplaceAll(certHash, "-", "")
 
-	bindingInfo := fmt.Sprintf("*:%d:%s", port, host)
+	bindingInfo := iisconfig.FormatBindingInformation("*", port, host)
 	// sslFlags=1 表示启用 SNI
 	output, err := util.RunCmdCombined(getAppcmdPath(), "set", "site",
 		fmt.Sprintf("/site.name:%s", siteName),
@@ -229,22 +281,31 @@ func AddHttpsBindingWithCert(siteName, host string, port int, certHash string) e
 			return fmt.Errorf("添加绑定失败: %v, 输出: %s", err, output)
 		}
 	}
+	inv.addSiteBinding(siteName, newHTTPSBinding(host, port))
 
 	return nil
 }
 
+// newHTTPSBinding 本程序添加的 SNI HTTPS 绑定（用于更新站点快照）
+func newHTTPSBinding(host string, port int) BindingInfo {
+	return BindingInfo{Protocol: "https", IP: "0.0.0.0", Port: port, Host: host, HasSSL: true, SSLFlags: 1}
+}
+
 // RemoveHttpsBinding 移除 HTTPS 绑定
 func RemoveHttpsBinding(siteName, host string, port int) error {
 	if port == 0 {
 		port = 443
 	}
 
+	// 国际化域名使用 A-label
+	host = util.ToASCII(host)
+
 	// 参数验证
 	if err := validateBindingParams(siteName, host, port); err != nil {
 		return err
 	}
 
-	bindingInfo := fmt.Sprintf("*:%d:%s", port, host)
+	bindingInfo := iisconfig.FormatBindingInformation("*", port, host)
 	output, err := util.RunCmdCombined(getAppcmdPath(), "set", "site",
 		fmt.Sprintf("/site.name:%s", siteName),
 		fmt.Sprintf("/-bindings.[protocol='https',bindingInformation='%s']", bindingInfo))
@@ -252,6 +313,7 @@ func RemoveHttpsBinding(siteName, host string, port int) error {
 	if err != nil {
 		return fmt.Errorf("移除绑定失败: %v, 输出: %s", err, output)
 	}
+	inv.removeSiteBinding(siteName, newHTTPSBinding(host, port))
 
 	return nil
 }
@@ -291,6 +353,7 @@ func StartSite(siteName string) error {
 	if err != nil {
 		return fmt.Errorf("启动站点失败: %v, 输出: %s", err, output)
 	}
+	setCachedSiteState(siteName, "Started")
 	return nil
 }
 
@@ -305,9 +368,77 @@ func StopSite(siteName string) error {
 	if err != nil {
 		return fmt.Errorf("停止站点失败: %v, 输出: %s", err, output)
 	}
+	setCachedSiteState(siteName, "Stopped")
 	return nil
 }
 
+// RestartSite 重启站点（先停止再启动），返回命令输出
+// ctx 取消时不再停止站点；已停止的站点仍在剩余时限内启动，不因 ctx 取消而停留在停止状态
+func RestartSite(ctx context.Context, siteName string, timeout time.Duration) (string, error) {
+	if err := util.ValidateSiteName(siteName); err != nil {
+		return "", fmt.Errorf("无效的站点名称: %w", err)
+	}
+
+	// 停止和启动共用一个时限
+	deadline := time.Now().Add(timeout)
+	stopOutput, err := util.RunCmdWithTimeout(ctx, timeout, nil, getAppcmdPath(), "stop", "site", siteName)
+	if err != nil {
+		return stopOutput, fmt.Errorf("停止站点失败: %v", err)
+	}
+	remaining := time.Until(deadline)
+	if remaining <= 0 {
+		setCachedSiteState(siteName, "Stopped")
+		return strings.TrimSpace(stopOutput), fmt.Errorf("重启站点超时（%v），站点已停止", timeout)
+	}
+	startOutput, err := util.RunCmdWithTimeout(context.WithoutCancel(ctx), remaining, nil, getAppcmdPath(), "start", "site", siteName)
+	output := strings.TrimSpace(stopOutput) + "\n" + strings.TrimSpace(startOutput)
+	if err != nil {
+		setCachedSiteState(siteName, "Stopped")
+		return output, fmt.Errorf("启动站点失败: %v", err)
+	}
+	setCachedSiteState(siteName, "Started")
+	return output, nil
+}
+
+// EnsureSiteStarted 站点未运行时启动站点，返回命令输出
+func EnsureSiteStarted(ctx context.Context, siteName string, timeout time.Duration) (string, error) {
+	state, err := GetSiteState(siteName)
+	if err != nil {
+		return "", err
+	}
+	if strings.EqualFold(state, "Started") {
+		return "站点已在运行", nil
+	}
+
+	output, err := util.RunCmdWithTimeout(ctx, timeout, nil, getAppcmdPath(), "start", "site", siteName)
+	if err != nil {
+		return output, fmt.Errorf("启动站点失败: %v", err)
+	}
+	setCachedSiteState(siteName, "Started")
+	return output, nil
+}
+
+// setCachedSiteState 更新站点快照中的运行状态
+func setCachedSiteState(siteName, state string) {
+	inv.updateSite(siteName, func(site *SiteInfo) {
+		site.State = state
+	})
+}
+
+// RecycleAppPool 回收应用程序池，返回命令输出
+func RecycleAppPool(ctx context.Context, poolName string, timeout time.Duration) (string, error) {
+	// 应用程序池名称与站点名称规则相同
+	if err := util.ValidateSiteName(poolName); err != nil {
+		return "", fmt.Errorf("无效的应用程序池名称: %w", err)
+	}
+
+	output, err := util.RunCmdWithTimeout(ctx, timeout, nil, getAppcmdPath(), "recycle", "apppool", "/apppool.name:"+poolName)
+	if err != nil {
+		return output, fmt.Errorf("回收应用程序池失败: %v", err)
+	}
+	return output, nil
+}
+
 // HttpBindingMatch HTTP 绑定匹配结果
 type HttpBindingMatch struct {
 	SiteName   string
@@ -319,7 +450,7 @@ type HttpBindingMatch struct {
 // FindMatchingBindings 查找与证书域名匹配的 IIS 绑定
 // 返回: httpsBindings (已有HTTPS绑定), httpBindings (可添加HTTPS的HTTP绑定)
 func FindMatchingBindings(certDomains []string) (httpsMatches []HttpBindingMatch, httpMatches []HttpBindingMatch, err error) {
-	sites, err := ScanSites()
+	sites, err := CachedSites()
 	if err != nil {
 		return nil, nil, err
 	}
@@ -397,6 +528,11 @@ func GetSitePhysicalPath(siteName string) (string, error) {
 		return "", fmt.Errorf("无效的站点名称: %w", err)
 	}
 
+	// 优先直接读取 applicationHost.config，避免启动 PowerShell
+	if path, err := getSitePhysicalPathFromConfig(siteName); err == nil {
+		return path, nil
+	}
+
 	// 转义 PowerShell 字符串
 	escapedSiteName := util.EscapePowerShellString(siteName)
 
@@ -472,16 +608,16 @@ func expandIISPhysicalPath(path string) string {
 
 // GetSitePhysicalPathByDomain 根据域名查找站点并获取物理路径
 func GetSitePhysicalPathByDomain(domain string) (string, string, error) {
-	sites, err := ScanSites()
+	sites, err := CachedSites()
 	if err != nil {
 		return "", "", err
 	}
 
-	domain = strings.ToLower(strings.TrimSpace(domain))
+	domain = util.ToASCII(domain)
 
 	for _, site := range sites {
 		for _, binding := range site.Bindings {
-			if strings.EqualFold(binding.Host, domain) {
+			if util.EqualDomain(binding.Host, domain) {
 				path, err := GetSitePhysicalPath(site.Name)
 				if err != nil {
 					continue
@@ -491,6 +627,24 @@ func GetSitePhysicalPathByDomain(domain string) (string, string, error) {
 		}
 	}
 
+	// IP 证书：优先使用 80 端口绑定到该 IP 的站点
+	if ip := net.ParseIP(domain); ip != nil {
+		for _, site := range sites {
+			for _, binding := range site.Bindings {
+				if binding.Host != "" || !strings.EqualFold(binding.Protocol, "http") || binding.Port != 80 {
+					continue
+				}
+				if ip.Equal(net.ParseIP(binding.IP)) {
+					path, err := GetSitePhysicalPath(site.Name)
+					if err != nil {
+						continue
+					}
+					return site.Name, path, nil
+				}
+			}
+		}
+	}
+
 	candidateSites := make([]string, 0)
 	seen := make(map[string]bool)
 	for _, site := range sites {
@@ -526,9 +680,10 @@ func GetSitePhysicalPathByDomain(domain string) (string, string, error) {
 // MatchDomainForBinding 检查绑定域名是否匹配证书域名
 // bindingHost: IIS 绑定的域名 (如 www.example.com)
 // certDomain: 证书的域名 (如 *.example.com 或 www.example.com)
+// 国际化域名统一转换为 A-label 后比较
 func MatchDomainForBinding(bindingHost, certDomain string) bool {
-	bindingHost = strings.ToLower(strings.TrimSpace(bindingHost))
-	certDomain = strings.ToLower(strings.TrimSpace(certDomain))
+	bindingHost = util.ToASCII(bindingHost)
+	certDomain = util.ToASCII(certDomain)
 
 	if bindingHost == "" || certDomain == "" {
 		return false
@@ -539,6 +694,12 @@ func MatchDomainForBinding(bindingHost, certDomain string) bool {
 		return true
 	}
 
+	// IP 地址按地址比较，不参与通配符匹配
+	if ip := net.ParseIP(bindingHost); ip != nil {
+		certIP := net.ParseIP(certDomain)
+		return certIP != nil && certIP.Equal(ip)
+	}
+
 	// 通配符证书匹配: *.example.com 匹配 www.example.com, api.example.com 等
 	if strings.HasPrefix(certDomain, "*.") {
 		suffix := certDomain[1:] // ".example.com"
@@ -0,0 +1,108 @@
+package iis
+
+import (
+	"fmt"
+	"strings"
+
+	"cert-deploy/iis/iisconfig"
+	"cert-deploy/util"
+)
+
+// LoadAppHostConfig 加载本机 applicationHost.config
+func LoadAppHostConfig() (*iisconfig.AppHostConfig, error) {
+	return iisconfig.LoadAppHost(iisconfig.DefaultAppHostPath())
+}
+
+// applyAppHost 用 applicationHost.config 补全 appcmd 扫描结果
+// appcmd list site 的 bindings 属性不包含 sslFlags，也没有应用程序和 FTP 设置
+func applyAppHost(sites []SiteInfo, cfg *iisconfig.AppHostConfig) {
+	flags := make(map[string]int)
+	details := make(map[string]iisconfig.Site)
+	for _, s := range cfg.Sites() {
+		details[strings.ToLower(s.Name)] = s
+		for _, b := range s.Bindings {
+			info := b.BindingInformation
+			if ip, port, host, err := iisconfig.ParseBindingInformation(info); err == nil {
+				info = iisconfig.FormatBindingInformation(ip, port, util.ToASCII(host))
+			}
+			key := strings.ToLower(s.Name + "|" + b.Protocol + "|" + info)
+			flags[key] = b.SSLFlags
+		}
+	}
+
+	for i := range sites {
+		for j := range sites[i].Bindings {
+			b := &sites[i].Bindings[j]
+			info := iisconfig.FormatBindingInformation(b.IP, b.Port, b.Host)
+			key := strings.ToLower(sites[i].Name + "|" + b.Protocol + "|" + info)
+			if v, ok := flags[key]; ok {
+				b.SSLFlags = v
+			}
+		}
+
+		detail, ok := details[strings.ToLower(sites[i].Name)]
+		if !ok {
+			continue
+		}
+		for _, app := range detail.Applications {
+			info := ApplicationInfo{Path: app.Path, AppPool: app.ApplicationPool}
+			for _, vdir := range app.VirtualDirectories {
+				if vdir.Path == "/" {
+					info.PhysicalPath = vdir.PhysicalPath
+				}
+			}
+			sites[i].Applications = append(sites[i].Applications, info)
+		}
+		if detail.FTP != nil {
+			sites[i].FTP = &FTPInfo{
+				CertHash:             detail.FTP.ServerCertHash,
+				CertStore:            detail.FTP.ServerCertStoreName,
+				ControlChannelPolicy: detail.FTP.ControlChannelPolicy,
+				DataChannelPolicy:    detail.FTP.DataChannelPolicy,
+			}
+		}
+	}
+}
+
+// getSitePhysicalPathFromConfig 从 applicationHost.config 读取站点物理路径
+func getSitePhysicalPathFromConfig(siteName string) (string, error) {
+	cfg, err := LoadAppHostConfig()
+	if err != nil {
+		return "", err
+	}
+	site, err := cfg.Site(siteName)
+	if err != nil {
+		return "", err
+	}
+	path := site.PhysicalPath()
+	if path == "" {
+		return "", fmt.Errorf("站点 %s 物理路径为空", siteName)
+	}
+	return expandIISPhysicalPath(path), nil
+}
+
+// SetBindingSSLFlags 修改站点 https 绑定的 sslFlags（通过 appcmd 写入）
+func SetBindingSSLFlags(siteName, host string, port int, flags int) error {
+	host = util.ToASCII(host)
+	if err := validateBindingParams(siteName, host, port); err != nil {
+		return err
+	}
+
+	info := iisconfig.FormatBindingInformation("*", port, host)
+	output, err := util.RunCmdCombined(getAppcmdPath(), "set", "site",
+		fmt.Sprintf("/site.name:%s", siteName),
+		fmt.Sprintf("/bindings.[protocol='https',bindingInformation='%s'].sslFlags:%d", info, flags))
+	if err != nil {
+		return fmt.Errorf("修改 sslFlags 失败: %v, 输出: %s", err, output)
+	}
+
+	inv.updateSite(siteName, func(site *SiteInfo) {
+		for i := range site.Bindings {
+			b := &site.Bindings[i]
+			if b.HasSSL && b.Port == port && strings.EqualFold(b.Host, host) {
+				b.SSLFlags = flags
+			}
+		}
+	})
+	return nil
+}
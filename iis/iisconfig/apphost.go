@@ -0,0 +1,576 @@
+package iisconfig
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"cert-deploy/util"
+)
+
+// SSL 标志位（binding 元素的 sslFlags 属性）
+const (
+	SSLFlagSNI              = 1  // 服务器名称指示
+	SSLFlagCentralCertStore = 2  // 集中式证书存储
+	SSLFlagDisableHTTP2     = 4  // 禁用 HTTP/2
+	SSLFlagDisableOCSP      = 8  // 禁用 OCSP 装订
+	SSLFlagDisableQUIC      = 16 // 禁用 QUIC
+	SSLFlagDisableTLS13     = 32 // 禁用 TLS 1.3
+	SSLFlagDisableLegacyTLS = 64 // 禁用旧版 TLS
+
+	validSSLFlags = 127
+)
+
+// ErrBindingExists 绑定已存在（protocol + bindingInformation 全局唯一）
+var ErrBindingExists = errors.New("绑定已存在")
+
+// ErrSharedConfig 启用了 IIS 共享配置，本机的 applicationHost.config 不是生效的配置
+var ErrSharedConfig = errors.New("IIS 已启用共享配置")
+
+// Binding 站点绑定
+type Binding struct {
+	Protocol           string
+	BindingInformation string // ip:port:host
+	IP                 string // "*" 表示全部未分配
+	Port               int
+	Host               string
+	SSLFlags           int
+}
+
+// VirtualDirectory 虚拟目录
+type VirtualDirectory struct {
+	Path         string
+	PhysicalPath string
+}
+
+// Application 应用程序
+type Application struct {
+	Path               string
+	ApplicationPool    string
+	VirtualDirectories []VirtualDirectory
+}
+
+// FTPSettings FTP 站点 SSL 设置
+type FTPSettings struct {
+	ServerCertHash       string
+	ServerCertStoreName  string
+	ControlChannelPolicy string
+	DataChannelPolicy    string
+}
+
+// Site 站点配置
+type Site struct {
+	ID              int64
+	Name            string
+	ServerAutoStart bool
+	Bindings        []Binding
+	Applications    []Application
+	FTP             *FTPSettings // 非 FTP 站点为 nil
+}
+
+// AppPool 应用程序池
+type AppPool struct {
+	Name                  string
+	ManagedRuntimeVersion string
+	ManagedPipelineMode   string
+	AutoStart             bool
+	StartMode             string
+	IdentityType          string
+}
+
+// PhysicalPath 返回站点根应用根虚拟目录的物理路径
+func (s *Site) PhysicalPath() string {
+	for _, app := range s.Applications {
+		if app.Path != "/" {
+			continue
+		}
+		for _, vdir := range app.VirtualDirectories {
+			if vdir.Path == "/" {
+				return vdir.PhysicalPath
+			}
+		}
+	}
+	return ""
+}
+
+// AppHostConfig applicationHost.config 文件
+type AppHostConfig struct {
+	Path    string
+	doc     *Document
+	modTime time.Time
+}
+
+// DefaultAppHostPath 获取 applicationHost.config 默认路径
+func DefaultAppHostPath() string {
+	windir := os.Getenv("windir")
+	if windir == "" {
+		windir = "C:\\Windows"
+	}
+	return filepath.Join(windir, "System32", "inetsrv", "config", "applicationHost.config")
+}
+
+// LoadAppHost 从文件加载 applicationHost.config
+func LoadAppHost(path string) (*AppHostConfig, error) {
+	info, err := os.Stat(path)
+	if err != nil {
+		return nil, fmt.Errorf("读取 IIS 配置失败: %w", err)
+	}
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("读取 IIS 配置失败: %w", err)
+	}
+	cfg, err := ParseAppHost(data)
+	if err != nil {
+		return nil, err
+	}
+	cfg.Path = path
+	cfg.modTime = info.ModTime()
+	return cfg, nil
+}
+
+// ParseAppHost 解析 applicationHost.config 内容
+func ParseAppHost(data []byte) (*AppHostConfig, error) {
+	doc, err := ParseDocument(data)
+	if err != nil {
+		return nil, err
+	}
+	if doc.Element().Name != "configuration" {
+		return nil, fmt.Errorf("无效的 IIS 配置: 根元素为 <%s>", doc.Element().Name)
+	}
+	return &AppHostConfig{doc: doc}, nil
+}
+
+// Bytes 序列化配置内容
+func (c *AppHostConfig) Bytes() []byte {
+	return c.doc.Bytes()
+}
+
+func (c *AppHostConfig) sitesNode() *Node {
+	return c.doc.Element().Find("system.applicationHost/sites")
+}
+
+func (c *AppHostConfig) siteNode(name string) *Node {
+	sites := c.sitesNode()
+	if sites == nil {
+		return nil
+	}
+	for _, s := range sites.Elements("site") {
+		if strings.EqualFold(s.AttrOr("name", ""), name) {
+			return s
+		}
+	}
+	return nil
+}
+
+// Sites 列出所有站点
+func (c *AppHostConfig) Sites() []Site {
+	result := make([]Site, 0)
+	sites := c.sitesNode()
+	if sites == nil {
+		return result
+	}
+
+	defaultPool := "DefaultAppPool"
+	if defaults := sites.Child("applicationDefaults"); defaults != nil {
+		defaultPool = defaults.AttrOr("applicationPool", defaultPool)
+	}
+
+	for _, s := range sites.Elements("site") {
+		id, _ := strconv.ParseInt(s.AttrOr("id", "0"), 10, 64)
+		site := Site{
+			ID:              id,
+			Name:            s.AttrOr("name", ""),
+			ServerAutoStart: !strings.EqualFold(s.AttrOr("serverAutoStart", "true"), "false"),
+			Bindings:        make([]Binding, 0),
+			Applications:    make([]Application, 0),
+		}
+
+		if bindings := s.Child("bindings"); bindings != nil {
+			for _, b := range bindings.Elements("binding") {
+				site.Bindings = append(site.Bindings, bindingFromNode(b))
+			}
+		}
+
+		sitePool := defaultPool
+		if defaults := s.Child("applicationDefaults"); defaults != nil {
+			sitePool = defaults.AttrOr("applicationPool", sitePool)
+		}
+		for _, a := range s.Elements("application") {
+			app := Application{
+				Path:               a.AttrOr("path", "/"),
+				ApplicationPool:    a.AttrOr("applicationPool", sitePool),
+				VirtualDirectories: make([]VirtualDirectory, 0),
+			}
+			for _, v := range a.Elements("virtualDirectory") {
+				app.VirtualDirectories = append(app.VirtualDirectories, VirtualDirectory{
+					Path:         v.AttrOr("path", "/"),
+					PhysicalPath: v.AttrOr("physicalPath", ""),
+				})
+			}
+			site.Applications = append(site.Applications, app)
+		}
+
+		if ssl := s.Find("ftpServer/security/ssl"); ssl != nil {
+			site.FTP = &FTPSettings{
+				ServerCertHash:       ssl.AttrOr("serverCertHash", ""),
+				ServerCertStoreName:  ssl.AttrOr("serverCertStoreName", "MY"),
+				ControlChannelPolicy: ssl.AttrOr("controlChannelPolicy", "SslRequire"),
+				DataChannelPolicy:    ssl.AttrOr("dataChannelPolicy", "SslRequire"),
+			}
+		} else if s.Child("ftpServer") != nil || siteHasProtocol(site, "ftp") {
+			site.FTP = &FTPSettings{ServerCertStoreName: "MY", ControlChannelPolicy: "SslRequire", DataChannelPolicy: "SslRequire"}
+		}
+
+		result = append(result, site)
+	}
+	return result
+}
+
+// Site 按名称获取站点
+func (c *AppHostConfig) Site(name string) (*Site, error) {
+	for _, s := range c.Sites() {
+		if strings.EqualFold(s.Name, name) {
+			return &s, nil
+		}
+	}
+	return nil, fmt.Errorf("站点不存在: %s", name)
+}
+
+// AppPools 列出所有应用程序池
+func (c *AppHostConfig) AppPools() []AppPool {
+	result := make([]AppPool, 0)
+	pools := c.doc.Element().Find("system.applicationHost/applicationPools")
+	if pools == nil {
+		return result
+	}
+
+	defaults := AppPool{ManagedRuntimeVersion: "v4.0", ManagedPipelineMode: "Integrated", AutoStart: true, StartMode: "OnDemand", IdentityType: "ApplicationPoolIdentity"}
+	if d := pools.Child("applicationPoolDefaults"); d != nil {
+		defaults = appPoolFromNode(d, defaults)
+	}
+
+	for _, p := range pools.Elements("add") {
+		pool := appPoolFromNode(p, defaults)
+		pool.Name = p.AttrOr("name", "")
+		result = append(result, pool)
+	}
+	return result
+}
+
+func appPoolFromNode(n *Node, defaults AppPool) AppPool {
+	pool := defaults
+	pool.ManagedRuntimeVersion = n.AttrOr("managedRuntimeVersion", pool.ManagedRuntimeVersion)
+	pool.ManagedPipelineMode = n.AttrOr("managedPipelineMode", pool.ManagedPipelineMode)
+	pool.StartMode = n.AttrOr("startMode", pool.StartMode)
+	if v, ok := n.Attr("autoStart"); ok {
+		pool.AutoStart = !strings.EqualFold(v, "false")
+	}
+	if pm := n.Child("processModel"); pm != nil {
+		pool.IdentityType = pm.AttrOr("identityType", pool.IdentityType)
+	}
+	return pool
+}
+
+func siteHasProtocol(site Site, protocol string) bool {
+	for _, b := range site.Bindings {
+		if strings.EqualFold(b.Protocol, protocol) {
+			return true
+		}
+	}
+	return false
+}
+
+func bindingFromNode(n *Node) Binding {
+	b := Binding{
+		Protocol:           n.AttrOr("protocol", ""),
+		BindingInformation: n.AttrOr("bindingInformation", ""),
+	}
+	b.SSLFlags, _ = strconv.Atoi(n.AttrOr("sslFlags", "0"))
+	if ip, port, host, err := ParseBindingInformation(b.BindingInformation); err == nil {
+		b.IP, b.Port, b.Host = ip, port, host
+	}
+	return b
+}
+
+// ParseBindingInformation 解析 bindingInformation（ip:port:host，IPv6 形如 [::1]:443:host）
+func ParseBindingInformation(info string) (ip string, port int, host string, err error) {
+	rest := info
+	if strings.HasPrefix(rest, "[") {
+		end := strings.Index(rest, "]")
+		if end < 0 {
+			return "", 0, "", fmt.Errorf("无效的绑定信息: %s", info)
+		}
+		ip = rest[:end+1]
+		rest = strings.TrimPrefix(rest[end+1:], ":")
+	} else {
+		idx := strings.Index(rest, ":")
+		if idx < 0 {
+			return "", 0, "", fmt.Errorf("无效的绑定信息: %s", info)
+		}
+		ip = rest[:idx]
+		rest = rest[idx+1:]
+	}
+
+	parts := strings.SplitN(rest, ":", 2)
+	port, err = strconv.Atoi(parts[0])
+	if err != nil || port < 1 || port > 65535 {
+		return "", 0, "", fmt.Errorf("无效的绑定端口: %s", info)
+	}
+	if len(parts) > 1 {
+		host = parts[1]
+	}
+	if ip == "" {
+		ip = "*"
+	}
+	return ip, port, host, nil
+}
+
+// FormatBindingInformation 生成 bindingInformation
+func FormatBindingInformation(ip string, port int, host string) string {
+	if ip == "" || ip == "0.0.0.0" {
+		ip = "*"
+	}
+	if strings.Contains(ip, ":") && !strings.HasPrefix(ip, "[") {
+		ip = "[" + ip + "]"
+	}
+	return fmt.Sprintf("%s:%d:%s", ip, port, host)
+}
+
+// validateBinding 按 IIS 配置架构校验绑定
+func validateBinding(b Binding) error {
+	if b.Protocol == "" {
+		return fmt.Errorf("绑定协议不能为空")
+	}
+	if strings.EqualFold(b.Protocol, "http") || strings.EqualFold(b.Protocol, "https") || strings.EqualFold(b.Protocol, "ftp") {
+		if _, _, _, err := ParseBindingInformation(b.BindingInformation); err != nil {
+			return err
+		}
+	}
+	if b.SSLFlags < 0 || b.SSLFlags&^validSSLFlags != 0 {
+		return fmt.Errorf("无效的 sslFlags: %d", b.SSLFlags)
+	}
+	if b.SSLFlags != 0 && !strings.EqualFold(b.Protocol, "https") {
+		return fmt.Errorf("只有 https 绑定可以设置 sslFlags")
+	}
+	if b.SSLFlags&SSLFlagSNI != 0 {
+		_, _, host, _ := ParseBindingInformation(b.BindingInformation)
+		if host == "" {
+			return fmt.Errorf("启用 SNI 的绑定必须指定主机名")
+		}
+	}
+	return nil
+}
+
+// findBindingNode 在所有站点中查找绑定（IIS 要求 protocol + bindingInformation 全局唯一）
+func (c *AppHostConfig) findBindingNode(protocol, bindingInformation string) (site *Node, binding *Node) {
+	sites := c.sitesNode()
+	if sites == nil {
+		return nil, nil
+	}
+	for _, s := range sites.Elements("site") {
+		bindings := s.Child("bindings")
+		if bindings == nil {
+			continue
+		}
+		for _, b := range bindings.Elements("binding") {
+			if strings.EqualFold(b.AttrOr("protocol", ""), protocol) &&
+				strings.EqualFold(b.AttrOr("bindingInformation", ""), bindingInformation) {
+				return s, b
+			}
+		}
+	}
+	return nil, nil
+}
+
+// AddBinding 为站点添加绑定
+func (c *AppHostConfig) AddBinding(siteName string, b Binding) error {
+	if b.BindingInformation == "" {
+		b.BindingInformation = FormatBindingInformation(b.IP, b.Port, b.Host)
+	}
+	if err := validateBinding(b); err != nil {
+		return err
+	}
+
+	site := c.siteNode(siteName)
+	if site == nil {
+		return fmt.Errorf("站点不存在: %s", siteName)
+	}
+	if owner, _ := c.findBindingNode(b.Protocol, b.BindingInformation); owner != nil {
+		return fmt.Errorf("%w: %s/%s（站点 %s）", ErrBindingExists, b.Protocol, b.BindingInformation, owner.AttrOr("name", ""))
+	}
+
+	node := NewElement("binding", "protocol", strings.ToLower(b.Protocol), "bindingInformation", b.BindingInformation)
+	if b.SSLFlags != 0 {
+		node.SetAttr("sslFlags", strconv.Itoa(b.SSLFlags))
+	}
+
+	bindings := site.Child("bindings")
+	if bindings == nil {
+		bindings = NewElement("bindings")
+		site.AppendElement(bindings)
+	}
+	bindings.AppendElement(node)
+	return nil
+}
+
+// RemoveBinding 删除站点绑定
+func (c *AppHostConfig) RemoveBinding(siteName, protocol, bindingInformation string) error {
+	owner, node := c.findBindingNode(protocol, bindingInformation)
+	if node == nil || !strings.EqualFold(owner.AttrOr("name", ""), siteName) {
+		return fmt.Errorf("站点 %s 不存在绑定 %s/%s", siteName, protocol, bindingInformation)
+	}
+	node.Parent.RemoveElement(node)
+	return nil
+}
+
+// SetBindingSSLFlags 修改 https 绑定的 sslFlags
+func (c *AppHostConfig) SetBindingSSLFlags(siteName, bindingInformation string, flags int) error {
+	owner, node := c.findBindingNode("https", bindingInformation)
+	if node == nil || !strings.EqualFold(owner.AttrOr("name", ""), siteName) {
+		return fmt.Errorf("站点 %s 不存在 https 绑定 %s", siteName, bindingInformation)
+	}
+	if err := validateBinding(Binding{Protocol: "https", BindingInformation: bindingInformation, SSLFlags: flags}); err != nil {
+		return err
+	}
+	if flags == 0 {
+		node.RemoveAttr("sslFlags")
+	} else {
+		node.SetAttr("sslFlags", strconv.Itoa(flags))
+	}
+	return nil
+}
+
+// HasGlobalModule 检查是否注册了全局模块（如 URL Rewrite 的 RewriteModule）
+func (c *AppHostConfig) HasGlobalModule(name string) bool {
+	modules := c.doc.Element().Find("system.webServer/globalModules")
+	if modules == nil {
+		return false
+	}
+	for _, m := range modules.Elements("add") {
+		if strings.EqualFold(m.AttrOr("name", ""), name) {
+			return true
+		}
+	}
+	return false
+}
+
+// Save 写回配置文件
+// 写入前先备份原文件，并通过临时文件 + 重命名保证不会写出半个文件（保留原文件的所有者和权限）
+// 同目录的 redirection.config 启用共享配置时拒绝写入
+func (c *AppHostConfig) Save() error {
+	if c.Path == "" {
+		return fmt.Errorf("未指定配置文件路径")
+	}
+	if err := checkRedirection(c.Path); err != nil {
+		return err
+	}
+
+	// 加载后文件被其他程序（IIS 管理器、appcmd）修改过，拒绝覆盖
+	if info, err := os.Stat(c.Path); err == nil && !c.modTime.IsZero() && !info.ModTime().Equal(c.modTime) {
+		return fmt.Errorf("IIS 配置已被其他程序修改，请重新加载后再试")
+	}
+
+	backupPath, err := c.Backup()
+	if err != nil {
+		return err
+	}
+
+	if err := util.WriteFileAtomic(c.Path, c.Bytes(), 0644); err != nil {
+		return fmt.Errorf("写入 IIS 配置失败（备份: %s）: %w", backupPath, err)
+	}
+
+	if info, err := os.Stat(c.Path); err == nil {
+		c.modTime = info.ModTime()
+	}
+	return nil
+}
+
+// checkRedirection 检查 applicationHost.config 同目录的 redirection.config
+// configurationRedirection enabled="true" 时 IIS 从共享位置读取配置，修改本机文件不会生效
+func checkRedirection(appHostPath string) error {
+	path := filepath.Join(filepath.Dir(appHostPath), "redirection.config")
+	data, err := os.ReadFile(path)
+	if os.IsNotExist(err) {
+		return nil
+	}
+	if err != nil {
+		return fmt.Errorf("读取 %s 失败: %w", path, err)
+	}
+	doc, err := ParseDocument(data)
+	if err != nil {
+		return fmt.Errorf("解析 %s 失败: %w", path, err)
+	}
+	node := doc.Element().Child("configurationRedirection")
+	if node != nil && strings.EqualFold(node.AttrOr("enabled", "false"), "true") {
+		return fmt.Errorf("%w（%s），不修改本机配置文件，请在共享配置中修改", ErrSharedConfig, node.AttrOr("path", ""))
+	}
+	return nil
+}
+
+// Backup 备份当前配置文件，返回备份路径
+func (c *AppHostConfig) Backup() (string, error) {
+	data, err := os.ReadFile(c.Path)
+	if err != nil {
+		return "", fmt.Errorf("备份 IIS 配置失败: %w", err)
+	}
+	backupPath, err := writeBackup(c.Path, data, 0600)
+	if err != nil {
+		return "", fmt.Errorf("备份 IIS 配置失败: %w", err)
+	}
+	return backupPath, nil
+}
+
+// 每个文件保留的备份数（不含最早的一份）
+const maxBackups = 10
+
+// writeBackup 写入 path.certdeploy-时间.bak 备份，返回备份路径
+// 文件名精确到纳秒并以 O_EXCL 创建，同一时刻多次保存不会覆盖已有备份；
+// 超出 maxBackups 时删除较旧的备份，但保留最早的一份（修改前的原始文件）
+func writeBackup(path string, data []byte, perm os.FileMode) (string, error) {
+	stamp := time.Now().Format("20060102-150405.000000000")
+	var f *os.File
+	var backupPath string
+	for i := 0; ; i++ {
+		backupPath = fmt.Sprintf("%s.certdeploy-%s.bak", path, stamp)
+		if i > 0 {
+			backupPath = fmt.Sprintf("%s.certdeploy-%s-%d.bak", path, stamp, i)
+		}
+		var err error
+		f, err = os.OpenFile(backupPath, os.O_CREATE|os.O_EXCL|os.O_WRONLY, perm)
+		if err == nil {
+			break
+		}
+		if !os.IsExist(err) {
+			return "", err
+		}
+	}
+	if _, err := f.Write(data); err != nil {
+		f.Close()
+		os.Remove(backupPath)
+		return "", err
+	}
+	if err := f.Close(); err != nil {
+		os.Remove(backupPath)
+		return "", err
+	}
+
+	pruneBackups(path)
+	return backupPath, nil
+}
+
+// pruneBackups 删除多余的旧备份
+func pruneBackups(path string) {
+	backups, err := filepath.Glob(path + ".certdeploy-*.bak")
+	if err != nil || len(backups) <= maxBackups+1 {
+		return
+	}
+	sort.Strings(backups)
+	for _, b := range backups[1 : len(backups)-maxBackups] {
+		os.Remove(b)
+	}
+}
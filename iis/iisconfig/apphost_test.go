@@ -0,0 +1,376 @@
+package iisconfig
+
+import (
+	"bytes"
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func loadFixture(t *testing.T) []byte {
+	t.Helper()
+	data, err := os.ReadFile(filepath.Join("testdata", "applicationHost.config"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	return data
+}
+
+func parseFixture(t *testing.T) *AppHostConfig {
+	t.Helper()
+	cfg, err := ParseAppHost(loadFixture(t))
+	if err != nil {
+		t.Fatal(err)
+	}
+	return cfg
+}
+
+// copyFixture 复制到临时目录并加载，用于测试保存
+func copyFixture(t *testing.T) *AppHostConfig {
+	t.Helper()
+	path := filepath.Join(t.TempDir(), "applicationHost.config")
+	if err := os.WriteFile(path, loadFixture(t), 0600); err != nil {
+		t.Fatal(err)
+	}
+	cfg, err := LoadAppHost(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return cfg
+}
+
+func TestParseAppHostRoundTrip(t *testing.T) {
+	data := loadFixture(t)
+	cfg := parseFixture(t)
+	if !bytes.Equal(cfg.Bytes(), data) {
+		t.Fatalf("未修改时序列化结果与原文件不同:\n%s", cfg.Bytes())
+	}
+
+	if _, err := ParseAppHost([]byte(`<root />`)); err == nil {
+		t.Error("根元素不是 configuration 时应返回错误")
+	}
+}
+
+func TestSites(t *testing.T) {
+	sites := parseFixture(t).Sites()
+	if len(sites) != 3 {
+		t.Fatalf("站点数 = %d，期望 3", len(sites))
+	}
+
+	def := sites[0]
+	if def.ID != 1 || def.Name != "Default Web Site" || !def.ServerAutoStart {
+		t.Errorf("Default Web Site = %+v", def)
+	}
+	if got := def.PhysicalPath(); got != `%SystemDrive%\inetpub\wwwroot` {
+		t.Errorf("PhysicalPath = %q", got)
+	}
+	if got := def.Applications[0].ApplicationPool; got != "DefaultAppPool" {
+		t.Errorf("默认应用程序池 = %q", got)
+	}
+	if def.FTP != nil {
+		t.Error("非 FTP 站点的 FTP 应为 nil")
+	}
+
+	shop := sites[1]
+	if shop.ServerAutoStart {
+		t.Error("shop 的 serverAutoStart 为 false")
+	}
+	if len(shop.Applications) != 2 {
+		t.Fatalf("shop 应用程序数 = %d，期望 2", len(shop.Applications))
+	}
+	if app := shop.Applications[0]; app.ApplicationPool != "ShopPool" || app.VirtualDirectories[0].PhysicalPath != `D:\sites\shop` {
+		t.Errorf("shop / = %+v", app)
+	}
+	if app := shop.Applications[1]; app.Path != "/api" || app.ApplicationPool != "DefaultAppPool" {
+		t.Errorf("shop /api = %+v（未指定时使用 applicationDefaults 的应用程序池）", app)
+	}
+
+	wantBindings := []Binding{
+		{Protocol: "http", BindingInformation: "*:80:shop.example.com", IP: "*", Port: 80, Host: "shop.example.com"},
+		{Protocol: "https", BindingInformation: "*:443:shop.example.com", IP: "*", Port: 443, Host: "shop.example.com", SSLFlags: SSLFlagSNI},
+		{Protocol: "https", BindingInformation: "192.168.1.10:8443:", IP: "192.168.1.10", Port: 8443},
+	}
+	if len(shop.Bindings) != len(wantBindings) {
+		t.Fatalf("shop 绑定数 = %d，期望 %d", len(shop.Bindings), len(wantBindings))
+	}
+	for i, want := range wantBindings {
+		if shop.Bindings[i] != want {
+			t.Errorf("绑定 %d = %+v，期望 %+v", i, shop.Bindings[i], want)
+		}
+	}
+
+	files := sites[2]
+	want := FTPSettings{
+		ServerCertHash:       "0123456789ABCDEF0123456789ABCDEF01234567",
+		ServerCertStoreName:  "MY",
+		ControlChannelPolicy: "SslAllow",
+		DataChannelPolicy:    "SslRequire",
+	}
+	if files.FTP == nil || *files.FTP != want {
+		t.Errorf("FTP = %+v，期望 %+v", files.FTP, want)
+	}
+
+	if _, err := parseFixture(t).Site("SHOP"); err != nil {
+		t.Errorf("按名称查找站点应不区分大小写: %v", err)
+	}
+}
+
+func TestAppPools(t *testing.T) {
+	pools := parseFixture(t).AppPools()
+	want := []AppPool{
+		{Name: "DefaultAppPool", ManagedRuntimeVersion: "v4.0", ManagedPipelineMode: "Integrated", AutoStart: true, StartMode: "OnDemand", IdentityType: "ApplicationPoolIdentity"},
+		{Name: "ShopPool", ManagedRuntimeVersion: "", ManagedPipelineMode: "Integrated", AutoStart: false, StartMode: "OnDemand", IdentityType: "NetworkService"},
+	}
+	if len(pools) != len(want) {
+		t.Fatalf("应用程序池数 = %d，期望 %d", len(pools), len(want))
+	}
+	for i := range want {
+		if pools[i] != want[i] {
+			t.Errorf("应用程序池 %d = %+v，期望 %+v", i, pools[i], want[i])
+		}
+	}
+}
+
+func TestAddRemoveBinding(t *testing.T) {
+	original := loadFixture(t)
+	cfg := parseFixture(t)
+
+	b := Binding{Protocol: "https", IP: "*", Port: 443, Host: "www.shop.example.com", SSLFlags: SSLFlagSNI}
+	if err := cfg.AddBinding("shop", b); err != nil {
+		t.Fatal(err)
+	}
+	out := string(cfg.Bytes())
+	line := "\n                    <binding protocol=\"https\" bindingInformation=\"*:443:www.shop.example.com\" sslFlags=\"1\" />\n                </bindings>"
+	if !strings.Contains(out, line) {
+		t.Errorf("新绑定未按兄弟节点缩进写在最后:\n%s", out)
+	}
+	site, _ := cfg.Site("shop")
+	if got := site.Bindings[len(site.Bindings)-1]; got.Host != "www.shop.example.com" || got.SSLFlags != SSLFlagSNI {
+		t.Errorf("新绑定 = %+v", got)
+	}
+
+	// protocol + bindingInformation 全局唯一，其他站点已有的绑定也不能添加
+	if err := cfg.AddBinding("shop", Binding{Protocol: "http", IP: "*", Port: 80}); !errors.Is(err, ErrBindingExists) {
+		t.Errorf("重复绑定应返回 ErrBindingExists，实际 %v", err)
+	}
+	if err := cfg.AddBinding("shop", Binding{Protocol: "https", IP: "*", Port: 443, SSLFlags: SSLFlagSNI}); err == nil {
+		t.Error("启用 SNI 但没有主机名应返回错误")
+	}
+	if err := cfg.AddBinding("missing", Binding{Protocol: "https", IP: "*", Port: 443, Host: "a.example.com"}); err == nil {
+		t.Error("站点不存在应返回错误")
+	}
+
+	if err := cfg.RemoveBinding("shop", "https", "*:443:www.shop.example.com"); err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(cfg.Bytes(), original) {
+		t.Errorf("添加后删除应恢复原内容:\n%s", cfg.Bytes())
+	}
+
+	// 绑定属于其他站点时不删除
+	if err := cfg.RemoveBinding("shop", "http", "*:80:"); err == nil {
+		t.Error("删除其他站点的绑定应返回错误")
+	}
+
+	// 删除最后一个绑定时写回为自闭合标签
+	if err := cfg.RemoveBinding("Default Web Site", "http", "*:80:"); err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(string(cfg.Bytes()), "<bindings />") {
+		t.Error("没有绑定时应写回 <bindings />")
+	}
+}
+
+func TestSetBindingSSLFlags(t *testing.T) {
+	original := loadFixture(t)
+	cfg := parseFixture(t)
+
+	if err := cfg.SetBindingSSLFlags("shop", "*:443:shop.example.com", 0); err != nil {
+		t.Fatal(err)
+	}
+	if strings.Contains(string(cfg.Bytes()), `"*:443:shop.example.com" sslFlags`) {
+		t.Error("sslFlags 为 0 时应删除属性")
+	}
+	if err := cfg.SetBindingSSLFlags("shop", "*:443:shop.example.com", SSLFlagSNI); err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(cfg.Bytes(), original) {
+		t.Errorf("恢复 sslFlags 后应与原内容相同:\n%s", cfg.Bytes())
+	}
+
+	if err := cfg.SetBindingSSLFlags("shop", "*:443:shop.example.com", SSLFlagSNI|SSLFlagDisableHTTP2); err != nil {
+		t.Fatal(err)
+	}
+	site, _ := cfg.Site("shop")
+	if got := site.Bindings[1].SSLFlags; got != 5 {
+		t.Errorf("sslFlags = %d，期望 5", got)
+	}
+
+	if err := cfg.SetBindingSSLFlags("shop", "*:443:shop.example.com", 128); err == nil {
+		t.Error("无效的 sslFlags 应返回错误")
+	}
+	if err := cfg.SetBindingSSLFlags("shop", "192.168.1.10:8443:", SSLFlagSNI); err == nil {
+		t.Error("没有主机名的绑定不能启用 SNI")
+	}
+	if err := cfg.SetBindingSSLFlags("Default Web Site", "*:443:shop.example.com", 0); err == nil {
+		t.Error("绑定不属于该站点时应返回错误")
+	}
+}
+
+func TestSave(t *testing.T) {
+	original := loadFixture(t)
+	cfg := copyFixture(t)
+
+	if err := cfg.SetBindingSSLFlags("shop", "*:443:shop.example.com", 0); err != nil {
+		t.Fatal(err)
+	}
+	if err := cfg.Save(); err != nil {
+		t.Fatal(err)
+	}
+	// 同一秒内再次保存，备份不能覆盖上一份
+	if err := cfg.AddBinding("shop", Binding{Protocol: "https", IP: "*", Port: 443, Host: "www.shop.example.com", SSLFlags: SSLFlagSNI}); err != nil {
+		t.Fatal(err)
+	}
+	if err := cfg.Save(); err != nil {
+		t.Fatal(err)
+	}
+
+	reloaded, err := LoadAppHost(cfg.Path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(reloaded.Bytes(), cfg.Bytes()) {
+		t.Error("重新加载的内容与保存的不同")
+	}
+	site, _ := reloaded.Site("shop")
+	if len(site.Bindings) != 4 || site.Bindings[1].SSLFlags != 0 {
+		t.Errorf("保存后的绑定 = %+v", site.Bindings)
+	}
+
+	backups, _ := filepath.Glob(cfg.Path + ".certdeploy-*.bak")
+	if len(backups) != 2 {
+		t.Fatalf("备份数 = %d，期望 2: %v", len(backups), backups)
+	}
+	first, _ := os.ReadFile(backups[0])
+	if !bytes.Equal(first, original) {
+		t.Error("第一份备份应为修改前的原文件")
+	}
+
+	matches, _ := filepath.Glob(filepath.Join(filepath.Dir(cfg.Path), "*.tmp-*"))
+	if len(matches) != 0 {
+		t.Errorf("保存后残留临时文件: %v", matches)
+	}
+}
+
+func TestSaveRejectsExternalChange(t *testing.T) {
+	cfg := copyFixture(t)
+
+	// 模拟 IIS 管理器在加载后修改了文件
+	later := time.Now().Add(time.Minute)
+	if err := os.Chtimes(cfg.Path, later, later); err != nil {
+		t.Fatal(err)
+	}
+	if err := cfg.Save(); err == nil {
+		t.Error("文件被其他程序修改后应拒绝覆盖")
+	}
+}
+
+func TestSaveSharedConfig(t *testing.T) {
+	tests := []struct {
+		name        string
+		redirection string // 为空表示没有 redirection.config
+		wantErr     bool
+	}{
+		{name: "没有 redirection.config"},
+		{name: "未启用共享配置", redirection: `<configuration><configurationRedirection /></configuration>`},
+		{name: "已关闭共享配置", redirection: `<configuration><configurationRedirection enabled="false" path="\\fs01\iis" /></configuration>`},
+		{name: "已启用共享配置", redirection: `<configuration><configurationRedirection enabled="true" path="\\fs01\iis" /></configuration>`, wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cfg := copyFixture(t)
+			if tt.redirection != "" {
+				path := filepath.Join(filepath.Dir(cfg.Path), "redirection.config")
+				if err := os.WriteFile(path, []byte(tt.redirection), 0600); err != nil {
+					t.Fatal(err)
+				}
+			}
+			if err := cfg.SetBindingSSLFlags("shop", "*:443:shop.example.com", 0); err != nil {
+				t.Fatal(err)
+			}
+
+			err := cfg.Save()
+			if !tt.wantErr {
+				if err != nil {
+					t.Fatal(err)
+				}
+				return
+			}
+			if !errors.Is(err, ErrSharedConfig) || !strings.Contains(err.Error(), `\\fs01\iis`) {
+				t.Fatalf("期望 ErrSharedConfig，实际 %v", err)
+			}
+			data, _ := os.ReadFile(cfg.Path)
+			if !bytes.Equal(data, loadFixture(t)) {
+				t.Error("共享配置时不应修改本机配置文件")
+			}
+		})
+	}
+}
+
+func TestBackupPrune(t *testing.T) {
+	original := loadFixture(t)
+	cfg := copyFixture(t)
+
+	for i := 0; i < maxBackups+3; i++ {
+		if _, err := cfg.Backup(); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(cfg.Path, []byte("<configuration />"), 0600); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	backups, _ := filepath.Glob(cfg.Path + ".certdeploy-*.bak")
+	if len(backups) != maxBackups+1 {
+		t.Fatalf("备份数 = %d，期望 %d", len(backups), maxBackups+1)
+	}
+	first, _ := os.ReadFile(backups[0])
+	if !bytes.Equal(first, original) {
+		t.Error("清理旧备份时应保留最早的一份")
+	}
+}
+
+func TestBindingInformation(t *testing.T) {
+	tests := []struct {
+		info string
+		ip   string
+		port int
+		host string
+	}{
+		{"*:443:www.example.com", "*", 443, "www.example.com"},
+		{"192.168.1.10:8443:", "192.168.1.10", 8443, ""},
+		{":80:", "*", 80, ""},
+		{"[::1]:443:v6.example.com", "[::1]", 443, "v6.example.com"},
+	}
+	for _, tt := range tests {
+		ip, port, host, err := ParseBindingInformation(tt.info)
+		if err != nil || ip != tt.ip || port != tt.port || host != tt.host {
+			t.Errorf("ParseBindingInformation(%q) = %q, %d, %q, %v", tt.info, ip, port, host, err)
+		}
+	}
+	for _, bad := range []string{"", "*", "*:0:", "*:70000:", "[::1:443:"} {
+		if _, _, _, err := ParseBindingInformation(bad); err == nil {
+			t.Errorf("ParseBindingInformation(%q) 应返回错误", bad)
+		}
+	}
+
+	if got := FormatBindingInformation("0.0.0.0", 443, "a.example.com"); got != "*:443:a.example.com" {
+		t.Errorf("FormatBindingInformation = %q", got)
+	}
+	if got := FormatBindingInformation("::1", 443, ""); got != "[::1]:443:" {
+		t.Errorf("FormatBindingInformation IPv6 = %q", got)
+	}
+}
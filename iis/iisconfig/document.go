@@ -0,0 +1,376 @@
+package iisconfig
+
+import (
+	"bytes"
+	"encoding/xml"
+	"fmt"
+	"io"
+	"strings"
+)
+
+// NodeKind XML 节点类型
+type NodeKind int
+
+const (
+	NodeDocument NodeKind = iota
+	NodeElement
+	NodeText
+	NodeComment
+	NodeProcInst
+	NodeDirective
+)
+
+// Node XML 节点
+// 与 encoding/xml 的结构体映射不同，Node 保留注释、空白和属性顺序，
+// 修改后写回时不会打乱 IIS 配置文件中与本工具无关的部分
+type Node struct {
+	Kind     NodeKind
+	Name     string     // 元素名（含前缀）或处理指令目标
+	Attrs    []xml.Attr // 元素属性（保持原始顺序）
+	Text     string     // 文本、注释、处理指令或 DTD 内容
+	Children []*Node
+	Parent   *Node
+}
+
+// Document XML 文档
+type Document struct {
+	Root *Node // NodeDocument 类型的根节点
+	bom  bool  // 原文件是否带 UTF-8 BOM
+}
+
+var utf8BOM = []byte{0xEF, 0xBB, 0xBF}
+
+// ParseDocument 解析 XML 文档
+func ParseDocument(data []byte) (*Document, error) {
+	doc := &Document{Root: &Node{Kind: NodeDocument}}
+	if bytes.HasPrefix(data, utf8BOM) {
+		doc.bom = true
+		data = data[len(utf8BOM):]
+	}
+
+	decoder := xml.NewDecoder(bytes.NewReader(data))
+	current := doc.Root
+	for {
+		tok, err := decoder.RawToken()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, fmt.Errorf("解析 XML 失败: %w", err)
+		}
+
+		switch t := tok.(type) {
+		case xml.StartElement:
+			node := &Node{Kind: NodeElement, Name: qualifiedName(t.Name), Attrs: copyAttrs(t.Attr)}
+			current.appendNode(node)
+			current = node
+		case xml.EndElement:
+			if current.Kind != NodeElement || current.Name != qualifiedName(t.Name) {
+				return nil, fmt.Errorf("解析 XML 失败: 未匹配的结束标签 </%s>", qualifiedName(t.Name))
+			}
+			current = current.Parent
+		case xml.CharData:
+			current.appendNode(&Node{Kind: NodeText, Text: string(t)})
+		case xml.Comment:
+			current.appendNode(&Node{Kind: NodeComment, Text: string(t)})
+		case xml.ProcInst:
+			current.appendNode(&Node{Kind: NodeProcInst, Name: t.Target, Text: string(t.Inst)})
+		case xml.Directive:
+			current.appendNode(&Node{Kind: NodeDirective, Text: string(t)})
+		}
+	}
+
+	if current != doc.Root {
+		return nil, fmt.Errorf("解析 XML 失败: 元素 <%s> 未闭合", current.Name)
+	}
+	if doc.Element() == nil {
+		return nil, fmt.Errorf("解析 XML 失败: 缺少根元素")
+	}
+	return doc, nil
+}
+
+// Element 返回文档根元素
+func (d *Document) Element() *Node {
+	for _, c := range d.Root.Children {
+		if c.Kind == NodeElement {
+			return c
+		}
+	}
+	return nil
+}
+
+// Bytes 序列化文档
+func (d *Document) Bytes() []byte {
+	var buf bytes.Buffer
+	if d.bom {
+		buf.Write(utf8BOM)
+	}
+	for _, c := range d.Root.Children {
+		writeNode(&buf, c)
+	}
+	return buf.Bytes()
+}
+
+func writeNode(buf *bytes.Buffer, n *Node) {
+	switch n.Kind {
+	case NodeElement:
+		buf.WriteByte('<')
+		buf.WriteString(n.Name)
+		for _, a := range n.Attrs {
+			buf.WriteByte(' ')
+			buf.WriteString(qualifiedName(a.Name))
+			buf.WriteString(`="`)
+			buf.WriteString(escapeAttr(a.Value))
+			buf.WriteByte('"')
+		}
+		if len(n.Children) == 0 {
+			// 与 IIS 写出的格式保持一致: <add name="x" />
+			buf.WriteString(" />")
+			return
+		}
+		buf.WriteByte('>')
+		for _, c := range n.Children {
+			writeNode(buf, c)
+		}
+		buf.WriteString("</")
+		buf.WriteString(n.Name)
+		buf.WriteByte('>')
+	case NodeText:
+		buf.WriteString(escapeText(n.Text))
+	case NodeComment:
+		buf.WriteString("<!--")
+		buf.WriteString(n.Text)
+		buf.WriteString("-->")
+	case NodeProcInst:
+		buf.WriteString("<?")
+		buf.WriteString(n.Name)
+		if n.Text != "" {
+			buf.WriteByte(' ')
+			buf.WriteString(n.Text)
+		}
+		buf.WriteString("?>")
+	case NodeDirective:
+		buf.WriteString("<!")
+		buf.WriteString(n.Text)
+		buf.WriteByte('>')
+	}
+}
+
+var (
+	attrEscaper = strings.NewReplacer("&", "&amp;", "<", "&lt;", ">", "&gt;", `"`, "&quot;", "\n", "&#xA;", "\r", "&#xD;", "\t", "&#x9;")
+	textEscaper = strings.NewReplacer("&", "&amp;", "<", "&lt;", ">", "&gt;")
+)
+
+func escapeAttr(s string) string { return attrEscaper.Replace(s) }
+func escapeText(s string) string { return textEscaper.Replace(s) }
+
+func qualifiedName(name xml.Name) string {
+	if name.Space != "" {
+		return name.Space + ":" + name.Local
+	}
+	return name.Local
+}
+
+func copyAttrs(attrs []xml.Attr) []xml.Attr {
+	result := make([]xml.Attr, len(attrs))
+	copy(result, attrs)
+	return result
+}
+
+// NewElement 创建元素节点
+// attrs 按 name, value 成对传入
+func NewElement(name string, attrs ...string) *Node {
+	node := &Node{Kind: NodeElement, Name: name}
+	for i := 0; i+1 < len(attrs); i += 2 {
+		node.SetAttr(attrs[i], attrs[i+1])
+	}
+	return node
+}
+
+func (n *Node) appendNode(child *Node) {
+	child.Parent = n
+	n.Children = append(n.Children, child)
+}
+
+// Attr 获取属性值
+func (n *Node) Attr(name string) (string, bool) {
+	for _, a := range n.Attrs {
+		if qualifiedName(a.Name) == name {
+			return a.Value, true
+		}
+	}
+	return "", false
+}
+
+// AttrOr 获取属性值，不存在时返回默认值
+func (n *Node) AttrOr(name, def string) string {
+	if v, ok := n.Attr(name); ok {
+		return v
+	}
+	return def
+}
+
+// SetAttr 设置属性值（已存在则原位修改，保持属性顺序）
+func (n *Node) SetAttr(name, value string) {
+	for i, a := range n.Attrs {
+		if qualifiedName(a.Name) == name {
+			n.Attrs[i].Value = value
+			return
+		}
+	}
+	n.Attrs = append(n.Attrs, xml.Attr{Name: xml.Name{Local: name}, Value: value})
+}
+
+// RemoveAttr 删除属性
+func (n *Node) RemoveAttr(name string) {
+	for i, a := range n.Attrs {
+		if qualifiedName(a.Name) == name {
+			n.Attrs = append(n.Attrs[:i], n.Attrs[i+1:]...)
+			return
+		}
+	}
+}
+
+// Elements 返回指定名称的直接子元素（name 为空时返回全部子元素）
+func (n *Node) Elements(name string) []*Node {
+	result := make([]*Node, 0)
+	for _, c := range n.Children {
+		if c.Kind == NodeElement && (name == "" || c.Name == name) {
+			result = append(result, c)
+		}
+	}
+	return result
+}
+
+// Child 返回第一个指定名称的子元素
+func (n *Node) Child(name string) *Node {
+	for _, c := range n.Children {
+		if c.Kind == NodeElement && c.Name == name {
+			return c
+		}
+	}
+	return nil
+}
+
+// Find 按路径查找子元素，如 "system.applicationHost/sites"
+func (n *Node) Find(path string) *Node {
+	current := n
+	for _, part := range strings.Split(path, "/") {
+		if current = current.Child(part); current == nil {
+			return nil
+		}
+	}
+	return current
+}
+
+// Ensure 按路径查找子元素，不存在的层级自动创建
+func (n *Node) Ensure(path string) *Node {
+	current := n
+	for _, part := range strings.Split(path, "/") {
+		child := current.Child(part)
+		if child == nil {
+			child = NewElement(part)
+			current.AppendElement(child)
+		}
+		current = child
+	}
+	return current
+}
+
+// indent 返回节点所在行的缩进
+func (n *Node) indent() string {
+	if n.Parent == nil {
+		return ""
+	}
+	for i, c := range n.Parent.Children {
+		if c != n {
+			continue
+		}
+		if i > 0 && n.Parent.Children[i-1].Kind == NodeText {
+			text := n.Parent.Children[i-1].Text
+			if idx := strings.LastIndex(text, "\n"); idx >= 0 {
+				return text[idx+1:]
+			}
+		}
+		break
+	}
+	return ""
+}
+
+// AppendElement 追加子元素，并按兄弟节点的缩进风格插入换行
+func (n *Node) AppendElement(child *Node) {
+	child.Parent = n
+
+	// 找到最后一个子元素，沿用其前面的空白
+	lastElem := -1
+	for i, c := range n.Children {
+		if c.Kind == NodeElement {
+			lastElem = i
+		}
+	}
+
+	if lastElem >= 0 {
+		indent := "\n" + n.Children[lastElem].indent()
+		tail := append([]*Node{}, n.Children[lastElem+1:]...)
+		n.Children = append(n.Children[:lastElem+1], &Node{Kind: NodeText, Text: indent, Parent: n}, child)
+		n.Children = append(n.Children, tail...)
+		return
+	}
+
+	parentIndent := n.indent()
+	n.Children = append(n.Children,
+		&Node{Kind: NodeText, Text: "\n" + parentIndent + "    ", Parent: n},
+		child,
+		&Node{Kind: NodeText, Text: "\n" + parentIndent, Parent: n},
+	)
+}
+
+// InsertElementAt 在第 index 个子元素之前插入元素（index 超出范围时追加到末尾）
+func (n *Node) InsertElementAt(index int, child *Node) {
+	elems := n.Elements("")
+	if index >= len(elems) {
+		n.AppendElement(child)
+		return
+	}
+	target := elems[index]
+	child.Parent = n
+	indent := "\n" + target.indent()
+	for i, c := range n.Children {
+		if c == target {
+			rest := append([]*Node{child, {Kind: NodeText, Text: indent, Parent: n}}, n.Children[i:]...)
+			n.Children = append(n.Children[:i], rest...)
+			return
+		}
+	}
+}
+
+// RemoveElement 删除子元素（连同其前面的空白）
+func (n *Node) RemoveElement(child *Node) bool {
+	for i, c := range n.Children {
+		if c != child {
+			continue
+		}
+		start := i
+		if i > 0 && n.Children[i-1].Kind == NodeText && strings.TrimSpace(n.Children[i-1].Text) == "" {
+			start = i - 1
+		}
+		n.Children = append(n.Children[:start], n.Children[i+1:]...)
+		child.Parent = nil
+
+		// 没有子元素时清掉剩余空白，写回为自闭合标签
+		if len(n.Elements("")) == 0 {
+			onlySpace := true
+			for _, c := range n.Children {
+				if c.Kind != NodeText || strings.TrimSpace(c.Text) != "" {
+					onlySpace = false
+					break
+				}
+			}
+			if onlySpace {
+				n.Children = nil
+			}
+		}
+		return true
+	}
+	return false
+}
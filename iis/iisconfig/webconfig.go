@@ -0,0 +1,292 @@
+package iisconfig
+
+import (
+	"bytes"
+	"fmt"
+	"os"
+	"regexp"
+	"strings"
+
+	"cert-deploy/util"
+)
+
+// 本工具写入的 web.config 元素前会加上此注释，撤销时只删除带标记的元素，
+// 不会误删用户手工配置的 httpRedirect / customHeaders
+const managedMarker = " managed by cert-deploy "
+
+// RedirectRulePrefix 本工具写入的 URL Rewrite 规则名前缀
+const RedirectRulePrefix = "CertDeploy HTTPS Redirect"
+
+// HSTSHeader HSTS 响应头名称
+const HSTSHeader = "Strict-Transport-Security"
+
+// ACMEChallengePath 文件验证目录，跳转时必须放行
+const ACMEChallengePath = ".well-known/acme-challenge"
+
+const emptyWebConfig = "<?xml version=\"1.0\" encoding=\"UTF-8\"?>\n<configuration></configuration>\n"
+
+// WebConfig 站点 web.config 文件
+type WebConfig struct {
+	Path     string
+	doc      *Document
+	exists   bool   // 文件加载时是否存在
+	original []byte // 加载时的内容，用于判断是否有修改
+}
+
+// LoadWebConfig 加载 web.config，文件不存在时返回空配置
+func LoadWebConfig(path string) (*WebConfig, error) {
+	data, err := os.ReadFile(path)
+	exists := true
+	if os.IsNotExist(err) {
+		data = []byte(emptyWebConfig)
+		exists = false
+	} else if err != nil {
+		return nil, fmt.Errorf("读取 web.config 失败: %w", err)
+	}
+
+	doc, err := ParseDocument(data)
+	if err != nil {
+		return nil, fmt.Errorf("web.config 格式错误: %w", err)
+	}
+	if doc.Element().Name != "configuration" {
+		return nil, fmt.Errorf("web.config 格式错误: 根元素为 <%s>", doc.Element().Name)
+	}
+
+	wc := &WebConfig{Path: path, doc: doc, exists: exists}
+	if exists {
+		wc.original = data
+	}
+	return wc, nil
+}
+
+// Bytes 序列化 web.config
+func (w *WebConfig) Bytes() []byte {
+	return w.doc.Bytes()
+}
+
+// Changed 是否有修改需要写回
+func (w *WebConfig) Changed() bool {
+	if !w.exists {
+		// 新文件只在确实写入了配置时才需要创建
+		return len(w.doc.Element().Elements("")) > 0
+	}
+	return !bytes.Equal(w.original, w.Bytes())
+}
+
+// Save 写回 web.config（无修改时不写文件）
+func (w *WebConfig) Save() error {
+	if !w.Changed() {
+		return nil
+	}
+	if w.exists {
+		if _, err := writeBackup(w.Path, w.original, 0644); err != nil {
+			return fmt.Errorf("备份 web.config 失败: %w", err)
+		}
+	}
+	if err := util.WriteFileAtomic(w.Path, w.Bytes(), 0644); err != nil {
+		return fmt.Errorf("写入 web.config 失败: %w", err)
+	}
+	w.original = w.Bytes()
+	w.exists = true
+	return nil
+}
+
+func (w *WebConfig) webServer() *Node {
+	return w.doc.Element().Ensure("system.webServer")
+}
+
+// isManaged 判断元素是否由本工具写入（前一个非空白节点为标记注释）
+func isManaged(n *Node) bool {
+	if n.Parent == nil {
+		return false
+	}
+	var prev *Node
+	for _, c := range n.Parent.Children {
+		if c == n {
+			break
+		}
+		if c.Kind == NodeText && strings.TrimSpace(c.Text) == "" {
+			continue
+		}
+		prev = c
+	}
+	return prev != nil && prev.Kind == NodeComment && prev.Text == managedMarker
+}
+
+// appendManaged 追加元素并在其前面加上标记注释
+func appendManaged(parent, child *Node) {
+	parent.AppendElement(child)
+	for i, c := range parent.Children {
+		if c == child {
+			marker := &Node{Kind: NodeComment, Text: managedMarker, Parent: parent}
+			ws := &Node{Kind: NodeText, Text: "\n" + child.indent(), Parent: parent}
+			rest := append([]*Node{marker, ws}, parent.Children[i:]...)
+			parent.Children = append(parent.Children[:i], rest...)
+			return
+		}
+	}
+}
+
+// removeManaged 删除元素及其标记注释
+func removeManaged(parent, child *Node) {
+	for i, c := range parent.Children {
+		if c != child {
+			continue
+		}
+		for j := i - 1; j >= 0; j-- {
+			prev := parent.Children[j]
+			if prev.Kind == NodeText && strings.TrimSpace(prev.Text) == "" {
+				continue
+			}
+			if prev.Kind == NodeComment && prev.Text == managedMarker {
+				parent.RemoveElement(prev)
+			}
+			break
+		}
+		break
+	}
+	parent.RemoveElement(child)
+}
+
+// pruneEmpty 自下而上删除本工具创建后变空的容器元素
+func pruneEmpty(n *Node, stop *Node) {
+	for n != nil && n != stop && n.Kind == NodeElement && len(n.Children) == 0 && len(n.Attrs) == 0 {
+		parent := n.Parent
+		parent.RemoveElement(n)
+		n = parent
+	}
+}
+
+// RedirectRuleName 返回指定域名的跳转规则名
+func RedirectRuleName(domain string) string {
+	return fmt.Sprintf("%s (%s)", RedirectRulePrefix, strings.ToLower(domain))
+}
+
+// hostPattern 将域名（支持 *.example.com）转为 SERVER_NAME 匹配正则
+func hostPattern(domain string) string {
+	domain = strings.ToLower(domain)
+	if strings.HasPrefix(domain, "*.") {
+		return `^[^.]+\.` + regexp.QuoteMeta(domain[2:]) + `$`
+	}
+	return `^` + regexp.QuoteMeta(domain) + `$`
+}
+
+// SetRewriteRedirect 添加或删除 URL Rewrite 跳转规则
+// 仅对指定域名的 HTTP 请求生效，放行 /.well-known/acme-challenge/ 以免影响文件验证
+func (w *WebConfig) SetRewriteRedirect(domain string, httpsPort int, enable bool) {
+	name := RedirectRuleName(domain)
+	rules := w.doc.Element().Find("system.webServer/rewrite/rules")
+	if rules != nil {
+		for _, r := range rules.Elements("rule") {
+			if r.AttrOr("name", "") == name {
+				rules.RemoveElement(r)
+			}
+		}
+	}
+
+	if !enable {
+		if rules != nil {
+			pruneEmpty(rules, w.doc.Element())
+		}
+		return
+	}
+
+	target := "https://{SERVER_NAME}/{R:1}"
+	if httpsPort != 0 && httpsPort != 443 {
+		target = fmt.Sprintf("https://{SERVER_NAME}:%d/{R:1}", httpsPort)
+	}
+
+	// 插入到最前面，保证先于站点已有的重写规则执行；<clear /> 之后的位置才有效
+	rules = w.webServer().Ensure("rewrite/rules")
+	index := 0
+	for i, e := range rules.Elements("") {
+		if e.Name == "clear" {
+			index = i + 1
+		}
+	}
+
+	// 先挂到文档上再添加子元素，子元素才能沿用正确的缩进
+	rule := NewElement("rule", "name", name, "stopProcessing", "true")
+	rules.InsertElementAt(index, rule)
+	rule.AppendElement(NewElement("match", "url", "(.*)"))
+	conditions := NewElement("conditions", "logicalGrouping", "MatchAll", "trackAllCaptures", "false")
+	rule.AppendElement(conditions)
+	conditions.AppendElement(NewElement("add", "input", "{HTTPS}", "pattern", "^OFF$"))
+	conditions.AppendElement(NewElement("add", "input", "{SERVER_NAME}", "pattern", hostPattern(domain)))
+	conditions.AppendElement(NewElement("add", "input", "{REQUEST_URI}", "pattern", `^/\.well-known/acme-challenge/`, "negate", "true"))
+	rule.AppendElement(NewElement("action", "type", "Redirect", "url", target, "redirectType", "Permanent"))
+}
+
+// SetHTTPRedirect 添加或删除 httpRedirect 跳转（未安装 URL Rewrite 时使用）
+// httpRedirect 对整个站点生效，只能用于不提供 HTTPS 的纯 HTTP 站点，否则会循环跳转
+func (w *WebConfig) SetHTTPRedirect(destination string, enable bool) error {
+	root := w.doc.Element()
+	ws := root.Child("system.webServer")
+	if ws != nil {
+		if n := ws.Child("httpRedirect"); n != nil {
+			if !isManaged(n) {
+				if enable {
+					return fmt.Errorf("web.config 已有其他 httpRedirect 配置")
+				}
+			} else {
+				removeManaged(ws, n)
+			}
+		}
+	}
+
+	// 验证目录的豁免配置
+	for _, loc := range root.Elements("location") {
+		if isManaged(loc) && strings.EqualFold(loc.AttrOr("path", ""), ACMEChallengePath) {
+			removeManaged(root, loc)
+		}
+	}
+
+	if !enable {
+		if ws != nil {
+			pruneEmpty(ws, root)
+		}
+		return nil
+	}
+
+	appendManaged(w.webServer(), NewElement("httpRedirect",
+		"enabled", "true",
+		"destination", strings.TrimRight(destination, "/")+"$S$Q",
+		"exactDestination", "true",
+		"httpResponseStatus", "Permanent",
+	))
+
+	loc := NewElement("location", "path", ACMEChallengePath)
+	appendManaged(root, loc)
+	loc.Ensure("system.webServer/httpRedirect").SetAttr("enabled", "false")
+	return nil
+}
+
+// SetHSTS 设置或删除 Strict-Transport-Security 响应头（value 为空时删除）
+// 先 remove 再 add，避免与上级配置继承的同名头冲突
+func (w *WebConfig) SetHSTS(value string) error {
+	headers := w.doc.Element().Find("system.webServer/httpProtocol/customHeaders")
+	if headers != nil {
+		for _, h := range headers.Elements("") {
+			if !strings.EqualFold(h.AttrOr("name", ""), HSTSHeader) {
+				continue
+			}
+			if isManaged(h) {
+				removeManaged(headers, h)
+			} else if value != "" {
+				return fmt.Errorf("web.config 已有其他 %s 配置", HSTSHeader)
+			}
+		}
+	}
+
+	if value == "" {
+		if headers != nil {
+			pruneEmpty(headers, w.doc.Element())
+		}
+		return nil
+	}
+
+	headers = w.webServer().Ensure("httpProtocol/customHeaders")
+	appendManaged(headers, NewElement("remove", "name", HSTSHeader))
+	appendManaged(headers, NewElement("add", "name", HSTSHeader, "value", value))
+	return nil
+}
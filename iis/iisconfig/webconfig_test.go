@@ -0,0 +1,85 @@
+package iisconfig
+
+import (
+	"bytes"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+const userWebConfig = `<?xml version="1.0" encoding="UTF-8"?>
+<configuration>
+    <system.webServer>
+        <defaultDocument>
+            <files>
+                <add value="index.html" />
+            </files>
+        </defaultDocument>
+    </system.webServer>
+</configuration>
+`
+
+func TestWebConfigSaveBackups(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "web.config")
+	if err := os.WriteFile(path, []byte(userWebConfig), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	// 同一秒内连续两次修改，用户的原始 web.config 备份不能被覆盖
+	for _, value := range []string{"max-age=300", "max-age=31536000"} {
+		w, err := LoadWebConfig(path)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if err := w.SetHSTS(value); err != nil {
+			t.Fatal(err)
+		}
+		if err := w.Save(); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	backups, _ := filepath.Glob(path + ".certdeploy-*.bak")
+	if len(backups) != 2 {
+		t.Fatalf("备份数 = %d，期望 2: %v", len(backups), backups)
+	}
+	first, _ := os.ReadFile(backups[0])
+	if string(first) != userWebConfig {
+		t.Errorf("第一份备份应为用户的原始 web.config:\n%s", first)
+	}
+}
+
+func TestWebConfigReversible(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "web.config")
+	if err := os.WriteFile(path, []byte(userWebConfig), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	w, err := LoadWebConfig(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	w.SetRewriteRedirect("www.example.com", 443, true)
+	if err := w.SetHSTS("max-age=31536000"); err != nil {
+		t.Fatal(err)
+	}
+	changed := w.Bytes()
+
+	// 重复应用没有变化
+	w.SetRewriteRedirect("www.example.com", 443, true)
+	if err := w.SetHSTS("max-age=31536000"); err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(w.Bytes(), changed) {
+		t.Errorf("重复应用应没有变化:\n%s", w.Bytes())
+	}
+
+	// 撤销后恢复原内容
+	w.SetRewriteRedirect("www.example.com", 443, false)
+	if err := w.SetHSTS(""); err != nil {
+		t.Fatal(err)
+	}
+	if string(w.Bytes()) != userWebConfig {
+		t.Errorf("撤销后应恢复原内容:\n%s", w.Bytes())
+	}
+}
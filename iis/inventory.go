@@ -0,0 +1,191 @@
+package iis
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"sync"
+
+	"cert-deploy/util"
+)
+
+// inventory SSL 绑定和站点的快照
+// 首次查询时执行一次 netsh/appcmd 加载，本程序修改绑定后原地更新，
+// 外部可能修改时（每次部署开始）调用 InvalidateInventory 丢弃
+type inventory struct {
+	mu             sync.Mutex
+	bindings       []SSLBinding
+	bindingsLoaded bool
+	sites          []SiteInfo
+	sitesLoaded    bool
+}
+
+var inv inventory
+
+// InvalidateInventory 丢弃 SSL 绑定和站点快照，下次查询重新加载
+func InvalidateInventory() {
+	inv.mu.Lock()
+	defer inv.mu.Unlock()
+	inv.bindings, inv.bindingsLoaded = nil, false
+	inv.sites, inv.sitesLoaded = nil, false
+}
+
+// CachedSSLBindings 从快照获取 SSL 绑定列表（返回副本）
+func CachedSSLBindings() ([]SSLBinding, error) {
+	inv.mu.Lock()
+	defer inv.mu.Unlock()
+	if !inv.bindingsLoaded {
+		bindings, err := listSSLBindings()
+		if err != nil {
+			return nil, err
+		}
+		inv.bindings, inv.bindingsLoaded = bindings, true
+	}
+	return append([]SSLBinding(nil), inv.bindings...), nil
+}
+
+// CachedSites 从快照获取站点列表（返回副本）
+func CachedSites() ([]SiteInfo, error) {
+	inv.mu.Lock()
+	defer inv.mu.Unlock()
+	if !inv.sitesLoaded {
+		sites, err := scanSites()
+		if err != nil {
+			return nil, err
+		}
+		inv.sites, inv.sitesLoaded = sites, true
+	}
+	return copySites(inv.sites), nil
+}
+
+// setBindings 用完整列表刷新绑定快照
+func (v *inventory) setBindings(bindings []SSLBinding) {
+	v.mu.Lock()
+	defer v.mu.Unlock()
+	v.bindings, v.bindingsLoaded = append([]SSLBinding(nil), bindings...), true
+}
+
+// putBinding 新增或替换一条绑定（快照未加载时忽略）
+func (v *inventory) putBinding(b SSLBinding) {
+	v.mu.Lock()
+	defer v.mu.Unlock()
+	if !v.bindingsLoaded {
+		return
+	}
+	for i := range v.bindings {
+		if strings.EqualFold(v.bindings[i].HostnamePort, b.HostnamePort) {
+			v.bindings[i] = b
+			return
+		}
+	}
+	v.bindings = append(v.bindings, b)
+}
+
+// removeBinding 删除一条绑定
+func (v *inventory) removeBinding(hostnamePort string) {
+	v.mu.Lock()
+	defer v.mu.Unlock()
+	for i := range v.bindings {
+		if strings.EqualFold(v.bindings[i].HostnamePort, hostnamePort) {
+			v.bindings = append(v.bindings[:i], v.bindings[i+1:]...)
+			return
+		}
+	}
+}
+
+// setSites 用完整列表刷新站点快照
+func (v *inventory) setSites(sites []SiteInfo) {
+	v.mu.Lock()
+	defer v.mu.Unlock()
+	v.sites, v.sitesLoaded = copySites(sites), true
+}
+
+// addSiteBinding 为站点追加绑定（已存在时忽略）
+func (v *inventory) addSiteBinding(siteName string, b BindingInfo) {
+	v.mu.Lock()
+	defer v.mu.Unlock()
+	for i := range v.sites {
+		if !strings.EqualFold(v.sites[i].Name, siteName) {
+			continue
+		}
+		for _, existing := range v.sites[i].Bindings {
+			if sameSiteBinding(existing, b) {
+				return
+			}
+		}
+		v.sites[i].Bindings = append(v.sites[i].Bindings, b)
+		return
+	}
+}
+
+// removeSiteBinding 删除站点绑定
+func (v *inventory) removeSiteBinding(siteName string, b BindingInfo) {
+	v.mu.Lock()
+	defer v.mu.Unlock()
+	for i := range v.sites {
+		if !strings.EqualFold(v.sites[i].Name, siteName) {
+			continue
+		}
+		bindings := v.sites[i].Bindings[:0]
+		for _, existing := range v.sites[i].Bindings {
+			if !sameSiteBinding(existing, b) {
+				bindings = append(bindings, existing)
+			}
+		}
+		v.sites[i].Bindings = bindings
+		return
+	}
+}
+
+// updateSite 修改站点快照（站点不存在时忽略）
+func (v *inventory) updateSite(siteName string, fn func(site *SiteInfo)) {
+	v.mu.Lock()
+	defer v.mu.Unlock()
+	for i := range v.sites {
+		if strings.EqualFold(v.sites[i].Name, siteName) {
+			fn(&v.sites[i])
+			return
+		}
+	}
+}
+
+func sameSiteBinding(a, b BindingInfo) bool {
+	return strings.EqualFold(a.Protocol, b.Protocol) && a.Port == b.Port &&
+		strings.EqualFold(a.Host, b.Host) && a.IP == b.IP
+}
+
+func copySites(sites []SiteInfo) []SiteInfo {
+	result := make([]SiteInfo, len(sites))
+	for i, s := range sites {
+		result[i] = s
+		result[i].Bindings = append([]BindingInfo(nil), s.Bindings...)
+	}
+	return result
+}
+
+// querySSLBinding 直接查询单条绑定（netsh http show sslcert hostnameport=/ipport=），不经过快照
+// 不存在或查询失败时返回 nil
+func querySSLBinding(ctx context.Context, kind, key string) *SSLBinding {
+	output, _ := util.RunCmdWithTimeout(ctx, netshTimeout, nil, "netsh", "http", "show", "sslcert", fmt.Sprintf("%s=%s", kind, key))
+	for _, b := range parseSSLBindings(output) {
+		if strings.EqualFold(b.HostnamePort, key) {
+			return &b
+		}
+	}
+	return nil
+}
+
+// QueryBindingForHost 实时查询主机的 SSL 绑定（不使用快照），并更新快照
+func QueryBindingForHost(hostname string, port int) *SSLBinding {
+	if port == 0 {
+		port = 443
+	}
+	key := fmt.Sprintf("%s:%d", util.ToASCII(hostname), port)
+	binding := querySSLBinding(context.Background(), "hostnameport", key)
+	if binding != nil {
+		inv.putBinding(*binding)
+	} else {
+		inv.removeBinding(key)
+	}
+	return binding
+}
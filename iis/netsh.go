@@ -2,9 +2,12 @@ package iis
 
 import (
 	"bufio"
+	"context"
 	"fmt"
+	"net"
 	"regexp"
 	"strings"
+	"time"
 
 	"cert-deploy/util"
 )
@@ -12,6 +15,9 @@ import (
 // 默认 AppID (用于标识应用程序)
 const defaultAppID = "{00000000-0000-0000-0000-000000000000}"
 
+// netshTimeout 单条 netsh 命令的最长执行时间
+const netshTimeout = 30 * time.Second
+
 // SSLBinding SSL 证书绑定信息
 type SSLBinding struct {
 	HostnamePort    string
@@ -22,11 +28,15 @@ type SSLBinding struct {
 }
 
 // BindCertificate 绑定证书到指定的主机名和端口 (SNI 模式)
-func BindCertificate(hostname string, port int, certHash string) error {
+// ctx 取消时不再开始绑定；已删除原绑定后添加新绑定不受取消影响，避免主机名失去证书
+func BindCertificate(ctx context.Context, hostname string, port int, certHash string) error {
 	if port == 0 {
 		port = 443
 	}
 
+	// 国际化域名使用 A-label
+	hostname = util.ToASCII(hostname)
+
 	// 参数验证
 	if err := util.ValidateHostname(hostname); err != nil {
 		return fmt.Errorf("无效的主机名: %w", err)
@@ -45,11 +55,15 @@ func BindCertificate(hostname string, port int, certHash string) error {
 
 	hostnamePort := fmt.Sprintf("%s:%d", hostname, port)
 
+	if err := ctx.Err(); err != nil {
+		return fmt.Errorf("绑定中止: %w", err)
+	}
+
 	// 先尝试删除已有绑定（忽略错误）
-	_ = UnbindCertificate(hostname, port)
+	_ = UnbindCertificate(ctx, hostname, port)
 
 	// 添加新绑定
-	output, err := util.RunCmdCombined("netsh", "http", "add", "sslcert",
+	output, err := util.RunCmdWithTimeout(context.WithoutCancel(ctx), netshTimeout, nil, "netsh", "http", "add", "sslcert",
 		fmt.Sprintf("hostnameport=%s", hostnamePort),
 		fmt.Sprintf("certhash=%s", certHash),
 		fmt.Sprintf("appid=%s", defaultAppID),
@@ -64,30 +78,12 @@ func BindCertificate(hostname string, port int, certHash string) error {
 		return fmt.Errorf("绑定证书失败: %v, 输出: %s", err, output)
 	}
 
-	// 验证绑定是否真正成功
-	binding, verifyErr := GetBindingForHost(hostname, port)
-	if verifyErr != nil {
-		// 验证失败但命令成功，给出警告而非错误
-		if isSuccess {
-			return nil // 命令报告成功，信任它
-		}
-		return fmt.Errorf("绑定后验证失败: %v", verifyErr)
-	}
-	if binding == nil {
-		if isSuccess {
-			return nil // 命令报告成功，可能是解析问题
-		}
-		return fmt.Errorf("绑定未生效: 未找到绑定记录，输出: %s", output)
-	}
-	if !strings.EqualFold(binding.CertHash, certHash) {
-		return fmt.Errorf("绑定证书不匹配: 期望 %s, 实际 %s", certHash, binding.CertHash)
-	}
-
-	return nil
+	// 验证绑定是否真正成功（只查询这一条绑定）
+	return verifyBinding(ctx, "hostnameport", hostnamePort, certHash, isSuccess, output)
 }
 
-// BindCertificateByIP 绑定证书到指定的 IP 和端口 (非 SNI 模式)
-func BindCertificateByIP(ip string, port int, certHash string) error {
+// BindCertificateByIP 绑定证书到指定的 IP 和端口 (非 SNI 模式)，ctx 的处理同 BindCertificate
+func BindCertificateByIP(ctx context.Context, ip string, port int, certHash string) error {
 	if port == 0 {
 		port = 443
 	}
@@ -113,11 +109,15 @@ func BindCertificateByIP(ip string, port int, certHash string) error {
 
 	ipPort := fmt.Sprintf("%s:%d", ip, port)
 
+	if err := ctx.Err(); err != nil {
+		return fmt.Errorf("绑定中止: %w", err)
+	}
+
 	// 先尝试删除已有绑定
-	_ = UnbindCertificateByIP(ip, port)
+	_ = UnbindCertificateByIP(ctx, ip, port)
 
 	// 添加新绑定
-	output, err := util.RunCmdCombined("netsh", "http", "add", "sslcert",
+	output, err := util.RunCmdWithTimeout(context.WithoutCancel(ctx), netshTimeout, nil, "netsh", "http", "add", "sslcert",
 		fmt.Sprintf("ipport=%s", ipPort),
 		fmt.Sprintf("certhash=%s", certHash),
 		fmt.Sprintf("appid=%s", defaultAppID),
@@ -132,20 +132,23 @@ func BindCertificateByIP(ip string, port int, certHash string) error {
 		return fmt.Errorf("绑定证书失败: %v, 输出: %s", err, output)
 	}
 
-	// 验证绑定是否真正成功
-	binding, verifyErr := GetBindingForIP(ip, port)
-	if verifyErr != nil {
-		if isSuccess {
-			return nil
-		}
-		return fmt.Errorf("绑定后验证失败: %v", verifyErr)
-	}
+	// 验证绑定是否真正成功（只查询这一条绑定）
+	return verifyBinding(ctx, "ipport", ipPort, certHash, isSuccess, output)
+}
+
+// verifyBinding 绑定后查询确认证书已生效，并更新绑定快照
+// kind: hostnameport 或 ipport；isSuccess: netsh 输出是否报告成功
+func verifyBinding(ctx context.Context, kind, key, certHash string, isSuccess bool, output string) error {
+	binding := querySSLBinding(context.WithoutCancel(ctx), kind, key)
 	if binding == nil {
 		if isSuccess {
+			// 命令报告成功，可能是解析问题，信任它
+			inv.putBinding(SSLBinding{HostnamePort: key, CertHash: certHash, AppID: defaultAppID, CertStoreName: "MY"})
 			return nil
 		}
 		return fmt.Errorf("绑定未生效: 未找到绑定记录，输出: %s", output)
 	}
+	inv.putBinding(*binding)
 	if !strings.EqualFold(binding.CertHash, certHash) {
 		return fmt.Errorf("绑定证书不匹配: 期望 %s, 实际 %s", certHash, binding.CertHash)
 	}
@@ -154,11 +157,14 @@ func BindCertificateByIP(ip string, port int, certHash string) error {
 }
 
 // UnbindCertificate 解除主机名端口的证书绑定 (SNI)
-func UnbindCertificate(hostname string, port int) error {
+func UnbindCertificate(ctx context.Context, hostname string, port int) error {
 	if port == 0 {
 		port = 443
 	}
 
+	// 国际化域名使用 A-label
+	hostname = util.ToASCII(hostname)
+
 	// 参数验证
 	if err := util.ValidateHostname(hostname); err != nil {
 		return fmt.Errorf("无效的主机名: %w", err)
@@ -168,18 +174,19 @@ func UnbindCertificate(hostname string, port int) error {
 	}
 
 	hostnamePort := fmt.Sprintf("%s:%d", hostname, port)
-	output, err := util.RunCmdCombined("netsh", "http", "delete", "sslcert",
+	output, err := util.RunCmdWithTimeout(ctx, netshTimeout, nil, "netsh", "http", "delete", "sslcert",
 		fmt.Sprintf("hostnameport=%s", hostnamePort))
 
 	if err != nil {
 		return fmt.Errorf("解除绑定失败: %v, 输出: %s", err, output)
 	}
+	inv.removeBinding(hostnamePort)
 
 	return nil
 }
 
 // UnbindCertificateByIP 解除 IP 端口的证书绑定
-func UnbindCertificateByIP(ip string, port int) error {
+func UnbindCertificateByIP(ctx context.Context, ip string, port int) error {
 	if port == 0 {
 		port = 443
 	}
@@ -196,18 +203,28 @@ func UnbindCertificateByIP(ip string, port int) error {
 	}
 
 	ipPort := fmt.Sprintf("%s:%d", ip, port)
-	output, err := util.RunCmdCombined("netsh", "http", "delete", "sslcert",
+	output, err := util.RunCmdWithTimeout(ctx, netshTimeout, nil, "netsh", "http", "delete", "sslcert",
 		fmt.Sprintf("ipport=%s", ipPort))
 
 	if err != nil {
 		return fmt.Errorf("解除绑定失败: %v, 输出: %s", err, output)
 	}
+	inv.removeBinding(ipPort)
 
 	return nil
 }
 
-// ListSSLBindings 列出所有 SSL 证书绑定
+// ListSSLBindings 列出所有 SSL 证书绑定（实时查询，同时刷新快照）
 func ListSSLBindings() ([]SSLBinding, error) {
+	bindings, err := listSSLBindings()
+	if err != nil {
+		return nil, err
+	}
+	inv.setBindings(bindings)
+	return bindings, nil
+}
+
+func listSSLBindings() ([]SSLBinding, error) {
 	output, err := util.RunCmd("netsh", "http", "show", "sslcert")
 	if err != nil {
 		return nil, fmt.Errorf("获取 SSL 绑定列表失败: %v", err)
@@ -242,7 +259,7 @@ func parseSSLBindings(output string) []SSLBinding {
 				bindings = append(bindings, *current)
 			}
 			current = &SSLBinding{
-				HostnamePort: strings.TrimSpace(matches[1]),
+				HostnamePort: asciiHostPort(strings.TrimSpace(matches[1])),
 			}
 			continue
 		}
@@ -275,12 +292,12 @@ func GetBindingForHost(hostname string, port int) (*SSLBinding, error) {
 		port = 443
 	}
 
-	bindings, err := ListSSLBindings()
+	bindings, err := CachedSSLBindings()
 	if err != nil {
 		return nil, err
 	}
 
-	target := fmt.Sprintf("%s:%d", hostname, port)
+	target := fmt.Sprintf("%s:%d", util.ToASCII(hostname), port)
 	for _, b := range bindings {
 		if strings.EqualFold(b.HostnamePort, target) {
 			return &b, nil
@@ -299,7 +316,7 @@ func GetBindingForIP(ip string, port int) (*SSLBinding, error) {
 		ip = "0.0.0.0"
 	}
 
-	bindings, err := ListSSLBindings()
+	bindings, err := CachedSSLBindings()
 	if err != nil {
 		return nil, err
 	}
@@ -317,7 +334,7 @@ func GetBindingForIP(ip string, port int) (*SSLBinding, error) {
 // FindBindingsForDomains 查找与指定域名匹配的 SSL 绑定
 // 返回: 实际绑定域名 -> SSLBinding 映射（通配符会匹配多个）
 func FindBindingsForDomains(domains []string) (map[string]*SSLBinding, error) {
-	bindings, err := ListSSLBindings()
+	bindings, err := CachedSSLBindings()
 	if err != nil {
 		return nil, err
 	}
@@ -339,6 +356,15 @@ func FindBindingsForDomains(domains []string) (map[string]*SSLBinding, error) {
 	return result, nil
 }
 
+// asciiHostPort "hostname:port" 中的主机名转换为 A-label，与程序内部的比较方式一致
+func asciiHostPort(hostnamePort string) string {
+	idx := strings.LastIndex(hostnamePort, ":")
+	if idx <= 0 {
+		return hostnamePort
+	}
+	return util.ToASCII(hostnamePort[:idx]) + hostnamePort[idx:]
+}
+
 // ParseHostFromBinding 从 "hostname:port" 提取主机名
 func ParseHostFromBinding(hostnamePort string) string {
 	idx := strings.LastIndex(hostnamePort, ":")
@@ -364,14 +390,20 @@ func ParsePortFromBinding(hostnamePort string) int {
 
 // matchDomain 检查绑定是否匹配域名（支持通配符）
 func matchDomain(bindingHost, certDomain string) bool {
-	bindingHost = strings.ToLower(bindingHost)
-	certDomain = strings.ToLower(certDomain)
+	bindingHost = util.ToASCII(bindingHost)
+	certDomain = util.ToASCII(certDomain)
 
 	// 精确匹配
 	if bindingHost == certDomain {
 		return true
 	}
 
+	// IP 地址（ipport 绑定）按地址比较，不参与通配符匹配
+	if ip := net.ParseIP(bindingHost); ip != nil {
+		certIP := net.ParseIP(certDomain)
+		return certIP != nil && certIP.Equal(ip)
+	}
+
 	// 通配符证书匹配: *.example.com 匹配 www.example.com
 	if strings.HasPrefix(certDomain, "*.") {
 		suffix := certDomain[1:] // ".example.com"
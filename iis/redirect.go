@@ -0,0 +1,209 @@
+package iis
+
+import (
+	"fmt"
+	"log"
+	"path/filepath"
+	"strings"
+
+	"cert-deploy/iis/iisconfig"
+	"cert-deploy/util"
+)
+
+// HTTPSPolicy 站点 HTTPS 策略
+// 字段为 nil 时不管理该项，保持 web.config 现状
+type HTTPSPolicy struct {
+	ForceHTTPS *bool   // 强制 HTTP 跳转 HTTPS，false 表示撤销本工具写入的跳转
+	HSTS       *string // HSTS 响应头的值，空字符串表示撤销
+}
+
+// ApplyHTTPSPolicy 按策略修改站点 web.config
+// siteName 为提供 HTTPS 的站点，domain、port 为绑定规则的域名和 HTTPS 端口
+// 重复执行结果不变；只修改本工具写入的配置，不影响用户手工添加的内容
+func ApplyHTTPSPolicy(siteName, domain string, port int, policy HTTPSPolicy) error {
+	domain = util.ToASCII(domain)
+	if err := validateBindingParams(siteName, domain, port); err != nil {
+		return err
+	}
+
+	if policy.ForceHTTPS != nil {
+		if err := applyHTTPSRedirect(siteName, domain, port, *policy.ForceHTTPS); err != nil {
+			return fmt.Errorf("配置 HTTPS 跳转失败: %w", err)
+		}
+	}
+
+	if policy.HSTS != nil {
+		if err := applyHSTS(siteName, *policy.HSTS); err != nil {
+			return fmt.Errorf("配置 HSTS 失败: %w", err)
+		}
+	}
+
+	return nil
+}
+
+// loadSiteWebConfig 加载站点根目录下的 web.config
+func loadSiteWebConfig(siteName string) (*iisconfig.WebConfig, error) {
+	sitePath, err := GetSitePhysicalPath(siteName)
+	if err != nil {
+		return nil, err
+	}
+	return iisconfig.LoadWebConfig(filepath.Join(sitePath, "web.config"))
+}
+
+// applyHSTS 在 HTTPS 站点的 web.config 中设置 HSTS 响应头
+func applyHSTS(siteName, value string) error {
+	wc, err := loadSiteWebConfig(siteName)
+	if err != nil {
+		return err
+	}
+	if err := wc.SetHSTS(value); err != nil {
+		return err
+	}
+	if !wc.Changed() {
+		return nil
+	}
+	if err := wc.Save(); err != nil {
+		return err
+	}
+	if value == "" {
+		log.Printf("已移除站点 %s 的 HSTS 响应头", siteName)
+	} else {
+		log.Printf("已设置站点 %s 的 HSTS 响应头: %s", siteName, value)
+	}
+	return nil
+}
+
+// applyHTTPSRedirect 在提供 HTTP 的站点上配置跳转
+// HTTP 绑定可能与 HTTPS 在同一站点，也可能在单独的站点
+func applyHTTPSRedirect(siteName, domain string, port int, enable bool) error {
+	sites, err := CachedSites()
+	if err != nil {
+		return err
+	}
+
+	httpSites := findHTTPSitesForDomain(sites, siteName, domain)
+	if len(httpSites) == 0 {
+		if enable {
+			log.Printf("域名 %s 没有 HTTP 绑定，无需配置跳转", domain)
+		}
+		return nil
+	}
+
+	hasRewrite := false
+	if cfg, err := LoadAppHostConfig(); err == nil {
+		hasRewrite = cfg.HasGlobalModule("RewriteModule")
+	}
+
+	for _, site := range httpSites {
+		wc, err := loadSiteWebConfig(site.Name)
+		if err != nil {
+			return err
+		}
+
+		switch {
+		case !enable:
+			wc.SetRewriteRedirect(domain, port, false)
+			if err := wc.SetHTTPRedirect("", false); err != nil {
+				return err
+			}
+		case hasRewrite:
+			// 已安装 URL Rewrite：按域名精确跳转，顺带清理此前写入的 httpRedirect
+			if err := wc.SetHTTPRedirect("", false); err != nil {
+				return err
+			}
+			wc.SetRewriteRedirect(domain, port, true)
+		default:
+			destination, err := httpRedirectDestination(sites, site, domain, port)
+			if err != nil {
+				return err
+			}
+			wc.SetRewriteRedirect(domain, port, false)
+			if err := wc.SetHTTPRedirect(destination, true); err != nil {
+				return err
+			}
+		}
+
+		if !wc.Changed() {
+			continue
+		}
+		if err := wc.Save(); err != nil {
+			return err
+		}
+		if enable {
+			log.Printf("已配置站点 %s 的 HTTP 跳转 HTTPS: %s", site.Name, domain)
+		} else {
+			log.Printf("已移除站点 %s 的 HTTP 跳转 HTTPS: %s", site.Name, domain)
+		}
+	}
+	return nil
+}
+
+// findHTTPSitesForDomain 查找承载该域名 HTTP 请求的站点
+// 优先按主机名匹配；没有时退回到 HTTPS 站点自身的无主机名 HTTP 绑定
+func findHTTPSitesForDomain(sites []SiteInfo, httpsSite, domain string) []SiteInfo {
+	result := make([]SiteInfo, 0)
+	for _, site := range sites {
+		for _, b := range site.Bindings {
+			if b.Protocol == "http" && b.Host != "" && MatchDomainForBinding(b.Host, domain) {
+				result = append(result, site)
+				break
+			}
+		}
+	}
+	if len(result) > 0 {
+		return result
+	}
+
+	for _, site := range sites {
+		if !strings.EqualFold(site.Name, httpsSite) {
+			continue
+		}
+		for _, b := range site.Bindings {
+			if b.Protocol == "http" && b.Host == "" {
+				result = append(result, site)
+				break
+			}
+		}
+	}
+	return result
+}
+
+// httpRedirectDestination 计算 httpRedirect 的跳转目标
+// httpRedirect 不区分协议和主机名，对整个目录生效，因此只允许用于：
+// 站点不提供 HTTPS、不与 HTTPS 站点共用目录、且只承载这一个域名
+func httpRedirectDestination(sites []SiteInfo, site SiteInfo, domain string, port int) (string, error) {
+	if strings.HasPrefix(domain, "*.") {
+		return "", fmt.Errorf("未安装 URL Rewrite，通配符域名 %s 无法配置跳转", domain)
+	}
+
+	for _, b := range site.Bindings {
+		if b.Protocol == "https" {
+			return "", fmt.Errorf("未安装 URL Rewrite，站点 %s 同时提供 HTTP 和 HTTPS，使用 httpRedirect 会循环跳转", site.Name)
+		}
+		if b.Protocol == "http" && !strings.EqualFold(b.Host, domain) {
+			return "", fmt.Errorf("未安装 URL Rewrite，站点 %s 还承载其他域名（%s），无法整站跳转", site.Name, b.Host)
+		}
+	}
+
+	sitePath, err := GetSitePhysicalPath(site.Name)
+	if err != nil {
+		return "", err
+	}
+	for _, other := range sites {
+		if strings.EqualFold(other.Name, site.Name) {
+			continue
+		}
+		otherPath, err := GetSitePhysicalPath(other.Name)
+		if err == nil && strings.EqualFold(filepath.Clean(otherPath), filepath.Clean(sitePath)) {
+			return "", fmt.Errorf("未安装 URL Rewrite，站点 %s 与 %s 共用目录，无法使用 httpRedirect", site.Name, other.Name)
+		}
+	}
+
+	if err := util.ValidateDomain(domain); err != nil {
+		return "", err
+	}
+	if port != 0 && port != 443 {
+		return fmt.Sprintf("https://%s:%d", domain, port), nil
+	}
+	return "https://" + domain, nil
+}
@@ -4,10 +4,27 @@ import "time"
 
 // SiteInfo IIS 站点信息
 type SiteInfo struct {
-	ID       int64
-	Name     string
-	State    string
-	Bindings []BindingInfo
+	ID           int64
+	Name         string
+	State        string
+	Bindings     []BindingInfo
+	Applications []ApplicationInfo // 来自 applicationHost.config，读取失败时为空
+	FTP          *FTPInfo          // 非 FTP 站点为 nil
+}
+
+// ApplicationInfo 应用程序
+type ApplicationInfo struct {
+	Path         string
+	AppPool      string
+	PhysicalPath string // 根虚拟目录的物理路径（未展开环境变量）
+}
+
+// FTPInfo FTP 站点 SSL 设置
+type FTPInfo struct {
+	CertHash             string
+	CertStore            string
+	ControlChannelPolicy string
+	DataChannelPolicy    string
 }
 
 // BindingInfo 绑定信息
@@ -1,15 +1,20 @@
 package main
 
 import (
+	"encoding/json"
 	"flag"
 	"fmt"
 	"log"
 	"os"
 	"path/filepath"
+	"strings"
 
+	"cert-deploy/cli"
 	"cert-deploy/config"
 	"cert-deploy/deploy"
+	"cert-deploy/notify"
 	"cert-deploy/ui"
+	"cert-deploy/util"
 )
 
 var (
@@ -17,8 +22,19 @@ var (
 )
 
 func main() {
+	// 子命令（sites、certs、bind、deploy 等），用于无界面管理
+	if len(os.Args) > 1 && cli.IsCommand(os.Args[1]) {
+		os.Exit(cli.Run(os.Args[1:]))
+	}
+
 	// 命令行参数
 	autoMode := flag.Bool("auto", false, "自动部署模式（用于计划任务）")
+	dryRun := flag.Bool("dry-run", false, "预演模式：只输出将要执行的操作（配合 -auto）")
+	jsonOutput := flag.Bool("json", false, "以 JSON 格式输出（配合 -dry-run、-status、-validate）")
+	showStatus := flag.Bool("status", false, "显示未完成的部署进度")
+	validate := flag.Bool("validate", false, "检查配置，有错误时返回非零退出码")
+	applyFile := flag.String("apply", "", "应用声明式配置文件（JSON 或 YAML），配合 -dry-run 只显示变更")
+	notifyTest := flag.Bool("notify-test", false, "向所有启用的通知渠道发送测试消息")
 	debugMode := flag.Bool("debug", false, "启用调试模式（输出到 debug.log）")
 	showVersion := flag.Bool("version", false, "显示版本号")
 	showHelp := flag.Bool("help", false, "显示帮助")
@@ -35,6 +51,32 @@ func main() {
 		return
 	}
 
+	if *showStatus {
+		runStatus(*jsonOutput)
+		return
+	}
+
+	if *validate {
+		runValidate(*jsonOutput)
+		return
+	}
+
+	if *notifyTest {
+		runNotifyTest()
+		return
+	}
+
+	if *applyFile != "" {
+		runApply(*applyFile, *dryRun)
+		return
+	}
+
+	if *autoMode && *dryRun {
+		// 预演模式
+		runDryRun(*jsonOutput)
+		return
+	}
+
 	if *autoMode {
 		// 自动部署模式
 		runAutoDeploy()
@@ -75,19 +117,247 @@ func runAutoDeploy() {
 	log.Printf("========== 自动部署完成 ==========")
 }
 
+// runDryRun 输出自动部署的预演计划，不做任何修改
+func runDryRun(jsonOutput bool) {
+	// 过程日志写入 stderr，stdout 只输出计划
+	log.SetOutput(os.Stderr)
+
+	cfg, err := config.Load()
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "加载配置失败: %v\n", err)
+		os.Exit(1)
+	}
+
+	plan := deploy.PlanAutoDeploy(cfg)
+	if jsonOutput {
+		data, err := plan.JSON()
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "输出 JSON 失败: %v\n", err)
+			os.Exit(1)
+		}
+		fmt.Println(string(data))
+		return
+	}
+	fmt.Print(plan.String())
+}
+
+// runStatus 输出未完成的部署进度（完成后状态文件即删除）
+func runStatus(jsonOutput bool) {
+	states, err := deploy.DeployStates()
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "读取部署状态失败: %v\n", err)
+		os.Exit(1)
+	}
+
+	if jsonOutput {
+		data, err := json.MarshalIndent(states, "", "  ")
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "输出 JSON 失败: %v\n", err)
+			os.Exit(1)
+		}
+		fmt.Println(string(data))
+		return
+	}
+
+	if len(states) == 0 {
+		fmt.Println("没有未完成的部署")
+		return
+	}
+	for _, st := range states {
+		mark := "完成"
+		if !st.Finished() {
+			mark = "未完成"
+		}
+		fmt.Printf("[订单 %d] %s  %s（%s）  更新于 %s\n", st.OrderID, st.Domain, st.Step.Name(), mark, st.UpdatedAt)
+		if st.Thumbprint != "" {
+			fmt.Printf("    证书指纹: %s\n", st.Thumbprint)
+		}
+		if len(st.Bound) > 0 {
+			fmt.Printf("    已绑定: %s\n", strings.Join(st.Bound, ", "))
+		}
+		if st.Error != "" {
+			fmt.Printf("    错误: %s\n", st.Error)
+		}
+	}
+}
+
+// runValidate 检查配置并输出问题，有错误时退出码为 1
+func runValidate(jsonOutput bool) {
+	cfg, err := config.Load()
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "加载配置失败: %v\n", err)
+		os.Exit(1)
+	}
+
+	report := deploy.ValidateConfig(cfg)
+	if jsonOutput {
+		data, err := report.JSON()
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "输出 JSON 失败: %v\n", err)
+			os.Exit(1)
+		}
+		fmt.Println(string(data))
+	} else {
+		fmt.Print(report.String())
+	}
+	if report.Errors() > 0 {
+		os.Exit(1)
+	}
+}
+
+// runNotifyTest 向所有启用的通知渠道发送测试消息
+func runNotifyTest() {
+	cfg, err := config.Load()
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "加载配置失败: %v\n", err)
+		os.Exit(1)
+	}
+	if cfg.Notify == nil || len(cfg.Notify.Channels) == 0 {
+		fmt.Println("没有配置通知渠道")
+		return
+	}
+
+	failed := false
+	for _, ch := range cfg.Notify.Channels {
+		if !ch.Enabled {
+			continue
+		}
+		if err := notify.SendTest(ch); err != nil {
+			fmt.Printf("[失败] %s (%s): %v\n", ch.Name, ch.Type, err)
+			failed = true
+			continue
+		}
+		fmt.Printf("[成功] %s (%s)\n", ch.Name, ch.Type)
+	}
+	if failed {
+		os.Exit(1)
+	}
+}
+
+// runApply 应用声明式配置文件并输出变更，dryRun 时只输出不保存
+func runApply(path string, dryRun bool) {
+	desired, err := config.LoadDesiredState(path)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "%v\n", err)
+		os.Exit(1)
+	}
+
+	if dryRun {
+		cfg, err := config.Load()
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "加载配置失败: %v\n", err)
+			os.Exit(1)
+		}
+		changes, err := config.ApplyDesired(cfg, desired)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "%v\n", err)
+			os.Exit(1)
+		}
+		printChanges(changes)
+		return
+	}
+
+	var changes []config.Change
+	var oldTaskName string
+	cfg, err := config.Update(func(latest *config.Config) error {
+		oldTaskName = latest.TaskName
+		var err error
+		if changes, err = config.ApplyDesired(latest, desired); err != nil {
+			return err
+		}
+		if len(changes) == 0 {
+			return config.ErrNoChanges
+		}
+		return nil
+	})
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "应用配置失败: %v\n", err)
+		os.Exit(1)
+	}
+	printChanges(changes)
+
+	if desired.Schedule != nil {
+		if err := syncSchedule(cfg, oldTaskName, changes); err != nil {
+			fmt.Fprintf(os.Stderr, "同步计划任务失败: %v\n", err)
+			os.Exit(1)
+		}
+	}
+}
+
+// printChanges 输出配置变更
+func printChanges(changes []config.Change) {
+	if len(changes) == 0 {
+		fmt.Println("配置已是期望状态，无需修改")
+		return
+	}
+	for _, c := range changes {
+		fmt.Println(c.String())
+	}
+}
+
+// syncSchedule 按配置创建或删除计划任务，任务已存在且计划未变化时不重建
+func syncSchedule(cfg *config.Config, oldTaskName string, changes []config.Change) error {
+	if oldTaskName != cfg.TaskName && util.IsTaskExists(oldTaskName) {
+		if err := util.DeleteTask(oldTaskName); err != nil {
+			return err
+		}
+	}
+
+	exists := util.IsTaskExists(cfg.TaskName)
+	if !cfg.AutoCheckEnabled {
+		if exists {
+			return util.DeleteTask(cfg.TaskName)
+		}
+		return nil
+	}
+
+	changed := false
+	for _, c := range changes {
+		if strings.HasPrefix(c.Target, "schedule.") {
+			changed = true
+		}
+	}
+	if exists && !changed {
+		return nil
+	}
+	return util.CreateTask(cfg.TaskName, cfg.CheckInterval)
+}
+
 // printUsage 打印使用说明
 func printUsage() {
 	fmt.Printf(`IIS 证书部署工具 v%s
 
 用法:
   certdeploy.exe [选项]
+  certdeploy.exe <子命令> [参数]
 
 选项:
   -auto      自动部署模式（用于计划任务）
+  -dry-run   预演模式，配合 -auto 使用，只输出将要执行的操作
+  -json      预演结果、部署进度或检查结果以 JSON 格式输出
+  -status    显示未完成的部署进度
+  -validate  检查配置，有错误时返回非零退出码
+  -apply 文件  应用声明式配置文件（JSON 或 YAML），配合 -dry-run 只显示变更
+  -notify-test  向所有启用的通知渠道发送测试消息
   -debug     启用调试模式（输出到 debug.log）
   -version   显示版本号
   -help      显示帮助
 
+命令行管理:
+  certdeploy.exe help 列出全部子命令，界面上的操作都可以通过子命令完成，适用于
+  SSH 或 Server Core 等没有桌面的环境：
+  certdeploy.exe sites list
+  certdeploy.exe certs list|show|delete
+  certdeploy.exe install pfx|pem
+  certdeploy.exe bind www.example.com:443 --cert 指纹 [--site 站点]
+  certdeploy.exe unbind www.example.com:443 [--site 站点]
+  certdeploy.exe orders import|list|enable|disable|remove
+  certdeploy.exe task install|remove|run
+  certdeploy.exe deploy [--order 订单ID] [--force]
+
+  list、show 支持 --json；出错时退出码为 1。修改证书和绑定的命令与 GUI、计划任务
+  共用部署锁，部署进行中时返回错误
+
 GUI 模式:
   直接运行 certdeploy.exe 进入图形界面
 
@@ -97,12 +367,48 @@ GUI 模式:
   自动部署模式会读取配置文件，检查所有启用的站点：
   - 如果证书在配置的天数内过期，自动从部署接口获取新证书并部署
   - 部署结果记录到日志文件
+  - GUI 正在部署时等待其完成（最长 30 分钟），数据目录下的 deploy.lock 为部署锁
+  - 每个证书的部署进度保存在订单目录的 state.json，进程中断后下次运行继续未完成的
+    步骤；订单已更换或移出配置时，删除中断时安装但未被绑定使用的证书
 
   可配合 Windows 任务计划程序定时执行
 
+预演模式:
+  certdeploy.exe -auto -dry-run
+  certdeploy.exe -auto -dry-run -json
+
+  按自动部署的同一套逻辑（续签时间、域名冲突、绑定匹配）列出将要执行的操作：
+  提交 CSR、安装证书、更换绑定（原指纹 => 新指纹）、发送回调等，不做任何修改
+
+部署进度:
+  certdeploy.exe -status
+  certdeploy.exe -status -json
+
+配置检查:
+  certdeploy.exe -validate
+  certdeploy.exe -validate -json
+
+  不调用接口、不做修改，逐项输出错误和警告及修复建议：Token 和 SMTP 密码能否解密、
+  绑定域名是否在证书中、站点是否存在、端口和绑定规则是否重复、验证方法与域名是否兼容、
+  部署后动作的站点和脚本等。有错误时退出码为 1，可在下发配置后执行
+
+通知:
+  配置文件 notify 节点设置邮件、Webhook、钉钉、企业微信、飞书、Slack 渠道，
+  每次自动部署后发送部署结果和即将过期的证书，同一告警在 dedup_hours 内只发送一次
+  certdeploy.exe -notify-test
+
+声明式配置:
+  certdeploy.exe -apply desired.yaml -dry-run
+  certdeploy.exe -apply desired.yaml
+
+  文件声明 API 配置（profiles）、证书、绑定规则、续签时间和计划任务（schedule），
+  与当前配置比较后输出变更（+ 新增、~ 修改、- 删除），重复应用没有变更；prune: true
+  时删除文件中没有的证书和 API 配置。Token 不能写在文件中，通过 token_env（环境变量）
+  或 token_file（文件）提供，保存时加密；两者都不设置时保留本机已保存的 Token
+
 配置目录:
   程序同目录下的 CertDeploy 文件夹
-  - 配置文件: CertDeploy/config.json
+  - 配置文件: CertDeploy/config.json（每次保存前备份为 config.json.1..5，损坏时自动从备份恢复）
   - 日志目录: CertDeploy/logs/
 
 创建计划任务:
@@ -0,0 +1,258 @@
+package notify
+
+import (
+	"bytes"
+	"crypto/hmac"
+	"crypto/sha256"
+	"crypto/tls"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"io"
+	"mime"
+	"net"
+	"net/http"
+	"net/smtp"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+
+	"cert-deploy/config"
+)
+
+var httpClient = &http.Client{Timeout: 15 * time.Second}
+
+// postJSON 发送 JSON 请求，返回响应内容（非 2xx 状态码视为失败）
+func postJSON(rawURL string, headers map[string]string, payload interface{}) ([]byte, error) {
+	data, err := json.Marshal(payload)
+	if err != nil {
+		return nil, fmt.Errorf("序列化通知内容失败: %w", err)
+	}
+
+	req, err := http.NewRequest(http.MethodPost, rawURL, bytes.NewReader(data))
+	if err != nil {
+		return nil, fmt.Errorf("创建请求失败: %w", err)
+	}
+	req.Header.Set("Content-Type", "application/json; charset=utf-8")
+	for k, v := range headers {
+		req.Header.Set(k, v)
+	}
+
+	resp, err := httpClient.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("请求失败: %w", err)
+	}
+	defer resp.Body.Close()
+
+	body, _ := io.ReadAll(io.LimitReader(resp.Body, 64*1024))
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		return nil, fmt.Errorf("HTTP %d: %s", resp.StatusCode, strings.TrimSpace(string(body)))
+	}
+	return body, nil
+}
+
+// checkBotResponse 检查机器人接口返回的错误码（钉钉/企业微信 errcode，飞书 code）
+func checkBotResponse(body []byte) error {
+	var resp struct {
+		ErrCode *int   `json:"errcode"`
+		ErrMsg  string `json:"errmsg"`
+		Code    *int   `json:"code"`
+		Msg     string `json:"msg"`
+	}
+	if err := json.Unmarshal(body, &resp); err != nil {
+		return fmt.Errorf("解析响应失败: %w", err)
+	}
+	if resp.ErrCode != nil && *resp.ErrCode != 0 {
+		return fmt.Errorf("错误码 %d: %s", *resp.ErrCode, resp.ErrMsg)
+	}
+	if resp.Code != nil && *resp.Code != 0 {
+		return fmt.Errorf("错误码 %d: %s", *resp.Code, resp.Msg)
+	}
+	return nil
+}
+
+// sendWebhook 通用 Webhook：POST 标题、正文和结构化事件
+func sendWebhook(ch config.NotifyChannel, title, body string, msg *Message) error {
+	payload := map[string]interface{}{
+		"title":    title,
+		"text":     body,
+		"host":     msg.Host,
+		"time":     msg.Time,
+		"severity": msg.Severity,
+		"events":   msg.Events,
+	}
+	_, err := postJSON(ch.URL, ch.Headers, payload)
+	return err
+}
+
+// sendDingTalk 钉钉机器人，配置加签密钥时附加 timestamp 和 sign
+func sendDingTalk(ch config.NotifyChannel, title, body string) error {
+	target := ch.URL
+	if ch.Secret != "" {
+		timestamp := strconv.FormatInt(time.Now().UnixMilli(), 10)
+		target = appendQuery(target, url.Values{"timestamp": {timestamp}, "sign": {dingTalkSign(ch.Secret, timestamp)}})
+	}
+	payload := map[string]interface{}{
+		"msgtype": "text",
+		"text":    map[string]string{"content": title + "\n\n" + body},
+	}
+	resp, err := postJSON(target, nil, payload)
+	if err != nil {
+		return err
+	}
+	return checkBotResponse(resp)
+}
+
+// dingTalkSign 钉钉加签：以密钥对 "timestamp\n密钥" 做 HmacSHA256，timestamp 为毫秒
+func dingTalkSign(secret, timestamp string) string {
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write([]byte(timestamp + "\n" + secret))
+	return base64.StdEncoding.EncodeToString(mac.Sum(nil))
+}
+
+// sendWeCom 企业微信群机器人
+func sendWeCom(ch config.NotifyChannel, title, body string) error {
+	payload := map[string]interface{}{
+		"msgtype": "text",
+		"text":    map[string]string{"content": title + "\n\n" + body},
+	}
+	resp, err := postJSON(ch.URL, nil, payload)
+	if err != nil {
+		return err
+	}
+	return checkBotResponse(resp)
+}
+
+// sendFeishu 飞书自定义机器人，配置签名校验时附加 timestamp 和 sign
+func sendFeishu(ch config.NotifyChannel, title, body string) error {
+	payload := map[string]interface{}{
+		"msg_type": "text",
+		"content":  map[string]string{"text": title + "\n\n" + body},
+	}
+	if ch.Secret != "" {
+		timestamp := strconv.FormatInt(time.Now().Unix(), 10)
+		payload["timestamp"] = timestamp
+		payload["sign"] = feishuSign(ch.Secret, timestamp)
+	}
+	resp, err := postJSON(ch.URL, nil, payload)
+	if err != nil {
+		return err
+	}
+	return checkBotResponse(resp)
+}
+
+// feishuSign 飞书签名：以 "timestamp\n密钥" 为密钥对空数据做 HmacSHA256，timestamp 为秒
+func feishuSign(secret, timestamp string) string {
+	mac := hmac.New(sha256.New, []byte(timestamp+"\n"+secret))
+	return base64.StdEncoding.EncodeToString(mac.Sum(nil))
+}
+
+// sendSlack Slack Incoming Webhook
+func sendSlack(ch config.NotifyChannel, title, body string) error {
+	payload := map[string]string{"text": "*" + title + "*\n" + body}
+	_, err := postJSON(ch.URL, nil, payload)
+	return err
+}
+
+func appendQuery(rawURL string, values url.Values) string {
+	sep := "?"
+	if strings.Contains(rawURL, "?") {
+		sep = "&"
+	}
+	return rawURL + sep + values.Encode()
+}
+
+// sendMail 通过 SMTP 发送纯文本邮件
+// security: tls（465 端口默认）直接建立 TLS；starttls（587/25 端口默认）明文连接后升级；none 不加密
+func sendMail(cfg *config.SMTPConfig, subject, body string) error {
+	port := cfg.Port
+	if port == 0 {
+		port = 465
+	}
+	security := cfg.Security
+	if security == "" {
+		security = "starttls"
+		if port == 465 {
+			security = "tls"
+		}
+	}
+
+	addr := net.JoinHostPort(cfg.Host, strconv.Itoa(port))
+	tlsConfig := &tls.Config{ServerName: cfg.Host}
+	dialer := &net.Dialer{Timeout: 15 * time.Second}
+
+	var conn net.Conn
+	var err error
+	if security == "tls" {
+		conn, err = tls.DialWithDialer(dialer, "tcp", addr, tlsConfig)
+	} else {
+		conn, err = dialer.Dial("tcp", addr)
+	}
+	if err != nil {
+		return fmt.Errorf("连接邮件服务器失败: %w", err)
+	}
+	conn.SetDeadline(time.Now().Add(30 * time.Second))
+
+	client, err := smtp.NewClient(conn, cfg.Host)
+	if err != nil {
+		conn.Close()
+		return fmt.Errorf("连接邮件服务器失败: %w", err)
+	}
+	defer client.Close()
+
+	if security == "starttls" {
+		if err := client.StartTLS(tlsConfig); err != nil {
+			return fmt.Errorf("STARTTLS 失败: %w", err)
+		}
+	}
+	if cfg.Username != "" {
+		password, err := cfg.GetPassword()
+		if err != nil {
+			return err
+		}
+		if err := client.Auth(smtp.PlainAuth("", cfg.Username, password, cfg.Host)); err != nil {
+			return fmt.Errorf("邮件认证失败: %w", err)
+		}
+	}
+
+	if err := client.Mail(cfg.From); err != nil {
+		return fmt.Errorf("设置发件人失败: %w", err)
+	}
+	for _, to := range cfg.To {
+		if err := client.Rcpt(to); err != nil {
+			return fmt.Errorf("设置收件人 %s 失败: %w", to, err)
+		}
+	}
+
+	w, err := client.Data()
+	if err != nil {
+		return fmt.Errorf("发送邮件失败: %w", err)
+	}
+	if _, err := w.Write(buildMail(cfg.From, cfg.To, subject, body)); err != nil {
+		return fmt.Errorf("发送邮件失败: %w", err)
+	}
+	if err := w.Close(); err != nil {
+		return fmt.Errorf("发送邮件失败: %w", err)
+	}
+	return client.Quit()
+}
+
+func buildMail(from string, to []string, subject, body string) []byte {
+	var buf bytes.Buffer
+	buf.WriteString("From: " + from + "\r\n")
+	buf.WriteString("To: " + strings.Join(to, ", ") + "\r\n")
+	buf.WriteString("Subject: " + mime.BEncoding.Encode("UTF-8", subject) + "\r\n")
+	buf.WriteString("Date: " + time.Now().Format(time.RFC1123Z) + "\r\n")
+	buf.WriteString("MIME-Version: 1.0\r\n")
+	buf.WriteString("Content-Type: text/plain; charset=UTF-8\r\n")
+	buf.WriteString("Content-Transfer-Encoding: base64\r\n\r\n")
+
+	encoded := base64.StdEncoding.EncodeToString([]byte(strings.ReplaceAll(body, "\n", "\r\n")))
+	for len(encoded) > 76 {
+		buf.WriteString(encoded[:76] + "\r\n")
+		encoded = encoded[76:]
+	}
+	buf.WriteString(encoded + "\r\n")
+	return buf.Bytes()
+}
@@ -0,0 +1,22 @@
+package notify
+
+import "testing"
+
+func TestSign(t *testing.T) {
+	// 期望值按钉钉、飞书文档的签名算法独立计算
+	tests := []struct {
+		name      string
+		sign      func(secret, timestamp string) string
+		secret    string
+		timestamp string
+		want      string
+	}{
+		{"钉钉", dingTalkSign, "SECtest", "1700000000000", "aZLLrriXgn05YbwaGR7knYsLeJADjr9NwLaNNKpxh4g="},
+		{"飞书", feishuSign, "feishu-secret", "1700000000", "OrBzY1Y01Gq+HgJsl+7OfWcMVwc7YocohQm5iiZwjhU="},
+	}
+	for _, tt := range tests {
+		if got := tt.sign(tt.secret, tt.timestamp); got != tt.want {
+			t.Errorf("%s签名 = %s，期望 %s", tt.name, got, tt.want)
+		}
+	}
+}
@@ -0,0 +1,106 @@
+package notify
+
+import (
+	"encoding/json"
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"cert-deploy/config"
+	"cert-deploy/util"
+)
+
+// 告警记录保留时间，超过后清理
+const historyRetention = 30 * 24 * time.Hour
+
+// history 已发送告警的记录（数据目录 notify_history.json），用于去重
+// 键为 渠道|事件类型|订单|域名，值为发送时间
+type history struct {
+	path    string
+	entries map[string]string
+	changed bool
+}
+
+func loadHistory() *history {
+	h := &history{
+		path:    filepath.Join(config.GetDataDir(), "notify_history.json"),
+		entries: make(map[string]string),
+	}
+	data, err := os.ReadFile(h.path)
+	if err != nil {
+		return h
+	}
+	if err := json.Unmarshal(data, &h.entries); err != nil {
+		log.Printf("解析通知记录失败，重新记录: %v", err)
+		h.entries = make(map[string]string)
+	}
+	return h
+}
+
+func historyKey(channel string, e Event) string {
+	return strings.ToLower(fmt.Sprintf("%s|%s|%d|%s", channel, e.Kind, e.OrderID, e.Domain))
+}
+
+// suppressed 告警是否在去重时间内已发送过（部署成功的通知不去重）
+func (h *history) suppressed(channel string, e Event, window time.Duration) bool {
+	if e.Kind == KindDeploySuccess {
+		return false
+	}
+	sentAt, ok := h.sentAt(historyKey(channel, e))
+	return ok && time.Since(sentAt) < window
+}
+
+// record 记录已发送的告警
+func (h *history) record(channel string, e Event) {
+	if e.Kind == KindDeploySuccess {
+		return
+	}
+	h.entries[historyKey(channel, e)] = time.Now().Format(time.RFC3339)
+	h.changed = true
+}
+
+// resolve 证书部署成功后清除其所有告警记录
+func (h *history) resolve(e Event) {
+	suffix := strings.ToLower(fmt.Sprintf("|%d|%s", e.OrderID, e.Domain))
+	for key := range h.entries {
+		if strings.HasSuffix(key, suffix) {
+			delete(h.entries, key)
+			h.changed = true
+		}
+	}
+}
+
+func (h *history) sentAt(key string) (time.Time, bool) {
+	value, ok := h.entries[key]
+	if !ok {
+		return time.Time{}, false
+	}
+	t, err := time.Parse(time.RFC3339, value)
+	if err != nil {
+		return time.Time{}, false
+	}
+	return t, true
+}
+
+func (h *history) save() {
+	for key := range h.entries {
+		if t, ok := h.sentAt(key); !ok || time.Since(t) > historyRetention {
+			delete(h.entries, key)
+			h.changed = true
+		}
+	}
+	if !h.changed {
+		return
+	}
+
+	data, err := json.MarshalIndent(h.entries, "", "  ")
+	if err != nil {
+		return
+	}
+	if err := util.WriteFileAtomic(h.path, data, 0600); err != nil {
+		log.Printf("保存通知记录失败: %v", err)
+	}
+}
@@ -0,0 +1,87 @@
+package notify
+
+import (
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestHistorySuppressed(t *testing.T) {
+	window := 24 * time.Hour
+	failed := Event{Kind: KindDeployFailed, OrderID: 42, Domain: "www.example.com"}
+
+	tests := []struct {
+		name    string
+		channel string
+		event   Event
+		sentAgo time.Duration // 0 表示没有发送记录
+		want    bool
+	}{
+		{name: "没有记录", event: failed},
+		{name: "去重时间内", event: failed, sentAgo: time.Hour, want: true},
+		{name: "超过去重时间", event: failed, sentAgo: 25 * time.Hour},
+		{name: "其他渠道不受影响", channel: "mail", event: failed, sentAgo: time.Hour},
+		{name: "其他事件类型不受影响", event: Event{Kind: KindExpired, OrderID: 42, Domain: "www.example.com"}, sentAgo: time.Hour},
+		{name: "域名不区分大小写", event: Event{Kind: KindDeployFailed, OrderID: 42, Domain: "WWW.example.com"}, sentAgo: time.Hour, want: true},
+		{name: "部署成功不去重", event: Event{Kind: KindDeploySuccess, OrderID: 42, Domain: "www.example.com"}, sentAgo: time.Hour},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			h := &history{entries: make(map[string]string)}
+			if tt.sentAgo > 0 {
+				for _, kind := range []string{KindDeployFailed, KindDeploySuccess} {
+					e := Event{Kind: kind, OrderID: 42, Domain: "www.example.com"}
+					h.entries[historyKey("ops", e)] = time.Now().Add(-tt.sentAgo).Format(time.RFC3339)
+				}
+			}
+			channel := tt.channel
+			if channel == "" {
+				channel = "ops"
+			}
+			if got := h.suppressed(channel, tt.event, window); got != tt.want {
+				t.Errorf("suppressed = %v，期望 %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestHistoryRecordResolveSave(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "notify_history.json")
+	h := &history{path: path, entries: map[string]string{
+		"ops|expired|1|stale.example.com": time.Now().Add(-historyRetention - time.Hour).Format(time.RFC3339),
+	}}
+
+	failed := Event{Kind: KindDeployFailed, OrderID: 42, Domain: "www.example.com"}
+	h.record("ops", failed)
+	h.record("mail", failed)
+	h.record("ops", Event{Kind: KindExpiring, OrderID: 7, Domain: "api.example.com"})
+	h.record("ops", Event{Kind: KindDeploySuccess, OrderID: 7, Domain: "api.example.com"}) // 成功不记录
+	if !h.suppressed("ops", failed, time.Hour) {
+		t.Fatal("记录后应在去重时间内")
+	}
+
+	// 部署成功清除该证书在所有渠道的告警记录
+	h.resolve(Event{Kind: KindDeploySuccess, OrderID: 42, Domain: "www.example.com"})
+	if h.suppressed("ops", failed, time.Hour) || h.suppressed("mail", failed, time.Hour) {
+		t.Error("部署成功后仍被去重")
+	}
+
+	h.save()
+	data, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var saved map[string]string
+	if err := json.Unmarshal(data, &saved); err != nil {
+		t.Fatal(err)
+	}
+	// 过期记录被清理，只剩 api.example.com 的告警
+	if len(saved) != 1 {
+		t.Errorf("保存的记录 = %v，期望只有 1 条", saved)
+	}
+	if _, ok := saved["ops|expiring|7|api.example.com"]; !ok {
+		t.Errorf("缺少 api.example.com 的记录: %v", saved)
+	}
+}
@@ -0,0 +1,201 @@
+// Package notify 发送部署结果和证书过期提醒（邮件、Webhook、钉钉、企业微信、飞书、Slack）
+package notify
+
+import (
+	"fmt"
+	"log"
+	"os"
+	"sort"
+	"time"
+
+	"cert-deploy/config"
+)
+
+// 事件类型
+const (
+	KindDeploySuccess = "deploy_success" // 部署成功
+	KindDeployFailed  = "deploy_failed"  // 部署失败
+	KindExpiring      = "expiring"       // 证书即将过期
+	KindExpired       = "expired"        // 证书已过期
+)
+
+var kindLabels = map[string]string{
+	KindDeploySuccess: "成功",
+	KindDeployFailed:  "失败",
+	KindExpiring:      "即将过期",
+	KindExpired:       "已过期",
+}
+
+// Event 一条通知事件
+type Event struct {
+	Kind       string    `json:"kind"`
+	Severity   string    `json:"severity"`
+	OrderID    int       `json:"order_id,omitempty"`
+	Domain     string    `json:"domain"`
+	Message    string    `json:"message"`
+	Thumbprint string    `json:"thumbprint,omitempty"`
+	ExpiresAt  string    `json:"expires_at,omitempty"`
+	DaysLeft   int       `json:"days_left,omitempty"`
+	Time       time.Time `json:"time"`
+}
+
+// Label 事件类型显示名称
+func (e Event) Label() string {
+	if label, ok := kindLabels[e.Kind]; ok {
+		return label
+	}
+	return e.Kind
+}
+
+// Message 一次发送的内容（模板数据），同一渠道一次运行的事件合并为一条消息
+type Message struct {
+	Host     string  `json:"host"`
+	Time     string  `json:"time"`
+	Severity string  `json:"severity"` // 事件中的最高级别
+	Events   []Event `json:"events"`
+}
+
+// Count 指定类型的事件数
+func (m *Message) Count(kind string) int {
+	n := 0
+	for _, e := range m.Events {
+		if e.Kind == kind {
+			n++
+		}
+	}
+	return n
+}
+
+// Summary 事件统计，如“失败 1 个，即将过期 2 个”
+func (m *Message) Summary() string {
+	summary := ""
+	for _, kind := range []string{KindDeployFailed, KindExpired, KindExpiring, KindDeploySuccess} {
+		if n := m.Count(kind); n > 0 {
+			if summary != "" {
+				summary += "，"
+			}
+			summary += fmt.Sprintf("%s %d 个", kindLabels[kind], n)
+		}
+	}
+	return summary
+}
+
+// Send 按各渠道的级别过滤和去重发送事件
+// 部署成功的事件清除该证书的告警记录，下次失败立即通知
+func Send(cfg *config.NotifyConfig, events []Event) {
+	if cfg == nil || len(cfg.Channels) == 0 || len(events) == 0 {
+		return
+	}
+
+	h := loadHistory()
+	for _, e := range events {
+		if e.Kind == KindDeploySuccess {
+			h.resolve(e)
+		}
+	}
+
+	window := time.Duration(cfg.DedupWindow()) * time.Hour
+	for _, ch := range cfg.Channels {
+		if !ch.Enabled {
+			continue
+		}
+		if err := ch.Validate(); err != nil {
+			log.Printf("%v", err)
+			continue
+		}
+
+		pending := make([]Event, 0)
+		for _, e := range events {
+			if !passSeverity(ch, e.Severity) {
+				continue
+			}
+			if h.suppressed(ch.Name, e, window) {
+				log.Printf("通知渠道 %s: %s %s 在 %v 内已通知，跳过", ch.Name, e.Domain, e.Label(), window)
+				continue
+			}
+			pending = append(pending, e)
+		}
+		if len(pending) == 0 {
+			continue
+		}
+
+		if err := deliver(ch, newMessage(pending)); err != nil {
+			log.Printf("通知渠道 %s 发送失败: %v", ch.Name, err)
+			continue
+		}
+		log.Printf("通知渠道 %s: 已发送 %d 条事件", ch.Name, len(pending))
+		for _, e := range pending {
+			h.record(ch.Name, e)
+		}
+	}
+
+	h.save()
+}
+
+// SendTest 向渠道发送一条测试消息（不受级别过滤和去重限制）
+func SendTest(ch config.NotifyChannel) error {
+	if err := ch.Validate(); err != nil {
+		return err
+	}
+	return deliver(ch, newMessage([]Event{{
+		Kind:     KindDeploySuccess,
+		Severity: config.SeverityInfo,
+		Domain:   "example.com",
+		Message:  "这是一条测试消息",
+		Time:     time.Now(),
+	}}))
+}
+
+// deliver 渲染模板并通过渠道发送
+func deliver(ch config.NotifyChannel, msg *Message) error {
+	title, body, err := render(ch, msg)
+	if err != nil {
+		return err
+	}
+	// Webhook 地址和加签密钥加密保存，发送前解密到副本
+	if ch.Type != config.NotifySMTP {
+		if ch.URL, err = ch.GetURL(); err != nil {
+			return err
+		}
+		if ch.Secret, err = ch.GetSecret(); err != nil {
+			return err
+		}
+	}
+	switch ch.Type {
+	case config.NotifySMTP:
+		return sendMail(ch.SMTP, title, body)
+	case config.NotifyWebhook:
+		return sendWebhook(ch, title, body, msg)
+	case config.NotifyDingTalk:
+		return sendDingTalk(ch, title, body)
+	case config.NotifyWeCom:
+		return sendWeCom(ch, title, body)
+	case config.NotifyFeishu:
+		return sendFeishu(ch, title, body)
+	case config.NotifySlack:
+		return sendSlack(ch, title, body)
+	}
+	return fmt.Errorf("不支持的通知类型: %s", ch.Type)
+}
+
+func passSeverity(ch config.NotifyChannel, severity string) bool {
+	minimum := ch.MinSeverity
+	if minimum == "" {
+		minimum = config.SeverityWarning
+	}
+	return config.SeverityLevel(severity) >= config.SeverityLevel(minimum)
+}
+
+func newMessage(events []Event) *Message {
+	host, _ := os.Hostname()
+	sorted := append([]Event(nil), events...)
+	sort.SliceStable(sorted, func(i, j int) bool {
+		return config.SeverityLevel(sorted[i].Severity) > config.SeverityLevel(sorted[j].Severity)
+	})
+	return &Message{
+		Host:     host,
+		Time:     time.Now().Format("2006-01-02 15:04:05"),
+		Severity: sorted[0].Severity,
+		Events:   sorted,
+	}
+}
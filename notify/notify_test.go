@@ -0,0 +1,115 @@
+package notify
+
+import (
+	"strings"
+	"testing"
+	"time"
+
+	"cert-deploy/config"
+)
+
+func TestPassSeverity(t *testing.T) {
+	tests := []struct {
+		minimum  string
+		severity string
+		want     bool
+	}{
+		{"", config.SeverityInfo, false}, // 默认 warning
+		{"", config.SeverityWarning, true},
+		{"", config.SeverityError, true},
+		{config.SeverityInfo, config.SeverityInfo, true},
+		{config.SeverityError, config.SeverityWarning, false},
+		{config.SeverityError, config.SeverityError, true},
+		{config.SeverityWarning, "unknown", true}, // 未知级别按 warning
+		{config.SeverityError, "unknown", false},
+	}
+	for _, tt := range tests {
+		ch := config.NotifyChannel{MinSeverity: tt.minimum}
+		if got := passSeverity(ch, tt.severity); got != tt.want {
+			t.Errorf("passSeverity(min=%q, %q) = %v，期望 %v", tt.minimum, tt.severity, got, tt.want)
+		}
+	}
+}
+
+func TestRender(t *testing.T) {
+	msg := &Message{
+		Host:     "web01",
+		Time:     "2026-01-01 08:00:00",
+		Severity: config.SeverityError,
+		Events: []Event{
+			{Kind: KindDeployFailed, Severity: config.SeverityError, OrderID: 42, Domain: "www.example.com", Message: "绑定失败"},
+			{Kind: KindExpiring, Severity: config.SeverityWarning, Domain: "api.example.com", Message: "还有 5 天过期", ExpiresAt: "2026-01-06"},
+			{Kind: KindExpiring, Severity: config.SeverityWarning, Domain: "old.example.com", Message: "还有 3 天过期"},
+		},
+	}
+
+	tests := []struct {
+		name      string
+		ch        config.NotifyChannel
+		wantTitle string
+		wantBody  []string
+		wantErr   bool
+	}{
+		{
+			name:      "默认模板",
+			wantTitle: "[证书部署] web01 失败 1 个，即将过期 2 个",
+			wantBody:  []string{"主机: web01", "[失败] www.example.com（订单 42）", "  绑定失败", "过期时间: 2026-01-06"},
+		},
+		{
+			name:      "自定义模板",
+			ch:        config.NotifyChannel{Title: "{{.Severity}}\n{{.Count \"expiring\"}}", Template: "{{range .Events}}{{.Domain}};{{end}}"},
+			wantTitle: "error 2", // 标题中的换行合并为空格
+			wantBody:  []string{"www.example.com;api.example.com;old.example.com;"},
+		},
+		{
+			name:    "模板语法错误",
+			ch:      config.NotifyChannel{Template: "{{.Host"},
+			wantErr: true,
+		},
+		{
+			name:    "模板引用不存在的字段",
+			ch:      config.NotifyChannel{Template: "{{.Missing}}"},
+			wantErr: true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			title, body, err := render(tt.ch, msg)
+			if tt.wantErr {
+				if err == nil {
+					t.Fatal("期望返回错误")
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if title != tt.wantTitle {
+				t.Errorf("标题 = %q，期望 %q", title, tt.wantTitle)
+			}
+			for _, want := range tt.wantBody {
+				if !strings.Contains(body, want) {
+					t.Errorf("正文缺少 %q:\n%s", want, body)
+				}
+			}
+		})
+	}
+}
+
+func TestNewMessageOrdersBySeverity(t *testing.T) {
+	msg := newMessage([]Event{
+		{Kind: KindDeploySuccess, Severity: config.SeverityInfo, Domain: "a.example.com", Time: time.Now()},
+		{Kind: KindExpired, Severity: config.SeverityError, Domain: "b.example.com", Time: time.Now()},
+		{Kind: KindExpiring, Severity: config.SeverityWarning, Domain: "c.example.com", Time: time.Now()},
+	})
+	if msg.Severity != config.SeverityError {
+		t.Errorf("Severity = %q，期望 error", msg.Severity)
+	}
+	var domains []string
+	for _, e := range msg.Events {
+		domains = append(domains, e.Domain)
+	}
+	if got := strings.Join(domains, ","); got != "b.example.com,c.example.com,a.example.com" {
+		t.Errorf("事件顺序 = %s", got)
+	}
+}
@@ -0,0 +1,59 @@
+package notify
+
+import (
+	"bytes"
+	"fmt"
+	"strings"
+	"text/template"
+
+	"cert-deploy/config"
+)
+
+// 默认模板，渠道可通过 title/template 覆盖，模板数据为 Message
+const (
+	defaultTitle = `[证书部署] {{.Host}} {{.Summary}}`
+
+	defaultBody = `主机: {{.Host}}
+时间: {{.Time}}
+{{range .Events}}
+[{{.Label}}] {{.Domain}}{{if .OrderID}}（订单 {{.OrderID}}）{{end}}
+  {{.Message}}{{if .ExpiresAt}}
+  过期时间: {{.ExpiresAt}}{{end}}
+{{end}}`
+)
+
+// render 渲染标题和正文
+func render(ch config.NotifyChannel, msg *Message) (string, string, error) {
+	titleTpl := ch.Title
+	if titleTpl == "" {
+		titleTpl = defaultTitle
+	}
+	bodyTpl := ch.Template
+	if bodyTpl == "" {
+		bodyTpl = defaultBody
+	}
+
+	title, err := execute("title", titleTpl, msg)
+	if err != nil {
+		return "", "", err
+	}
+	body, err := execute("body", bodyTpl, msg)
+	if err != nil {
+		return "", "", err
+	}
+	// 标题用于邮件主题，不能换行
+	title = strings.Join(strings.Fields(title), " ")
+	return title, strings.TrimSpace(body), nil
+}
+
+func execute(name, text string, msg *Message) (string, error) {
+	tpl, err := template.New(name).Parse(text)
+	if err != nil {
+		return "", fmt.Errorf("解析通知模板失败: %w", err)
+	}
+	var buf bytes.Buffer
+	if err := tpl.Execute(&buf, msg); err != nil {
+		return "", fmt.Errorf("渲染通知模板失败: %w", err)
+	}
+	return buf.String(), nil
+}
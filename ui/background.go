@@ -179,6 +179,18 @@ func (t *BackgroundTask) runLoop() {
 func (t *BackgroundTask) doCheck() {
 	t.updateStatus(TaskStatusRunning, "正在检测证书...")
 
+	// 计划任务正在部署时跳过本次检测，等下个周期
+	lock, err := deploy.AcquireRunLock("gui", 0)
+	if err != nil {
+		if deploy.IsAlreadyRunning(err) {
+			t.updateStatus(TaskStatusIdle, fmt.Sprintf("跳过本次检测: %v", err))
+		} else {
+			t.updateStatus(TaskStatusFailed, fmt.Sprintf("获取部署锁失败: %v", err))
+		}
+		return
+	}
+	defer lock.Release()
+
 	cfg, err := config.Load()
 	if err != nil {
 		t.updateStatus(TaskStatusFailed, fmt.Sprintf("加载配置失败: %v", err))
@@ -192,17 +204,25 @@ func (t *BackgroundTask) doCheck() {
 
 	t.updateStatus(TaskStatusRunning, fmt.Sprintf("正在检查 %d 个证书...", len(cfg.Certificates)))
 
+	// 状态栏显示当前证书的部署步骤
+	deploy.SetProgressHook(func(p deploy.Progress) {
+		t.updateStatus(TaskStatusRunning, fmt.Sprintf("正在部署 %s: %s", p.Domain, p.Step.Name()))
+	})
 	results := deploy.AutoDeploy(cfg)
+	deploy.SetProgressHook(nil)
 
 	t.mu.Lock()
 	t.lastRun = time.Now()
 	t.results = results
 	t.mu.Unlock()
 
-	// 统计结果
+	// 统计结果（未变化的绑定不计入部署成功）
 	successCount := 0
 	failCount := 0
 	for _, r := range results {
+		if r.Unchanged {
+			continue
+		}
 		if r.Success {
 			successCount++
 		} else {
@@ -210,7 +230,7 @@ func (t *BackgroundTask) doCheck() {
 		}
 	}
 
-	if len(results) == 0 {
+	if successCount == 0 && failCount == 0 {
 		t.updateStatus(TaskStatusSuccess, fmt.Sprintf("检测完成，无需更新 (上次: %s)", t.lastRun.Format("15:04:05")))
 	} else if failCount == 0 {
 		t.updateStatus(TaskStatusSuccess, fmt.Sprintf("部署成功 %d 个 (上次: %s)", successCount, t.lastRun.Format("15:04:05")))
@@ -241,18 +261,30 @@ func (t *BackgroundTask) updateStatus(status TaskStatus, message string) {
 func CheckCertExpiry(cfg *config.Config) []CertExpiryInfo {
 	results := make([]CertExpiryInfo, 0)
 
-	token := cfg.GetToken()
-	if token == "" {
-		return results
-	}
-
-	client := api.NewClient(cfg.APIBaseURL, token)
+	// 每个 API 配置创建一次客户端，未配置 Token 的跳过
+	clients := make(map[string]*api.Client)
+	checked := make(map[string]bool)
 
 	for _, certCfg := range cfg.Certificates {
 		if !certCfg.Enabled {
 			continue
 		}
 
+		name := config.ProfileName(certCfg.Profile)
+		if !checked[name] {
+			checked[name] = true
+			baseURL, token, err := cfg.API(name)
+			if err != nil {
+				results = append(results, CertExpiryInfo{Error: err.Error()})
+			} else if token != "" {
+				clients[name] = api.NewClient(baseURL, token)
+			}
+		}
+		client := clients[name]
+		if client == nil {
+			continue
+		}
+
 		certData, err := client.GetCertByOrderID(certCfg.OrderID)
 		if err != nil {
 			results = append(results, CertExpiryInfo{
@@ -262,8 +294,15 @@ func CheckCertExpiry(cfg *config.Config) []CertExpiryInfo {
 			continue
 		}
 
-		expiresAt, _ := time.Parse("2006-01-02", certData.ExpiresAt)
-		daysLeft := int(time.Until(expiresAt).Hours() / 24)
+		_, expiresAt, err := cert.Validity(certData.Certificate, certData.ExpiresAt)
+		if err != nil {
+			results = append(results, CertExpiryInfo{
+				Domain: certCfg.Domain,
+				Error:  err.Error(),
+			})
+			continue
+		}
+		daysLeft := cert.DaysUntil(expiresAt, time.Now())
 
 		results = append(results, CertExpiryInfo{
 			Domain:    certCfg.Domain,
@@ -307,7 +346,7 @@ func CheckLocalCerts() []LocalCertInfo {
 			continue
 		}
 
-		daysLeft := int(time.Until(c.NotAfter).Hours() / 24)
+		daysLeft := cert.DaysUntil(c.NotAfter, time.Now())
 		info := LocalCertInfo{
 			Thumbprint: c.Thumbprint,
 			Subject:    c.Subject,
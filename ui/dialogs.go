@@ -1,8 +1,8 @@
 package ui
 
 import (
+	"context"
 	"fmt"
-	"os"
 	"strings"
 	"syscall"
 	"unsafe"
@@ -10,7 +10,9 @@ import (
 	"cert-deploy/api"
 	"cert-deploy/cert"
 	"cert-deploy/config"
+	"cert-deploy/deploy"
 	"cert-deploy/iis"
+	"cert-deploy/util"
 
 	"github.com/rodrigocfd/windigo/co"
 	"github.com/rodrigocfd/windigo/ui"
@@ -19,6 +21,8 @@ import (
 
 // ShowBindDialog 显示证书绑定对话框
 func ShowBindDialog(owner ui.Parent, site *iis.SiteInfo, certs []cert.CertInfo, onSuccess func()) {
+	invalidateSnapshots()
+
 	// 过滤出有私钥的证书
 	allValidCerts := make([]cert.CertInfo, 0)
 	for _, c := range certs {
@@ -203,13 +207,8 @@ func ShowBindDialog(owner ui.Parent, site *iis.SiteInfo, certs []cert.CertInfo,
 			return
 		}
 
-		// 实时查询当前绑定
-		binding, err := iis.GetBindingForHost(domain, port)
-		if err != nil {
-			txtCurrentBinding.SetText(fmt.Sprintf("查询失败: %v", err))
-			return
-		}
-
+		// 实时查询当前绑定（只查询这一条）
+		binding := iis.QueryBindingForHost(domain, port)
 		if binding == nil {
 			txtCurrentBinding.SetText("(未绑定)")
 			return
@@ -291,7 +290,7 @@ func ShowBindDialog(owner ui.Parent, site *iis.SiteInfo, certs []cert.CertInfo,
 			// 检查站点是否有对应的 https 绑定，如果没有则创建
 			hasBinding := false
 			for _, b := range site.Bindings {
-				if b.Protocol == "https" && b.Host == domain && b.Port == port {
+				if b.Protocol == "https" && util.EqualDomain(b.Host, domain) && b.Port == port {
 					hasBinding = true
 					break
 				}
@@ -311,7 +310,7 @@ func ShowBindDialog(owner ui.Parent, site *iis.SiteInfo, certs []cert.CertInfo,
 			}
 
 			// 绑定证书
-			err := iis.BindCertificate(domain, port, selectedCert.Thumbprint)
+			err := iis.BindCertificate(context.Background(), domain, port, selectedCert.Thumbprint)
 
 			dlg.UiThread(func() {
 				btnBind.Hwnd().EnableWindow(true)
@@ -389,7 +388,7 @@ func getDomainsFromSite(site *iis.SiteInfo) []string {
 	// 先添加所有绑定的域名
 	for _, b := range site.Bindings {
 		if b.Host != "" && !seen[b.Host] {
-			domains = append(domains, b.Host)
+			domains = append(domains, util.ToUnicode(b.Host))
 			seen[b.Host] = true
 		}
 	}
@@ -399,6 +398,7 @@ func getDomainsFromSite(site *iis.SiteInfo) []string {
 
 // ShowInstallDialog 显示导入证书对话框
 func ShowInstallDialog(owner ui.Parent, onSuccess func()) {
+	invalidateSnapshots()
 	logDebug("ShowInstallDialog: creating modal")
 	dlg := ui.NewModal(owner,
 		ui.OptsModal().
@@ -532,13 +532,16 @@ func ShowInstallDialog(owner ui.Parent, onSuccess func()) {
 
 // ShowAPIDialog 显示从部署接口获取证书对话框
 func ShowAPIDialog(owner ui.Parent, onSuccess func()) {
+	invalidateSnapshots()
+
 	// 加载配置获取默认值
 	cfg, _ := config.Load()
 	defaultURL := ""
 	defaultToken := ""
+	var tokenErr error
 	if cfg != nil {
 		defaultURL = cfg.APIBaseURL
-		defaultToken = cfg.GetToken()
+		defaultToken, tokenErr = cfg.GetToken()
 	}
 
 	logDebug("ShowAPIDialog: creating modal")
@@ -706,18 +709,17 @@ func ShowAPIDialog(owner ui.Parent, onSuccess func()) {
 	)
 
 	// 保存配置的函数
-	saveConfig := func() {
+	saveConfig := func() error {
 		apiURL := strings.TrimSpace(txtAPIURL.Text())
 		token := strings.TrimSpace(txtToken.Text())
-		if apiURL != "" || token != "" {
-			cfg, _ := config.Load()
-			if cfg == nil {
-				cfg = config.DefaultConfig()
-			}
-			cfg.APIBaseURL = apiURL
-			cfg.SetToken(token)
-			cfg.Save()
+		if apiURL == "" && token == "" {
+			return nil
 		}
+		_, err := config.Update(func(latest *config.Config) error {
+			latest.APIBaseURL = apiURL
+			return latest.SetToken(token)
+		})
+		return err
 	}
 
 	// 获取选中的证书索引列表
@@ -762,6 +764,10 @@ func ShowAPIDialog(owner ui.Parent, onSuccess func()) {
 		lblValidation.Hwnd().EnableWindow(false)
 		cmbValidation.Hwnd().EnableWindow(false)
 		cmbValidation.Items.Select(0) // 默认选择"自动"
+
+		if tokenErr != nil {
+			txtDetail.SetText(fmt.Sprintf("读取已保存的 Token 失败: %v\r\n\r\n请重新输入 Token，获取证书时重新加密保存。", tokenErr))
+		}
 		return 0
 	})
 
@@ -823,8 +829,10 @@ func ShowAPIDialog(owner ui.Parent, onSuccess func()) {
 			return
 		}
 
-		// 保存配置
-		saveConfig()
+		// 保存配置（失败时仍可用输入的 Token 查询）
+		if err := saveConfig(); err != nil {
+			ui.MsgError(dlg, "错误", "保存配置失败", fmt.Sprintf("接口地址和 Token 未保存: %v", err))
+		}
 
 		client := api.NewClient(apiURL, token)
 
@@ -856,7 +864,7 @@ func ShowAPIDialog(owner ui.Parent, onSuccess func()) {
 				// 更新证书列表
 				certDataList = certList
 				for _, c := range certList {
-					lstCerts.Items.Add(c.Domain, c.ExpiresAt, fmt.Sprintf("%d", c.OrderID))
+					lstCerts.Items.Add(util.ToUnicode(c.Domain), c.ExpiresAt, fmt.Sprintf("%d", c.OrderID))
 				}
 
 				// 启用按钮
@@ -920,6 +928,13 @@ func ShowAPIDialog(owner ui.Parent, onSuccess func()) {
 			}
 		}
 
+		// 与后台检测、计划任务互斥，避免同时安装证书和写配置
+		runLock, err := deploy.AcquireRunLock("gui", 0)
+		if err != nil {
+			ui.MsgOk(dlg, "提示", "部署任务正在运行", fmt.Sprintf("%v\n\n请稍后再试。", err))
+			return
+		}
+
 		txtDetail.SetText(fmt.Sprintf("正在检查 %d 个证书...", len(certsToInstall)))
 		btnInstall.Hwnd().EnableWindow(false)
 		btnFetch.Hwnd().EnableWindow(false)
@@ -928,9 +943,15 @@ func ShowAPIDialog(owner ui.Parent, onSuccess func()) {
 
 		// 在 goroutine 外先获取复选框状态
 		autoUpdateEnabled := chkAutoUpdate.IsChecked()
-		validationMethodCopy := validationMethod
+		importOpts := deploy.ImportOptions{
+			AutoUpdate:       autoUpdateEnabled,
+			UseLocalKey:      localKeyEnabled,
+			ValidationMethod: validationMethod,
+		}
 
 		go func() {
+			defer runLock.Release()
+
 			var results []string
 			successCount := 0
 			skipCount := 0
@@ -939,200 +960,22 @@ func ShowAPIDialog(owner ui.Parent, onSuccess func()) {
 
 			for i, certToInstall := range certsToInstall {
 				dlg.UiThread(func() {
-					txtDetail.SetText(fmt.Sprintf("正在处理 (%d/%d): %s", i+1, len(certsToInstall), certToInstall.Domain))
+					txtDetail.SetText(fmt.Sprintf("正在处理 (%d/%d): %s", i+1, len(certsToInstall), util.ToUnicode(certToInstall.Domain)))
 				})
 
-				// 检查证书是否已存在（按序列号）
-				var existingThumbprint string
-				serialNumber, err := cert.GetCertSerialNumber(certToInstall.Certificate)
-				if err == nil {
-					exists, existingCert, _ := cert.IsCertExists(serialNumber)
-					if exists && existingCert != nil {
-						results = append(results, fmt.Sprintf("- %s: 已存在 (指纹: %s...)", certToInstall.Domain, existingCert.Thumbprint[:16]))
-						skipCount++
-						existingThumbprint = existingCert.Thumbprint
-
-						// 即使证书已存在，也检查并保存自动部署配置
-						if autoUpdateEnabled {
-							cfg, _ := config.Load()
-							if cfg == nil {
-								cfg = config.DefaultConfig()
-							}
-							existing := cfg.GetCertificateByOrderID(certToInstall.OrderID)
-							if existing == nil {
-								certConfig := config.CertConfig{
-									OrderID:          certToInstall.OrderID,
-									Domain:           certToInstall.Domain,
-									Domains:          certToInstall.GetDomainList(),
-									ExpiresAt:        certToInstall.ExpiresAt,
-									SerialNumber:     serialNumber,
-									Enabled:          true,
-									UseLocalKey:      localKeyEnabled,
-									ValidationMethod: validationMethodCopy,
-									AutoBindMode:     true,
-									BindRules:        []config.BindRule{},
-								}
-								cfg.AddCertificate(certConfig)
-								cfg.Save()
-								results = append(results, fmt.Sprintf("  → 已添加自动更新配置"))
-							}
-						}
-
-						// 证书已存在，但仍需检查并添加缺失的 HTTPS 绑定
-						allDomains := certToInstall.GetDomainList()
-						if len(allDomains) == 0 && certToInstall.Domain != "" {
-							allDomains = []string{certToInstall.Domain}
-						}
-
-						results = append(results, fmt.Sprintf("  [检查绑定] 证书域名: %v", allDomains))
-
-						_, httpMatches, _ := iis.FindMatchingBindings(allDomains)
-						if len(httpMatches) > 0 {
-							results = append(results, fmt.Sprintf("  [检查绑定] 发现 %d 个 HTTP 绑定需要添加 HTTPS", len(httpMatches)))
-							for _, match := range httpMatches {
-								if err := iis.AddHttpsBinding(match.SiteName, match.Host, match.Port); err != nil {
-									results = append(results, fmt.Sprintf("  ! 添加HTTPS绑定失败 %s: %v", match.Host, err))
-									continue
-								}
-								if err := iis.BindCertificate(match.Host, match.Port, existingThumbprint); err == nil {
-									results = append(results, fmt.Sprintf("  → 已添加绑定: %s:%d (站点: %s)", match.Host, match.Port, match.SiteName))
-								} else {
-									results = append(results, fmt.Sprintf("  ! 绑定证书失败 %s: %v", match.Host, err))
-								}
-							}
-						}
-						continue
-					}
-				}
-
-				// 将 PEM 转换为 PFX
-				pfxPath, err := cert.PEMToPFX(
-					certToInstall.Certificate,
-					certToInstall.PrivateKey,
-					certToInstall.CACert,
-					"",
-				)
-
-				if err != nil {
-					results = append(results, fmt.Sprintf("✗ %s: 转换失败 - %v", certToInstall.Domain, err))
-					failCount++
-					continue
-				}
-
-				// 安装 PFX
-				result, err := cert.InstallPFX(pfxPath, "")
-				os.Remove(pfxPath)
-
-				if err != nil {
-					results = append(results, fmt.Sprintf("✗ %s: 安装失败 - %v", certToInstall.Domain, err))
-					failCount++
-					continue
-				}
-
-				if !result.Success {
-					results = append(results, fmt.Sprintf("✗ %s: %s", certToInstall.Domain, result.ErrorMessage))
+				r := deploy.ImportCert(certToInstall, importOpts)
+				results = append(results, r.Lines...)
+				switch r.Status {
+				case deploy.ImportInstalled:
+					successCount++
+				case deploy.ImportSkipped:
+					skipCount++
+				default:
 					failCount++
-					continue
 				}
-
-				results = append(results, fmt.Sprintf("✓ %s: %s", certToInstall.Domain, result.Thumbprint))
-				successCount++
-
-				// 尝试默认绑定
-				allDomains := certToInstall.GetDomainList()
-				if len(allDomains) == 0 && certToInstall.Domain != "" {
-					allDomains = []string{certToInstall.Domain}
-				}
-
-				// 调试: 显示证书域名列表
-				results = append(results, fmt.Sprintf("  [调试] 证书域名: %v", allDomains))
-
-				httpsMatches, httpMatches, findErr := iis.FindMatchingBindings(allDomains)
-				if findErr != nil {
-					results = append(results, fmt.Sprintf("  ! 查找绑定失败: %v", findErr))
-				}
-
-				// 调试: 显示匹配结果
-				results = append(results, fmt.Sprintf("  [调试] 匹配: HTTPS=%d, HTTP=%d", len(httpsMatches), len(httpMatches)))
-				for _, m := range httpMatches {
-					results = append(results, fmt.Sprintf("  [调试] HTTP匹配: %s (站点: %s)", m.Host, m.SiteName))
-				}
-
-				boundCount := 0
-
-				// 1. 更新已有的 HTTPS 绑定
-				for _, match := range httpsMatches {
-					var bindErr error
-					// 判断是否 IP 绑定
-					isIP := true
-					for _, c := range match.Host {
-						if c != '.' && (c < '0' || c > '9') {
-							isIP = false
-							break
-						}
-					}
-					if isIP {
-						bindErr = iis.BindCertificateByIP(match.Host, match.Port, result.Thumbprint)
-					} else {
-						bindErr = iis.BindCertificate(match.Host, match.Port, result.Thumbprint)
-					}
-					if bindErr == nil {
-						boundCount++
-						results = append(results, fmt.Sprintf("  → 已更新绑定: %s:%d", match.Host, match.Port))
-					} else {
-						results = append(results, fmt.Sprintf("  ! 更新绑定失败 %s:%d: %v", match.Host, match.Port, bindErr))
-					}
-				}
-
-				// 2. 为 HTTP 绑定添加 HTTPS 绑定
-				for _, match := range httpMatches {
-					// 先添加 HTTPS 绑定
-					if err := iis.AddHttpsBinding(match.SiteName, match.Host, match.Port); err != nil {
-						results = append(results, fmt.Sprintf("  ! 添加HTTPS绑定失败 %s: %v", match.Host, err))
-						continue
-					}
-					// 再绑定证书
-					if err := iis.BindCertificate(match.Host, match.Port, result.Thumbprint); err == nil {
-						boundCount++
-						results = append(results, fmt.Sprintf("  → 已添加绑定: %s:%d (站点: %s)", match.Host, match.Port, match.SiteName))
-					} else {
-						results = append(results, fmt.Sprintf("  ! 绑定证书失败 %s: %v", match.Host, err))
-					}
-				}
-
-				// 如果没有任何绑定，记录需要手动绑定
-				if boundCount == 0 && len(httpsMatches) == 0 && len(httpMatches) == 0 {
-					results = append(results, fmt.Sprintf("  ! 未找到匹配的 IIS 绑定，请手动绑定"))
+				if r.ManualBind {
 					manualBindCount++
 				}
-
-				// 如果勾选了"自动更新"，保存证书配置
-				if autoUpdateEnabled {
-					cfg, _ := config.Load()
-					if cfg == nil {
-						cfg = config.DefaultConfig()
-					}
-
-					// 检查是否已存在（按 OrderID）
-					existing := cfg.GetCertificateByOrderID(certToInstall.OrderID)
-					if existing == nil {
-						// 创建证书配置
-						certConfig := config.CertConfig{
-							OrderID:          certToInstall.OrderID,
-							Domain:           certToInstall.Domain,
-							Domains:          certToInstall.GetDomainList(),
-							ExpiresAt:        certToInstall.ExpiresAt,
-							SerialNumber:     serialNumber,
-							Enabled:          true,
-							UseLocalKey:      localKeyEnabled,
-							ValidationMethod: validationMethodCopy,
-							AutoBindMode:     true,
-							BindRules:        []config.BindRule{},
-						}
-						cfg.AddCertificate(certConfig)
-						cfg.Save()
-					}
-				}
 			}
 
 			dlg.UiThread(func() {
@@ -1242,8 +1085,25 @@ func showOpenFileDialog(hwnd win.HWND, title string, filter string) string {
 	return ""
 }
 
+// findCertIndex 在最新配置中查找证书：先按订单 ID，再按主域名（本地私钥模式续签后订单 ID 会变化），找不到时返回 -1
+func findCertIndex(cfg *config.Config, orderID int, domain string) int {
+	for i, c := range cfg.Certificates {
+		if c.OrderID == orderID {
+			return i
+		}
+	}
+	for i, c := range cfg.Certificates {
+		if util.EqualDomain(c.Domain, domain) {
+			return i
+		}
+	}
+	return -1
+}
+
 // ShowCertManagerDialog 显示证书管理对话框（简化版）
 func ShowCertManagerDialog(owner ui.Parent, onSuccess func()) {
+	invalidateSnapshots()
+
 	cfg, _ := config.Load()
 	if cfg == nil {
 		cfg = config.DefaultConfig()
@@ -1258,6 +1118,20 @@ func ShowCertManagerDialog(owner ui.Parent, onSuccess func()) {
 
 	selectedIdx := -1
 
+	// 对话框中的修改，保存时在最新配置上重放，不覆盖期间自动部署写入的订单 ID 等字段
+	var edits []func(latest *config.Config)
+
+	// editCert 修改选中的证书：立即更新显示，并记录到 edits
+	editCert := func(fn func(c *config.CertConfig)) {
+		orderID, domain := cfg.Certificates[selectedIdx].OrderID, cfg.Certificates[selectedIdx].Domain
+		fn(&cfg.Certificates[selectedIdx])
+		edits = append(edits, func(latest *config.Config) {
+			if i := findCertIndex(latest, orderID, domain); i >= 0 {
+				fn(&latest.Certificates[i])
+			}
+		})
+	}
+
 	// 提示文字
 	ui.NewStatic(dlg,
 		ui.OptsStatic().
@@ -1279,7 +1153,8 @@ func ShowCertManagerDialog(owner ui.Parent, onSuccess func()) {
 	btnRemove := ui.NewButton(dlg, ui.OptsButton().Text("删除").Position(ui.Dpi(95, 270)).Width(ui.DpiX(50)).Height(ui.DpiY(28)))
 	btnToggleLocalKey := ui.NewButton(dlg, ui.OptsButton().Text("本地私钥").Position(ui.Dpi(150, 270)).Width(ui.DpiX(70)).Height(ui.DpiY(28)))
 	btnToggleValidation := ui.NewButton(dlg, ui.OptsButton().Text("验证方法").Position(ui.Dpi(225, 270)).Width(ui.DpiX(70)).Height(ui.DpiY(28)))
-	btnRefresh := ui.NewButton(dlg, ui.OptsButton().Text("刷新").Position(ui.Dpi(300, 270)).Width(ui.DpiX(50)).Height(ui.DpiY(28)))
+	btnToggleAutoHTTPS := ui.NewButton(dlg, ui.OptsButton().Text("自动HTTPS").Position(ui.Dpi(300, 270)).Width(ui.DpiX(70)).Height(ui.DpiY(28)))
+	btnRefresh := ui.NewButton(dlg, ui.OptsButton().Text("刷新").Position(ui.Dpi(375, 270)).Width(ui.DpiX(50)).Height(ui.DpiY(28)))
 
 	// 配置区
 	ui.NewStatic(dlg, ui.OptsStatic().Text("续签:").Position(ui.Dpi(20, 315)))
@@ -1321,7 +1196,14 @@ func ShowCertManagerDialog(owner ui.Parent, onSuccess func()) {
 				localKey = "是"
 				validation = getValidationDisplay(c.ValidationMethod)
 			}
-			lstCerts.Items.Add(c.Domain, c.ExpiresAt, status, localKey, validation)
+			autoHTTPS := "-"
+			if c.AutoBindMode {
+				autoHTTPS = "否"
+				if c.AutoAddHTTPS {
+					autoHTTPS = "是"
+				}
+			}
+			lstCerts.Items.Add(util.ToUnicode(c.Domain), c.ExpiresAt, status, localKey, validation, autoHTTPS)
 		}
 	}
 
@@ -1332,6 +1214,7 @@ func ShowCertManagerDialog(owner ui.Parent, onSuccess func()) {
 		lstCerts.Cols.Add("状态", ui.DpiX(45))
 		lstCerts.Cols.Add("本地私钥", ui.DpiX(60))
 		lstCerts.Cols.Add("验证方法", ui.DpiX(60))
+		lstCerts.Cols.Add("自动HTTPS", ui.DpiX(65))
 
 		chkIIS7Mode.SetCheck(cfg.IIS7Mode)
 		refreshList()
@@ -1340,6 +1223,7 @@ func ShowCertManagerDialog(owner ui.Parent, onSuccess func()) {
 		btnRemove.Hwnd().EnableWindow(false)
 		btnToggleLocalKey.Hwnd().EnableWindow(false)
 		btnToggleValidation.Hwnd().EnableWindow(false)
+		btnToggleAutoHTTPS.Hwnd().EnableWindow(false)
 		return 0
 	})
 
@@ -1351,11 +1235,14 @@ func ShowCertManagerDialog(owner ui.Parent, onSuccess func()) {
 			btnToggleLocalKey.Hwnd().EnableWindow(true)
 			// 只有启用本地私钥时才能切换验证方法
 			btnToggleValidation.Hwnd().EnableWindow(cfg.Certificates[selectedIdx].UseLocalKey)
+			// 只有自动绑定模式才能自动添加 HTTPS 绑定
+			btnToggleAutoHTTPS.Hwnd().EnableWindow(cfg.Certificates[selectedIdx].AutoBindMode)
 		} else {
 			btnToggle.Hwnd().EnableWindow(false)
 			btnRemove.Hwnd().EnableWindow(false)
 			btnToggleLocalKey.Hwnd().EnableWindow(false)
 			btnToggleValidation.Hwnd().EnableWindow(false)
+			btnToggleAutoHTTPS.Hwnd().EnableWindow(false)
 		}
 	}
 
@@ -1373,7 +1260,8 @@ func ShowCertManagerDialog(owner ui.Parent, onSuccess func()) {
 	// 启用/停用
 	btnToggle.On().BnClicked(func() {
 		if selectedIdx >= 0 && selectedIdx < len(cfg.Certificates) {
-			cfg.Certificates[selectedIdx].Enabled = !cfg.Certificates[selectedIdx].Enabled
+			enabled := !cfg.Certificates[selectedIdx].Enabled
+			editCert(func(c *config.CertConfig) { c.Enabled = enabled })
 			refreshList()
 			if selectedIdx < lstCerts.Items.Count() {
 				lstCerts.Items.Get(selectedIdx).Select(true)
@@ -1384,7 +1272,13 @@ func ShowCertManagerDialog(owner ui.Parent, onSuccess func()) {
 	// 删除
 	btnRemove.On().BnClicked(func() {
 		if selectedIdx >= 0 && selectedIdx < len(cfg.Certificates) {
+			orderID, domain := cfg.Certificates[selectedIdx].OrderID, cfg.Certificates[selectedIdx].Domain
 			cfg.RemoveCertificateByIndex(selectedIdx)
+			edits = append(edits, func(latest *config.Config) {
+				if i := findCertIndex(latest, orderID, domain); i >= 0 {
+					latest.RemoveCertificateByIndex(i)
+				}
+			})
 			selectedIdx = -1
 			refreshList()
 			updateButtonStates()
@@ -1394,11 +1288,14 @@ func ShowCertManagerDialog(owner ui.Parent, onSuccess func()) {
 	// 切换本地私钥
 	btnToggleLocalKey.On().BnClicked(func() {
 		if selectedIdx >= 0 && selectedIdx < len(cfg.Certificates) {
-			cfg.Certificates[selectedIdx].UseLocalKey = !cfg.Certificates[selectedIdx].UseLocalKey
-			// 关闭本地私钥时，清除验证方法
-			if !cfg.Certificates[selectedIdx].UseLocalKey {
-				cfg.Certificates[selectedIdx].ValidationMethod = ""
-			}
+			useLocalKey := !cfg.Certificates[selectedIdx].UseLocalKey
+			editCert(func(c *config.CertConfig) {
+				c.UseLocalKey = useLocalKey
+				// 关闭本地私钥时，清除验证方法
+				if !useLocalKey {
+					c.ValidationMethod = ""
+				}
+			})
 			refreshList()
 			if selectedIdx < lstCerts.Items.Count() {
 				lstCerts.Items.Get(selectedIdx).Select(true)
@@ -1442,7 +1339,22 @@ func ShowCertManagerDialog(owner ui.Parent, onSuccess func()) {
 				}
 			}
 
-			cert.ValidationMethod = nextMethod
+			editCert(func(c *config.CertConfig) { c.ValidationMethod = nextMethod })
+			refreshList()
+			if selectedIdx < lstCerts.Items.Count() {
+				lstCerts.Items.Get(selectedIdx).Select(true)
+			}
+		}
+	})
+
+	// 切换自动添加 HTTPS 绑定
+	btnToggleAutoHTTPS.On().BnClicked(func() {
+		if selectedIdx >= 0 && selectedIdx < len(cfg.Certificates) {
+			if !cfg.Certificates[selectedIdx].AutoBindMode {
+				return
+			}
+			autoAddHTTPS := !cfg.Certificates[selectedIdx].AutoAddHTTPS
+			editCert(func(c *config.CertConfig) { c.AutoAddHTTPS = autoAddHTTPS })
 			refreshList()
 			if selectedIdx < lstCerts.Items.Count() {
 				lstCerts.Items.Get(selectedIdx).Select(true)
@@ -1461,6 +1373,7 @@ func ShowCertManagerDialog(owner ui.Parent, onSuccess func()) {
 			newCfg = config.DefaultConfig()
 		}
 		cfg = newCfg
+		edits = nil
 		txtRenewLocal.SetText(fmt.Sprintf("%d", cfg.RenewDaysLocal))
 		txtRenewFetch.SetText(fmt.Sprintf("%d", cfg.RenewDaysFetch))
 		chkIIS7Mode.SetCheck(cfg.IIS7Mode)
@@ -1481,14 +1394,22 @@ func ShowCertManagerDialog(owner ui.Parent, onSuccess func()) {
 		if renewFetch < 1 {
 			renewFetch = 1
 		}
-		cfg.RenewDaysLocal = renewLocal
-		cfg.RenewDaysFetch = renewFetch
-		cfg.IIS7Mode = chkIIS7Mode.IsChecked()
+		iis7Mode := chkIIS7Mode.IsChecked()
 
-		if err := cfg.Save(); err != nil {
+		saved, err := config.Update(func(latest *config.Config) error {
+			for _, edit := range edits {
+				edit(latest)
+			}
+			latest.RenewDaysLocal = renewLocal
+			latest.RenewDaysFetch = renewFetch
+			latest.IIS7Mode = iis7Mode
+			return nil
+		})
+		if err != nil {
 			ui.MsgError(dlg, "错误", "保存失败", err.Error())
 			return
 		}
+		cfg, edits = saved, nil
 		ui.MsgOk(dlg, "成功", "配置已保存", "")
 		dlg.Hwnd().SendMessage(co.WM_CLOSE, 0, 0)
 		if onSuccess != nil {
@@ -391,9 +391,11 @@ func (app *AppWindow) toggleAutoCheck() {
 					return
 				}
 
-				if cfg != nil {
-					cfg.AutoCheckEnabled = false
-					cfg.Save()
+				if _, err := config.Update(func(latest *config.Config) error {
+					latest.AutoCheckEnabled = false
+					return nil
+				}); err != nil {
+					app.appendTaskLog(fmt.Sprintf("保存配置失败: %v", err))
 				}
 
 				app.btnAutoCheck.SetText("启动自动部署")
@@ -427,8 +429,12 @@ func (app *AppWindow) toggleAutoCheck() {
 					return
 				}
 
-				cfg.AutoCheckEnabled = true
-				cfg.Save()
+				if _, err := config.Update(func(latest *config.Config) error {
+					latest.AutoCheckEnabled = true
+					return nil
+				}); err != nil {
+					app.appendTaskLog(fmt.Sprintf("保存配置失败: %v", err))
+				}
 
 				app.btnAutoCheck.SetText("停止自动部署")
 				app.statusIndicator.SetState(IndicatorRunning)
@@ -497,10 +503,12 @@ func (app *AppWindow) updateTaskStatus() {
 		app.appendTaskLog(message)
 		results := app.bgTask.GetResults()
 		for _, r := range results {
-			if r.Success {
-				app.appendTaskLog(fmt.Sprintf("  ✓ %s: %s", r.Domain, r.Message))
+			if r.Unchanged {
+				app.appendTaskLog(fmt.Sprintf("  = %s: %s", r.Label(), r.Message))
+			} else if r.Success {
+				app.appendTaskLog(fmt.Sprintf("  ✓ %s: %s", r.Label(), r.Message))
 			} else {
-				app.appendTaskLog(fmt.Sprintf("  ✗ %s: %s", r.Domain, r.Message))
+				app.appendTaskLog(fmt.Sprintf("  ✗ %s: %s", r.Label(), r.Message))
 			}
 		}
 	}
@@ -528,6 +536,13 @@ func (app *AppWindow) appendTaskLog(text string) {
 	app.txtTaskLog.Hwnd().SendMessage(0x00B6, 0, 0xFFFF) // EM_LINESCROLL
 }
 
+// invalidateSnapshots 丢弃证书、SSL 绑定和站点快照，之后的查询重新加载
+// 刷新列表和打开对话框时调用，避免按其他程序修改前的快照判断
+func invalidateSnapshots() {
+	cert.InvalidateInventory()
+	iis.InvalidateInventory()
+}
+
 // doLoadDataAsync 异步加载数据
 func (app *AppWindow) doLoadDataAsync(onComplete func()) {
 	app.loadingMu.Lock()
@@ -539,6 +554,9 @@ func (app *AppWindow) doLoadDataAsync(onComplete func()) {
 	app.loadingMu.Unlock()
 
 	go func() {
+		// IIS 管理器或其他程序可能已修改绑定和证书，丢弃快照
+		invalidateSnapshots()
+
 		var loadErr error
 		var sites []iis.SiteInfo
 		var certs []cert.CertInfo
@@ -624,7 +642,7 @@ func formatBindings(bindings []iis.BindingInfo) string {
 	parts := make([]string, 0, len(bindings))
 	for _, b := range bindings {
 		if b.Host != "" {
-			parts = append(parts, fmt.Sprintf("%s://%s:%d", b.Protocol, b.Host, b.Port))
+			parts = append(parts, fmt.Sprintf("%s://%s:%d", b.Protocol, util.ToUnicode(b.Host), b.Port))
 		} else {
 			parts = append(parts, fmt.Sprintf("%s://*:%d", b.Protocol, b.Port))
 		}
@@ -640,7 +658,7 @@ func getCertInfoForSite(site iis.SiteInfo, sslBindings []iis.SSLBinding, certs [
 		}
 
 		for _, ssl := range sslBindings {
-			hostPort := fmt.Sprintf("%s:%d", b.Host, b.Port)
+			hostPort := fmt.Sprintf("%s:%d", util.ToASCII(b.Host), b.Port)
 			if strings.EqualFold(ssl.HostnamePort, hostPort) ||
 				strings.HasSuffix(ssl.HostnamePort, fmt.Sprintf(":%d", b.Port)) {
 				thumbprint := strings.ToUpper(strings.ReplaceAll(ssl.CertHash, " ", ""))
@@ -2,8 +2,12 @@ package util
 
 import (
 	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"os"
 	"os/exec"
-	"syscall"
+	"time"
 	"unicode/utf8"
 
 	"golang.org/x/text/encoding/simplifiedchinese"
@@ -17,11 +21,7 @@ func RunPowerShell(script string) (string, error) {
 
 	cmd := exec.Command("powershell", "-NoProfile", "-NonInteractive", "-WindowStyle", "Hidden", "-Command", fullScript)
 
-	// 隐藏窗口
-	cmd.SysProcAttr = &syscall.SysProcAttr{
-		HideWindow:    true,
-		CreationFlags: 0x08000000, // CREATE_NO_WINDOW
-	}
+	hideWindow(cmd)
 
 	output, err := cmd.Output()
 	if err != nil {
@@ -37,10 +37,7 @@ func RunPowerShellCombined(script string) (string, error) {
 
 	cmd := exec.Command("powershell", "-NoProfile", "-NonInteractive", "-WindowStyle", "Hidden", "-Command", fullScript)
 
-	cmd.SysProcAttr = &syscall.SysProcAttr{
-		HideWindow:    true,
-		CreationFlags: 0x08000000,
-	}
+	hideWindow(cmd)
 
 	output, err := cmd.CombinedOutput()
 	if err != nil {
@@ -54,10 +51,7 @@ func RunPowerShellCombined(script string) (string, error) {
 func RunCmd(name string, args ...string) (string, error) {
 	cmd := exec.Command(name, args...)
 
-	cmd.SysProcAttr = &syscall.SysProcAttr{
-		HideWindow:    true,
-		CreationFlags: 0x08000000,
-	}
+	hideWindow(cmd)
 
 	output, err := cmd.Output()
 	if err != nil {
@@ -77,10 +71,7 @@ func RunCmd(name string, args ...string) (string, error) {
 func RunCmdCombined(name string, args ...string) (string, error) {
 	cmd := exec.Command(name, args...)
 
-	cmd.SysProcAttr = &syscall.SysProcAttr{
-		HideWindow:    true,
-		CreationFlags: 0x08000000,
-	}
+	hideWindow(cmd)
 
 	output, err := cmd.CombinedOutput()
 
@@ -93,6 +84,34 @@ func RunCmdCombined(name string, args ...string) (string, error) {
 	return string(utf8Output), err
 }
 
+// RunCmdWithTimeout 执行命令并限制运行时间，返回 stdout + stderr
+// env 为追加到当前环境的变量（KEY=VALUE），超时或 parent 取消后结束进程
+func RunCmdWithTimeout(parent context.Context, timeout time.Duration, env []string, name string, args ...string) (string, error) {
+	ctx, cancel := context.WithTimeout(parent, timeout)
+	defer cancel()
+
+	cmd := exec.CommandContext(ctx, name, args...)
+	hideWindow(cmd)
+	if len(env) > 0 {
+		cmd.Env = append(os.Environ(), env...)
+	}
+	// 进程被结束后，子进程可能仍占用输出管道，不再等待
+	cmd.WaitDelay = 5 * time.Second
+
+	output, err := cmd.CombinedOutput()
+	if parent.Err() != nil {
+		err = fmt.Errorf("执行中止: %w", parent.Err())
+	} else if errors.Is(ctx.Err(), context.DeadlineExceeded) {
+		err = fmt.Errorf("执行超时（%v）", timeout)
+	}
+
+	utf8Output, convErr := GBKToUTF8(output)
+	if convErr != nil {
+		return string(output), err
+	}
+	return string(utf8Output), err
+}
+
 // GBKToUTF8 将 GBK 编码转换为 UTF-8
 // 如果已经是有效的 UTF-8 且包含中文，则不转换
 func GBKToUTF8(data []byte) ([]byte, error) {
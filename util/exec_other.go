@@ -0,0 +1,8 @@
+//go:build !windows
+
+package util
+
+import "os/exec"
+
+// hideWindow 非 Windows 平台没有控制台窗口（仅用于在其他平台编译和运行测试）
+func hideWindow(cmd *exec.Cmd) {}
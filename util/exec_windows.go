@@ -0,0 +1,14 @@
+package util
+
+import (
+	"os/exec"
+	"syscall"
+)
+
+// hideWindow 子进程不显示控制台窗口（CREATE_NO_WINDOW）
+func hideWindow(cmd *exec.Cmd) {
+	cmd.SysProcAttr = &syscall.SysProcAttr{
+		HideWindow:    true,
+		CreationFlags: 0x08000000,
+	}
+}
@@ -0,0 +1,47 @@
+package util
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+)
+
+// WriteFileAtomic 先写入同目录的临时文件并刷盘，再替换目标文件
+// 中途崩溃或断电时目标文件保持原内容，不会留下写了一半的文件
+// 临时文件名唯一，多个进程同时写同一文件时互不覆盖临时文件
+// 目标文件已存在时，替换前把它的所有者和 DACL 复制到临时文件（Windows），替换后权限不变
+func WriteFileAtomic(path string, data []byte, perm os.FileMode) error {
+	f, err := os.CreateTemp(filepath.Dir(path), filepath.Base(path)+".tmp-*")
+	if err != nil {
+		return fmt.Errorf("创建临时文件失败: %w", err)
+	}
+	tmpPath := f.Name()
+	fail := func(format string, err error) error {
+		f.Close()
+		os.Remove(tmpPath)
+		return fmt.Errorf(format, err)
+	}
+
+	if err := f.Chmod(perm); err != nil {
+		return fail("设置临时文件权限失败: %w", err)
+	}
+	if _, err := f.Write(data); err != nil {
+		return fail("写入临时文件失败: %w", err)
+	}
+	if err := f.Sync(); err != nil {
+		return fail("刷新临时文件失败: %w", err)
+	}
+	if err := f.Close(); err != nil {
+		os.Remove(tmpPath)
+		return fmt.Errorf("关闭临时文件失败: %w", err)
+	}
+	if err := copyFileSecurity(path, tmpPath); err != nil {
+		os.Remove(tmpPath)
+		return err
+	}
+	if err := os.Rename(tmpPath, path); err != nil {
+		os.Remove(tmpPath)
+		return fmt.Errorf("替换文件失败: %w", err)
+	}
+	return nil
+}
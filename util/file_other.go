@@ -0,0 +1,8 @@
+//go:build !windows
+
+package util
+
+// copyFileSecurity 非 Windows 平台的权限由 WriteFileAtomic 的 perm 参数决定（仅用于在其他平台编译和运行测试）
+func copyFileSecurity(src, dst string) error {
+	return nil
+}
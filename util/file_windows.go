@@ -0,0 +1,134 @@
+package util
+
+import (
+	"fmt"
+	"syscall"
+	"unsafe"
+)
+
+var (
+	dllAdvapi32 = syscall.NewLazyDLL("advapi32.dll")
+	dllKernel32 = syscall.NewLazyDLL("kernel32.dll")
+
+	procGetNamedSecurityInfo         = dllAdvapi32.NewProc("GetNamedSecurityInfoW")
+	procSetNamedSecurityInfo         = dllAdvapi32.NewProc("SetNamedSecurityInfoW")
+	procGetSecurityDescriptorControl = dllAdvapi32.NewProc("GetSecurityDescriptorControl")
+	procLookupPrivilegeValue         = dllAdvapi32.NewProc("LookupPrivilegeValueW")
+	procAdjustTokenPrivileges        = dllAdvapi32.NewProc("AdjustTokenPrivileges")
+	procLocalFree                    = dllKernel32.NewProc("LocalFree")
+)
+
+const (
+	seFileObject = 1 // SE_OBJECT_TYPE: SE_FILE_OBJECT
+
+	ownerSecurityInformation           = 0x00000001
+	groupSecurityInformation           = 0x00000002
+	daclSecurityInformation            = 0x00000004
+	protectedDaclSecurityInformation   = 0x80000000
+	unprotectedDaclSecurityInformation = 0x20000000
+
+	seDaclProtected = 0x1000 // SECURITY_DESCRIPTOR_CONTROL: SE_DACL_PROTECTED
+
+	errorFileNotFound   = 2
+	errorInvalidOwner   = 1307
+	errorNotAllAssigned = 1300
+
+	sePrivilegeEnabled = 0x2
+)
+
+// copyFileSecurity 把 src 的所有者、主要组和 DACL 复制到 dst（替换文件前调用）
+// 临时文件继承的是目录的默认权限，直接替换会丢失原文件单独设置的权限（如 applicationHost.config）
+// 所有者不是当前账户时需要 SeRestorePrivilege（管理员默认拥有，未启用），设置失败时启用后重试
+// src 不存在时不做处理
+func copyFileSecurity(src, dst string) error {
+	srcPtr, err := syscall.UTF16PtrFromString(src)
+	if err != nil {
+		return err
+	}
+	dstPtr, err := syscall.UTF16PtrFromString(dst)
+	if err != nil {
+		return err
+	}
+
+	var owner, group, dacl, sd uintptr
+	r, _, _ := procGetNamedSecurityInfo.Call(
+		uintptr(unsafe.Pointer(srcPtr)),
+		seFileObject,
+		ownerSecurityInformation|groupSecurityInformation|daclSecurityInformation,
+		uintptr(unsafe.Pointer(&owner)),
+		uintptr(unsafe.Pointer(&group)),
+		uintptr(unsafe.Pointer(&dacl)),
+		0,
+		uintptr(unsafe.Pointer(&sd)),
+	)
+	if r == errorFileNotFound {
+		return nil
+	}
+	if r != 0 {
+		return fmt.Errorf("读取原文件权限失败: %w", syscall.Errno(r))
+	}
+	defer procLocalFree.Call(sd)
+
+	// 保持原文件 DACL 是否继承目录权限的设置
+	var control uint16
+	var revision uint32
+	info := uintptr(ownerSecurityInformation | groupSecurityInformation | daclSecurityInformation | unprotectedDaclSecurityInformation)
+	if r, _, _ := procGetSecurityDescriptorControl.Call(sd, uintptr(unsafe.Pointer(&control)), uintptr(unsafe.Pointer(&revision))); r != 0 && control&seDaclProtected != 0 {
+		info = ownerSecurityInformation | groupSecurityInformation | daclSecurityInformation | protectedDaclSecurityInformation
+	}
+
+	set := func() uintptr {
+		r, _, _ := procSetNamedSecurityInfo.Call(uintptr(unsafe.Pointer(dstPtr)), seFileObject, info, owner, group, dacl, 0)
+		return r
+	}
+	r = set()
+	if r == errorInvalidOwner {
+		if err := enableRestorePrivilege(); err != nil {
+			return fmt.Errorf("设置文件所有者失败: %w", err)
+		}
+		r = set()
+	}
+	if r != 0 {
+		return fmt.Errorf("设置文件权限失败: %w", syscall.Errno(r))
+	}
+	return nil
+}
+
+// enableRestorePrivilege 为当前进程启用 SeRestorePrivilege（允许把文件所有者设为其他账户）
+func enableRestorePrivilege() error {
+	process, err := syscall.GetCurrentProcess()
+	if err != nil {
+		return err
+	}
+	var token syscall.Token
+	if err := syscall.OpenProcessToken(process, syscall.TOKEN_ADJUST_PRIVILEGES|syscall.TOKEN_QUERY, &token); err != nil {
+		return err
+	}
+	defer token.Close()
+
+	name, err := syscall.UTF16PtrFromString("SeRestorePrivilege")
+	if err != nil {
+		return err
+	}
+	// TOKEN_PRIVILEGES，LUID 由两个 32 位整数组成，按 4 字节对齐
+	var privileges struct {
+		count      uint32
+		luid       [2]uint32
+		attributes uint32
+	}
+	if r, _, err := procLookupPrivilegeValue.Call(0, uintptr(unsafe.Pointer(name)), uintptr(unsafe.Pointer(&privileges.luid))); r == 0 {
+		return err
+	}
+	privileges.count = 1
+	privileges.attributes = sePrivilegeEnabled
+
+	r, _, err := procAdjustTokenPrivileges.Call(uintptr(token), 0, uintptr(unsafe.Pointer(&privileges)), 0, 0, 0)
+	if r == 0 {
+		return err
+	}
+	// 调用成功但账户没有该权限时 GetLastError 为 ERROR_NOT_ALL_ASSIGNED
+	if errno, ok := err.(syscall.Errno); ok && errno == errorNotAllAssigned {
+		return fmt.Errorf("当前账户没有 SeRestorePrivilege 权限")
+	}
+	return nil
+}
@@ -0,0 +1,61 @@
+package util
+
+import (
+	"net"
+	"strings"
+
+	"golang.org/x/net/idna"
+)
+
+// ===== 国际化域名 =====
+
+// ToASCII 域名转换为 A-label（punycode）小写形式，用于比较和 netsh/appcmd 调用
+// 保留通配符前缀 *.；IP 地址和无法转换的输入只做小写处理
+func ToASCII(domain string) string {
+	domain = strings.ToLower(strings.TrimSpace(domain))
+	if domain == "" || net.ParseIP(domain) != nil {
+		return domain
+	}
+
+	prefix := ""
+	if strings.HasPrefix(domain, "*.") {
+		prefix, domain = "*.", domain[2:]
+	}
+	ascii, err := idna.Lookup.ToASCII(domain)
+	if err != nil {
+		return prefix + domain
+	}
+	return prefix + ascii
+}
+
+// ToUnicode 域名转换为 U-label 形式，用于界面和日志显示
+// 无法转换时原样返回
+func ToUnicode(domain string) string {
+	if !strings.Contains(strings.ToLower(domain), "xn--") {
+		return domain
+	}
+
+	prefix := ""
+	if strings.HasPrefix(domain, "*.") {
+		prefix, domain = "*.", domain[2:]
+	}
+	unicode, err := idna.Display.ToUnicode(domain)
+	if err != nil {
+		return prefix + domain
+	}
+	return prefix + unicode
+}
+
+// DisplayHostPort "host:port" 中的主机名转换为 U-label 显示
+func DisplayHostPort(hostPort string) string {
+	idx := strings.LastIndex(hostPort, ":")
+	if idx <= 0 {
+		return ToUnicode(hostPort)
+	}
+	return ToUnicode(hostPort[:idx]) + hostPort[idx:]
+}
+
+// EqualDomain 两个域名是否相同（不区分大小写，U-label 与 A-label 视为相同）
+func EqualDomain(a, b string) bool {
+	return ToASCII(a) == ToASCII(b)
+}
@@ -0,0 +1,135 @@
+package util
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"time"
+)
+
+// 等待锁时的轮询间隔
+const lockPollInterval = 2 * time.Second
+
+// LockInfo 锁文件内容
+type LockInfo struct {
+	PID       int       `json:"pid"`
+	Owner     string    `json:"owner"` // 持有者说明，如 "gui" / "auto"
+	StartedAt time.Time `json:"started_at"`
+}
+
+// LockedError 锁已被其他进程持有
+type LockedError struct {
+	Info LockInfo
+}
+
+func (e *LockedError) Error() string {
+	return fmt.Sprintf("已有部署任务正在运行（%s，PID %d，开始于 %s）",
+		e.Info.Owner, e.Info.PID, e.Info.StartedAt.Local().Format("2006-01-02 15:04:05"))
+}
+
+// FileLock 基于锁文件的跨进程互斥锁
+type FileLock struct {
+	path string
+	info LockInfo
+}
+
+// TryLock 尝试获取锁，已被持有时返回 *LockedError
+// 持有进程已退出时自动清理
+func TryLock(path, owner string) (*FileLock, error) {
+	info := LockInfo{PID: os.Getpid(), Owner: owner, StartedAt: time.Now()}
+	data, err := json.Marshal(info)
+	if err != nil {
+		return nil, err
+	}
+
+	for attempt := 0; attempt < 3; attempt++ {
+		// O_EXCL 保证只有一个进程能创建成功
+		f, err := os.OpenFile(path, os.O_CREATE|os.O_EXCL|os.O_WRONLY, 0600)
+		if err == nil {
+			_, writeErr := f.Write(data)
+			closeErr := f.Close()
+			if writeErr != nil || closeErr != nil {
+				os.Remove(path)
+				return nil, fmt.Errorf("写入锁文件失败: %v", errors.Join(writeErr, closeErr))
+			}
+			return &FileLock{path: path, info: info}, nil
+		}
+		if !os.IsExist(err) {
+			return nil, fmt.Errorf("创建锁文件失败: %w", err)
+		}
+
+		holder, readErr := readLockInfo(path)
+		if readErr == nil && !isStaleLock(holder) {
+			return nil, &LockedError{Info: holder}
+		}
+		if readErr != nil {
+			// 锁文件刚创建还未写入内容时读取为空，按修改时间判断
+			if stat, statErr := os.Stat(path); statErr == nil && time.Since(stat.ModTime()) < time.Minute {
+				return nil, &LockedError{Info: LockInfo{Owner: "unknown", StartedAt: stat.ModTime()}}
+			}
+		}
+
+		// 清理前再确认一次，避免误删其他进程刚创建的新锁
+		if current, err := readLockInfo(path); err == nil && readErr == nil &&
+			(current.PID != holder.PID || !current.StartedAt.Equal(holder.StartedAt)) {
+			continue
+		}
+		if err := os.Remove(path); err != nil && !os.IsNotExist(err) {
+			return nil, fmt.Errorf("清理失效锁文件失败: %w", err)
+		}
+	}
+	return nil, fmt.Errorf("获取锁失败: %s", path)
+}
+
+// WaitLock 获取锁，被持有时最多等待 timeout
+func WaitLock(path, owner string, timeout time.Duration) (*FileLock, error) {
+	deadline := time.Now().Add(timeout)
+	for {
+		lock, err := TryLock(path, owner)
+		var locked *LockedError
+		if err == nil || !errors.As(err, &locked) || time.Now().After(deadline) {
+			return lock, err
+		}
+		time.Sleep(lockPollInterval)
+	}
+}
+
+// Release 释放锁（只删除自己创建的锁文件）
+func (l *FileLock) Release() error {
+	if l == nil {
+		return nil
+	}
+	holder, err := readLockInfo(l.path)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil
+		}
+		return err
+	}
+	if holder.PID != l.info.PID || !holder.StartedAt.Equal(l.info.StartedAt) {
+		return fmt.Errorf("锁已被其他进程接管")
+	}
+	return os.Remove(l.path)
+}
+
+func readLockInfo(path string) (LockInfo, error) {
+	var info LockInfo
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return info, err
+	}
+	if err := json.Unmarshal(data, &info); err != nil {
+		return info, fmt.Errorf("锁文件格式错误: %w", err)
+	}
+	return info, nil
+}
+
+// isStaleLock 判断锁是否失效：进程已退出或 PID 已被复用
+// 只依据进程状态判断，长时间运行的部署不会被误判为失效
+func isStaleLock(info LockInfo) bool {
+	if info.PID == os.Getpid() {
+		return false
+	}
+	return !isProcessRunning(info.PID, info.StartedAt)
+}
@@ -0,0 +1,18 @@
+//go:build !windows
+
+package util
+
+import (
+	"os"
+	"syscall"
+	"time"
+)
+
+// isProcessRunning 检查进程是否仍在运行（仅用于在其他平台编译和运行测试，不检查 PID 复用）
+func isProcessRunning(pid int, lockedAt time.Time) bool {
+	p, err := os.FindProcess(pid)
+	if err != nil {
+		return false
+	}
+	return p.Signal(syscall.Signal(0)) == nil
+}
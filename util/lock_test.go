@@ -0,0 +1,47 @@
+package util
+
+import (
+	"encoding/json"
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestTryLockKeepsLongRunningHolder(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "deploy.lock")
+	// 持有进程仍在运行，加锁时间再早也不能视为失效
+	data, _ := json.Marshal(LockInfo{PID: os.Getpid(), Owner: "auto", StartedAt: time.Now().Add(-24 * time.Hour)})
+	if err := os.WriteFile(path, data, 0600); err != nil {
+		t.Fatal(err)
+	}
+
+	_, err := TryLock(path, "gui")
+	var locked *LockedError
+	if !errors.As(err, &locked) {
+		t.Fatalf("期望 LockedError，实际 %v", err)
+	}
+	if locked.Info.Owner != "auto" {
+		t.Errorf("持有者 = %q，期望 auto", locked.Info.Owner)
+	}
+}
+
+func TestTryLockRelease(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "deploy.lock")
+	lock, err := TryLock(path, "gui")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := TryLock(path, "auto"); err == nil {
+		t.Fatal("锁被持有时应获取失败")
+	}
+	if err := lock.Release(); err != nil {
+		t.Fatal(err)
+	}
+	lock, err = TryLock(path, "auto")
+	if err != nil {
+		t.Fatalf("释放后应能重新获取: %v", err)
+	}
+	lock.Release()
+}
@@ -0,0 +1,34 @@
+package util
+
+import (
+	"errors"
+	"syscall"
+	"time"
+)
+
+// isProcessRunning 检查进程是否仍在运行，且启动时间早于加锁时间（排除 PID 复用）
+func isProcessRunning(pid int, lockedAt time.Time) bool {
+	const processQueryLimitedInformation = 0x1000
+	const stillActive = 259
+
+	h, err := syscall.OpenProcess(processQueryLimitedInformation, false, uint32(pid))
+	if err != nil {
+		// 无权限打开时保守处理，视为仍在运行
+		return errors.Is(err, syscall.ERROR_ACCESS_DENIED)
+	}
+	defer syscall.CloseHandle(h)
+
+	var code uint32
+	if err := syscall.GetExitCodeProcess(h, &code); err != nil || code != stillActive {
+		return false
+	}
+
+	var creation, exit, kernel, user syscall.Filetime
+	if err := syscall.GetProcessTimes(h, &creation, &exit, &kernel, &user); err == nil {
+		created := time.Unix(0, creation.Nanoseconds())
+		if created.After(lockedAt.Add(time.Second)) {
+			return false
+		}
+	}
+	return true
+}
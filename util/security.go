@@ -60,11 +60,12 @@ func NormalizeThumbprint(thumbprint string) (string, error) {
 // hostnameRegex 主机名正则
 var hostnameRegex = regexp.MustCompile(`^[a-zA-Z0-9]([a-zA-Z0-9\-]{0,61}[a-zA-Z0-9])?(\.[a-zA-Z0-9]([a-zA-Z0-9\-]{0,61}[a-zA-Z0-9])?)*$`)
 
-// ValidateHostname 验证主机名格式
+// ValidateHostname 验证主机名格式（国际化域名按 A-label 验证）
 func ValidateHostname(hostname string) error {
 	if hostname == "" {
 		return fmt.Errorf("主机名不能为空")
 	}
+	hostname = ToASCII(hostname)
 	if len(hostname) > 253 {
 		return fmt.Errorf("主机名长度不能超过253个字符")
 	}
@@ -77,11 +78,12 @@ func ValidateHostname(hostname string) error {
 // domainRegex 域名正则（支持通配符）
 var domainRegex = regexp.MustCompile(`^(\*\.)?[a-zA-Z0-9]([a-zA-Z0-9\-]{0,61}[a-zA-Z0-9])?(\.[a-zA-Z0-9]([a-zA-Z0-9\-]{0,61}[a-zA-Z0-9])?)*$`)
 
-// ValidateDomain 验证域名格式（支持通配符如 *.example.com）
+// ValidateDomain 验证域名格式（支持通配符如 *.example.com，国际化域名按 A-label 验证）
 func ValidateDomain(domain string) error {
 	if domain == "" {
 		return fmt.Errorf("域名不能为空")
 	}
+	domain = ToASCII(domain)
 	if len(domain) > 253 {
 		return fmt.Errorf("域名长度不能超过253个字符")
 	}